@@ -116,7 +116,7 @@ export function Crashes() {
             <Pagination
               page={crashesData.page}
               pageSize={crashesData.page_size}
-              totalCount={crashesData.total_count}
+              totalCount={crashesData.total_count ?? 0}
               onPageChange={setPage}
             />
           )}
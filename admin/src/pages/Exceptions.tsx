@@ -91,7 +91,7 @@ export function Exceptions() {
         <Pagination
           page={exceptionsData.page}
           pageSize={exceptionsData.page_size}
-          totalCount={exceptionsData.total_count}
+          totalCount={exceptionsData.total_count ?? 0}
           onPageChange={setPage}
         />
       )}
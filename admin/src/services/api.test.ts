@@ -124,7 +124,9 @@ describe('API Service', () => {
       const params = { start_time: '2024-01-01', page: 1, page_size: 20 }
       const result = await getCrashes(params)
 
-      expect(mockGet).toHaveBeenCalledWith('/crashes', { params })
+      expect(mockGet).toHaveBeenCalledWith('/crashes', {
+        params: { ...params, total: true },
+      })
       expect(result).toEqual(mockData)
     })
   })
@@ -152,7 +154,9 @@ describe('API Service', () => {
       const params = { start_time: '2024-01-01', page: 2, page_size: 50 }
       const result = await getExceptions(params)
 
-      expect(mockGet).toHaveBeenCalledWith('/exceptions', { params })
+      expect(mockGet).toHaveBeenCalledWith('/exceptions', {
+        params: { ...params, total: true },
+      })
       expect(result).toEqual(mockData)
     })
   })
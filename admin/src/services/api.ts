@@ -82,7 +82,9 @@ export async function getScenes(appVersion?: string): Promise<string[]> {
 export async function getCrashes(
   params: FilterParams & PaginationParams
 ): Promise<CrashListResponse> {
-  const { data } = await api.get<CrashListResponse>('/crashes', { params })
+  const { data } = await api.get<CrashListResponse>('/crashes', {
+    params: { ...params, total: true },
+  })
   if (!data) {
     return { crashes: [], total_count: 0, page: 1, page_size: 20 }
   }
@@ -112,7 +114,9 @@ export async function getCrashDetail(
 export async function getExceptions(
   params: FilterParams & PaginationParams
 ): Promise<ExceptionListResponse> {
-  const { data } = await api.get<ExceptionListResponse>('/exceptions', { params })
+  const { data } = await api.get<ExceptionListResponse>('/exceptions', {
+    params: { ...params, total: true },
+  })
   if (!data) {
     return { exceptions: [], total_count: 0, page: 1, page_size: 20 }
   }
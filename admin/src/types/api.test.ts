@@ -67,8 +67,10 @@ describe('API Types', () => {
       sample_message: 'Segmentation fault',
       count: 100,
       session_count: 50,
+      affected_users: 40,
       first_seen: '2024-01-01T00:00:00Z',
       last_seen: '2024-01-15T00:00:00Z',
+      trend_pct: 25,
       affected_versions: ['1.0.0', '1.1.0'],
       top_devices: ['Pixel 6', 'Galaxy S21'],
     }
@@ -114,8 +116,10 @@ describe('API Types', () => {
       message: 'NullReferenceException',
       count: 500,
       session_count: 200,
+      affected_users: 150,
       first_seen: '2024-01-01T00:00:00Z',
       last_seen: '2024-01-15T00:00:00Z',
+      trend_pct: -10,
     }
 
     expect(exception.fingerprint).toBe('exc-123')
@@ -63,17 +63,24 @@ export interface CrashGroup {
   sample_message: string
   count: number
   session_count: number
+  affected_users: number
   first_seen: string
   last_seen: string
+  trend_pct: number
   affected_versions: string[]
   top_devices: string[]
 }
 
+export type GroupSort = 'count' | 'sessions' | 'users' | 'first_seen' | 'last_seen' | 'trend'
+
 export interface CrashListResponse {
   crashes: CrashGroup[]
-  total_count: number
+  total_count?: number
   page: number
   page_size: number
+  sort?: GroupSort
+  order?: 'asc' | 'desc'
+  next_cursor?: string
 }
 
 export interface CrashOccurrence {
@@ -121,15 +128,20 @@ export interface ExceptionGroup {
   message: string
   count: number
   session_count: number
+  affected_users: number
   first_seen: string
   last_seen: string
+  trend_pct: number
 }
 
 export interface ExceptionListResponse {
   exceptions: ExceptionGroup[]
-  total_count: number
+  total_count?: number
   page: number
   page_size: number
+  sort?: GroupSort
+  order?: 'asc' | 'desc'
+  next_cursor?: string
 }
 
 // Query params
@@ -235,6 +235,45 @@ namespace OzxApm.Core
 
             _isInitialized = true;
             Log(LogLevel.Info, "APM SDK initialized successfully");
+
+            // Server-side sampling, feature toggles and kill switch
+            StartCoroutine(new RemoteConfigFetcher(config).Fetch(OnRemoteConfig));
+        }
+
+        private void OnRemoteConfig(RemoteConfig remote)
+        {
+            if (!_isInitialized)
+                return;
+
+            RemoteConfigFetcher.Apply(_config, remote);
+
+            if (!_config.Enabled)
+            {
+                Log(LogLevel.Info, "APM SDK disabled by remote configuration");
+                foreach (var collector in _collectors)
+                {
+                    collector.Stop();
+                }
+                _collectors.Clear();
+                return;
+            }
+
+            // Stop collectors turned off remotely
+            StopCollector(ref _performanceCollector, _config.EnablePerformance);
+            StopCollector(ref _jankDetector, _config.EnableJankDetection);
+            StopCollector(ref _startupTracker, _config.EnableStartupTiming);
+            StopCollector(ref _sceneLoadTracker, _config.EnableSceneLoadTracking);
+            StopCollector(ref _exceptionCollector, _config.EnableExceptionCapture);
+        }
+
+        private void StopCollector<T>(ref T collector, bool enabled) where T : class, ICollector
+        {
+            if (enabled || collector == null)
+                return;
+
+            collector.Stop();
+            _collectors.Remove(collector);
+            collector = null;
         }
 
         private void InitializeCollectors()
@@ -367,7 +406,7 @@ namespace OzxApm.Core
         /// </summary>
         internal void EnqueueEvent(BaseEvent evt)
         {
-            if (!_isInitialized || evt == null)
+            if (!_isInitialized || !_config.Enabled || evt == null)
                 return;
 
             // Fill common fields
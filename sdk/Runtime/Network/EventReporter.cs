@@ -26,6 +26,7 @@ namespace OzxApm.Network
         private int _consecutiveFailures;
         private const int MaxConsecutiveFailures = 5;
         private float _backoffMultiplier = 1f;
+        private DateTime _retryAfterUtc = DateTime.MinValue;
 
         public EventReporter(ApmConfig config, OfflineStorage offlineStorage, NetworkLogger networkLogger)
         {
@@ -43,6 +44,14 @@ namespace OzxApm.Network
             if (events == null || events.Count == 0)
                 return;
 
+            // The server asked us to back off; keep events for later
+            if (DateTime.UtcNow < _retryAfterUtc)
+            {
+                _networkLogger?.LogOfflineQueue(events.Count, "Rate limited by server");
+                _offlineStorage?.Store(events);
+                return;
+            }
+
             // Serialize events
             string json = JsonSerializer.SerializeEventBatch(events);
             byte[] data = Encoding.UTF8.GetBytes(json);
@@ -86,6 +95,7 @@ namespace OzxApm.Network
             {
                 headers["X-App-Key"] = _config.AppKey;
             }
+            headers["X-Device-ID"] = DeviceInfo.GetDeviceId();
             if (isCompressed)
             {
                 headers["Content-Encoding"] = "gzip";
@@ -135,6 +145,21 @@ namespace OzxApm.Network
 
         private void OnFailure(UnityWebRequest request, double elapsedMs, List<BaseEvent> events)
         {
+            // Throttling is not a failure: wait as long as the server asks and
+            // keep the events
+            if (request.responseCode == 429)
+            {
+                int retryAfterSeconds;
+                if (!int.TryParse(request.GetResponseHeader("Retry-After"), out retryAfterSeconds) || retryAfterSeconds <= 0)
+                {
+                    retryAfterSeconds = 60;
+                }
+                _retryAfterUtc = DateTime.UtcNow.AddSeconds(retryAfterSeconds);
+                _networkLogger?.LogOfflineQueue(events.Count, $"Rate limited, retrying after {retryAfterSeconds}s");
+                _offlineStorage?.Store(events);
+                return;
+            }
+
             _consecutiveFailures++;
             _backoffMultiplier = Math.Min(_backoffMultiplier * 2, 32f);
 
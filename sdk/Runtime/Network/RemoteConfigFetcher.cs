@@ -0,0 +1,126 @@
+using System;
+using System.Collections;
+using UnityEngine;
+using UnityEngine.Networking;
+using OzxApm.Core;
+using OzxApm.Models;
+using OzxApm.Utils;
+
+namespace OzxApm.Network
+{
+    /// <summary>
+    /// Remote SDK configuration served by GET /v1/config
+    /// </summary>
+    [Serializable]
+    public class RemoteConfig
+    {
+        public bool enabled = true;
+        public float sampling_interval_seconds;
+        public float jank_threshold_ms;
+        public int batch_size;
+        public float flush_interval_seconds;
+        public RemoteFeatures features = new RemoteFeatures();
+    }
+
+    [Serializable]
+    public class RemoteFeatures
+    {
+        public bool performance = true;
+        public bool jank_detection = true;
+        public bool exception_capture = true;
+        public bool startup_timing = true;
+        public bool scene_load_tracking = true;
+    }
+
+    /// <summary>
+    /// Fetches remote configuration from the server
+    /// </summary>
+    public class RemoteConfigFetcher
+    {
+        private readonly ApmConfig _config;
+        private readonly string _configUrl;
+
+        public RemoteConfigFetcher(ApmConfig config)
+        {
+            _config = config;
+            _configUrl = config.ServerUrl.TrimEnd('/') + "/v1/config"
+                + "?app_version=" + UnityWebRequest.EscapeURL(config.AppVersion)
+                + "&platform=" + UnityWebRequest.EscapeURL(DeviceInfo.GetPlatformString());
+        }
+
+        /// <summary>
+        /// Coroutine that fetches the configuration and invokes onLoaded on
+        /// success. Failures keep the local configuration.
+        /// </summary>
+        public IEnumerator Fetch(Action<RemoteConfig> onLoaded)
+        {
+            using (var request = UnityWebRequest.Get(_configUrl))
+            {
+                if (!string.IsNullOrEmpty(_config.AppKey))
+                {
+                    request.SetRequestHeader("X-App-Key", _config.AppKey);
+                }
+                request.timeout = (int)_config.RequestTimeoutSeconds;
+
+                yield return request.SendWebRequest();
+
+                if (request.result != UnityWebRequest.Result.Success)
+                {
+                    ApmClient.Log(LogLevel.Warning, $"Failed to fetch remote config: {request.error}");
+                    yield break;
+                }
+
+                RemoteConfig remote;
+                try
+                {
+                    remote = JsonUtility.FromJson<RemoteConfig>(request.downloadHandler.text);
+                }
+                catch (Exception e)
+                {
+                    ApmClient.Log(LogLevel.Warning, $"Invalid remote config: {e.Message}");
+                    yield break;
+                }
+
+                if (remote != null)
+                {
+                    onLoaded?.Invoke(remote);
+                }
+            }
+        }
+
+        /// <summary>
+        /// Applies remote settings to the config. Only positive values
+        /// override local settings; features can only be turned off.
+        /// </summary>
+        public static void Apply(ApmConfig config, RemoteConfig remote)
+        {
+            if (!remote.enabled)
+            {
+                config.Enabled = false;
+            }
+            if (remote.sampling_interval_seconds > 0)
+            {
+                config.SamplingIntervalSeconds = remote.sampling_interval_seconds;
+            }
+            if (remote.jank_threshold_ms > 0)
+            {
+                config.JankThresholdMs = remote.jank_threshold_ms;
+            }
+            if (remote.batch_size > 0)
+            {
+                config.BatchSize = remote.batch_size;
+            }
+            if (remote.flush_interval_seconds > 0)
+            {
+                config.FlushIntervalSeconds = remote.flush_interval_seconds;
+            }
+
+            var features = remote.features ?? new RemoteFeatures();
+            config.EnablePerformance &= features.performance;
+            config.EnableJankDetection &= features.jank_detection;
+            config.EnableExceptionCapture &= features.exception_capture;
+            config.EnableStartupTiming &= features.startup_timing;
+            config.EnableSceneLoadTracking &= features.scene_load_tracking;
+        }
+    }
+}
@@ -11,9 +11,16 @@ import (
 
 	"go.uber.org/zap"
 
+	"github.com/warriorguo/ozx_apm/server/internal/adminauth"
 	"github.com/warriorguo/ozx_apm/server/internal/api"
 	"github.com/warriorguo/ozx_apm/server/internal/config"
+	"github.com/warriorguo/ozx_apm/server/internal/keystore"
+	"github.com/warriorguo/ozx_apm/server/internal/metrics"
+	"github.com/warriorguo/ozx_apm/server/internal/processor"
+	"github.com/warriorguo/ozx_apm/server/internal/quota"
+	"github.com/warriorguo/ozx_apm/server/internal/remoteconfig"
 	"github.com/warriorguo/ozx_apm/server/internal/storage"
+	"github.com/warriorguo/ozx_apm/server/internal/tracing"
 )
 
 func main() {
@@ -41,12 +48,26 @@ func main() {
 		zap.Bool("admin_server_enabled", cfg.AdminServer.Enabled),
 	)
 
+	// Tracing is installed before anything that creates spans
+	shutdownTracing := func(context.Context) error { return nil }
+	if cfg.Tracing.Enabled {
+		shutdownTracing, err = tracing.Setup(context.Background(), cfg.Tracing)
+		if err != nil {
+			logger.Fatal("failed to set up tracing", zap.Error(err))
+		}
+		logger.Info("tracing enabled", zap.String("exporter", cfg.Tracing.Exporter))
+	}
+
 	// Initialize ClickHouse client
 	chClient, err := storage.NewClickHouseClient(&cfg.ClickHouse, logger)
 	if err != nil {
 		logger.Fatal("failed to connect to ClickHouse", zap.Error(err))
 	}
 	defer chClient.Close()
+	metrics.RegisterClickHousePool(func() (open, idle, max int) {
+		stats := chClient.Stats()
+		return stats.Open, stats.Idle, stats.MaxOpenConns
+	})
 
 	// Run migrations
 	ctx := context.Background()
@@ -58,10 +79,23 @@ func main() {
 	// Initialize repository
 	repo := storage.NewRepository(chClient, logger)
 
+	// SDK keys from config plus those managed through the admin API
+	keys := keystore.New(repo, cfg.Auth.AppKeys, cfg.Auth.KeyCacheTTL, logger)
+
+	// Ingest quotas, shared so the admin server can report on them
+	limits := quota.New(cfg.RateLimit)
+
+	// Remote SDK config, also driving ingest sampling
+	remote := remoteconfig.New(repo, remoteconfig.CacheTTL, logger)
+
+	// Real-time stats of the last minute, exported on /metrics/game
+	stats := processor.NewAggregator()
+	defer stats.Stop()
+
 	// Start SDK ingestion server if enabled
 	var sdkServer *http.Server
 	if cfg.Server.Enabled {
-		sdkRouter := api.NewRouter(cfg, repo, logger)
+		sdkRouter := api.NewRouter(cfg, repo, keys, limits, remote, stats, logger)
 		sdkAddr := fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.Port)
 		sdkServer = &http.Server{
 			Addr:         sdkAddr,
@@ -81,7 +115,17 @@ func main() {
 	// Start Admin server if enabled
 	var adminServer *http.Server
 	if cfg.AdminServer.Enabled {
-		adminRouter := api.NewAdminRouter(cfg, repo, logger)
+		var authn *adminauth.Authenticator
+		if cfg.AdminServer.Auth.Enabled {
+			authn, err = adminauth.New(ctx, cfg.AdminServer.Auth, logger)
+			if err != nil {
+				logger.Fatal("failed to set up admin auth", zap.Error(err))
+			}
+		} else {
+			logger.Warn("admin auth is disabled; the admin API is open to anyone who can reach it")
+		}
+
+		adminRouter := api.NewAdminRouter(cfg, repo, keys, limits, remote, stats, authn, logger)
 		adminAddr := fmt.Sprintf("%s:%d", cfg.AdminServer.Host, cfg.AdminServer.Port)
 		adminServer = &http.Server{
 			Addr:         adminAddr,
@@ -121,5 +165,9 @@ func main() {
 		}
 	}
 
+	if err := shutdownTracing(ctx); err != nil {
+		logger.Error("tracing shutdown error", zap.Error(err))
+	}
+
 	logger.Info("servers stopped")
 }
@@ -0,0 +1,249 @@
+package adminauth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/oauth2"
+
+	"github.com/warriorguo/ozx_apm/server/internal/config"
+)
+
+// AllApps grants a role on every app
+const AllApps = "*"
+
+// Role is an admin user's level of access to an app
+type Role string
+
+const (
+	RoleViewer    Role = "viewer"
+	RoleDeveloper Role = "developer"
+	RoleAdmin     Role = "admin"
+)
+
+// rank orders roles so that a higher role includes every lower one
+func (r Role) rank() int {
+	switch r {
+	case RoleViewer:
+		return 1
+	case RoleDeveloper:
+		return 2
+	case RoleAdmin:
+		return 3
+	}
+	return 0
+}
+
+// Includes reports whether r grants at least the access of other
+func (r Role) Includes(other Role) bool {
+	return r.rank() > 0 && r.rank() >= other.rank()
+}
+
+var (
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	ErrInvalidToken       = errors.New("invalid session")
+	ErrUnknownUser        = errors.New("user has no access")
+)
+
+// Principal is an authenticated admin user
+type Principal struct {
+	Username string          `json:"username"`
+	Roles    map[string]Role `json:"roles"` // app ID (or AllApps) -> role
+}
+
+// Can reports whether the principal has at least role min on an app. An
+// empty appID means data across all apps, which needs the role on AllApps.
+func (p *Principal) Can(appID string, min Role) bool {
+	if p.Roles[AllApps].Includes(min) {
+		return true
+	}
+	return appID != "" && p.Roles[strings.ToLower(appID)].Includes(min)
+}
+
+type user struct {
+	passwordHash []byte
+	roles        map[string]Role
+}
+
+// Authenticator verifies admin logins and the session tokens issued for them
+type Authenticator struct {
+	users      map[string]user // lower-cased username -> user
+	secret     []byte
+	sessionTTL time.Duration
+	logger     *zap.Logger
+
+	oauth    *oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+// dummyHash is compared against for unknown users so that login timing does
+// not reveal which usernames exist
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+
+// New creates an Authenticator. If an OIDC issuer is configured its discovery
+// document is fetched, so ctx bounds that request.
+func New(ctx context.Context, cfg config.AdminAuthConfig, logger *zap.Logger) (*Authenticator, error) {
+	if len(cfg.TokenSecret) < 32 {
+		return nil, errors.New("admin_server.auth.token_secret must be at least 32 characters")
+	}
+
+	users := make(map[string]user, len(cfg.Users))
+	for _, u := range cfg.Users {
+		roles := make(map[string]Role, len(u.Roles))
+		for appID, role := range u.Roles {
+			if Role(role).rank() == 0 {
+				return nil, fmt.Errorf("admin user %s: unknown role %q", u.Username, role)
+			}
+			roles[strings.ToLower(appID)] = Role(role)
+		}
+		users[strings.ToLower(u.Username)] = user{
+			passwordHash: []byte(u.PasswordHash),
+			roles:        roles,
+		}
+	}
+
+	a := &Authenticator{
+		users:      users,
+		secret:     []byte(cfg.TokenSecret),
+		sessionTTL: cfg.SessionTTL,
+		logger:     logger,
+	}
+
+	if cfg.OIDC.Issuer != "" {
+		provider, err := oidc.NewProvider(ctx, cfg.OIDC.Issuer)
+		if err != nil {
+			return nil, fmt.Errorf("oidc discovery: %w", err)
+		}
+		a.oauth = &oauth2.Config{
+			ClientID:     cfg.OIDC.ClientID,
+			ClientSecret: cfg.OIDC.ClientSecret,
+			RedirectURL:  cfg.OIDC.RedirectURL,
+			Endpoint:     provider.Endpoint(),
+			Scopes:       []string{oidc.ScopeOpenID, "email"},
+		}
+		a.verifier = provider.Verifier(&oidc.Config{ClientID: cfg.OIDC.ClientID})
+	}
+
+	return a, nil
+}
+
+// Login checks a local user's password
+func (a *Authenticator) Login(username, password string) (*Principal, error) {
+	u, ok := a.users[strings.ToLower(username)]
+	if !ok || len(u.passwordHash) == 0 {
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return nil, ErrInvalidCredentials
+	}
+	if err := bcrypt.CompareHashAndPassword(u.passwordHash, []byte(password)); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+	return a.principal(username)
+}
+
+// IssueToken returns a signed session token for a principal
+func (a *Authenticator) IssueToken(p *Principal) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(a.sessionTTL)
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Subject:   strings.ToLower(p.Username),
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(expiresAt),
+	})
+	signed, err := token.SignedString(a.secret)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("sign token: %w", err)
+	}
+	return signed, expiresAt, nil
+}
+
+// ParseToken verifies a session token. Roles are looked up from the current
+// configuration rather than the token, so removing a user or role takes
+// effect immediately.
+func (a *Authenticator) ParseToken(token string) (*Principal, error) {
+	var claims jwt.RegisteredClaims
+	_, err := jwt.ParseWithClaims(token, &claims, func(*jwt.Token) (interface{}, error) {
+		return a.secret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	return a.principal(claims.Subject)
+}
+
+// OIDCEnabled reports whether an OIDC provider is configured
+func (a *Authenticator) OIDCEnabled() bool {
+	return a.oauth != nil
+}
+
+// OIDCAuthURL returns the provider URL to send the browser to
+func (a *Authenticator) OIDCAuthURL(state string) string {
+	return a.oauth.AuthCodeURL(state)
+}
+
+// OIDCExchange trades an authorization code for the user it identifies. The
+// user must be configured with the email the provider verified.
+func (a *Authenticator) OIDCExchange(ctx context.Context, code string) (*Principal, error) {
+	token, err := a.oauth.Exchange(ctx, code)
+	if err != nil {
+		return nil, fmt.Errorf("exchange code: %w", err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, errors.New("no id_token in token response")
+	}
+	idToken, err := a.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("verify id_token: %w", err)
+	}
+
+	var claims struct {
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+	}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("parse claims: %w", err)
+	}
+	if claims.Email == "" || !claims.EmailVerified {
+		return nil, ErrUnknownUser
+	}
+	return a.principal(claims.Email)
+}
+
+func (a *Authenticator) principal(username string) (*Principal, error) {
+	u, ok := a.users[strings.ToLower(username)]
+	if !ok || len(u.roles) == 0 {
+		return nil, ErrUnknownUser
+	}
+	return &Principal{Username: strings.ToLower(username), Roles: u.roles}, nil
+}
+
+// GenerateState returns a random OIDC state value
+func GenerateState() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("generate state: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a copy of ctx carrying the authenticated admin user
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFromContext returns the authenticated admin user, or nil
+func PrincipalFromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalKey{}).(*Principal)
+	return p
+}
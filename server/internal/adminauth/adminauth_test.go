@@ -0,0 +1,170 @@
+package adminauth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/warriorguo/ozx_apm/server/internal/config"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+func newTestAuthenticator(t *testing.T) *Authenticator {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte("hunter2"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("hash password: %v", err)
+	}
+
+	a, err := New(context.Background(), config.AdminAuthConfig{
+		TokenSecret: testSecret,
+		SessionTTL:  time.Hour,
+		Users: []config.AdminUserConfig{
+			{Username: "Alice", PasswordHash: string(hash), Roles: map[string]string{"*": "admin"}},
+			{Username: "bob", PasswordHash: string(hash), Roles: map[string]string{"game-a": "developer"}},
+			{Username: "carol@example.com", Roles: map[string]string{"game-b": "viewer"}},
+		},
+	}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("new authenticator: %v", err)
+	}
+	return a
+}
+
+func TestRole_Includes(t *testing.T) {
+	tests := []struct {
+		role, other Role
+		want        bool
+	}{
+		{RoleAdmin, RoleViewer, true},
+		{RoleDeveloper, RoleDeveloper, true},
+		{RoleViewer, RoleDeveloper, false},
+		{Role(""), RoleViewer, false},
+		{Role("owner"), RoleViewer, false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.role.Includes(tt.other); got != tt.want {
+			t.Errorf("%q.Includes(%q) = %v, want %v", tt.role, tt.other, got, tt.want)
+		}
+	}
+}
+
+func TestPrincipal_Can(t *testing.T) {
+	p := &Principal{Roles: map[string]Role{"game-a": RoleDeveloper, "game-b": RoleViewer}}
+
+	tests := []struct {
+		appID string
+		min   Role
+		want  bool
+	}{
+		{"game-a", RoleDeveloper, true},
+		{"Game-A", RoleViewer, true},
+		{"game-a", RoleAdmin, false},
+		{"game-b", RoleDeveloper, false},
+		{"game-c", RoleViewer, false},
+		{"", RoleViewer, false},
+	}
+
+	for _, tt := range tests {
+		if got := p.Can(tt.appID, tt.min); got != tt.want {
+			t.Errorf("Can(%q, %q) = %v, want %v", tt.appID, tt.min, got, tt.want)
+		}
+	}
+
+	global := &Principal{Roles: map[string]Role{AllApps: RoleViewer}}
+	if !global.Can("", RoleViewer) || !global.Can("game-z", RoleViewer) {
+		t.Error("expected a global viewer to see every app")
+	}
+}
+
+func TestNew_RejectsBadConfig(t *testing.T) {
+	if _, err := New(context.Background(), config.AdminAuthConfig{TokenSecret: "short"}, zap.NewNop()); err == nil {
+		t.Error("expected short token secret to be rejected")
+	}
+
+	_, err := New(context.Background(), config.AdminAuthConfig{
+		TokenSecret: testSecret,
+		Users:       []config.AdminUserConfig{{Username: "a", Roles: map[string]string{"*": "owner"}}},
+	}, zap.NewNop())
+	if err == nil {
+		t.Error("expected unknown role to be rejected")
+	}
+}
+
+func TestAuthenticator_Login(t *testing.T) {
+	a := newTestAuthenticator(t)
+
+	p, err := a.Login("alice", "hunter2")
+	if err != nil {
+		t.Fatalf("expected login to succeed: %v", err)
+	}
+	if p.Username != "alice" || p.Roles[AllApps] != RoleAdmin {
+		t.Errorf("unexpected principal %+v", p)
+	}
+
+	if _, err := a.Login("alice", "wrong"); err != ErrInvalidCredentials {
+		t.Errorf("expected ErrInvalidCredentials for wrong password, got %v", err)
+	}
+	if _, err := a.Login("mallory", "hunter2"); err != ErrInvalidCredentials {
+		t.Errorf("expected ErrInvalidCredentials for unknown user, got %v", err)
+	}
+	if _, err := a.Login("carol@example.com", ""); err != ErrInvalidCredentials {
+		t.Errorf("expected OIDC-only user to be refused a password login, got %v", err)
+	}
+}
+
+func TestAuthenticator_TokenRoundTrip(t *testing.T) {
+	a := newTestAuthenticator(t)
+
+	token, expiresAt, err := a.IssueToken(&Principal{Username: "bob"})
+	if err != nil {
+		t.Fatalf("issue token: %v", err)
+	}
+	if time.Until(expiresAt) <= 0 {
+		t.Errorf("expected expiry in the future, got %v", expiresAt)
+	}
+
+	p, err := a.ParseToken(token)
+	if err != nil {
+		t.Fatalf("parse token: %v", err)
+	}
+	if p.Username != "bob" || p.Roles["game-a"] != RoleDeveloper {
+		t.Errorf("unexpected principal %+v", p)
+	}
+}
+
+func TestAuthenticator_ParseTokenRejects(t *testing.T) {
+	a := newTestAuthenticator(t)
+
+	sign := func(claims jwt.RegisteredClaims, secret string) string {
+		s, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+		return s
+	}
+	future := jwt.NewNumericDate(time.Now().Add(time.Hour))
+	past := jwt.NewNumericDate(time.Now().Add(-time.Hour))
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"garbage", "not-a-token"},
+		{"wrong secret", sign(jwt.RegisteredClaims{Subject: "alice", ExpiresAt: future}, "another-secret-another-secret-xx")},
+		{"expired", sign(jwt.RegisteredClaims{Subject: "alice", ExpiresAt: past}, testSecret)},
+		{"no expiry", sign(jwt.RegisteredClaims{Subject: "alice"}, testSecret)},
+		{"removed user", sign(jwt.RegisteredClaims{Subject: "dave", ExpiresAt: future}, testSecret)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := a.ParseToken(tt.token); err == nil {
+				t.Error("expected token to be rejected")
+			}
+		})
+	}
+}
@@ -1,14 +1,21 @@
 package alert
 
 import (
+	"context"
 	"sync"
 	"time"
 
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 
+	"github.com/warriorguo/ozx_apm/server/internal/metrics"
 	"github.com/warriorguo/ozx_apm/server/internal/processor"
 )
 
+var tracer = otel.Tracer("github.com/warriorguo/ozx_apm/server/internal/alert")
+
 // Rule represents an alert rule
 type Rule struct {
 	ID          string
@@ -93,6 +100,11 @@ func (e *Evaluator) evaluate() {
 	copy(rules, e.rules)
 	e.mu.RUnlock()
 
+	// One span per pass, with an event per evaluated rule
+	_, span := tracer.Start(context.Background(), "alert.evaluate",
+		trace.WithAttributes(attribute.Int("alert.rules", len(rules))))
+	defer span.End()
+
 	now := time.Now()
 
 	for _, rule := range rules {
@@ -101,6 +113,8 @@ func (e *Evaluator) evaluate() {
 			continue
 		}
 
+		metrics.AlertEvaluations.WithLabelValues(string(rule.Type)).Inc()
+
 		var value float64
 		var shouldFire bool
 
@@ -121,7 +135,16 @@ func (e *Evaluator) evaluate() {
 			shouldFire = value >= rule.Threshold
 		}
 
+		span.AddEvent("rule evaluated", trace.WithAttributes(
+			attribute.String("alert.rule_id", rule.ID),
+			attribute.String("alert.rule_type", string(rule.Type)),
+			attribute.Float64("alert.value", value),
+			attribute.Float64("alert.threshold", rule.Threshold),
+			attribute.Bool("alert.fired", shouldFire),
+		))
+
 		if shouldFire {
+			metrics.AlertsFired.WithLabelValues(string(rule.Type)).Inc()
 			alert := &Alert{
 				Rule:       rule,
 				AppVersion: rule.AppVersion,
@@ -0,0 +1,335 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+
+	"github.com/warriorguo/ozx_apm/server/internal/keystore"
+	"github.com/warriorguo/ozx_apm/server/internal/models"
+	"github.com/warriorguo/ozx_apm/server/internal/storage"
+)
+
+// defaultRotationOverlap is how long a rotated key keeps working by default
+const defaultRotationOverlap = 24 * time.Hour
+
+// maxRotationOverlap caps how long a rotated key may keep working
+const maxRotationOverlap = 30 * 24 * time.Hour
+
+// appIDPattern only admits lowercase IDs: storage compares app_id exactly and
+// roles are keyed by lowercase IDs, so "MyGame" and "mygame" must not coexist
+var appIDPattern = regexp.MustCompile(`^[a-z0-9_-]{1,64}$`)
+
+// AppHandler manages apps and their SDK keys
+type AppHandler struct {
+	repo   *storage.Repository
+	keys   *keystore.Store
+	logger *zap.Logger
+}
+
+func NewAppHandler(repo *storage.Repository, keys *keystore.Store, logger *zap.Logger) *AppHandler {
+	return &AppHandler{
+		repo:   repo,
+		keys:   keys,
+		logger: logger,
+	}
+}
+
+type createAppRequest struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type createKeyRequest struct {
+	Label     string     `json:"label"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+type rotateKeyRequest struct {
+	Overlap string `json:"overlap,omitempty"`
+}
+
+func (h *AppHandler) ListApps(w http.ResponseWriter, r *http.Request) {
+	if h.repo == nil {
+		http.Error(w, "repository not configured", http.StatusInternalServerError)
+		return
+	}
+
+	apps, err := h.repo.ListApps(r.Context())
+	if err != nil {
+		h.logger.Error("failed to list apps", zap.Error(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"apps": apps,
+	})
+}
+
+func (h *AppHandler) CreateApp(w http.ResponseWriter, r *http.Request) {
+	if h.repo == nil {
+		http.Error(w, "repository not configured", http.StatusInternalServerError)
+		return
+	}
+
+	ctx := r.Context()
+
+	var req createAppRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !appIDPattern.MatchString(req.ID) {
+		http.Error(w, "id must be 1-64 lowercase letters, digits, '-' or '_'", http.StatusBadRequest)
+		return
+	}
+	if req.Name == "" {
+		req.Name = req.ID
+	}
+
+	existing, err := h.repo.GetApp(ctx, req.ID)
+	if err != nil {
+		h.logger.Error("failed to get app", zap.Error(err), zap.String("app_id", req.ID))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if existing != nil {
+		http.Error(w, "app already exists", http.StatusConflict)
+		return
+	}
+
+	app := models.App{
+		ID:        req.ID,
+		Name:      req.Name,
+		CreatedAt: time.Now(),
+	}
+	if err := h.repo.SaveApp(ctx, app); err != nil {
+		h.logger.Error("failed to save app", zap.Error(err), zap.String("app_id", app.ID))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(app)
+}
+
+func (h *AppHandler) ListKeys(w http.ResponseWriter, r *http.Request) {
+	if h.repo == nil {
+		http.Error(w, "repository not configured", http.StatusInternalServerError)
+		return
+	}
+
+	appID := chi.URLParam(r, "app_id")
+	if appID == "" {
+		http.Error(w, "app_id parameter required", http.StatusBadRequest)
+		return
+	}
+
+	keys, err := h.repo.ListAPIKeys(r.Context(), appID)
+	if err != nil {
+		h.logger.Error("failed to list api keys", zap.Error(err), zap.String("app_id", appID))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"keys": keys,
+	})
+}
+
+// CreateKey issues a new key for an app. The key is only returned here.
+func (h *AppHandler) CreateKey(w http.ResponseWriter, r *http.Request) {
+	if h.repo == nil {
+		http.Error(w, "repository not configured", http.StatusInternalServerError)
+		return
+	}
+
+	ctx := r.Context()
+
+	appID := chi.URLParam(r, "app_id")
+	if appID == "" {
+		http.Error(w, "app_id parameter required", http.StatusBadRequest)
+		return
+	}
+
+	var req createKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		http.Error(w, "expires_at must be in the future", http.StatusBadRequest)
+		return
+	}
+
+	app, err := h.repo.GetApp(ctx, appID)
+	if err != nil {
+		h.logger.Error("failed to get app", zap.Error(err), zap.String("app_id", appID))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if app == nil {
+		http.Error(w, "app not found", http.StatusNotFound)
+		return
+	}
+
+	issued, err := h.issueKey(r, appID, req.Label, req.ExpiresAt)
+	if err != nil {
+		h.logger.Error("failed to issue api key", zap.Error(err), zap.String("app_id", appID))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(issued)
+}
+
+// RotateKey issues a replacement for a key and lets the old key keep
+// working for an overlap period so SDK builds can be rolled out
+func (h *AppHandler) RotateKey(w http.ResponseWriter, r *http.Request) {
+	if h.repo == nil {
+		http.Error(w, "repository not configured", http.StatusInternalServerError)
+		return
+	}
+
+	ctx := r.Context()
+	appID := chi.URLParam(r, "app_id")
+	keyID := chi.URLParam(r, "key_id")
+
+	var req rotateKeyRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid JSON: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	overlap := defaultRotationOverlap
+	if req.Overlap != "" {
+		d, err := time.ParseDuration(req.Overlap)
+		if err != nil || d < 0 || d > maxRotationOverlap {
+			http.Error(w, "overlap must be a duration between 0s and 720h", http.StatusBadRequest)
+			return
+		}
+		overlap = d
+	}
+
+	old, err := h.repo.GetAPIKey(ctx, appID, keyID)
+	if err != nil {
+		h.logger.Error("failed to get api key", zap.Error(err), zap.String("app_id", appID), zap.String("key_id", keyID))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if old == nil {
+		http.Error(w, "key not found", http.StatusNotFound)
+		return
+	}
+	if !keystore.Active(*old, time.Now()) {
+		http.Error(w, "key is already expired or revoked", http.StatusConflict)
+		return
+	}
+
+	issued, err := h.issueKey(r, appID, old.Label, old.ExpiresAt)
+	if err != nil {
+		h.logger.Error("failed to issue api key", zap.Error(err), zap.String("app_id", appID))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	// Only ever shorten the old key's lifetime
+	cutoff := time.Now().Add(overlap)
+	if old.ExpiresAt == nil || cutoff.Before(*old.ExpiresAt) {
+		old.ExpiresAt = &cutoff
+	}
+	if err := h.repo.SaveAPIKey(ctx, *old); err != nil {
+		h.logger.Error("failed to expire rotated api key", zap.Error(err), zap.String("key_id", old.ID))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	h.invalidateKeys()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.RotatedAPIKey{
+		Previous: *old,
+		Issued:   *issued,
+	})
+}
+
+// RevokeKey disables a key immediately
+func (h *AppHandler) RevokeKey(w http.ResponseWriter, r *http.Request) {
+	if h.repo == nil {
+		http.Error(w, "repository not configured", http.StatusInternalServerError)
+		return
+	}
+
+	ctx := r.Context()
+	appID := chi.URLParam(r, "app_id")
+	keyID := chi.URLParam(r, "key_id")
+
+	key, err := h.repo.GetAPIKey(ctx, appID, keyID)
+	if err != nil {
+		h.logger.Error("failed to get api key", zap.Error(err), zap.String("app_id", appID), zap.String("key_id", keyID))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if key == nil {
+		http.Error(w, "key not found", http.StatusNotFound)
+		return
+	}
+
+	if key.RevokedAt == nil {
+		now := time.Now()
+		key.RevokedAt = &now
+		if err := h.repo.SaveAPIKey(ctx, *key); err != nil {
+			h.logger.Error("failed to revoke api key", zap.Error(err), zap.String("key_id", keyID))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		h.invalidateKeys()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(key)
+}
+
+func (h *AppHandler) issueKey(r *http.Request, appID, label string, expiresAt *time.Time) (*models.IssuedAPIKey, error) {
+	id, err := keystore.GenerateID()
+	if err != nil {
+		return nil, err
+	}
+	raw, prefix, err := keystore.GenerateKey()
+	if err != nil {
+		return nil, err
+	}
+
+	key := models.APIKey{
+		ID:        id,
+		AppID:     appID,
+		Label:     label,
+		Prefix:    prefix,
+		Hash:      keystore.HashKey(raw),
+		CreatedAt: time.Now(),
+		ExpiresAt: expiresAt,
+	}
+	if err := h.repo.SaveAPIKey(r.Context(), key); err != nil {
+		return nil, err
+	}
+	h.invalidateKeys()
+
+	return &models.IssuedAPIKey{APIKey: key, Key: raw}, nil
+}
+
+func (h *AppHandler) invalidateKeys() {
+	if h.keys != nil {
+		h.keys.Invalidate()
+	}
+}
@@ -0,0 +1,74 @@
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// Tests for actual AppHandler with nil repository
+
+func TestNewAppHandler(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	handler := NewAppHandler(nil, nil, logger)
+	if handler == nil {
+		t.Error("expected non-nil handler")
+	}
+}
+
+func TestAppHandler_NilRepo(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	handler := NewAppHandler(nil, nil, logger)
+
+	tests := []struct {
+		name    string
+		method  string
+		target  string
+		body    string
+		handler http.HandlerFunc
+	}{
+		{"ListApps", http.MethodGet, "/apps", "", handler.ListApps},
+		{"CreateApp", http.MethodPost, "/apps", `{"id":"game-a"}`, handler.CreateApp},
+		{"ListKeys", http.MethodGet, "/apps/game-a/keys", "", handler.ListKeys},
+		{"CreateKey", http.MethodPost, "/apps/game-a/keys", `{"label":"prod"}`, handler.CreateKey},
+		{"RotateKey", http.MethodPost, "/apps/game-a/keys/k1/rotate", "", handler.RotateKey},
+		{"RevokeKey", http.MethodDelete, "/apps/game-a/keys/k1", "", handler.RevokeKey},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+
+			tt.handler(w, req)
+
+			if w.Code != http.StatusInternalServerError {
+				t.Errorf("expected status %d, got %d", http.StatusInternalServerError, w.Code)
+			}
+		})
+	}
+}
+
+func TestAppIDPattern(t *testing.T) {
+	tests := []struct {
+		id   string
+		want bool
+	}{
+		{"game-a", true},
+		{"game_2", true},
+		{"Game_2", false},
+		{"", false},
+		{"has space", false},
+		{"slash/id", false},
+		{strings.Repeat("a", 65), false},
+	}
+
+	for _, tt := range tests {
+		if got := appIDPattern.MatchString(tt.id); got != tt.want {
+			t.Errorf("appIDPattern(%q) = %v, want %v", tt.id, got, tt.want)
+		}
+	}
+}
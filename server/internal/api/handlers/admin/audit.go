@@ -0,0 +1,60 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"github.com/warriorguo/ozx_apm/server/internal/api/params"
+	"github.com/warriorguo/ozx_apm/server/internal/models"
+	"github.com/warriorguo/ozx_apm/server/internal/storage"
+)
+
+// AuditHandler handles audit log requests
+type AuditHandler struct {
+	repo   *storage.Repository
+	logger *zap.Logger
+}
+
+func NewAuditHandler(repo *storage.Repository, logger *zap.Logger) *AuditHandler {
+	return &AuditHandler{
+		repo:   repo,
+		logger: logger,
+	}
+}
+
+// ListAuditLog returns mutating admin requests, newest first
+func (h *AuditHandler) ListAuditLog(w http.ResponseWriter, r *http.Request) {
+	if h.repo == nil {
+		http.Error(w, "repository not configured", http.StatusInternalServerError)
+		return
+	}
+
+	ctx := r.Context()
+	q := r.URL.Query()
+	appID := q.Get("app_id")
+
+	p := params.New(r)
+	startTime, endTime := p.TimeRange()
+
+	limit := p.Limit()
+
+	if err := p.Err(); err != nil {
+		params.WriteError(w, err)
+		return
+	}
+
+	entries, err := h.repo.GetAuditLog(ctx, appID, startTime, endTime, limit)
+	if err != nil {
+		h.logger.Error("failed to get audit log", zap.Error(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"time_range": models.TimeRange{Start: startTime, End: endTime},
+		"entries":    entries,
+	})
+}
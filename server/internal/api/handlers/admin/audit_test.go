@@ -0,0 +1,25 @@
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// Tests for actual AuditHandler with nil repository
+
+func TestAuditHandler_ListAuditLog_NilRepo(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	handler := NewAuditHandler(nil, logger)
+
+	req := httptest.NewRequest(http.MethodGet, "/audit", nil)
+	w := httptest.NewRecorder()
+
+	handler.ListAuditLog(w, req)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("expected status %d, got %d", http.StatusInternalServerError, w.Code)
+	}
+}
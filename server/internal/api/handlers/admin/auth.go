@@ -0,0 +1,177 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/warriorguo/ozx_apm/server/internal/adminauth"
+	"github.com/warriorguo/ozx_apm/server/internal/api/middleware"
+)
+
+// oidcStateCookie carries the OIDC state between login and callback
+const oidcStateCookie = "ozx_oidc_state"
+
+// AuthHandler handles admin login and logout
+type AuthHandler struct {
+	authn  *adminauth.Authenticator
+	logger *zap.Logger
+}
+
+func NewAuthHandler(authn *adminauth.Authenticator, logger *zap.Logger) *AuthHandler {
+	return &AuthHandler{
+		authn:  authn,
+		logger: logger,
+	}
+}
+
+type loginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type sessionResponse struct {
+	*adminauth.Principal
+	Token     string    `json:"token,omitempty"`
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+}
+
+// Login checks a local user's password and starts a session. The token is
+// set as a cookie for the admin UI and returned for API clients.
+func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
+	var req loginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	p, err := h.authn.Login(req.Username, req.Password)
+	if err != nil {
+		h.logger.Warn("admin login failed", zap.String("username", req.Username), zap.String("remote_addr", r.RemoteAddr))
+		http.Error(w, adminauth.ErrInvalidCredentials.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	h.startSession(w, r, p, false)
+}
+
+// Logout clears the session cookie
+func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     middleware.SessionCookie,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Me returns the logged in user and their roles
+func (h *AuthHandler) Me(w http.ResponseWriter, r *http.Request) {
+	p := adminauth.PrincipalFromContext(r.Context())
+	if p == nil {
+		http.Error(w, "authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(p)
+}
+
+// OIDCLogin redirects the browser to the OIDC provider
+func (h *AuthHandler) OIDCLogin(w http.ResponseWriter, r *http.Request) {
+	if !h.authn.OIDCEnabled() {
+		http.Error(w, "oidc not configured", http.StatusNotFound)
+		return
+	}
+
+	state, err := adminauth.GenerateState()
+	if err != nil {
+		h.logger.Error("failed to generate oidc state", zap.Error(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/auth/oidc",
+		MaxAge:   int((5 * time.Minute).Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, h.authn.OIDCAuthURL(state), http.StatusFound)
+}
+
+// OIDCCallback completes an OIDC login and redirects to the admin UI
+func (h *AuthHandler) OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	if !h.authn.OIDCEnabled() {
+		http.Error(w, "oidc not configured", http.StatusNotFound)
+		return
+	}
+
+	q := r.URL.Query()
+	state, err := r.Cookie(oidcStateCookie)
+	if err != nil || state.Value == "" || q.Get("state") != state.Value {
+		http.Error(w, "invalid oidc state", http.StatusBadRequest)
+		return
+	}
+	if errCode := q.Get("error"); errCode != "" {
+		http.Error(w, "oidc login failed: "+errCode, http.StatusUnauthorized)
+		return
+	}
+
+	p, err := h.authn.OIDCExchange(r.Context(), q.Get("code"))
+	if err != nil {
+		if errors.Is(err, adminauth.ErrUnknownUser) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		h.logger.Warn("oidc login failed", zap.Error(err))
+		http.Error(w, "oidc login failed", http.StatusUnauthorized)
+		return
+	}
+
+	h.startSession(w, r, p, true)
+}
+
+func (h *AuthHandler) startSession(w http.ResponseWriter, r *http.Request, p *adminauth.Principal, redirect bool) {
+	token, expiresAt, err := h.authn.IssueToken(p)
+	if err != nil {
+		h.logger.Error("failed to issue session token", zap.Error(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	// Strict, so the cookie is never sent on cross-site requests. The OIDC
+	// redirect back to the UI is same-site, so it is unaffected.
+	http.SetCookie(w, &http.Cookie{
+		Name:     middleware.SessionCookie,
+		Value:    token,
+		Path:     "/",
+		Expires:  expiresAt,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+	h.logger.Info("admin login", zap.String("username", p.Username))
+
+	if redirect {
+		http.Redirect(w, r, "/", http.StatusFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sessionResponse{
+		Principal: p,
+		Token:     token,
+		ExpiresAt: expiresAt,
+	})
+}
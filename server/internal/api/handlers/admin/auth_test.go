@@ -0,0 +1,108 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/warriorguo/ozx_apm/server/internal/adminauth"
+	"github.com/warriorguo/ozx_apm/server/internal/api/middleware"
+	"github.com/warriorguo/ozx_apm/server/internal/config"
+)
+
+func newTestAuthHandler(t *testing.T) *AuthHandler {
+	t.Helper()
+	hash, _ := bcrypt.GenerateFromPassword([]byte("hunter2"), bcrypt.MinCost)
+	authn, err := adminauth.New(context.Background(), config.AdminAuthConfig{
+		TokenSecret: "0123456789abcdef0123456789abcdef",
+		SessionTTL:  time.Hour,
+		Users: []config.AdminUserConfig{
+			{Username: "alice", PasswordHash: string(hash), Roles: map[string]string{"*": "viewer"}},
+		},
+	}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("new authenticator: %v", err)
+	}
+	return NewAuthHandler(authn, zap.NewNop())
+}
+
+func TestAuthHandler_Login(t *testing.T) {
+	handler := newTestAuthHandler(t)
+
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+	}{
+		{"valid credentials", `{"username":"alice","password":"hunter2"}`, http.StatusOK},
+		{"wrong password", `{"username":"alice","password":"nope"}`, http.StatusUnauthorized},
+		{"invalid JSON", `{`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/auth/login", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+
+			handler.Login(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+
+			var resp sessionResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if resp.Token == "" || resp.Username != "alice" {
+				t.Errorf("unexpected response %+v", resp)
+			}
+
+			var cookie *http.Cookie
+			for _, c := range w.Result().Cookies() {
+				if c.Name == middleware.SessionCookie {
+					cookie = c
+				}
+			}
+			if cookie == nil || cookie.Value != resp.Token || !cookie.HttpOnly {
+				t.Errorf("expected an HttpOnly session cookie, got %+v", cookie)
+			}
+		})
+	}
+}
+
+func TestAuthHandler_OIDCNotConfigured(t *testing.T) {
+	handler := newTestAuthHandler(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/auth/oidc/login", nil)
+	w := httptest.NewRecorder()
+
+	handler.OIDCLogin(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestAuthHandler_Me_Unauthenticated(t *testing.T) {
+	handler := newTestAuthHandler(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/auth/me", nil)
+	w := httptest.NewRecorder()
+
+	handler.Me(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected status %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+}
@@ -2,12 +2,12 @@ package admin
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
-	"strconv"
-	"time"
 
 	"go.uber.org/zap"
 
+	"github.com/warriorguo/ozx_apm/server/internal/api/params"
 	"github.com/warriorguo/ozx_apm/server/internal/models"
 	"github.com/warriorguo/ozx_apm/server/internal/storage"
 )
@@ -30,60 +30,95 @@ func (h *CrashHandler) ListCrashes(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ctx := r.Context()
-	q := r.URL.Query()
-
-	// Parse time range
-	endTime := time.Now()
-	startTime := endTime.Add(-7 * 24 * time.Hour)
-
-	if start := q.Get("start_time"); start != "" {
-		if t, err := time.Parse(time.RFC3339, start); err == nil {
-			startTime = t
-		}
+	p := params.New(r)
+	query := groupListQuery(r, p)
+	if err := p.Err(); err != nil {
+		params.WriteError(w, err)
+		return
 	}
-	if end := q.Get("end_time"); end != "" {
-		if t, err := time.Parse(time.RFC3339, end); err == nil {
-			endTime = t
+
+	resp, err := h.repo.GetCrashGroups(r.Context(), query)
+	if err != nil {
+		var invalid *storage.InvalidQueryError
+		if errors.As(err, &invalid) {
+			params.WriteError(w, params.Errors{{Field: invalid.Field, Message: invalid.Message}})
+			return
 		}
+		h.logger.Error("failed to get crash groups", zap.Error(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
 	}
 
-	appVersion := q.Get("app_version")
-	platform := q.Get("platform")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
 
-	page := 1
-	if p := q.Get("page"); p != "" {
-		if v, err := strconv.Atoi(p); err == nil && v > 0 {
-			page = v
-		}
+// groupListQuery parses the filters, sort and page of a crash or exception
+// group list. Totals are only counted with total=true, and pages after the
+// first are reached with page or with the next_cursor of the previous one,
+// which keeps the time range of the first page unless one is given.
+func groupListQuery(r *http.Request, p *params.Parser) models.GroupListQuery {
+	q := r.URL.Query()
+	query := models.GroupListQuery{
+		AppID:      q.Get("app_id"),
+		AppVersion: q.Get("app_version"),
+		Platform:   q.Get("platform"),
+		Cursor:     q.Get("cursor"),
+	}
+	if query.Cursor == "" || q.Get("start_time") != "" || q.Get("end_time") != "" {
+		query.StartTime, query.EndTime = p.TimeRange()
+	}
+	query.Sort = p.OneOf("sort", models.GroupSortCount, models.GroupSorts...)
+	query.Order = p.OneOf("order", "desc", "asc", "desc")
+	query.Page, query.PageSize = p.Page()
+	query.WithTotal = p.Bool("total", false)
+	return query
+}
+
+func (h *CrashHandler) GetCrashDetail(w http.ResponseWriter, r *http.Request) {
+	if h.repo == nil {
+		http.Error(w, "repository not configured", http.StatusInternalServerError)
+		return
 	}
 
-	pageSize := 20
-	if ps := q.Get("page_size"); ps != "" {
-		if v, err := strconv.Atoi(ps); err == nil && v > 0 && v <= 100 {
-			pageSize = v
-		}
+	ctx := r.Context()
+	q := r.URL.Query()
+	appID := q.Get("app_id")
+
+	p := params.New(r)
+	fingerprint := p.Required("fingerprint")
+	startTime, endTime := p.TimeRange()
+
+	if err := p.Err(); err != nil {
+		params.WriteError(w, err)
+		return
 	}
 
-	crashes, totalCount, err := h.repo.GetCrashGroups(ctx, startTime, endTime, appVersion, platform, page, pageSize)
+	detail, err := h.repo.GetCrashDetail(ctx, appID, fingerprint, startTime, endTime)
 	if err != nil {
-		h.logger.Error("failed to get crash groups", zap.Error(err))
+		h.logger.Error("failed to get crash detail", zap.Error(err), zap.String("fingerprint", fingerprint))
 		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
 	}
 
-	resp := models.CrashListResponse{
-		Crashes:    crashes,
-		TotalCount: totalCount,
-		Page:       page,
-		PageSize:   pageSize,
+	if detail == nil {
+		http.Error(w, "crash not found", http.StatusNotFound)
+		return
+	}
+
+	for i := range detail.Occurrences {
+		if id := detail.Occurrences[i].SessionID; id != "" {
+			detail.Occurrences[i].TimelineURL = sessionTimelineURL(id)
+		}
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(resp)
+	json.NewEncoder(w).Encode(detail)
 }
 
-func (h *CrashHandler) GetCrashDetail(w http.ResponseWriter, r *http.Request) {
+// GetCrashFreeStats returns crash-free sessions and users percentages with
+// an optional breakdown by version, platform or day
+func (h *CrashHandler) GetCrashFreeStats(w http.ResponseWriter, r *http.Request) {
 	if h.repo == nil {
 		http.Error(w, "repository not configured", http.StatusInternalServerError)
 		return
@@ -91,42 +126,51 @@ func (h *CrashHandler) GetCrashDetail(w http.ResponseWriter, r *http.Request) {
 
 	ctx := r.Context()
 	q := r.URL.Query()
+	appID := q.Get("app_id")
 
-	fingerprint := q.Get("fingerprint")
-	if fingerprint == "" {
-		http.Error(w, "fingerprint parameter required", http.StatusBadRequest)
-		return
-	}
+	p := params.New(r)
+	groupBy := p.OneOf("group_by", "", "version", "platform", "day")
+	userKey := p.OneOf("user_key", "device_id", "device_id", "user_id")
+	startTime, endTime := p.TimeRange()
 
-	// Parse time range
-	endTime := time.Now()
-	startTime := endTime.Add(-30 * 24 * time.Hour)
+	appVersion := q.Get("app_version")
+	platform := q.Get("platform")
 
-	if start := q.Get("start_time"); start != "" {
-		if t, err := time.Parse(time.RFC3339, start); err == nil {
-			startTime = t
-		}
-	}
-	if end := q.Get("end_time"); end != "" {
-		if t, err := time.Parse(time.RFC3339, end); err == nil {
-			endTime = t
-		}
+	if err := p.Err(); err != nil {
+		params.WriteError(w, err)
+		return
 	}
 
-	detail, err := h.repo.GetCrashDetail(ctx, fingerprint, startTime, endTime)
+	overall, err := h.repo.GetCrashFreeStats(ctx, appID, startTime, endTime, appVersion, platform, "", userKey)
 	if err != nil {
-		h.logger.Error("failed to get crash detail", zap.Error(err), zap.String("fingerprint", fingerprint))
+		h.logger.Error("failed to get crash-free stats", zap.Error(err))
 		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
 	}
 
-	if detail == nil {
-		http.Error(w, "crash not found", http.StatusNotFound)
-		return
+	resp := models.CrashFreeResponse{
+		TimeRange: models.TimeRange{Start: startTime, End: endTime},
+		GroupBy:   groupBy,
+		UserKey:   userKey,
+		Overall:   models.CrashFreeStats{Key: "all"},
+		Breakdown: []models.CrashFreeStats{},
+	}
+	if len(overall) > 0 {
+		resp.Overall = overall[0]
+	}
+
+	if groupBy != "" {
+		breakdown, err := h.repo.GetCrashFreeStats(ctx, appID, startTime, endTime, appVersion, platform, groupBy, userKey)
+		if err != nil {
+			h.logger.Error("failed to get crash-free breakdown", zap.Error(err), zap.String("group_by", groupBy))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		resp.Breakdown = breakdown
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(detail)
+	json.NewEncoder(w).Encode(resp)
 }
 
 // ExceptionHandler handles exception-related requests
@@ -148,55 +192,25 @@ func (h *ExceptionHandler) ListExceptions(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	ctx := r.Context()
-	q := r.URL.Query()
-
-	// Parse time range
-	endTime := time.Now()
-	startTime := endTime.Add(-7 * 24 * time.Hour)
-
-	if start := q.Get("start_time"); start != "" {
-		if t, err := time.Parse(time.RFC3339, start); err == nil {
-			startTime = t
-		}
-	}
-	if end := q.Get("end_time"); end != "" {
-		if t, err := time.Parse(time.RFC3339, end); err == nil {
-			endTime = t
-		}
-	}
-
-	appVersion := q.Get("app_version")
-	platform := q.Get("platform")
-
-	page := 1
-	if p := q.Get("page"); p != "" {
-		if v, err := strconv.Atoi(p); err == nil && v > 0 {
-			page = v
-		}
-	}
-
-	pageSize := 20
-	if ps := q.Get("page_size"); ps != "" {
-		if v, err := strconv.Atoi(ps); err == nil && v > 0 && v <= 100 {
-			pageSize = v
-		}
+	p := params.New(r)
+	query := groupListQuery(r, p)
+	if err := p.Err(); err != nil {
+		params.WriteError(w, err)
+		return
 	}
 
-	exceptions, totalCount, err := h.repo.GetExceptionGroups(ctx, startTime, endTime, appVersion, platform, page, pageSize)
+	resp, err := h.repo.GetExceptionGroups(r.Context(), query)
 	if err != nil {
+		var invalid *storage.InvalidQueryError
+		if errors.As(err, &invalid) {
+			params.WriteError(w, params.Errors{{Field: invalid.Field, Message: invalid.Message}})
+			return
+		}
 		h.logger.Error("failed to get exception groups", zap.Error(err))
 		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
 	}
 
-	resp := models.ExceptionListResponse{
-		Exceptions: exceptions,
-		TotalCount: totalCount,
-		Page:       page,
-		PageSize:   pageSize,
-	}
-
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
 }
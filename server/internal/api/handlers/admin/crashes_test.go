@@ -11,6 +11,7 @@ import (
 
 	"go.uber.org/zap"
 
+	"github.com/warriorguo/ozx_apm/server/internal/api/params"
 	"github.com/warriorguo/ozx_apm/server/internal/models"
 )
 
@@ -60,6 +61,20 @@ func TestCrashHandler_GetCrashDetail_NilRepo(t *testing.T) {
 	}
 }
 
+func TestCrashHandler_GetCrashFreeStats_NilRepo(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	handler := NewCrashHandler(nil, logger)
+
+	req := httptest.NewRequest(http.MethodGet, "/crash-free?group_by=version&user_key=user_id", nil)
+	w := httptest.NewRecorder()
+
+	handler.GetCrashFreeStats(w, req)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("expected status %d, got %d", http.StatusInternalServerError, w.Code)
+	}
+}
+
 func TestExceptionHandler_ListExceptions_NilRepo(t *testing.T) {
 	logger, _ := zap.NewDevelopment()
 	handler := NewExceptionHandler(nil, logger)
@@ -218,7 +233,7 @@ func (h *TestCrashHandler) ListCrashes(w http.ResponseWriter, r *http.Request) {
 
 	resp := models.CrashListResponse{
 		Crashes:    crashes,
-		TotalCount: totalCount,
+		TotalCount: &totalCount,
 		Page:       page,
 		PageSize:   pageSize,
 	}
@@ -321,7 +336,7 @@ func (h *TestExceptionHandler) ListExceptions(w http.ResponseWriter, r *http.Req
 
 	resp := models.ExceptionListResponse{
 		Exceptions: exceptions,
-		TotalCount: totalCount,
+		TotalCount: &totalCount,
 		Page:       page,
 		PageSize:   pageSize,
 	}
@@ -596,3 +611,34 @@ func TestListExceptions_Error(t *testing.T) {
 		t.Errorf("expected status %d, got %d", http.StatusInternalServerError, w.Code)
 	}
 }
+
+func TestGroupListQuery(t *testing.T) {
+	tests := []struct {
+		name      string
+		url       string
+		withRange bool
+		withTotal bool
+	}{
+		{"first page", "/api/crashes?app_id=game", true, false},
+		{"with total", "/api/crashes?app_id=game&total=true", true, true},
+		{"cursor keeps its range", "/api/crashes?app_id=game&cursor=abc", false, false},
+		{"cursor with a range", "/api/crashes?app_id=game&cursor=abc&start_time=2024-01-15T00:00:00Z&end_time=2024-01-16T00:00:00Z", true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			p := params.New(req)
+			query := groupListQuery(req, p)
+			if err := p.Err(); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if hasRange := !query.StartTime.IsZero() && !query.EndTime.IsZero(); hasRange != tt.withRange {
+				t.Errorf("expected a time range %v, got %v to %v", tt.withRange, query.StartTime, query.EndTime)
+			}
+			if query.WithTotal != tt.withTotal {
+				t.Errorf("expected total %v, got %v", tt.withTotal, query.WithTotal)
+			}
+		})
+	}
+}
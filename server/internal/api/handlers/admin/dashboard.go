@@ -2,11 +2,13 @@ package admin
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"time"
 
 	"go.uber.org/zap"
 
+	"github.com/warriorguo/ozx_apm/server/internal/api/params"
 	"github.com/warriorguo/ozx_apm/server/internal/models"
 	"github.com/warriorguo/ozx_apm/server/internal/storage"
 )
@@ -31,26 +33,20 @@ func (h *DashboardHandler) GetSummary(w http.ResponseWriter, r *http.Request) {
 
 	ctx := r.Context()
 	q := r.URL.Query()
+	appID := q.Get("app_id")
 
-	// Parse time range (default: last 24 hours)
-	endTime := time.Now()
-	startTime := endTime.Add(-24 * time.Hour)
-
-	if start := q.Get("start_time"); start != "" {
-		if t, err := time.Parse(time.RFC3339, start); err == nil {
-			startTime = t
-		}
-	}
-	if end := q.Get("end_time"); end != "" {
-		if t, err := time.Parse(time.RFC3339, end); err == nil {
-			endTime = t
-		}
-	}
+	p := params.New(r)
+	startTime, endTime := p.TimeRange()
 
 	appVersion := q.Get("app_version")
 	platform := q.Get("platform")
 
-	summary, err := h.repo.GetDashboardSummary(ctx, startTime, endTime, appVersion, platform)
+	if err := p.Err(); err != nil {
+		params.WriteError(w, err)
+		return
+	}
+
+	summary, err := h.repo.GetDashboardSummary(ctx, appID, startTime, endTime, appVersion, platform)
 	if err != nil {
 		h.logger.Error("failed to get dashboard summary", zap.Error(err))
 		http.Error(w, "internal error", http.StatusInternalServerError)
@@ -71,42 +67,36 @@ func (h *DashboardHandler) GetTimeSeries(w http.ResponseWriter, r *http.Request)
 
 	ctx := r.Context()
 	q := r.URL.Query()
+	appID := q.Get("app_id")
 
-	metric := q.Get("metric")
-	if metric == "" {
-		http.Error(w, "metric parameter required", http.StatusBadRequest)
-		return
-	}
-
-	// Parse time range
-	endTime := time.Now()
-	startTime := endTime.Add(-24 * time.Hour)
-
-	if start := q.Get("start_time"); start != "" {
-		if t, err := time.Parse(time.RFC3339, start); err == nil {
-			startTime = t
-		}
-	}
-	if end := q.Get("end_time"); end != "" {
-		if t, err := time.Parse(time.RFC3339, end); err == nil {
-			endTime = t
-		}
-	}
+	p := params.New(r)
+	metric := p.Required("metric")
+	startTime, endTime := p.TimeRange()
 
 	appVersion := q.Get("app_version")
 	platform := q.Get("platform")
 
 	// Determine interval based on time range
 	duration := endTime.Sub(startTime)
-	interval := "1 HOUR"
+	interval := time.Hour
 	if duration > 7*24*time.Hour {
-		interval = "1 DAY"
+		interval = 24 * time.Hour
 	} else if duration < 6*time.Hour {
-		interval = "5 MINUTE"
+		interval = 5 * time.Minute
 	}
 
-	data, err := h.repo.GetTimeSeries(ctx, metric, startTime, endTime, interval, appVersion, platform)
+	if err := p.Err(); err != nil {
+		params.WriteError(w, err)
+		return
+	}
+
+	data, err := h.repo.GetTimeSeries(ctx, appID, metric, startTime, endTime, interval, appVersion, platform)
 	if err != nil {
+		var invalid *storage.InvalidQueryError
+		if errors.As(err, &invalid) {
+			params.WriteError(w, params.Errors{{Field: invalid.Field, Message: invalid.Message}})
+			return
+		}
 		h.logger.Error("failed to get time series", zap.Error(err), zap.String("metric", metric))
 		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
@@ -129,34 +119,28 @@ func (h *DashboardHandler) GetDistribution(w http.ResponseWriter, r *http.Reques
 
 	ctx := r.Context()
 	q := r.URL.Query()
+	appID := q.Get("app_id")
 
-	metric := q.Get("metric")
-	if metric == "" {
-		http.Error(w, "metric parameter required", http.StatusBadRequest)
-		return
-	}
-
-	// Parse time range
-	endTime := time.Now()
-	startTime := endTime.Add(-24 * time.Hour)
-
-	if start := q.Get("start_time"); start != "" {
-		if t, err := time.Parse(time.RFC3339, start); err == nil {
-			startTime = t
-		}
-	}
-	if end := q.Get("end_time"); end != "" {
-		if t, err := time.Parse(time.RFC3339, end); err == nil {
-			endTime = t
-		}
-	}
+	p := params.New(r)
+	metric := p.Required("metric")
+	startTime, endTime := p.TimeRange()
 
 	appVersion := q.Get("app_version")
 	platform := q.Get("platform")
 	scene := q.Get("scene")
 
-	dist, err := h.repo.GetDistribution(ctx, metric, startTime, endTime, appVersion, platform, scene)
+	if err := p.Err(); err != nil {
+		params.WriteError(w, err)
+		return
+	}
+
+	dist, err := h.repo.GetDistribution(ctx, appID, metric, startTime, endTime, appVersion, platform, scene)
 	if err != nil {
+		var invalid *storage.InvalidQueryError
+		if errors.As(err, &invalid) {
+			params.WriteError(w, params.Errors{{Field: invalid.Field, Message: invalid.Message}})
+			return
+		}
 		h.logger.Error("failed to get distribution", zap.Error(err), zap.String("metric", metric))
 		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
@@ -174,8 +158,9 @@ func (h *DashboardHandler) GetAppVersions(w http.ResponseWriter, r *http.Request
 	}
 
 	ctx := r.Context()
+	appID := r.URL.Query().Get("app_id")
 
-	versions, err := h.repo.GetAppVersions(ctx)
+	versions, err := h.repo.GetAppVersions(ctx, appID)
 	if err != nil {
 		h.logger.Error("failed to get app versions", zap.Error(err))
 		http.Error(w, "internal error", http.StatusInternalServerError)
@@ -188,6 +173,128 @@ func (h *DashboardHandler) GetAppVersions(w http.ResponseWriter, r *http.Request
 	})
 }
 
+// GetSceneReport returns the performance, load times and stability of each
+// scene, worst first by sort
+func (h *DashboardHandler) GetSceneReport(w http.ResponseWriter, r *http.Request) {
+	if h.repo == nil {
+		http.Error(w, "repository not configured", http.StatusInternalServerError)
+		return
+	}
+
+	ctx := r.Context()
+	q := r.URL.Query()
+	appID := q.Get("app_id")
+
+	p := params.New(r)
+	startTime, endTime := p.TimeRange()
+	sortBy := p.OneOf("sort", models.SceneSortSamples, models.SceneSorts...)
+	limit := p.Limit()
+
+	appVersion := q.Get("app_version")
+	platform := q.Get("platform")
+
+	if err := p.Err(); err != nil {
+		params.WriteError(w, err)
+		return
+	}
+
+	scenes, err := h.repo.GetSceneReport(ctx, appID, startTime, endTime, appVersion, platform, sortBy, limit)
+	if err != nil {
+		h.logger.Error("failed to get scene report", zap.Error(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	resp := models.SceneReportResponse{
+		TimeRange: models.TimeRange{Start: startTime, End: endTime},
+		Sort:      sortBy,
+		Scenes:    scenes,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// GetJankAnalysis breaks janks down by cause and relates them to GC
+// activity, overall and for the scenes with the most janks, with the events
+// that most often preceded them
+func (h *DashboardHandler) GetJankAnalysis(w http.ResponseWriter, r *http.Request) {
+	if h.repo == nil {
+		http.Error(w, "repository not configured", http.StatusInternalServerError)
+		return
+	}
+
+	ctx := r.Context()
+	q := r.URL.Query()
+	appID := q.Get("app_id")
+
+	p := params.New(r)
+	startTime, endTime := p.TimeRange()
+	limit := p.Limit()
+	top := p.Int("top", 10, 1, 50)
+
+	appVersion := q.Get("app_version")
+	platform := q.Get("platform")
+	scene := q.Get("scene")
+
+	if err := p.Err(); err != nil {
+		params.WriteError(w, err)
+		return
+	}
+
+	resp, err := h.repo.GetJankAnalysis(ctx, appID, startTime, endTime, appVersion, platform, scene, limit, top)
+	if err != nil {
+		h.logger.Error("failed to get jank analysis", zap.Error(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	resp.TimeRange = models.TimeRange{Start: startTime, End: endTime}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// GetMemoryLeaks returns the sessions whose memory keeps growing, how many
+// such sessions each scene and version has, and the crashes likely caused by
+// running out of memory
+func (h *DashboardHandler) GetMemoryLeaks(w http.ResponseWriter, r *http.Request) {
+	if h.repo == nil {
+		http.Error(w, "repository not configured", http.StatusInternalServerError)
+		return
+	}
+
+	ctx := r.Context()
+	q := r.URL.Query()
+	appID := q.Get("app_id")
+
+	p := params.New(r)
+	startTime, endTime := p.TimeRange()
+	limit := p.Limit()
+	minGrowth := p.Int("min_growth_mb", 100, 1, 65536)
+	highMemory := p.Int("high_memory_mb", 0, 0, 65536)
+
+	appVersion := q.Get("app_version")
+	platform := q.Get("platform")
+	scene := q.Get("scene")
+
+	if err := p.Err(); err != nil {
+		params.WriteError(w, err)
+		return
+	}
+
+	resp, err := h.repo.GetMemoryLeaks(ctx, appID, startTime, endTime, appVersion, platform, scene,
+		float64(minGrowth), float64(highMemory), limit)
+	if err != nil {
+		h.logger.Error("failed to get memory leaks", zap.Error(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	resp.TimeRange = models.TimeRange{Start: startTime, End: endTime}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
 // GetScenes returns list of scenes
 func (h *DashboardHandler) GetScenes(w http.ResponseWriter, r *http.Request) {
 	if h.repo == nil {
@@ -196,9 +303,10 @@ func (h *DashboardHandler) GetScenes(w http.ResponseWriter, r *http.Request) {
 	}
 
 	ctx := r.Context()
+	appID := r.URL.Query().Get("app_id")
 	appVersion := r.URL.Query().Get("app_version")
 
-	scenes, err := h.repo.GetScenes(ctx, appVersion)
+	scenes, err := h.repo.GetScenes(ctx, appID, appVersion)
 	if err != nil {
 		h.logger.Error("failed to get scenes", zap.Error(err))
 		http.Error(w, "internal error", http.StatusInternalServerError)
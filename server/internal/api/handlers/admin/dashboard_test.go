@@ -10,7 +10,9 @@ import (
 
 	"go.uber.org/zap"
 
+	"github.com/warriorguo/ozx_apm/server/internal/api/params"
 	"github.com/warriorguo/ozx_apm/server/internal/models"
+	"github.com/warriorguo/ozx_apm/server/internal/storage"
 )
 
 // Tests for actual DashboardHandler with nil repository
@@ -93,6 +95,48 @@ func TestDashboardHandler_GetScenes_NilRepo(t *testing.T) {
 	}
 }
 
+func TestDashboardHandler_GetSceneReport_NilRepo(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	handler := NewDashboardHandler(nil, logger)
+
+	req := httptest.NewRequest(http.MethodGet, "/scenes/report", nil)
+	w := httptest.NewRecorder()
+
+	handler.GetSceneReport(w, req)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("expected status %d, got %d", http.StatusInternalServerError, w.Code)
+	}
+}
+
+func TestDashboardHandler_GetJankAnalysis_NilRepo(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	handler := NewDashboardHandler(nil, logger)
+
+	req := httptest.NewRequest(http.MethodGet, "/janks/analysis", nil)
+	w := httptest.NewRecorder()
+
+	handler.GetJankAnalysis(w, req)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("expected status %d, got %d", http.StatusInternalServerError, w.Code)
+	}
+}
+
+func TestDashboardHandler_GetMemoryLeaks_NilRepo(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	handler := NewDashboardHandler(nil, logger)
+
+	req := httptest.NewRequest(http.MethodGet, "/memory/leaks", nil)
+	w := httptest.NewRecorder()
+
+	handler.GetMemoryLeaks(w, req)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("expected status %d, got %d", http.StatusInternalServerError, w.Code)
+	}
+}
+
 // MockRepository implements a mock repository for testing
 type MockRepository struct {
 	SummaryFunc      func(ctx context.Context, startTime, endTime time.Time, appVersion, platform string) (*models.DashboardSummary, error)
@@ -555,3 +599,56 @@ func TestGetScenes(t *testing.T) {
 		})
 	}
 }
+
+func TestAdminHandlers_InvalidParams(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	// Invalid parameters are rejected before the repository is used, so an
+	// unconnected one will do
+	repo := &storage.Repository{}
+
+	dashboard := NewDashboardHandler(repo, logger)
+	crashes := NewCrashHandler(repo, logger)
+	exceptions := NewExceptionHandler(repo, logger)
+	sessions := NewSessionHandler(repo, logger)
+	releases := NewReleaseHandler(repo, logger)
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		query   string
+	}{
+		{"summary malformed start", dashboard.GetSummary, "?start_time=yesterday"},
+		{"scene report sort", dashboard.GetSceneReport, "?sort=name"},
+		{"jank analysis top events", dashboard.GetJankAnalysis, "?top=100"},
+		{"memory leaks growth", dashboard.GetMemoryLeaks, "?min_growth_mb=0"},
+		{"timeseries range too long", dashboard.GetTimeSeries, "?metric=fps&start_time=-90d"},
+		{"crashes page size", crashes.ListCrashes, "?page_size=5000"},
+		{"crashes sort", crashes.ListCrashes, "?sort=stack"},
+		{"crashes malformed cursor", crashes.ListCrashes, "?cursor=abc"},
+		{"exceptions order", exceptions.ListExceptions, "?order=up"},
+		{"exceptions total", exceptions.ListExceptions, "?total=maybe"},
+		{"crash detail end before start", crashes.GetCrashDetail, "?fingerprint=abc&start_time=-1h&end_time=-2h"},
+		{"sessions page", sessions.ListSessions, "?page=0"},
+		{"releases limit", releases.ListReleases, "?limit=abc"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/test"+tt.query, nil)
+			w := httptest.NewRecorder()
+
+			tt.handler(w, req)
+
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("expected status %d, got %d", http.StatusBadRequest, w.Code)
+			}
+			var resp params.ErrorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("failed to decode: %v", err)
+			}
+			if len(resp.Fields) == 0 {
+				t.Error("expected field errors")
+			}
+		})
+	}
+}
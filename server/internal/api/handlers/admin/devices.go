@@ -0,0 +1,110 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+
+	"github.com/warriorguo/ozx_apm/server/internal/api/params"
+	"github.com/warriorguo/ozx_apm/server/internal/models"
+	"github.com/warriorguo/ozx_apm/server/internal/storage"
+)
+
+// DeviceHandler handles device lookups for player support
+type DeviceHandler struct {
+	repo   *storage.Repository
+	logger *zap.Logger
+}
+
+func NewDeviceHandler(repo *storage.Repository, logger *zap.Logger) *DeviceHandler {
+	return &DeviceHandler{
+		repo:   repo,
+		logger: logger,
+	}
+}
+
+// SearchDevices returns the devices a user_id has played on
+func (h *DeviceHandler) SearchDevices(w http.ResponseWriter, r *http.Request) {
+	if h.repo == nil {
+		http.Error(w, "repository not configured", http.StatusInternalServerError)
+		return
+	}
+
+	ctx := r.Context()
+	q := r.URL.Query()
+	appID := q.Get("app_id")
+
+	p := params.New(r)
+	userID := p.Required("user_id")
+	startTime, endTime := p.TimeRange()
+
+	if err := p.Err(); err != nil {
+		params.WriteError(w, err)
+		return
+	}
+
+	devices, err := h.repo.FindDevicesByUser(ctx, appID, userID, startTime, endTime)
+	if err != nil {
+		h.logger.Error("failed to find devices", zap.Error(err), zap.String("user_id", userID))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	resp := models.DeviceSearchResponse{
+		UserID:  userID,
+		Devices: devices,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// GetDevice returns a device's sessions, versions, crashes, exceptions and
+// performance summary
+func (h *DeviceHandler) GetDevice(w http.ResponseWriter, r *http.Request) {
+	if h.repo == nil {
+		http.Error(w, "repository not configured", http.StatusInternalServerError)
+		return
+	}
+
+	ctx := r.Context()
+	q := r.URL.Query()
+	appID := q.Get("app_id")
+
+	deviceID := chi.URLParam(r, "device_id")
+	if deviceID == "" {
+		http.Error(w, "device_id parameter required", http.StatusBadRequest)
+		return
+	}
+
+	p := params.New(r)
+	startTime, endTime := p.TimeRange()
+
+	if err := p.Err(); err != nil {
+		params.WriteError(w, err)
+		return
+	}
+
+	history, err := h.repo.GetDeviceHistory(ctx, appID, deviceID, startTime, endTime)
+	if err != nil {
+		h.logger.Error("failed to get device history", zap.Error(err), zap.String("device_id", deviceID))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	if history == nil {
+		http.Error(w, "device not found", http.StatusNotFound)
+		return
+	}
+
+	for i := range history.Crashes {
+		if id := history.Crashes[i].SessionID; id != "" {
+			history.Crashes[i].TimelineURL = sessionTimelineURL(id)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(history)
+}
@@ -0,0 +1,47 @@
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// Tests for actual DeviceHandler with nil repository
+
+func TestNewDeviceHandler(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	handler := NewDeviceHandler(nil, logger)
+	if handler == nil {
+		t.Error("expected non-nil handler")
+	}
+}
+
+func TestDeviceHandler_SearchDevices_NilRepo(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	handler := NewDeviceHandler(nil, logger)
+
+	req := httptest.NewRequest(http.MethodGet, "/devices?user_id=u1", nil)
+	w := httptest.NewRecorder()
+
+	handler.SearchDevices(w, req)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("expected status %d, got %d", http.StatusInternalServerError, w.Code)
+	}
+}
+
+func TestDeviceHandler_GetDevice_NilRepo(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	handler := NewDeviceHandler(nil, logger)
+
+	req := httptest.NewRequest(http.MethodGet, "/devices/d1", nil)
+	w := httptest.NewRecorder()
+
+	handler.GetDevice(w, req)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("expected status %d, got %d", http.StatusInternalServerError, w.Code)
+	}
+}
@@ -0,0 +1,382 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/warriorguo/ozx_apm/server/internal/adminauth"
+	"github.com/warriorguo/ozx_apm/server/internal/api/params"
+	"github.com/warriorguo/ozx_apm/server/internal/models"
+	"github.com/warriorguo/ozx_apm/server/internal/storage"
+)
+
+// distributionPrefix marks Grafana targets answered by GetDistribution
+// instead of GetTimeSeries, e.g. "distribution:fps"
+const distributionPrefix = "distribution:"
+
+// grafanaTimeSeriesMetrics are the metrics GetTimeSeries supports
+var grafanaTimeSeriesMetrics = []string{
+	"fps", "frame_time", "crashes", "exceptions", "janks", "sessions",
+	"startup", "crash_free_sessions", "crash_free_users",
+}
+
+// grafanaDistributionMetrics are the metrics GetDistribution supports
+var grafanaDistributionMetrics = []string{"fps", "frame_time", "startup"}
+
+// minGrafanaInterval keeps dashboards zoomed far out from asking for
+// second-level buckets
+const minGrafanaInterval = time.Minute
+
+// GrafanaHandler implements the JSON datasource API used by Grafana's
+// SimpleJSON and Infinity plugins, so dashboards can query APM data without
+// direct ClickHouse access
+type GrafanaHandler struct {
+	repo   *storage.Repository
+	logger *zap.Logger
+}
+
+func NewGrafanaHandler(repo *storage.Repository, logger *zap.Logger) *GrafanaHandler {
+	return &GrafanaHandler{
+		repo:   repo,
+		logger: logger,
+	}
+}
+
+type grafanaRange struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+// grafanaFilters narrow a query. They come from a target's payload (or data,
+// for the older SimpleJSON plugin) and from ad hoc filters.
+type grafanaFilters struct {
+	AppID      string `json:"app_id"`
+	AppVersion string `json:"app_version"`
+	Platform   string `json:"platform"`
+	Scene      string `json:"scene"`
+}
+
+type grafanaTarget struct {
+	Target  string          `json:"target"`
+	RefID   string          `json:"refId"`
+	Payload *grafanaFilters `json:"payload"`
+	Data    *grafanaFilters `json:"data"`
+}
+
+type grafanaAdhocFilter struct {
+	Key      string `json:"key"`
+	Operator string `json:"operator"`
+	Value    string `json:"value"`
+}
+
+type grafanaQueryRequest struct {
+	Range        grafanaRange         `json:"range"`
+	IntervalMs   int64                `json:"intervalMs"`
+	Targets      []grafanaTarget      `json:"targets"`
+	AdhocFilters []grafanaAdhocFilter `json:"adhocFilters"`
+}
+
+// grafanaTimeSeries is a series of [value, unix milliseconds] pairs
+type grafanaTimeSeries struct {
+	Target     string       `json:"target"`
+	Datapoints [][2]float64 `json:"datapoints"`
+}
+
+type grafanaColumn struct {
+	Text string `json:"text"`
+	Type string `json:"type"`
+}
+
+type grafanaTable struct {
+	Type    string          `json:"type"`
+	RefID   string          `json:"refId,omitempty"`
+	Columns []grafanaColumn `json:"columns"`
+	Rows    [][]interface{} `json:"rows"`
+}
+
+type grafanaAnnotationRequest struct {
+	Range      grafanaRange `json:"range"`
+	Annotation struct {
+		Name  string `json:"name"`
+		Query string `json:"query"`
+	} `json:"annotation"`
+}
+
+type grafanaAnnotation struct {
+	Annotation string   `json:"annotation"`
+	Time       int64    `json:"time"`
+	Title      string   `json:"title"`
+	Text       string   `json:"text"`
+	Tags       []string `json:"tags"`
+}
+
+// TestDatasource answers Grafana's "Save & test" check
+func (h *GrafanaHandler) TestDatasource(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"status":"ok"}`))
+}
+
+// Search lists the targets a query can ask for, filtered by the target
+// typed so far
+func (h *GrafanaHandler) Search(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Target string `json:"target"`
+	}
+	// An empty body lists everything
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(grafanaSearch(req.Target))
+}
+
+// Query answers each target with a time series, or with a bucket table for
+// distribution targets
+func (h *GrafanaHandler) Query(w http.ResponseWriter, r *http.Request) {
+	if h.repo == nil {
+		http.Error(w, "repository not configured", http.StatusInternalServerError)
+		return
+	}
+
+	var req grafanaQueryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Range.From.IsZero() || req.Range.To.IsZero() {
+		http.Error(w, "range required", http.StatusBadRequest)
+		return
+	}
+	if err := params.CheckRange(req.Range.From, req.Range.To); err != nil {
+		params.WriteError(w, err)
+		return
+	}
+
+	// Targets may name any app, so each is checked before any is queried
+	appID := r.URL.Query().Get("app_id")
+	targetFilters := make([]grafanaFilters, len(req.Targets))
+	for i, target := range req.Targets {
+		if target.Target == "" {
+			continue
+		}
+		if !grafanaKnownTarget(target.Target) {
+			http.Error(w, "unknown target: "+target.Target, http.StatusBadRequest)
+			return
+		}
+		targetFilters[i] = target.filters(appID, req.AdhocFilters)
+		if !canView(r, targetFilters[i].AppID) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+	}
+
+	ctx := r.Context()
+	interval := grafanaInterval(req.IntervalMs)
+
+	resp := make([]interface{}, 0, len(req.Targets))
+	for i, target := range req.Targets {
+		if target.Target == "" {
+			continue
+		}
+		filters := targetFilters[i]
+
+		if metric, ok := strings.CutPrefix(target.Target, distributionPrefix); ok {
+			dist, err := h.repo.GetDistribution(ctx, filters.AppID, metric, req.Range.From, req.Range.To, filters.AppVersion, filters.Platform, filters.Scene)
+			if err != nil {
+				h.logger.Error("failed to get distribution", zap.Error(err), zap.String("target", target.Target))
+				http.Error(w, "internal error", http.StatusInternalServerError)
+				return
+			}
+			resp = append(resp, distributionTable(target.RefID, dist))
+			continue
+		}
+
+		points, err := h.repo.GetTimeSeries(ctx, filters.AppID, target.Target, req.Range.From, req.Range.To, interval, filters.AppVersion, filters.Platform)
+		if err != nil {
+			h.logger.Error("failed to get time series", zap.Error(err), zap.String("target", target.Target))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		resp = append(resp, timeSeries(target.Target, points))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// Annotations marks when each release was first seen in the range. The
+// annotation query is a query string such as "app_id=game&platform=android",
+// whose app defaults to the app_id query parameter.
+func (h *GrafanaHandler) Annotations(w http.ResponseWriter, r *http.Request) {
+	if h.repo == nil {
+		http.Error(w, "repository not configured", http.StatusInternalServerError)
+		return
+	}
+
+	var req grafanaAnnotationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Range.From.IsZero() || req.Range.To.IsZero() {
+		http.Error(w, "range required", http.StatusBadRequest)
+		return
+	}
+	if err := params.CheckRange(req.Range.From, req.Range.To); err != nil {
+		params.WriteError(w, err)
+		return
+	}
+
+	q, err := url.ParseQuery(req.Annotation.Query)
+	if err != nil {
+		http.Error(w, "invalid annotation query", http.StatusBadRequest)
+		return
+	}
+
+	appID := q.Get("app_id")
+	if appID == "" {
+		appID = r.URL.Query().Get("app_id")
+	}
+	if !canView(r, appID) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	ctx := r.Context()
+	start, end := req.Range.From, req.Range.To
+	releases, err := h.repo.GetReleases(ctx, appID, start, end, q.Get("platform"), adoptionInterval(start, end), nil, 100)
+	if err != nil {
+		h.logger.Error("failed to get releases", zap.Error(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	annotations := []grafanaAnnotation{}
+	for _, rel := range releases {
+		// Releases that shipped before the range are only still in use
+		if rel.FirstSeen.Before(start) {
+			continue
+		}
+		annotations = append(annotations, grafanaAnnotation{
+			Annotation: req.Annotation.Name,
+			Time:       rel.FirstSeen.UnixMilli(),
+			Title:      "Release " + rel.Version,
+			Text:       fmt.Sprintf("%d sessions, %.2f%% crash-free", rel.Sessions, rel.CrashFreeSessionsPct),
+			Tags:       []string{"release", rel.Version},
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(annotations)
+}
+
+// filters merges the target's filters with the dashboard's ad hoc filters.
+// Only equality ad hoc filters apply, and the app defaults to appID.
+func (t grafanaTarget) filters(appID string, adhoc []grafanaAdhocFilter) grafanaFilters {
+	f := grafanaFilters{AppID: appID}
+	if t.Payload != nil {
+		f = *t.Payload
+	} else if t.Data != nil {
+		f = *t.Data
+	}
+	if f.AppID == "" {
+		f.AppID = appID
+	}
+
+	for _, a := range adhoc {
+		if a.Operator != "=" {
+			continue
+		}
+		switch a.Key {
+		case "app_id":
+			f.AppID = a.Value
+		case "app_version":
+			f.AppVersion = a.Value
+		case "platform":
+			f.Platform = a.Value
+		case "scene":
+			f.Scene = a.Value
+		}
+	}
+	return f
+}
+
+// canView reports whether the user of r may view appID, all apps when
+// empty. Grafana requests name their apps in the body, which RequireRole
+// does not see. Without admin auth there is no user and anyone may.
+func canView(r *http.Request, appID string) bool {
+	p := adminauth.PrincipalFromContext(r.Context())
+	return p == nil || p.Can(appID, adminauth.RoleViewer)
+}
+
+// grafanaSearch returns the targets containing term, sorted
+func grafanaSearch(term string) []string {
+	targets := make([]string, 0, len(grafanaTimeSeriesMetrics)+len(grafanaDistributionMetrics))
+	targets = append(targets, grafanaTimeSeriesMetrics...)
+	for _, m := range grafanaDistributionMetrics {
+		targets = append(targets, distributionPrefix+m)
+	}
+
+	matches := []string{}
+	for _, t := range targets {
+		if strings.Contains(t, term) {
+			matches = append(matches, t)
+		}
+	}
+	sort.Strings(matches)
+	return matches
+}
+
+func grafanaKnownTarget(target string) bool {
+	if metric, ok := strings.CutPrefix(target, distributionPrefix); ok {
+		return slices.Contains(grafanaDistributionMetrics, metric)
+	}
+	return slices.Contains(grafanaTimeSeriesMetrics, target)
+}
+
+// grafanaInterval turns the panel's interval into a bucket size, rounded
+// down to whole seconds and at least minGrafanaInterval
+func grafanaInterval(intervalMs int64) time.Duration {
+	interval := time.Duration(intervalMs) * time.Millisecond
+	if interval < minGrafanaInterval {
+		interval = minGrafanaInterval
+	}
+	return interval.Truncate(time.Second)
+}
+
+func timeSeries(target string, points []models.TimeSeriesPoint) grafanaTimeSeries {
+	datapoints := make([][2]float64, len(points))
+	for i, p := range points {
+		datapoints[i] = [2]float64{p.Value, float64(p.Timestamp.UnixMilli())}
+	}
+	return grafanaTimeSeries{Target: target, Datapoints: datapoints}
+}
+
+func distributionTable(refID string, dist *models.DistributionResponse) grafanaTable {
+	table := grafanaTable{
+		Type:  "table",
+		RefID: refID,
+		Columns: []grafanaColumn{
+			{Text: "bucket", Type: "string"},
+			{Text: "count", Type: "number"},
+			{Text: "pct", Type: "number"},
+		},
+		Rows: [][]interface{}{},
+	}
+	for _, b := range dist.Buckets {
+		table.Rows = append(table.Rows, []interface{}{b.Bucket, b.Count, b.Pct})
+	}
+	return table
+}
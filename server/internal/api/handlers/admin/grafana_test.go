@@ -0,0 +1,259 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/warriorguo/ozx_apm/server/internal/adminauth"
+	"github.com/warriorguo/ozx_apm/server/internal/models"
+	"github.com/warriorguo/ozx_apm/server/internal/storage"
+)
+
+// Tests for actual GrafanaHandler with nil repository
+
+func TestNewGrafanaHandler(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	handler := NewGrafanaHandler(nil, logger)
+	if handler == nil {
+		t.Error("expected non-nil handler")
+	}
+}
+
+func TestGrafanaHandler_NilRepo(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	handler := NewGrafanaHandler(nil, logger)
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		body    string
+	}{
+		{"Query", handler.Query, `{"range":{"from":"2024-01-15T00:00:00Z","to":"2024-01-16T00:00:00Z"},"targets":[{"target":"fps"}]}`},
+		{"Annotations", handler.Annotations, `{"range":{"from":"2024-01-15T00:00:00Z","to":"2024-01-16T00:00:00Z"}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/grafana", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+
+			tt.handler(w, req)
+
+			if w.Code != http.StatusInternalServerError {
+				t.Errorf("expected status %d, got %d", http.StatusInternalServerError, w.Code)
+			}
+		})
+	}
+}
+
+func TestGrafanaHandler_TestDatasource(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	handler := NewGrafanaHandler(nil, logger)
+
+	req := httptest.NewRequest(http.MethodGet, "/grafana/", nil)
+	w := httptest.NewRecorder()
+
+	handler.TestDatasource(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+}
+
+func TestGrafanaHandler_Search(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	handler := NewGrafanaHandler(nil, logger)
+
+	tests := []struct {
+		body string
+		want []string
+	}{
+		{`{"target":"frame"}`, []string{"distribution:frame_time", "frame_time"}},
+		{`{"target":"distribution:"}`, []string{"distribution:fps", "distribution:frame_time", "distribution:startup"}},
+		{`{"target":"nope"}`, []string{}},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/grafana/search", strings.NewReader(tt.body))
+		w := httptest.NewRecorder()
+
+		handler.Search(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected status %d, got %d", tt.body, http.StatusOK, w.Code)
+		}
+		var got []string
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatalf("%s: failed to decode: %v", tt.body, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.body, tt.want, got)
+		}
+	}
+}
+
+func TestGrafanaHandler_Search_EmptyBody(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	handler := NewGrafanaHandler(nil, logger)
+
+	req := httptest.NewRequest(http.MethodPost, "/grafana/search", nil)
+	w := httptest.NewRecorder()
+
+	handler.Search(w, req)
+
+	var got []string
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("failed to decode: %v", err)
+	}
+	if want := len(grafanaTimeSeriesMetrics) + len(grafanaDistributionMetrics); len(got) != want {
+		t.Errorf("expected %d targets, got %d", want, len(got))
+	}
+}
+
+func TestGrafanaKnownTarget(t *testing.T) {
+	tests := map[string]bool{
+		"fps":                      true,
+		"crash_free_users":         true,
+		"distribution:startup":     true,
+		"distribution:crashes":     false,
+		"distribution:":            false,
+		"fps; DROP TABLE apm_x --": false,
+	}
+
+	for target, want := range tests {
+		if got := grafanaKnownTarget(target); got != want {
+			t.Errorf("grafanaKnownTarget(%q) = %v, expected %v", target, got, want)
+		}
+	}
+}
+
+func TestGrafanaInterval(t *testing.T) {
+	tests := []struct {
+		intervalMs int64
+		want       time.Duration
+	}{
+		{0, time.Minute},
+		{15000, time.Minute},
+		{300000, 5 * time.Minute},
+		{3601500, 3601 * time.Second},
+	}
+
+	for _, tt := range tests {
+		if got := grafanaInterval(tt.intervalMs); got != tt.want {
+			t.Errorf("grafanaInterval(%d) = %s, expected %s", tt.intervalMs, got, tt.want)
+		}
+	}
+}
+
+func TestGrafanaTarget_Filters(t *testing.T) {
+	target := grafanaTarget{
+		Target:  "fps",
+		Payload: &grafanaFilters{AppID: "game", Platform: "Android"},
+		Data:    &grafanaFilters{AppID: "ignored"},
+	}
+	adhoc := []grafanaAdhocFilter{
+		{Key: "app_version", Operator: "=", Value: "1.2.0"},
+		{Key: "platform", Operator: "=", Value: "iOS"},
+		{Key: "scene", Operator: "!=", Value: "MainMenu"},
+		{Key: "unknown", Operator: "=", Value: "x"},
+	}
+
+	got := target.filters("", adhoc)
+	want := grafanaFilters{AppID: "game", AppVersion: "1.2.0", Platform: "iOS"}
+	if got != want {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+
+	// The older SimpleJSON plugin sends data instead of payload
+	legacy := grafanaTarget{Target: "fps", Data: &grafanaFilters{Scene: "Battle"}}
+	if got := legacy.filters("", nil); got.Scene != "Battle" {
+		t.Errorf("expected scene Battle from data, got %+v", got)
+	}
+
+	// Targets without an app query the app of the request
+	if got := legacy.filters("game", nil); got.AppID != "game" || got.Scene != "Battle" {
+		t.Errorf("expected app game, got %+v", got)
+	}
+	if got := (grafanaTarget{Target: "fps"}).filters("game", nil); got.AppID != "game" {
+		t.Errorf("expected app game without filters, got %+v", got)
+	}
+}
+
+func TestGrafanaHandler_OtherApp(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	// Forbidden queries are rejected before the repository runs them, so an
+	// unconnected one will do
+	handler := NewGrafanaHandler(&storage.Repository{}, logger)
+	viewer := &adminauth.Principal{Username: "bob", Roles: map[string]adminauth.Role{"game": adminauth.RoleViewer}}
+
+	const span = `"range":{"from":"2024-01-15T00:00:00Z","to":"2024-01-16T00:00:00Z"}`
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		query   string
+		body    string
+	}{
+		{"payload", handler.Query, "?app_id=game", `{` + span + `,"targets":[{"target":"fps","payload":{"app_id":"other"}}]}`},
+		{"data", handler.Query, "?app_id=game", `{` + span + `,"targets":[{"target":"fps","data":{"app_id":"other"}}]}`},
+		{"ad hoc filter", handler.Query, "?app_id=game",
+			`{` + span + `,"targets":[{"target":"fps"}],"adhocFilters":[{"key":"app_id","operator":"=","value":"other"}]}`},
+		{"second target", handler.Query, "?app_id=game",
+			`{` + span + `,"targets":[{"target":"fps"},{"target":"distribution:fps","payload":{"app_id":"other"}}]}`},
+		{"all apps", handler.Query, "", `{` + span + `,"targets":[{"target":"fps"}]}`},
+		{"annotations", handler.Annotations, "?app_id=game", `{` + span + `,"annotation":{"query":"app_id=other"}}`},
+		{"all apps annotations", handler.Annotations, "", `{` + span + `}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/grafana/query"+tt.query, strings.NewReader(tt.body))
+			req = req.WithContext(adminauth.WithPrincipal(req.Context(), viewer))
+			w := httptest.NewRecorder()
+
+			tt.handler(w, req)
+
+			if w.Code != http.StatusForbidden {
+				t.Errorf("expected status %d, got %d", http.StatusForbidden, w.Code)
+			}
+		})
+	}
+}
+
+func TestTimeSeries(t *testing.T) {
+	ts := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	series := timeSeries("fps", []models.TimeSeriesPoint{{Timestamp: ts, Value: 59.5}})
+
+	data, err := json.Marshal(series)
+	if err != nil {
+		t.Fatalf("failed to marshal: %v", err)
+	}
+	want := `{"target":"fps","datapoints":[[59.5,1705312800000]]}`
+	if string(data) != want {
+		t.Errorf("expected %s, got %s", want, data)
+	}
+}
+
+func TestDistributionTable(t *testing.T) {
+	dist := &models.DistributionResponse{
+		Metric:  "fps",
+		Buckets: []models.DistributionBucket{{Bucket: "45-60", Count: 10, Pct: 50}},
+	}
+
+	table := distributionTable("A", dist)
+	if table.Type != "table" || table.RefID != "A" {
+		t.Errorf("unexpected table header: %+v", table)
+	}
+	if len(table.Columns) != 3 {
+		t.Errorf("expected 3 columns, got %d", len(table.Columns))
+	}
+	if len(table.Rows) != 1 || table.Rows[0][0] != "45-60" {
+		t.Errorf("unexpected rows: %v", table.Rows)
+	}
+}
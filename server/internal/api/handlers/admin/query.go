@@ -0,0 +1,115 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/warriorguo/ozx_apm/server/internal/api/params"
+	"github.com/warriorguo/ozx_apm/server/internal/models"
+	"github.com/warriorguo/ozx_apm/server/internal/storage"
+)
+
+// MetricQueryHandler serves generic metric queries, for views the fixed
+// dashboard endpoints do not cover
+type MetricQueryHandler struct {
+	repo   *storage.Repository
+	logger *zap.Logger
+}
+
+func NewMetricQueryHandler(repo *storage.Repository, logger *zap.Logger) *MetricQueryHandler {
+	return &MetricQueryHandler{
+		repo:   repo,
+		logger: logger,
+	}
+}
+
+// metricQueryRequest is a MetricQuery with times in any format the query
+// parameters accept. The app comes from the app_id query parameter, which
+// access is checked against; AppID may only repeat it.
+type metricQueryRequest struct {
+	AppID       string                `json:"app_id"`
+	Metric      string                `json:"metric"`
+	Aggregation string                `json:"aggregation"`
+	GroupBy     []string              `json:"group_by"`
+	Filters     []models.MetricFilter `json:"filters"`
+	Bucket      string                `json:"bucket"`
+	StartTime   string                `json:"start_time"`
+	EndTime     string                `json:"end_time"`
+	Limit       int                   `json:"limit"`
+}
+
+// Query aggregates a metric with the requested group-by, filters and bucket
+func (h *MetricQueryHandler) Query(w http.ResponseWriter, r *http.Request) {
+	if h.repo == nil {
+		http.Error(w, "repository not configured", http.StatusInternalServerError)
+		return
+	}
+
+	var req metricQueryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	q, err := req.metricQuery(r.URL.Query().Get("app_id"), time.Now())
+	if err != nil {
+		params.WriteError(w, err)
+		return
+	}
+
+	result, err := h.repo.QueryMetric(r.Context(), q)
+	if err != nil {
+		var invalid *storage.InvalidQueryError
+		if errors.As(err, &invalid) {
+			params.WriteError(w, params.Errors{{Field: invalid.Field, Message: invalid.Message}})
+			return
+		}
+		h.logger.Error("failed to query metric", zap.Error(err), zap.String("metric", q.Metric))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// metricQuery applies the defaults and limits of query parameters to req,
+// for appID
+func (req metricQueryRequest) metricQuery(appID string, now time.Time) (models.MetricQuery, error) {
+	q := models.MetricQuery{
+		AppID:       appID,
+		Metric:      req.Metric,
+		Aggregation: req.Aggregation,
+		GroupBy:     req.GroupBy,
+		Filters:     req.Filters,
+		Bucket:      req.Bucket,
+		Limit:       req.Limit,
+	}
+
+	var errs params.Errors
+	var err error
+	q.StartTime, q.EndTime, err = params.Range(req.StartTime, req.EndTime, now)
+	errors.As(err, &errs)
+
+	if req.AppID != "" && !strings.EqualFold(req.AppID, appID) {
+		errs = append(errs, params.FieldError{Field: "app_id", Message: "must match the app_id query parameter"})
+	}
+
+	switch {
+	case q.Limit == 0:
+		q.Limit = params.DefaultLimit
+	case q.Limit < 0 || q.Limit > params.MaxLimit:
+		errs = append(errs, params.FieldError{Field: "limit", Message: fmt.Sprintf("must be between 1 and %d", params.MaxLimit)})
+	}
+
+	if len(errs) > 0 {
+		return q, errs
+	}
+	return q, nil
+}
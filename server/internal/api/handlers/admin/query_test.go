@@ -0,0 +1,144 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/warriorguo/ozx_apm/server/internal/api/params"
+	"github.com/warriorguo/ozx_apm/server/internal/storage"
+)
+
+// Tests for actual MetricQueryHandler with nil repository
+
+func TestNewMetricQueryHandler(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	handler := NewMetricQueryHandler(nil, logger)
+	if handler == nil {
+		t.Error("expected non-nil handler")
+	}
+}
+
+func TestMetricQueryHandler_Query_NilRepo(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	handler := NewMetricQueryHandler(nil, logger)
+
+	req := httptest.NewRequest(http.MethodPost, "/query", strings.NewReader(`{"metric":"fps","aggregation":"avg"}`))
+	w := httptest.NewRecorder()
+
+	handler.Query(w, req)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("expected status %d, got %d", http.StatusInternalServerError, w.Code)
+	}
+}
+
+func TestMetricQueryHandler_Query_Invalid(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	// Invalid queries are rejected before the repository runs them, so an
+	// unconnected one will do
+	handler := NewMetricQueryHandler(&storage.Repository{}, logger)
+
+	tests := []struct {
+		name  string
+		body  string
+		field string
+	}{
+		{"unknown metric", `{"metric":"cpu","aggregation":"avg"}`, "metric"},
+		{"unknown dimension", `{"metric":"fps","aggregation":"avg","group_by":["user_id"]}`, "group_by[0]"},
+		{"bad operator", `{"metric":"fps","aggregation":"avg","filters":[{"dimension":"platform","op":"like","values":["A%"]}]}`, "filters[0].op"},
+		{"malformed time", `{"metric":"fps","aggregation":"avg","start_time":"last week"}`, "start_time"},
+		{"range too long", `{"metric":"fps","aggregation":"avg","start_time":"-60d"}`, "start_time"},
+		{"limit too large", `{"metric":"fps","aggregation":"avg","limit":5000}`, "limit"},
+		{"app outside the query", `{"app_id":"other","metric":"fps","aggregation":"avg"}`, "app_id"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/query", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+
+			handler.Query(w, req)
+
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("expected status %d, got %d", http.StatusBadRequest, w.Code)
+			}
+			var resp params.ErrorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("failed to decode: %v", err)
+			}
+			if len(resp.Fields) != 1 || resp.Fields[0].Field != tt.field {
+				t.Errorf("expected an error on %s, got %+v", tt.field, resp.Fields)
+			}
+		})
+	}
+}
+
+func TestMetricQueryRequest_Defaults(t *testing.T) {
+	now := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+
+	q, err := metricQueryRequest{Metric: "fps", Aggregation: "avg"}.metricQuery("game", now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !q.EndTime.Equal(now) || q.EndTime.Sub(q.StartTime) != params.DefaultRange {
+		t.Errorf("expected the default range ending now, got %s to %s", q.StartTime, q.EndTime)
+	}
+	if q.Limit != params.DefaultLimit {
+		t.Errorf("expected limit %d, got %d", params.DefaultLimit, q.Limit)
+	}
+	if q.AppID != "game" {
+		t.Errorf("expected the app of the query parameter, got %q", q.AppID)
+	}
+
+	q, err = metricQueryRequest{Metric: "fps", StartTime: "-6h", EndTime: "1705316400000", Limit: 5}.metricQuery("", now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := now.Add(-6 * time.Hour); !q.StartTime.Equal(want) {
+		t.Errorf("expected start %s, got %s", want, q.StartTime)
+	}
+	if want := time.UnixMilli(1705316400000); !q.EndTime.Equal(want) {
+		t.Errorf("expected end %s, got %s", want, q.EndTime)
+	}
+	if q.Limit != 5 {
+		t.Errorf("expected limit 5, got %d", q.Limit)
+	}
+}
+
+func TestMetricQueryRequest_AppID(t *testing.T) {
+	now := time.Now()
+
+	// The body may repeat the app access was checked for, in any case
+	q, err := metricQueryRequest{AppID: "Game", Metric: "fps"}.metricQuery("game", now)
+	if err != nil || q.AppID != "game" {
+		t.Errorf("expected app game, got %q, %v", q.AppID, err)
+	}
+
+	// but not name another one, or any app when the query covers all apps
+	for _, appID := range []string{"other", ""} {
+		_, err := metricQueryRequest{AppID: "game", Metric: "fps"}.metricQuery(appID, now)
+		var errs params.Errors
+		if !errors.As(err, &errs) || len(errs) != 1 || errs[0].Field != "app_id" {
+			t.Errorf("app_id %q: expected an app_id error, got %v", appID, err)
+		}
+	}
+}
+
+func TestMetricQueryRequest_Errors(t *testing.T) {
+	_, err := metricQueryRequest{StartTime: "soon", Limit: -1}.metricQuery("", time.Now())
+
+	var errs params.Errors
+	if !errors.As(err, &errs) || len(errs) != 2 {
+		t.Fatalf("expected two field errors, got %v", err)
+	}
+	if errs[0].Field != "start_time" || errs[1].Field != "limit" {
+		t.Errorf("unexpected fields: %+v", errs)
+	}
+}
@@ -0,0 +1,44 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"github.com/warriorguo/ozx_apm/server/internal/models"
+	"github.com/warriorguo/ozx_apm/server/internal/quota"
+)
+
+// QuotaHandler reports ingest quota usage and throttled traffic
+type QuotaHandler struct {
+	limits *quota.Limits
+	logger *zap.Logger
+}
+
+func NewQuotaHandler(limits *quota.Limits, logger *zap.Logger) *QuotaHandler {
+	return &QuotaHandler{
+		limits: limits,
+		logger: logger,
+	}
+}
+
+// GetQuotas returns today's event counts and throttled requests per app as
+// seen by this server instance
+func (h *QuotaHandler) GetQuotas(w http.ResponseWriter, r *http.Request) {
+	appID := r.URL.Query().Get("app_id")
+
+	usage := []models.QuotaUsage{}
+	if h.limits != nil {
+		for _, u := range h.limits.Usage() {
+			if appID == "" || u.AppID == appID {
+				usage = append(usage, u)
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"apps": usage,
+	})
+}
@@ -0,0 +1,53 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/warriorguo/ozx_apm/server/internal/config"
+	"github.com/warriorguo/ozx_apm/server/internal/models"
+	"github.com/warriorguo/ozx_apm/server/internal/quota"
+)
+
+func TestQuotaHandler_GetQuotas(t *testing.T) {
+	limits := quota.New(config.RateLimitConfig{DailyEvents: 100})
+	limits.AddEvents("game-a", 10)
+	limits.AddEvents("game-b", 20)
+	handler := NewQuotaHandler(limits, zap.NewNop())
+
+	req := httptest.NewRequest(http.MethodGet, "/quotas?app_id=game-b", nil)
+	w := httptest.NewRecorder()
+
+	handler.GetQuotas(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var resp struct {
+		Apps []models.QuotaUsage `json:"apps"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(resp.Apps) != 1 || resp.Apps[0].AppID != "game-b" || resp.Apps[0].EventsToday != 20 {
+		t.Errorf("unexpected response %+v", resp.Apps)
+	}
+}
+
+func TestQuotaHandler_NilLimits(t *testing.T) {
+	handler := NewQuotaHandler(nil, zap.NewNop())
+
+	req := httptest.NewRequest(http.MethodGet, "/quotas", nil)
+	w := httptest.NewRecorder()
+
+	handler.GetQuotas(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+}
@@ -0,0 +1,136 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/warriorguo/ozx_apm/server/internal/api/params"
+	"github.com/warriorguo/ozx_apm/server/internal/models"
+	"github.com/warriorguo/ozx_apm/server/internal/processor"
+	"github.com/warriorguo/ozx_apm/server/internal/storage"
+)
+
+// ReleaseHandler handles release health requests
+type ReleaseHandler struct {
+	repo   *storage.Repository
+	logger *zap.Logger
+}
+
+func NewReleaseHandler(repo *storage.Repository, logger *zap.Logger) *ReleaseHandler {
+	return &ReleaseHandler{
+		repo:   repo,
+		logger: logger,
+	}
+}
+
+// ListReleases returns health of the releases seen in the time range,
+// newest first
+func (h *ReleaseHandler) ListReleases(w http.ResponseWriter, r *http.Request) {
+	if h.repo == nil {
+		http.Error(w, "repository not configured", http.StatusInternalServerError)
+		return
+	}
+
+	ctx := r.Context()
+	q := r.URL.Query()
+	appID := q.Get("app_id")
+
+	p := params.New(r)
+	startTime, endTime := p.TimeRange()
+
+	platform := q.Get("platform")
+
+	limit := p.Limit()
+
+	if err := p.Err(); err != nil {
+		params.WriteError(w, err)
+		return
+	}
+
+	releases, err := h.repo.GetReleases(ctx, appID, startTime, endTime, platform, adoptionInterval(startTime, endTime), nil, limit)
+	if err != nil {
+		h.logger.Error("failed to get releases", zap.Error(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	resp := models.ReleaseListResponse{
+		TimeRange: models.TimeRange{Start: startTime, End: endTime},
+		Releases:  releases,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// CompareReleases returns the health of two releases and the deltas of
+// target against base, flagging statistically significant changes
+func (h *ReleaseHandler) CompareReleases(w http.ResponseWriter, r *http.Request) {
+	if h.repo == nil {
+		http.Error(w, "repository not configured", http.StatusInternalServerError)
+		return
+	}
+
+	ctx := r.Context()
+	q := r.URL.Query()
+	appID := q.Get("app_id")
+
+	base := q.Get("base")
+	target := q.Get("target")
+	if base == "" || target == "" {
+		http.Error(w, "base and target parameters required", http.StatusBadRequest)
+		return
+	}
+
+	p := params.New(r)
+	startTime, endTime := p.TimeRange()
+
+	platform := q.Get("platform")
+
+	if err := p.Err(); err != nil {
+		params.WriteError(w, err)
+		return
+	}
+
+	releases, err := h.repo.GetReleases(ctx, appID, startTime, endTime, platform, adoptionInterval(startTime, endTime), []string{base, target}, 2)
+	if err != nil {
+		h.logger.Error("failed to get releases", zap.Error(err), zap.String("base", base), zap.String("target", target))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	var baseRelease, targetRelease *models.ReleaseHealth
+	for i := range releases {
+		switch releases[i].Version {
+		case base:
+			baseRelease = &releases[i]
+		case target:
+			targetRelease = &releases[i]
+		}
+	}
+	if baseRelease == nil || targetRelease == nil {
+		http.Error(w, "release not found", http.StatusNotFound)
+		return
+	}
+
+	resp := models.ReleaseComparison{
+		TimeRange: models.TimeRange{Start: startTime, End: endTime},
+		Base:      *baseRelease,
+		Target:    *targetRelease,
+		Deltas:    processor.CompareReleases(baseRelease, targetRelease),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// adoptionInterval picks the adoption curve bucket size for a time range
+func adoptionInterval(startTime, endTime time.Time) time.Duration {
+	if endTime.Sub(startTime) > 3*24*time.Hour {
+		return 24 * time.Hour
+	}
+	return time.Hour
+}
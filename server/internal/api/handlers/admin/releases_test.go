@@ -0,0 +1,59 @@
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Tests for actual ReleaseHandler with nil repository
+
+func TestNewReleaseHandler(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	handler := NewReleaseHandler(nil, logger)
+	if handler == nil {
+		t.Error("expected non-nil handler")
+	}
+}
+
+func TestReleaseHandler_ListReleases_NilRepo(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	handler := NewReleaseHandler(nil, logger)
+
+	req := httptest.NewRequest(http.MethodGet, "/releases", nil)
+	w := httptest.NewRecorder()
+
+	handler.ListReleases(w, req)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("expected status %d, got %d", http.StatusInternalServerError, w.Code)
+	}
+}
+
+func TestReleaseHandler_CompareReleases_NilRepo(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	handler := NewReleaseHandler(nil, logger)
+
+	req := httptest.NewRequest(http.MethodGet, "/releases/compare?base=1.0.0&target=1.1.0", nil)
+	w := httptest.NewRecorder()
+
+	handler.CompareReleases(w, req)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("expected status %d, got %d", http.StatusInternalServerError, w.Code)
+	}
+}
+
+func TestAdoptionInterval(t *testing.T) {
+	now := time.Now()
+
+	if got := adoptionInterval(now.Add(-24*time.Hour), now); got != time.Hour {
+		t.Errorf("expected an hour for a day, got %s", got)
+	}
+	if got := adoptionInterval(now.Add(-7*24*time.Hour), now); got != 24*time.Hour {
+		t.Errorf("expected a day for a week, got %s", got)
+	}
+}
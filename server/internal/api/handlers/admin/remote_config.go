@@ -0,0 +1,149 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+
+	"github.com/warriorguo/ozx_apm/server/internal/models"
+	"github.com/warriorguo/ozx_apm/server/internal/processor"
+	"github.com/warriorguo/ozx_apm/server/internal/remoteconfig"
+	"github.com/warriorguo/ozx_apm/server/internal/storage"
+)
+
+// RemoteConfigHandler manages the SDK configuration rules of an app
+type RemoteConfigHandler struct {
+	repo     *storage.Repository
+	remote   *remoteconfig.Store
+	enricher *processor.Enricher
+	logger   *zap.Logger
+}
+
+func NewRemoteConfigHandler(repo *storage.Repository, remote *remoteconfig.Store, logger *zap.Logger) *RemoteConfigHandler {
+	return &RemoteConfigHandler{
+		repo:     repo,
+		remote:   remote,
+		enricher: processor.NewEnricher(),
+		logger:   logger,
+	}
+}
+
+func (h *RemoteConfigHandler) ListConfigs(w http.ResponseWriter, r *http.Request) {
+	if h.repo == nil {
+		http.Error(w, "repository not configured", http.StatusInternalServerError)
+		return
+	}
+
+	appID := chi.URLParam(r, "app_id")
+	if appID == "" {
+		http.Error(w, "app_id parameter required", http.StatusBadRequest)
+		return
+	}
+
+	configs, err := h.repo.ListRemoteConfigs(r.Context(), appID)
+	if err != nil {
+		h.logger.Error("failed to list remote configs", zap.Error(err), zap.String("app_id", appID))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"configs": configs,
+		"default": models.DefaultRemoteConfig(appID),
+	})
+}
+
+// PutConfig creates or replaces the rule for the app_version and platform in
+// the body. Fields left out take their default values. The platform is stored
+// the way ingest normalizes it, e.g. "iOS" for "IPhonePlayer".
+func (h *RemoteConfigHandler) PutConfig(w http.ResponseWriter, r *http.Request) {
+	if h.repo == nil {
+		http.Error(w, "repository not configured", http.StatusInternalServerError)
+		return
+	}
+
+	appID := chi.URLParam(r, "app_id")
+	if appID == "" {
+		http.Error(w, "app_id parameter required", http.StatusBadRequest)
+		return
+	}
+
+	cfg := models.DefaultRemoteConfig(appID)
+	if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
+		http.Error(w, "invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	cfg.AppID = appID
+	cfg.Platform = h.enricher.NormalizePlatform(cfg.Platform)
+	cfg.UpdatedAt = time.Now()
+	if err := validateRemoteConfig(cfg); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.repo.SaveRemoteConfig(r.Context(), cfg); err != nil {
+		h.logger.Error("failed to save remote config", zap.Error(err), zap.String("app_id", appID))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	h.invalidate()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cfg)
+}
+
+// DeleteConfig removes the rule selected by the app_version and platform
+// query parameters; without them the app-wide rule is removed
+func (h *RemoteConfigHandler) DeleteConfig(w http.ResponseWriter, r *http.Request) {
+	if h.repo == nil {
+		http.Error(w, "repository not configured", http.StatusInternalServerError)
+		return
+	}
+
+	appID := chi.URLParam(r, "app_id")
+	if appID == "" {
+		http.Error(w, "app_id parameter required", http.StatusBadRequest)
+		return
+	}
+	q := r.URL.Query()
+
+	if err := h.repo.DeleteRemoteConfig(r.Context(), appID, q.Get("app_version"), h.enricher.NormalizePlatform(q.Get("platform"))); err != nil {
+		h.logger.Error("failed to delete remote config", zap.Error(err), zap.String("app_id", appID))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	h.invalidate()
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// invalidate makes the change visible to this process immediately; other
+// instances pick it up within remoteconfig.CacheTTL
+func (h *RemoteConfigHandler) invalidate() {
+	if h.remote != nil {
+		h.remote.Invalidate()
+	}
+}
+
+func validateRemoteConfig(cfg models.RemoteConfig) error {
+	switch {
+	case cfg.PerfSampleRate < 0 || cfg.PerfSampleRate > 1:
+		return errors.New("perf_sample_rate must be between 0 and 1")
+	case cfg.MaxPerfSamplesPerMin < 0:
+		return errors.New("max_perf_samples_per_min must not be negative")
+	case cfg.SamplingIntervalSeconds <= 0:
+		return errors.New("sampling_interval_seconds must be positive")
+	case cfg.JankThresholdMs <= 0:
+		return errors.New("jank_threshold_ms must be positive")
+	case cfg.BatchSize <= 0:
+		return errors.New("batch_size must be positive")
+	case cfg.FlushIntervalSeconds <= 0:
+		return errors.New("flush_interval_seconds must be positive")
+	}
+	return nil
+}
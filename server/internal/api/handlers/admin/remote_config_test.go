@@ -0,0 +1,66 @@
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/warriorguo/ozx_apm/server/internal/models"
+)
+
+func TestRemoteConfigHandler_NilRepo(t *testing.T) {
+	handler := NewRemoteConfigHandler(nil, nil, zap.NewNop())
+
+	tests := []struct {
+		name    string
+		method  string
+		body    string
+		handler http.HandlerFunc
+	}{
+		{"ListConfigs", http.MethodGet, "", handler.ListConfigs},
+		{"PutConfig", http.MethodPut, `{"perf_sample_rate":0.5}`, handler.PutConfig},
+		{"DeleteConfig", http.MethodDelete, "", handler.DeleteConfig},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/apps/game-a/config", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+
+			tt.handler(w, req)
+
+			if w.Code != http.StatusInternalServerError {
+				t.Errorf("expected status %d, got %d", http.StatusInternalServerError, w.Code)
+			}
+		})
+	}
+}
+
+func TestValidateRemoteConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*models.RemoteConfig)
+		valid  bool
+	}{
+		{"default", func(c *models.RemoteConfig) {}, true},
+		{"zero sample rate", func(c *models.RemoteConfig) { c.PerfSampleRate = 0 }, true},
+		{"sample rate above 1", func(c *models.RemoteConfig) { c.PerfSampleRate = 1.5 }, false},
+		{"negative sample rate", func(c *models.RemoteConfig) { c.PerfSampleRate = -0.1 }, false},
+		{"negative cap", func(c *models.RemoteConfig) { c.MaxPerfSamplesPerMin = -1 }, false},
+		{"zero batch size", func(c *models.RemoteConfig) { c.BatchSize = 0 }, false},
+		{"zero flush interval", func(c *models.RemoteConfig) { c.FlushIntervalSeconds = 0 }, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := models.DefaultRemoteConfig("game-a")
+			tt.modify(&cfg)
+			if err := validateRemoteConfig(cfg); (err == nil) != tt.valid {
+				t.Errorf("validateRemoteConfig() error = %v, want valid %v", err, tt.valid)
+			}
+		})
+	}
+}
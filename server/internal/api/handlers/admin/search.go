@@ -0,0 +1,73 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"github.com/warriorguo/ozx_apm/server/internal/api/params"
+	"github.com/warriorguo/ozx_apm/server/internal/models"
+	"github.com/warriorguo/ozx_apm/server/internal/storage"
+)
+
+// SearchHandler handles full-text search over crashes and exceptions
+type SearchHandler struct {
+	repo   *storage.Repository
+	logger *zap.Logger
+}
+
+func NewSearchHandler(repo *storage.Repository, logger *zap.Logger) *SearchHandler {
+	return &SearchHandler{
+		repo:   repo,
+		logger: logger,
+	}
+}
+
+// Search returns the crash and exception groups whose message or stack
+// contains every word of q, with a highlighted snippet of each
+func (h *SearchHandler) Search(w http.ResponseWriter, r *http.Request) {
+	if h.repo == nil {
+		http.Error(w, "repository not configured", http.StatusInternalServerError)
+		return
+	}
+
+	ctx := r.Context()
+	q := r.URL.Query()
+	appID := q.Get("app_id")
+
+	p := params.New(r)
+	query := p.Required("q")
+	startTime, endTime := p.TimeRange()
+	kind := p.OneOf("kind", "", models.IssueCrash, models.IssueException)
+	limit := p.Limit()
+
+	if err := p.Err(); err != nil {
+		params.WriteError(w, err)
+		return
+	}
+
+	terms := storage.SearchTerms(query)
+	results, err := h.repo.SearchIssues(ctx, appID, terms, kind, startTime, endTime, limit)
+	if err != nil {
+		var invalid *storage.InvalidQueryError
+		if errors.As(err, &invalid) {
+			params.WriteError(w, params.Errors{{Field: invalid.Field, Message: invalid.Message}})
+			return
+		}
+		h.logger.Error("failed to search issues", zap.Error(err), zap.String("q", query))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	resp := models.SearchResponse{
+		Query:     query,
+		Terms:     terms,
+		TimeRange: models.TimeRange{Start: startTime, End: endTime},
+		Results:   results,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,82 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/warriorguo/ozx_apm/server/internal/api/params"
+	"github.com/warriorguo/ozx_apm/server/internal/storage"
+)
+
+// Tests for actual SearchHandler with nil repository
+
+func TestNewSearchHandler(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	handler := NewSearchHandler(nil, logger)
+	if handler == nil {
+		t.Error("expected non-nil handler")
+	}
+}
+
+func TestSearchHandler_Search_NilRepo(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	handler := NewSearchHandler(nil, logger)
+
+	req := httptest.NewRequest(http.MethodGet, "/search?q=NullReferenceException", nil)
+	w := httptest.NewRecorder()
+
+	handler.Search(w, req)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("expected status %d, got %d", http.StatusInternalServerError, w.Code)
+	}
+}
+
+func TestSearchHandler_Search_Invalid(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	// Invalid searches are rejected before the repository runs them, so an
+	// unconnected one will do
+	handler := NewSearchHandler(&storage.Repository{}, logger)
+
+	req := httptest.NewRequest(http.MethodGet, "/search", nil)
+	w := httptest.NewRecorder()
+	handler.Search(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d without q, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		field string
+	}{
+		{"only punctuation", "?q=...", "q"},
+		{"too many words", "?q=a+b+c+d+e+f+g+h+i", "q"},
+		{"unknown kind", "?q=crash&kind=jank", "kind"},
+		{"bad limit", "?q=crash&limit=0", "limit"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/search"+tt.query, nil)
+			w := httptest.NewRecorder()
+
+			handler.Search(w, req)
+
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("expected status %d, got %d", http.StatusBadRequest, w.Code)
+			}
+			var resp params.ErrorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("failed to decode: %v", err)
+			}
+			if len(resp.Fields) != 1 || resp.Fields[0].Field != tt.field {
+				t.Errorf("expected an error on %s, got %+v", tt.field, resp.Fields)
+			}
+		})
+	}
+}
@@ -0,0 +1,203 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+
+	"github.com/warriorguo/ozx_apm/server/internal/api/params"
+	"github.com/warriorguo/ozx_apm/server/internal/models"
+	"github.com/warriorguo/ozx_apm/server/internal/storage"
+)
+
+// SessionHandler handles session-related requests
+type SessionHandler struct {
+	repo   *storage.Repository
+	logger *zap.Logger
+}
+
+func NewSessionHandler(repo *storage.Repository, logger *zap.Logger) *SessionHandler {
+	return &SessionHandler{
+		repo:   repo,
+		logger: logger,
+	}
+}
+
+func (h *SessionHandler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	if h.repo == nil {
+		http.Error(w, "repository not configured", http.StatusInternalServerError)
+		return
+	}
+
+	ctx := r.Context()
+	q := r.URL.Query()
+	appID := q.Get("app_id")
+
+	p := params.New(r)
+	startTime, endTime := p.TimeRange()
+
+	appVersion := q.Get("app_version")
+	platform := q.Get("platform")
+
+	page, pageSize := p.Page()
+
+	if err := p.Err(); err != nil {
+		params.WriteError(w, err)
+		return
+	}
+
+	sessions, totalCount, err := h.repo.GetSessions(ctx, appID, startTime, endTime, appVersion, platform, page, pageSize)
+	if err != nil {
+		h.logger.Error("failed to get sessions", zap.Error(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	resp := models.SessionListResponse{
+		Sessions:   sessions,
+		TotalCount: totalCount,
+		Page:       page,
+		PageSize:   pageSize,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// GetSessionStats returns crash-free session rate and session length statistics
+func (h *SessionHandler) GetSessionStats(w http.ResponseWriter, r *http.Request) {
+	if h.repo == nil {
+		http.Error(w, "repository not configured", http.StatusInternalServerError)
+		return
+	}
+
+	ctx := r.Context()
+	q := r.URL.Query()
+	appID := q.Get("app_id")
+
+	p := params.New(r)
+	startTime, endTime := p.TimeRange()
+
+	appVersion := q.Get("app_version")
+	platform := q.Get("platform")
+
+	if err := p.Err(); err != nil {
+		params.WriteError(w, err)
+		return
+	}
+
+	stats, err := h.repo.GetSessionStats(ctx, appID, startTime, endTime, appVersion, platform)
+	if err != nil {
+		h.logger.Error("failed to get session stats", zap.Error(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+// GetSession returns a single session for drilldown
+func (h *SessionHandler) GetSession(w http.ResponseWriter, r *http.Request) {
+	if h.repo == nil {
+		http.Error(w, "repository not configured", http.StatusInternalServerError)
+		return
+	}
+
+	ctx := r.Context()
+	appID := r.URL.Query().Get("app_id")
+
+	sessionID := chi.URLParam(r, "session_id")
+	if sessionID == "" {
+		http.Error(w, "session_id parameter required", http.StatusBadRequest)
+		return
+	}
+
+	session, err := h.repo.GetSession(ctx, appID, sessionID)
+	if err != nil {
+		h.logger.Error("failed to get session", zap.Error(err), zap.String("session_id", sessionID))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	if session == nil {
+		http.Error(w, "session not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(session)
+}
+
+// GetSessionTimeline returns everything recorded in a session as one
+// time-ordered stream
+func (h *SessionHandler) GetSessionTimeline(w http.ResponseWriter, r *http.Request) {
+	if h.repo == nil {
+		http.Error(w, "repository not configured", http.StatusInternalServerError)
+		return
+	}
+
+	ctx := r.Context()
+	appID := r.URL.Query().Get("app_id")
+
+	sessionID := chi.URLParam(r, "session_id")
+	if sessionID == "" {
+		http.Error(w, "session_id parameter required", http.StatusBadRequest)
+		return
+	}
+
+	p := params.New(r)
+	limit := p.Int("limit", 1000, 1, 10000)
+
+	if err := p.Err(); err != nil {
+		params.WriteError(w, err)
+		return
+	}
+
+	session, err := h.repo.GetSession(ctx, appID, sessionID)
+	if err != nil {
+		h.logger.Error("failed to get session", zap.Error(err), zap.String("session_id", sessionID))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	// Bound the scan by the session's lifetime when it is known; sessions
+	// recorded before apm_sessions existed fall back to the retention window
+	endTime := time.Now()
+	startTime := endTime.Add(-30 * 24 * time.Hour)
+	if session != nil {
+		startTime = session.StartTime.Add(-time.Minute)
+		endTime = session.EndTime.Add(time.Minute)
+	}
+
+	events, truncated, err := h.repo.GetSessionTimeline(ctx, appID, sessionID, startTime, endTime, limit)
+	if err != nil {
+		h.logger.Error("failed to get session timeline", zap.Error(err), zap.String("session_id", sessionID))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	if session == nil && len(events) == 0 {
+		http.Error(w, "session not found", http.StatusNotFound)
+		return
+	}
+
+	resp := models.SessionTimeline{
+		SessionID: sessionID,
+		Session:   session,
+		Events:    events,
+		Truncated: truncated,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// sessionTimelineURL returns the admin API path of a session's timeline
+func sessionTimelineURL(sessionID string) string {
+	return "/api/sessions/" + url.PathEscape(sessionID) + "/timeline"
+}
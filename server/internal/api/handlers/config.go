@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"github.com/warriorguo/ozx_apm/server/internal/api/middleware"
+	"github.com/warriorguo/ozx_apm/server/internal/models"
+	"github.com/warriorguo/ozx_apm/server/internal/processor"
+	"github.com/warriorguo/ozx_apm/server/internal/remoteconfig"
+)
+
+// configMaxAge is how long SDKs may cache their configuration
+const configMaxAge = "max-age=60"
+
+// ConfigHandler serves remote configuration to the SDK
+type ConfigHandler struct {
+	remote   *remoteconfig.Store
+	enricher *processor.Enricher
+	logger   *zap.Logger
+}
+
+// NewConfigHandler creates a ConfigHandler. remote may be nil to serve the
+// default configuration.
+func NewConfigHandler(remote *remoteconfig.Store, logger *zap.Logger) *ConfigHandler {
+	return &ConfigHandler{
+		remote:   remote,
+		enricher: processor.NewEnricher(),
+		logger:   logger,
+	}
+}
+
+// GetConfig returns the configuration for the authenticated app, selected by
+// the app_version and platform query parameters. The platform is normalized
+// the way ingest normalizes it, so SDK names such as "IPhonePlayer" match
+// rules saved for "iOS".
+func (h *ConfigHandler) GetConfig(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	appID := middleware.AppIDFromContext(r.Context())
+
+	cfg := models.DefaultRemoteConfig(appID)
+	if h.remote != nil {
+		cfg = h.remote.Resolve(r.Context(), appID, q.Get("app_version"), h.enricher.NormalizePlatform(q.Get("platform")))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "private, "+configMaxAge)
+	json.NewEncoder(w).Encode(cfg)
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/warriorguo/ozx_apm/server/internal/api/middleware"
+	"github.com/warriorguo/ozx_apm/server/internal/models"
+	"github.com/warriorguo/ozx_apm/server/internal/remoteconfig"
+)
+
+type staticConfigs []models.RemoteConfig
+
+func (s staticConfigs) ListRemoteConfigs(ctx context.Context, appID string) ([]models.RemoteConfig, error) {
+	return s, nil
+}
+
+func TestConfigHandler_GetConfig(t *testing.T) {
+	android := models.DefaultRemoteConfig("game-a")
+	android.Platform = "Android"
+	android.PerfSampleRate = 0.25
+	remote := remoteconfig.New(staticConfigs{android}, time.Minute, zap.NewNop())
+
+	tests := []struct {
+		name     string
+		remote   *remoteconfig.Store
+		platform string
+		wantRate float64
+	}{
+		{"no store", nil, "Android", 1},
+		{"matching rule", remote, "Android", 0.25},
+		{"sdk platform name", remote, "AndroidPlayer", 0.25},
+		{"no matching rule", remote, "iOS", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewConfigHandler(tt.remote, zap.NewNop())
+			req := httptest.NewRequest(http.MethodGet, "/v1/config?platform="+tt.platform, nil)
+			req = req.WithContext(middleware.WithAppID(req.Context(), "game-a"))
+			w := httptest.NewRecorder()
+
+			handler.GetConfig(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+			}
+			var cfg models.RemoteConfig
+			if err := json.NewDecoder(w.Body).Decode(&cfg); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if cfg.AppID != "game-a" || cfg.PerfSampleRate != tt.wantRate {
+				t.Errorf("got app %q rate %v, want game-a rate %v", cfg.AppID, cfg.PerfSampleRate, tt.wantRate)
+			}
+		})
+	}
+}
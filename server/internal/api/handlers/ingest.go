@@ -1,27 +1,43 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"io"
 	"net/http"
+	"strings"
 	"time"
 
 	"go.uber.org/zap"
 
+	"github.com/warriorguo/ozx_apm/server/internal/api/middleware"
+	"github.com/warriorguo/ozx_apm/server/internal/metrics"
 	"github.com/warriorguo/ozx_apm/server/internal/models"
 	"github.com/warriorguo/ozx_apm/server/internal/processor"
 	"github.com/warriorguo/ozx_apm/server/internal/storage"
 )
 
+// PerfSampler decides whether a perf sample is stored, setting its weight
+type PerfSampler interface {
+	SamplePerf(ctx context.Context, sample *models.PerfSample) bool
+}
+
 type IngestHandler struct {
 	repo      *storage.Repository
+	sampler   PerfSampler
+	stats     *processor.Aggregator
 	validator *processor.Validator
 	enricher  *processor.Enricher
 	logger    *zap.Logger
 }
 
-func NewIngestHandler(repo *storage.Repository, logger *zap.Logger) *IngestHandler {
+// NewIngestHandler creates an IngestHandler. sampler may be nil to store
+// every perf sample, and stats nil to skip real-time stats.
+func NewIngestHandler(repo *storage.Repository, sampler PerfSampler, stats *processor.Aggregator, logger *zap.Logger) *IngestHandler {
 	return &IngestHandler{
 		repo:      repo,
+		sampler:   sampler,
+		stats:     stats,
 		validator: processor.NewValidator(),
 		enricher:  processor.NewEnricher(),
 		logger:    logger,
@@ -42,22 +58,128 @@ type EventWrapper struct {
 type IngestResponse struct {
 	Accepted int      `json:"accepted"`
 	Rejected int      `json:"rejected"`
+	Sampled  int      `json:"sampled,omitempty"` // accepted but dropped by server-side sampling
 	Errors   []string `json:"errors,omitempty"`
 }
 
+// event is one decoded SDK event. The pointer matching typ is set, or none
+// if the payload could not be decoded.
+type event struct {
+	typ       models.EventType
+	timestamp int64 // Unix milliseconds
+
+	perf      *models.PerfSample
+	jank      *models.Jank
+	startup   *models.Startup
+	sceneLoad *models.SceneLoad
+	exception *models.Exception
+	crash     *models.Crash
+	session   *models.SessionEvent
+}
+
+// deviceID returns the device the event was sent from, or ""
+func (e event) deviceID() string {
+	switch {
+	case e.perf != nil:
+		return e.perf.DeviceID
+	case e.jank != nil:
+		return e.jank.DeviceID
+	case e.startup != nil:
+		return e.startup.DeviceID
+	case e.sceneLoad != nil:
+		return e.sceneLoad.DeviceID
+	case e.exception != nil:
+		return e.exception.DeviceID
+	case e.crash != nil:
+		return e.crash.DeviceID
+	case e.session != nil:
+		return e.session.DeviceID
+	}
+	return ""
+}
+
+// deviceIDs returns the distinct devices events were sent from, for the
+// per-device rate limit
+func deviceIDs(events []event) []string {
+	seen := make(map[string]bool)
+	var ids []string
+	for _, e := range events {
+		if id := e.deviceID(); id != "" && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
 func (h *IngestHandler) IngestEvents(w http.ResponseWriter, r *http.Request) {
-	var req EventRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid JSON: "+err.Error(), http.StatusBadRequest)
-		return
+	var (
+		events   []event
+		errors   []string
+		rejected int
+	)
+
+	if isProtobuf(r.Header.Get("Content-Type")) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "failed to read body", http.StatusBadRequest)
+			return
+		}
+		events, rejected, err = decodeProtoBatch(body)
+		if err != nil {
+			http.Error(w, "invalid protobuf: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	} else {
+		var req EventRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid JSON: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		events, rejected, errors = decodeJSONEvents(req.Events)
 	}
 
-	if len(req.Events) == 0 {
+	if len(events) == 0 && rejected == 0 {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(IngestResponse{Accepted: 0})
 		return
 	}
 
+	if !middleware.AllowDevices(w, r, deviceIDs(events)) {
+		return
+	}
+
+	// Every row is stamped with the app the request authenticated as
+	res := h.ingest(r.Context(), middleware.AppIDFromContext(r.Context()), events)
+	rejected += res.rejected
+	accepted := res.stored + res.sampled
+
+	h.logger.Info("ingested events",
+		zap.Int("accepted", accepted),
+		zap.Int("rejected", rejected),
+		zap.Int("sampled", res.sampled),
+		zap.String("client_ip", r.RemoteAddr), // In production, extract from X-Forwarded-For
+	)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(IngestResponse{
+		Accepted: accepted,
+		Rejected: rejected,
+		Sampled:  res.sampled,
+		Errors:   errors,
+	})
+}
+
+// ingestResult counts what happened to decoded events
+type ingestResult struct {
+	stored   int
+	sampled  int // valid but dropped by server-side sampling
+	rejected int // failed validation
+}
+
+// ingest stamps decoded events with the app they were sent for, validates
+// them and stores them. It is shared by every ingest format.
+func (h *IngestHandler) ingest(ctx context.Context, appID string, events []event) ingestResult {
 	// Categorize events by type
 	var (
 		perfSamples []models.PerfSample
@@ -66,124 +188,142 @@ func (h *IngestHandler) IngestEvents(w http.ResponseWriter, r *http.Request) {
 		sceneLoads  []models.SceneLoad
 		exceptions  []models.Exception
 		crashes     []models.Crash
-		errors      []string
-		rejected    int
+		sessionEvts int
+		res         ingestResult
 	)
 
-	clientIP := r.RemoteAddr // In production, extract from X-Forwarded-For
+	sessions := processor.NewSessionBuilder()
 
-	for i, rawEvent := range req.Events {
-		var wrapper EventWrapper
-		if err := json.Unmarshal(rawEvent, &wrapper); err != nil {
-			errors = append(errors, "event "+string(rune(i))+": invalid format")
-			rejected++
-			continue
-		}
+	reject := func(typ models.EventType, err error) {
+		res.rejected++
+		metrics.EventsRejected.WithLabelValues(string(typ), rejectReason(err)).Inc()
+	}
 
-		timestamp := time.UnixMilli(wrapper.Timestamp)
-		if timestamp.IsZero() || wrapper.Timestamp == 0 {
+	for _, e := range events {
+		timestamp := time.UnixMilli(e.timestamp)
+		if timestamp.IsZero() || e.timestamp == 0 {
 			timestamp = time.Now()
 		}
 
-		switch models.EventType(wrapper.Type) {
-		case models.EventTypePerfSample:
-			var event models.PerfSample
-			if err := json.Unmarshal(rawEvent, &event); err != nil {
-				rejected++
-				continue
-			}
+		switch {
+		case e.perf != nil:
+			event := e.perf
+			event.AppID = appID
 			event.Timestamp = timestamp
 			event.Platform = h.enricher.NormalizePlatform(event.Platform)
 			event.DeviceModel = h.enricher.NormalizeDeviceModel(event.DeviceModel)
-			if err := h.validator.ValidatePerfSample(&event); err != nil {
-				rejected++
+			if err := h.validator.ValidatePerfSample(event); err != nil {
+				reject(e.typ, err)
 				continue
 			}
-			perfSamples = append(perfSamples, event)
-
-		case models.EventTypeJank:
-			var event models.Jank
-			if err := json.Unmarshal(rawEvent, &event); err != nil {
-				rejected++
+			metrics.EventsAccepted.WithLabelValues(string(e.typ)).Inc()
+			h.record(e)
+			// Sessions see every sample; sampling only thins what is stored
+			sessions.AddPerfSample(event)
+			if h.sampler != nil && !h.sampler.SamplePerf(ctx, event) {
+				res.sampled++
+				metrics.EventsSampled.WithLabelValues(string(e.typ)).Inc()
 				continue
 			}
+			perfSamples = append(perfSamples, *event)
+
+		case e.jank != nil:
+			event := e.jank
+			event.AppID = appID
 			event.Timestamp = timestamp
 			event.Platform = h.enricher.NormalizePlatform(event.Platform)
 			event.DeviceModel = h.enricher.NormalizeDeviceModel(event.DeviceModel)
-			if err := h.validator.ValidateJank(&event); err != nil {
-				rejected++
+			if err := h.validator.ValidateJank(event); err != nil {
+				reject(e.typ, err)
 				continue
 			}
-			janks = append(janks, event)
+			metrics.EventsAccepted.WithLabelValues(string(e.typ)).Inc()
+			h.record(e)
+			janks = append(janks, *event)
+			sessions.AddJank(event)
 
-		case models.EventTypeStartup:
-			var event models.Startup
-			if err := json.Unmarshal(rawEvent, &event); err != nil {
-				rejected++
-				continue
-			}
+		case e.startup != nil:
+			event := e.startup
+			event.AppID = appID
 			event.Timestamp = timestamp
 			event.Platform = h.enricher.NormalizePlatform(event.Platform)
 			event.DeviceModel = h.enricher.NormalizeDeviceModel(event.DeviceModel)
-			if err := h.validator.ValidateStartup(&event); err != nil {
-				rejected++
+			if err := h.validator.ValidateStartup(event); err != nil {
+				reject(e.typ, err)
 				continue
 			}
-			startups = append(startups, event)
+			metrics.EventsAccepted.WithLabelValues(string(e.typ)).Inc()
+			h.record(e)
+			startups = append(startups, *event)
+			sessions.AddStartup(event)
 
-		case models.EventTypeSceneLoad:
-			var event models.SceneLoad
-			if err := json.Unmarshal(rawEvent, &event); err != nil {
-				rejected++
-				continue
-			}
+		case e.sceneLoad != nil:
+			event := e.sceneLoad
+			event.AppID = appID
 			event.Timestamp = timestamp
 			event.Platform = h.enricher.NormalizePlatform(event.Platform)
 			event.DeviceModel = h.enricher.NormalizeDeviceModel(event.DeviceModel)
-			if err := h.validator.ValidateSceneLoad(&event); err != nil {
-				rejected++
+			if err := h.validator.ValidateSceneLoad(event); err != nil {
+				reject(e.typ, err)
 				continue
 			}
-			sceneLoads = append(sceneLoads, event)
+			metrics.EventsAccepted.WithLabelValues(string(e.typ)).Inc()
+			h.record(e)
+			sceneLoads = append(sceneLoads, *event)
+			sessions.AddSceneLoad(event)
 
-		case models.EventTypeException:
-			var event models.Exception
-			if err := json.Unmarshal(rawEvent, &event); err != nil {
-				rejected++
-				continue
-			}
+		case e.exception != nil:
+			event := e.exception
+			event.AppID = appID
 			event.Timestamp = timestamp
 			event.Platform = h.enricher.NormalizePlatform(event.Platform)
 			event.DeviceModel = h.enricher.NormalizeDeviceModel(event.DeviceModel)
-			if err := h.validator.ValidateException(&event); err != nil {
-				rejected++
+			if err := h.validator.ValidateException(event); err != nil {
+				reject(e.typ, err)
 				continue
 			}
-			exceptions = append(exceptions, event)
+			metrics.EventsAccepted.WithLabelValues(string(e.typ)).Inc()
+			h.record(e)
+			exceptions = append(exceptions, *event)
+			sessions.AddException(event)
 
-		case models.EventTypeCrash:
-			var event models.Crash
-			if err := json.Unmarshal(rawEvent, &event); err != nil {
-				rejected++
+		case e.crash != nil:
+			event := e.crash
+			event.AppID = appID
+			event.Timestamp = timestamp
+			event.Platform = h.enricher.NormalizePlatform(event.Platform)
+			event.DeviceModel = h.enricher.NormalizeDeviceModel(event.DeviceModel)
+			if err := h.validator.ValidateCrash(event); err != nil {
+				reject(e.typ, err)
 				continue
 			}
+			metrics.EventsAccepted.WithLabelValues(string(e.typ)).Inc()
+			h.record(e)
+			crashes = append(crashes, *event)
+			sessions.AddCrash(event)
+
+		case e.session != nil:
+			event := e.session
+			event.AppID = appID
 			event.Timestamp = timestamp
 			event.Platform = h.enricher.NormalizePlatform(event.Platform)
 			event.DeviceModel = h.enricher.NormalizeDeviceModel(event.DeviceModel)
-			if err := h.validator.ValidateCrash(&event); err != nil {
-				rejected++
+			if err := h.validator.ValidateSessionEvent(event); err != nil {
+				reject(e.typ, err)
 				continue
 			}
-			crashes = append(crashes, event)
+			metrics.EventsAccepted.WithLabelValues(string(e.typ)).Inc()
+			h.record(e)
+			sessionEvts++
+			sessions.AddSessionEvent(event)
 
 		default:
-			rejected++
+			res.rejected++
+			countDecodeReject(e.typ, "malformed")
 		}
 	}
 
 	// Insert events into ClickHouse
-	ctx := r.Context()
-
 	if len(perfSamples) > 0 {
 		if err := h.repo.InsertPerfSamples(ctx, perfSamples); err != nil {
 			h.logger.Error("failed to insert perf samples", zap.Error(err))
@@ -215,18 +355,115 @@ func (h *IngestHandler) IngestEvents(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	accepted := len(perfSamples) + len(janks) + len(startups) + len(sceneLoads) + len(exceptions) + len(crashes)
+	if sessionRows := sessions.Sessions(); len(sessionRows) > 0 {
+		if err := h.repo.InsertSessions(ctx, sessionRows); err != nil {
+			h.logger.Error("failed to insert sessions", zap.Error(err))
+		}
+	}
 
-	h.logger.Info("ingested events",
-		zap.Int("accepted", accepted),
-		zap.Int("rejected", rejected),
-		zap.String("client_ip", clientIP),
-	)
+	res.stored = len(perfSamples) + len(janks) + len(startups) + len(sceneLoads) + len(exceptions) + len(crashes) + sessionEvts
+	middleware.CountEvents(ctx, res.stored)
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(IngestResponse{
-		Accepted: accepted,
-		Rejected: rejected,
-		Errors:   errors,
-	})
+	return res
+}
+
+// record feeds a validated event into the real-time stats
+func (h *IngestHandler) record(e event) {
+	if h.stats == nil {
+		return
+	}
+	switch {
+	case e.perf != nil:
+		h.stats.RecordSession(e.perf.AppID, e.perf.AppVersion, e.perf.SessionID)
+		h.stats.RecordFPS(e.perf.AppID, e.perf.Platform, e.perf.FPS)
+	case e.jank != nil:
+		h.stats.RecordSession(e.jank.AppID, e.jank.AppVersion, e.jank.SessionID)
+		h.stats.RecordJank(e.jank.AppID, e.jank.AppVersion, e.jank.SessionID)
+	case e.startup != nil:
+		h.stats.RecordSession(e.startup.AppID, e.startup.AppVersion, e.startup.SessionID)
+		h.stats.RecordStartup(e.startup.AppID, e.startup.Platform, e.startup.TTIMs)
+	case e.sceneLoad != nil:
+		h.stats.RecordSession(e.sceneLoad.AppID, e.sceneLoad.AppVersion, e.sceneLoad.SessionID)
+	case e.exception != nil:
+		h.stats.RecordSession(e.exception.AppID, e.exception.AppVersion, e.exception.SessionID)
+		h.stats.RecordException(e.exception.AppID, e.exception.AppVersion, e.exception.SessionID)
+	case e.crash != nil:
+		h.stats.RecordSession(e.crash.AppID, e.crash.AppVersion, e.crash.SessionID)
+		h.stats.RecordCrash(e.crash.AppID, e.crash.AppVersion, e.crash.SessionID)
+	case e.session != nil:
+		h.stats.RecordSession(e.session.AppID, e.session.AppVersion, e.session.SessionID)
+	}
+}
+
+// decodeJSONEvents decodes the events of a JSON batch. Each event is parsed
+// once for its type and again into its model.
+func decodeJSONEvents(rawEvents []json.RawMessage) (events []event, rejected int, errors []string) {
+	events = make([]event, 0, len(rawEvents))
+	for i, rawEvent := range rawEvents {
+		var wrapper EventWrapper
+		if err := json.Unmarshal(rawEvent, &wrapper); err != nil {
+			errors = append(errors, "event "+string(rune(i))+": invalid format")
+			rejected++
+			countDecodeReject("", "malformed")
+			continue
+		}
+
+		e := event{typ: models.EventType(wrapper.Type), timestamp: wrapper.Timestamp}
+		var target interface{}
+		switch e.typ {
+		case models.EventTypePerfSample:
+			e.perf = &models.PerfSample{}
+			target = e.perf
+		case models.EventTypeJank:
+			e.jank = &models.Jank{}
+			target = e.jank
+		case models.EventTypeStartup:
+			e.startup = &models.Startup{}
+			target = e.startup
+		case models.EventTypeSceneLoad:
+			e.sceneLoad = &models.SceneLoad{}
+			target = e.sceneLoad
+		case models.EventTypeException:
+			e.exception = &models.Exception{}
+			target = e.exception
+		case models.EventTypeCrash:
+			e.crash = &models.Crash{}
+			target = e.crash
+		case models.EventTypeSessionStart, models.EventTypeSessionEnd:
+			e.session = &models.SessionEvent{}
+			target = e.session
+		default:
+			rejected++
+			countDecodeReject(e.typ, "unknown_type")
+			continue
+		}
+
+		if err := json.Unmarshal(rawEvent, target); err != nil {
+			rejected++
+			countDecodeReject(e.typ, "malformed")
+			continue
+		}
+		events = append(events, e)
+	}
+	return events, rejected, errors
+}
+
+// rejectReason turns a validation error into a metric label. The validator
+// only returns a fixed set of errors, so the label stays bounded.
+func rejectReason(err error) string {
+	return strings.ReplaceAll(err.Error(), " ", "_")
+}
+
+// countDecodeReject counts an event that could not be decoded. Types the
+// server does not know share one label, so clients cannot inflate the
+// metric's cardinality.
+func countDecodeReject(typ models.EventType, reason string) {
+	switch typ {
+	case models.EventTypePerfSample, models.EventTypeJank, models.EventTypeStartup,
+		models.EventTypeSceneLoad, models.EventTypeException, models.EventTypeCrash,
+		models.EventTypeSessionStart, models.EventTypeSessionEnd:
+	default:
+		typ = "unknown"
+	}
+	metrics.EventsRejected.WithLabelValues(string(typ), reason).Inc()
 }
@@ -0,0 +1,393 @@
+package handlers
+
+import (
+	"errors"
+	"math"
+	"mime"
+
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/warriorguo/ozx_apm/server/internal/models"
+)
+
+// Protobuf batches follow server/proto/ozx_apm/v1/events.proto. They are
+// decoded straight into the models structs with protowire, so no generated
+// code is needed and unknown fields from newer SDKs are skipped.
+
+// isProtobuf reports whether a Content-Type selects the protobuf format
+func isProtobuf(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	switch mediaType {
+	case "application/x-protobuf", "application/protobuf", "application/vnd.ozx-apm.events.v1+protobuf":
+		return true
+	}
+	return false
+}
+
+// Field numbers of the Event message
+const (
+	fieldEventType        protowire.Number = 1
+	fieldEventTimestamp   protowire.Number = 2
+	fieldEventAppVersion  protowire.Number = 3
+	fieldEventPlatform    protowire.Number = 4
+	fieldEventDeviceModel protowire.Number = 5
+	fieldEventOSVersion   protowire.Number = 6
+	fieldEventSessionID   protowire.Number = 7
+	fieldEventDeviceID    protowire.Number = 8
+	fieldEventScene       protowire.Number = 9
+	fieldEventUserID      protowire.Number = 10
+
+	fieldEventPerfSample protowire.Number = 16
+	fieldEventJank       protowire.Number = 17
+	fieldEventStartup    protowire.Number = 18
+	fieldEventSceneLoad  protowire.Number = 19
+	fieldEventException  protowire.Number = 20
+	fieldEventCrash      protowire.Number = 21
+)
+
+// decodeProtoBatch decodes a Batch message. A malformed batch is an error;
+// a malformed or unknown event is only rejected.
+func decodeProtoBatch(b []byte) (events []event, rejected int, err error) {
+	err = protoFields(b, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		if num != 1 || typ != protowire.BytesType {
+			return 0
+		}
+		v, n := protowire.ConsumeBytes(b)
+		if n < 0 {
+			return n
+		}
+		e, err := decodeProtoEvent(v)
+		if err != nil {
+			rejected++
+			reason := "malformed"
+			if err == errUnknownEventType {
+				reason = "unknown_type"
+			}
+			countDecodeReject(e.typ, reason)
+			return n
+		}
+		events = append(events, e)
+		return n
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return events, rejected, nil
+}
+
+var errUnknownEventType = errors.New("unknown event type")
+
+func decodeProtoEvent(b []byte) (event, error) {
+	var (
+		e          event
+		common     models.SessionEvent
+		payloadNum protowire.Number
+		payload    []byte
+	)
+
+	err := protoFields(b, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch num {
+		case fieldEventType:
+			var t string
+			n := protoString(typ, b, &t)
+			e.typ = models.EventType(t)
+			return n
+		case fieldEventTimestamp:
+			return protoInt64(typ, b, &e.timestamp)
+		case fieldEventAppVersion:
+			return protoString(typ, b, &common.AppVersion)
+		case fieldEventPlatform:
+			return protoString(typ, b, &common.Platform)
+		case fieldEventDeviceModel:
+			return protoString(typ, b, &common.DeviceModel)
+		case fieldEventOSVersion:
+			return protoString(typ, b, &common.OSVersion)
+		case fieldEventSessionID:
+			return protoString(typ, b, &common.SessionID)
+		case fieldEventDeviceID:
+			return protoString(typ, b, &common.DeviceID)
+		case fieldEventScene:
+			return protoString(typ, b, &common.Scene)
+		case fieldEventUserID:
+			return protoString(typ, b, &common.UserID)
+		case fieldEventPerfSample, fieldEventJank, fieldEventStartup,
+			fieldEventSceneLoad, fieldEventException, fieldEventCrash:
+			if typ != protowire.BytesType {
+				return 0
+			}
+			v, n := protowire.ConsumeBytes(b)
+			if n >= 0 {
+				payloadNum, payload = num, v
+			}
+			return n
+		}
+		return 0
+	})
+	if err != nil {
+		return e, err
+	}
+
+	// A payload for another type than the event's is ignored
+	payloadFor := func(num protowire.Number) []byte {
+		if payloadNum == num {
+			return payload
+		}
+		return nil
+	}
+
+	switch e.typ {
+	case models.EventTypePerfSample:
+		e.perf = &models.PerfSample{
+			AppVersion:  common.AppVersion,
+			Platform:    common.Platform,
+			DeviceModel: common.DeviceModel,
+			OSVersion:   common.OSVersion,
+			SessionID:   common.SessionID,
+			DeviceID:    common.DeviceID,
+			Scene:       common.Scene,
+		}
+		err = decodeProtoPerfSample(payloadFor(fieldEventPerfSample), e.perf)
+
+	case models.EventTypeJank:
+		e.jank = &models.Jank{
+			AppVersion:  common.AppVersion,
+			Platform:    common.Platform,
+			DeviceModel: common.DeviceModel,
+			OSVersion:   common.OSVersion,
+			SessionID:   common.SessionID,
+			DeviceID:    common.DeviceID,
+			Scene:       common.Scene,
+		}
+		err = decodeProtoJank(payloadFor(fieldEventJank), e.jank)
+
+	case models.EventTypeStartup:
+		e.startup = &models.Startup{
+			AppVersion:  common.AppVersion,
+			Platform:    common.Platform,
+			DeviceModel: common.DeviceModel,
+			OSVersion:   common.OSVersion,
+			SessionID:   common.SessionID,
+			DeviceID:    common.DeviceID,
+		}
+		err = decodeProtoStartup(payloadFor(fieldEventStartup), e.startup)
+
+	case models.EventTypeSceneLoad:
+		e.sceneLoad = &models.SceneLoad{
+			AppVersion:  common.AppVersion,
+			Platform:    common.Platform,
+			DeviceModel: common.DeviceModel,
+			SessionID:   common.SessionID,
+			DeviceID:    common.DeviceID,
+		}
+		err = decodeProtoSceneLoad(payloadFor(fieldEventSceneLoad), e.sceneLoad)
+
+	case models.EventTypeException:
+		e.exception = &models.Exception{
+			AppVersion:  common.AppVersion,
+			Platform:    common.Platform,
+			DeviceModel: common.DeviceModel,
+			OSVersion:   common.OSVersion,
+			SessionID:   common.SessionID,
+			DeviceID:    common.DeviceID,
+			Scene:       common.Scene,
+		}
+		err = decodeProtoException(payloadFor(fieldEventException), e.exception)
+
+	case models.EventTypeCrash:
+		e.crash = &models.Crash{
+			AppVersion:  common.AppVersion,
+			Platform:    common.Platform,
+			DeviceModel: common.DeviceModel,
+			OSVersion:   common.OSVersion,
+			SessionID:   common.SessionID,
+			DeviceID:    common.DeviceID,
+			Scene:       common.Scene,
+		}
+		err = decodeProtoCrash(payloadFor(fieldEventCrash), e.crash)
+
+	case models.EventTypeSessionStart, models.EventTypeSessionEnd:
+		e.session = &common
+
+	default:
+		return e, errUnknownEventType
+	}
+
+	return e, err
+}
+
+func decodeProtoPerfSample(b []byte, s *models.PerfSample) error {
+	return protoFields(b, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch num {
+		case 1:
+			return protoFloat(typ, b, &s.FPS)
+		case 2:
+			return protoFloat(typ, b, &s.FrameTimeMs)
+		case 3:
+			return protoFloat(typ, b, &s.MainThreadMs)
+		case 4:
+			return protoFloat(typ, b, &s.GCAllocKB)
+		case 5:
+			return protoFloat(typ, b, &s.MemMB)
+		}
+		return 0
+	})
+}
+
+func decodeProtoJank(b []byte, j *models.Jank) error {
+	return protoFields(b, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch num {
+		case 1:
+			return protoFloat(typ, b, &j.DurationMs)
+		case 2:
+			return protoFloat(typ, b, &j.MaxFrameMs)
+		case 3:
+			return protoUint32(typ, b, &j.RecentGCCount)
+		case 4:
+			return protoFloat(typ, b, &j.RecentGCAllocKB)
+		case 5:
+			return protoStrings(typ, b, &j.RecentEvents)
+		}
+		return 0
+	})
+}
+
+func decodeProtoStartup(b []byte, s *models.Startup) error {
+	return protoFields(b, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch num {
+		case 1:
+			return protoFloat(typ, b, &s.Phase1Ms)
+		case 2:
+			return protoFloat(typ, b, &s.Phase2Ms)
+		case 3:
+			return protoFloat(typ, b, &s.TTIMs)
+		}
+		return 0
+	})
+}
+
+func decodeProtoSceneLoad(b []byte, s *models.SceneLoad) error {
+	return protoFields(b, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch num {
+		case 1:
+			return protoString(typ, b, &s.SceneName)
+		case 2:
+			return protoFloat(typ, b, &s.LoadMs)
+		case 3:
+			return protoFloat(typ, b, &s.ActivateMs)
+		}
+		return 0
+	})
+}
+
+func decodeProtoException(b []byte, x *models.Exception) error {
+	return protoFields(b, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch num {
+		case 1:
+			return protoString(typ, b, &x.Fingerprint)
+		case 2:
+			return protoString(typ, b, &x.Message)
+		case 3:
+			return protoString(typ, b, &x.Stack)
+		case 4:
+			return protoUint32(typ, b, &x.Count)
+		}
+		return 0
+	})
+}
+
+func decodeProtoCrash(b []byte, c *models.Crash) error {
+	return protoFields(b, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch num {
+		case 1:
+			return protoString(typ, b, &c.CrashType)
+		case 2:
+			return protoString(typ, b, &c.Fingerprint)
+		case 3:
+			return protoString(typ, b, &c.Stack)
+		case 4:
+			return protoStrings(typ, b, &c.Breadcrumbs)
+		}
+		return 0
+	})
+}
+
+// protoFields calls fn for each field of a message. fn returns the bytes it
+// consumed, 0 to skip the field, or a negative protowire error code.
+func protoFields(b []byte, fn func(num protowire.Number, typ protowire.Type, b []byte) int) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		n = fn(num, typ, b)
+		if n == 0 {
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+	}
+	return nil
+}
+
+// The helpers below decode one field value. A wire type that does not match
+// the schema returns 0 so the field is skipped.
+
+func protoString(typ protowire.Type, b []byte, dst *string) int {
+	if typ != protowire.BytesType {
+		return 0
+	}
+	v, n := protowire.ConsumeBytes(b)
+	if n >= 0 {
+		*dst = string(v)
+	}
+	return n
+}
+
+func protoStrings(typ protowire.Type, b []byte, dst *[]string) int {
+	var s string
+	n := protoString(typ, b, &s)
+	if n > 0 {
+		*dst = append(*dst, s)
+	}
+	return n
+}
+
+func protoFloat(typ protowire.Type, b []byte, dst *float32) int {
+	if typ != protowire.Fixed32Type {
+		return 0
+	}
+	v, n := protowire.ConsumeFixed32(b)
+	if n >= 0 {
+		*dst = math.Float32frombits(v)
+	}
+	return n
+}
+
+func protoUint32(typ protowire.Type, b []byte, dst *uint32) int {
+	if typ != protowire.VarintType {
+		return 0
+	}
+	v, n := protowire.ConsumeVarint(b)
+	if n >= 0 {
+		*dst = uint32(v)
+	}
+	return n
+}
+
+func protoInt64(typ protowire.Type, b []byte, dst *int64) int {
+	if typ != protowire.VarintType {
+		return 0
+	}
+	v, n := protowire.ConsumeVarint(b)
+	if n >= 0 {
+		*dst = int64(v)
+	}
+	return n
+}
@@ -0,0 +1,299 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/warriorguo/ozx_apm/server/internal/models"
+)
+
+// protoField is a field of a test message: a string, float32, uint32, int64,
+// []string or a nested message ([]protoField)
+type protoField struct {
+	num   protowire.Number
+	value interface{}
+}
+
+func appendProto(b []byte, fields []protoField) []byte {
+	for _, f := range fields {
+		switch v := f.value.(type) {
+		case string:
+			b = protowire.AppendTag(b, f.num, protowire.BytesType)
+			b = protowire.AppendString(b, v)
+		case []string:
+			for _, s := range v {
+				b = protowire.AppendTag(b, f.num, protowire.BytesType)
+				b = protowire.AppendString(b, s)
+			}
+		case float32:
+			b = protowire.AppendTag(b, f.num, protowire.Fixed32Type)
+			b = protowire.AppendFixed32(b, math.Float32bits(v))
+		case uint32:
+			b = protowire.AppendTag(b, f.num, protowire.VarintType)
+			b = protowire.AppendVarint(b, uint64(v))
+		case int64:
+			b = protowire.AppendTag(b, f.num, protowire.VarintType)
+			b = protowire.AppendVarint(b, uint64(v))
+		case []protoField:
+			b = protowire.AppendTag(b, f.num, protowire.BytesType)
+			b = protowire.AppendBytes(b, appendProto(nil, v))
+		}
+	}
+	return b
+}
+
+func protoBatch(events ...[]protoField) []byte {
+	var b []byte
+	for _, e := range events {
+		b = appendProto(b, []protoField{{1, e}})
+	}
+	return b
+}
+
+func TestDecodeProtoBatch(t *testing.T) {
+	body := protoBatch(
+		[]protoField{
+			{fieldEventType, "perf_sample"},
+			{fieldEventTimestamp, int64(1705315800000)},
+			{fieldEventAppVersion, "1.0.0"},
+			{fieldEventPlatform, "Android"},
+			{fieldEventSessionID, "s1"},
+			{fieldEventScene, "Battle"},
+			{99, "field from a newer SDK"},
+			{fieldEventPerfSample, []protoField{{1, float32(58.5)}, {2, float32(17.1)}, {5, float32(512)}}},
+		},
+		[]protoField{
+			{fieldEventType, "crash"},
+			{fieldEventSessionID, "s1"},
+			{fieldEventCrash, []protoField{{1, "native"}, {3, "at Foo()"}, {4, []string{"a", "b"}}}},
+		},
+		[]protoField{
+			{fieldEventType, "session_start"},
+			{fieldEventSessionID, "s2"},
+			{fieldEventUserID, "u1"},
+		},
+		[]protoField{{fieldEventType, "unknown_type"}},
+		// Payload for another type is ignored
+		[]protoField{
+			{fieldEventType, "startup"},
+			{fieldEventPerfSample, []protoField{{1, float32(60)}}},
+		},
+	)
+
+	events, rejected, err := decodeProtoBatch(body)
+	if err != nil {
+		t.Fatalf("decodeProtoBatch() error = %v", err)
+	}
+	if rejected != 1 {
+		t.Errorf("expected 1 rejected, got %d", rejected)
+	}
+	if len(events) != 4 {
+		t.Fatalf("expected 4 events, got %d", len(events))
+	}
+
+	wantPerf := &models.PerfSample{
+		AppVersion:  "1.0.0",
+		Platform:    "Android",
+		SessionID:   "s1",
+		Scene:       "Battle",
+		FPS:         58.5,
+		FrameTimeMs: 17.1,
+		MemMB:       512,
+	}
+	if events[0].timestamp != 1705315800000 || !reflect.DeepEqual(events[0].perf, wantPerf) {
+		t.Errorf("perf sample = %+v at %d, want %+v", events[0].perf, events[0].timestamp, wantPerf)
+	}
+
+	wantCrash := &models.Crash{SessionID: "s1", CrashType: "native", Stack: "at Foo()", Breadcrumbs: []string{"a", "b"}}
+	if !reflect.DeepEqual(events[1].crash, wantCrash) {
+		t.Errorf("crash = %+v, want %+v", events[1].crash, wantCrash)
+	}
+
+	if s := events[2].session; s == nil || s.SessionID != "s2" || s.UserID != "u1" {
+		t.Errorf("unexpected session event %+v", s)
+	}
+
+	if s := events[3].startup; s == nil || s.Phase1Ms != 0 {
+		t.Errorf("expected empty startup, got %+v", s)
+	}
+}
+
+func TestDecodeProtoBatch_Malformed(t *testing.T) {
+	tests := []struct {
+		name         string
+		body         []byte
+		wantErr      bool
+		wantRejected int
+	}{
+		{"truncated batch", protoBatch([]protoField{{fieldEventType, "jank"}})[:3], true, 0},
+		{"invalid tag", []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, true, 0},
+		{"malformed event", appendProto(nil, []protoField{{1, string([]byte{0x0a, 0x05, 'a'})}}), false, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, rejected, err := decodeProtoBatch(tt.body)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodeProtoBatch() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if rejected != tt.wantRejected {
+				t.Errorf("expected %d rejected, got %d", tt.wantRejected, rejected)
+			}
+		})
+	}
+}
+
+func TestIsProtobuf(t *testing.T) {
+	tests := []struct {
+		contentType string
+		want        bool
+	}{
+		{"application/x-protobuf", true},
+		{"application/protobuf; charset=binary", true},
+		{"application/vnd.ozx-apm.events.v1+protobuf", true},
+		{"application/json", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := isProtobuf(tt.contentType); got != tt.want {
+			t.Errorf("isProtobuf(%q) = %v, want %v", tt.contentType, got, tt.want)
+		}
+	}
+}
+
+func TestIngestHandler_IngestEvents_Protobuf(t *testing.T) {
+	handler := NewIngestHandler(nil, nil, nil, zap.NewNop())
+
+	body := protoBatch([]protoField{{fieldEventType, "unknown_type"}})
+	req := httptest.NewRequest(http.MethodPost, "/v1/events", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	w := httptest.NewRecorder()
+
+	handler.IngestEvents(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	var resp IngestResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if resp.Rejected != 1 {
+		t.Errorf("expected 1 rejected, got %d", resp.Rejected)
+	}
+}
+
+func TestIngestHandler_IngestEvents_InvalidProtobuf(t *testing.T) {
+	handler := NewIngestHandler(nil, nil, nil, zap.NewNop())
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/events", bytes.NewReader([]byte{0x0a, 0x10}))
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	w := httptest.NewRecorder()
+
+	handler.IngestEvents(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+// benchmarkBatch returns the same batch of perf samples and janks in both
+// formats
+func benchmarkBatch(n int) (jsonBody, protoBody []byte) {
+	var rawEvents []map[string]interface{}
+	var protoEvents [][]protoField
+	for i := 0; i < n; i++ {
+		common := map[string]interface{}{
+			"timestamp":    int64(1705315800000 + i),
+			"app_version":  "1.2.3",
+			"platform":     "Android",
+			"device_model": "Pixel 7",
+			"os_version":   "14",
+			"session_id":   "0b6f3c1e-5d2a-4a8e-9c57-2f1d8e7a6b40",
+			"device_id":    "c5a1e2d3-7f6b-4c8a-9e0d-1b2c3d4e5f60",
+			"scene":        "Battle",
+		}
+		event := []protoField{
+			{fieldEventTimestamp, int64(1705315800000 + i)},
+			{fieldEventAppVersion, "1.2.3"},
+			{fieldEventPlatform, "Android"},
+			{fieldEventDeviceModel, "Pixel 7"},
+			{fieldEventOSVersion, "14"},
+			{fieldEventSessionID, "0b6f3c1e-5d2a-4a8e-9c57-2f1d8e7a6b40"},
+			{fieldEventDeviceID, "c5a1e2d3-7f6b-4c8a-9e0d-1b2c3d4e5f60"},
+			{fieldEventScene, "Battle"},
+		}
+
+		if i%10 == 0 {
+			common["type"] = "jank"
+			common["duration_ms"] = 120.5
+			common["max_frame_ms"] = 80.25
+			common["recent_gc_count"] = 2
+			common["recent_events"] = []string{"scene:Battle", "spawn:boss"}
+			event = append(event,
+				protoField{fieldEventType, "jank"},
+				protoField{fieldEventJank, []protoField{
+					{1, float32(120.5)}, {2, float32(80.25)}, {3, uint32(2)}, {5, []string{"scene:Battle", "spawn:boss"}},
+				}},
+			)
+		} else {
+			common["type"] = "perf_sample"
+			common["fps"] = 58.5
+			common["frame_time_ms"] = 17.1
+			common["main_thread_ms"] = 9.4
+			common["gc_alloc_kb"] = 12.5
+			common["mem_mb"] = 512.0
+			event = append(event,
+				protoField{fieldEventType, "perf_sample"},
+				protoField{fieldEventPerfSample, []protoField{
+					{1, float32(58.5)}, {2, float32(17.1)}, {3, float32(9.4)}, {4, float32(12.5)}, {5, float32(512)},
+				}},
+			)
+		}
+		rawEvents = append(rawEvents, common)
+		protoEvents = append(protoEvents, event)
+	}
+
+	jsonBody, _ = json.Marshal(map[string]interface{}{"events": rawEvents})
+	return jsonBody, protoBatch(protoEvents...)
+}
+
+func BenchmarkDecodeBatch(b *testing.B) {
+	for _, n := range []int{20, 200} {
+		jsonBody, protoBody := benchmarkBatch(n)
+
+		b.Run(fmt.Sprintf("JSON/%d", n), func(b *testing.B) {
+			b.SetBytes(int64(len(jsonBody)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				var req EventRequest
+				if err := json.NewDecoder(bytes.NewReader(jsonBody)).Decode(&req); err != nil {
+					b.Fatal(err)
+				}
+				if events, _, _ := decodeJSONEvents(req.Events); len(events) != n {
+					b.Fatalf("decoded %d events", len(events))
+				}
+			}
+		})
+
+		b.Run(fmt.Sprintf("Protobuf/%d", n), func(b *testing.B) {
+			b.SetBytes(int64(len(protoBody)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if events, _, err := decodeProtoBatch(protoBody); err != nil || len(events) != n {
+					b.Fatalf("decoded %d events: %v", len(events), err)
+				}
+			}
+		})
+	}
+}
@@ -6,15 +6,21 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"go.uber.org/zap"
 
+	"github.com/warriorguo/ozx_apm/server/internal/api/middleware"
+	"github.com/warriorguo/ozx_apm/server/internal/config"
+	"github.com/warriorguo/ozx_apm/server/internal/metrics"
 	"github.com/warriorguo/ozx_apm/server/internal/models"
+	"github.com/warriorguo/ozx_apm/server/internal/quota"
 )
 
 func TestIngestHandler_IngestEvents_EmptyBody(t *testing.T) {
 	logger, _ := zap.NewDevelopment()
-	handler := NewIngestHandler(nil, logger)
+	handler := NewIngestHandler(nil, nil, nil, logger)
 
 	req := httptest.NewRequest(http.MethodPost, "/v1/events", nil)
 	req.Header.Set("Content-Type", "application/json")
@@ -29,7 +35,7 @@ func TestIngestHandler_IngestEvents_EmptyBody(t *testing.T) {
 
 func TestIngestHandler_IngestEvents_InvalidJSON(t *testing.T) {
 	logger, _ := zap.NewDevelopment()
-	handler := NewIngestHandler(nil, logger)
+	handler := NewIngestHandler(nil, nil, nil, logger)
 
 	body := bytes.NewBufferString("not valid json")
 	req := httptest.NewRequest(http.MethodPost, "/v1/events", body)
@@ -45,7 +51,7 @@ func TestIngestHandler_IngestEvents_InvalidJSON(t *testing.T) {
 
 func TestIngestHandler_IngestEvents_EmptyBatch(t *testing.T) {
 	logger, _ := zap.NewDevelopment()
-	handler := NewIngestHandler(nil, logger)
+	handler := NewIngestHandler(nil, nil, nil, logger)
 
 	batch := models.EventBatch{Events: []models.RawEvent{}}
 	body, _ := json.Marshal(batch)
@@ -64,7 +70,7 @@ func TestIngestHandler_IngestEvents_EmptyBatch(t *testing.T) {
 
 func TestIngestHandler_IngestEvents_ValidBatch(t *testing.T) {
 	logger, _ := zap.NewDevelopment()
-	handler := NewIngestHandler(nil, logger)
+	handler := NewIngestHandler(nil, nil, nil, logger)
 
 	batch := models.EventBatch{
 		Events: []models.RawEvent{
@@ -91,7 +97,7 @@ func TestIngestHandler_IngestEvents_ValidBatch(t *testing.T) {
 
 func TestIngestHandler_IngestEvents_MultipleEventTypes(t *testing.T) {
 	logger, _ := zap.NewDevelopment()
-	handler := NewIngestHandler(nil, logger)
+	handler := NewIngestHandler(nil, nil, nil, logger)
 
 	ts := int64(1705315800000)
 
@@ -118,7 +124,7 @@ func TestIngestHandler_IngestEvents_MultipleEventTypes(t *testing.T) {
 
 func TestIngestHandler_IngestEvents_UnknownEventType(t *testing.T) {
 	logger, _ := zap.NewDevelopment()
-	handler := NewIngestHandler(nil, logger)
+	handler := NewIngestHandler(nil, nil, nil, logger)
 
 	batch := models.EventBatch{
 		Events: []models.RawEvent{
@@ -136,3 +142,54 @@ func TestIngestHandler_IngestEvents_UnknownEventType(t *testing.T) {
 	// Unknown event types should be handled gracefully
 	t.Logf("status code: %d", w.Code)
 }
+
+func TestIngestHandler_IngestEvents_RejectMetrics(t *testing.T) {
+	handler := NewIngestHandler(nil, nil, nil, zap.NewNop())
+
+	missingVersion := metrics.EventsRejected.WithLabelValues("perf_sample", "missing_app_version")
+	unknownType := metrics.EventsRejected.WithLabelValues("unknown", "unknown_type")
+	beforeVersion, beforeType := testutil.ToFloat64(missingVersion), testutil.ToFloat64(unknownType)
+
+	body, _ := json.Marshal(models.EventBatch{
+		Events: []models.RawEvent{
+			{Type: models.EventTypePerfSample, Timestamp: time.Now().UnixMilli()},
+			{Type: models.EventType("made_up_type"), Timestamp: time.Now().UnixMilli()},
+		},
+	})
+	req := httptest.NewRequest(http.MethodPost, "/v1/events", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+
+	handler.IngestEvents(w, req)
+
+	if got := testutil.ToFloat64(missingVersion) - beforeVersion; got != 1 {
+		t.Errorf("expected 1 rejection for missing_app_version, got %v", got)
+	}
+	if got := testutil.ToFloat64(unknownType) - beforeType; got != 1 {
+		t.Errorf("expected 1 rejection for unknown_type, got %v", got)
+	}
+}
+
+func TestIngestHandler_IngestEvents_DeviceRate(t *testing.T) {
+	limits := quota.New(config.RateLimitConfig{DeviceRate: 0.1, DeviceBurst: 1})
+	handler := middleware.Quota(limits)(http.HandlerFunc(NewIngestHandler(nil, nil, nil, zap.NewNop()).IngestEvents))
+
+	send := func(deviceID string) int {
+		body := `{"events":[{"type":"perf_sample","timestamp":1705315800000,"device_id":"` + deviceID + `","fps":60}]}`
+		req := httptest.NewRequest(http.MethodPost, "/v1/events", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req = req.WithContext(middleware.WithAppID(req.Context(), "game-a"))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := send("d1"); code != http.StatusOK {
+		t.Fatalf("expected first request to pass, got %d", code)
+	}
+	if code := send("d1"); code != http.StatusTooManyRequests {
+		t.Errorf("expected the device in the batch to be throttled, got %d", code)
+	}
+	if code := send("d2"); code != http.StatusOK {
+		t.Errorf("expected other devices to pass, got %d", code)
+	}
+}
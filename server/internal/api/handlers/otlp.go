@@ -0,0 +1,436 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/warriorguo/ozx_apm/server/internal/api/middleware"
+	"github.com/warriorguo/ozx_apm/server/internal/metrics"
+	"github.com/warriorguo/ozx_apm/server/internal/models"
+	"github.com/warriorguo/ozx_apm/server/internal/processor"
+)
+
+// OTLP/HTTP receiver for clients that already emit OpenTelemetry. Resource
+// and record attributes are mapped onto the common event fields; exception
+// log records become exceptions or crashes, and ozx.* metrics become perf
+// samples, startups and scene loads. Everything else is reported back as
+// rejected through OTLP partial success.
+
+// otlpScene is the attribute carrying the scene, which has no OTel
+// semantic convention
+const otlpScene = "ozx.scene"
+
+// otlpFingerprint overrides the computed exception fingerprint
+const otlpFingerprint = "ozx.fingerprint"
+
+// otlpMetric maps a metric onto a field of an event
+type otlpMetric struct {
+	typ models.EventType
+	set func(e *event, v float32)
+}
+
+var otlpMetrics = map[string]otlpMetric{
+	"ozx.perf.fps":               {models.EventTypePerfSample, func(e *event, v float32) { e.perf.FPS = v }},
+	"ozx.perf.frame_time_ms":     {models.EventTypePerfSample, func(e *event, v float32) { e.perf.FrameTimeMs = v }},
+	"ozx.perf.main_thread_ms":    {models.EventTypePerfSample, func(e *event, v float32) { e.perf.MainThreadMs = v }},
+	"ozx.perf.gc_alloc_kb":       {models.EventTypePerfSample, func(e *event, v float32) { e.perf.GCAllocKB = v }},
+	"ozx.perf.mem_mb":            {models.EventTypePerfSample, func(e *event, v float32) { e.perf.MemMB = v }},
+	"ozx.startup.phase1_ms":      {models.EventTypeStartup, func(e *event, v float32) { e.startup.Phase1Ms = v }},
+	"ozx.startup.phase2_ms":      {models.EventTypeStartup, func(e *event, v float32) { e.startup.Phase2Ms = v }},
+	"ozx.startup.tti_ms":         {models.EventTypeStartup, func(e *event, v float32) { e.startup.TTIMs = v }},
+	"ozx.scene_load.load_ms":     {models.EventTypeSceneLoad, func(e *event, v float32) { e.sceneLoad.LoadMs = v }},
+	"ozx.scene_load.activate_ms": {models.EventTypeSceneLoad, func(e *event, v float32) { e.sceneLoad.ActivateMs = v }},
+}
+
+// IngestOTLPLogs receives OTLP/HTTP log exports
+func (h *IngestHandler) IngestOTLPLogs(w http.ResponseWriter, r *http.Request) {
+	var req collogspb.ExportLogsServiceRequest
+	isProto, ok := readOTLP(w, r, &req)
+	if !ok {
+		return
+	}
+
+	events, unsupported := otlpLogEvents(&req)
+	metrics.EventsRejected.WithLabelValues("otlp_log", "unsupported").Add(float64(unsupported))
+	if !middleware.AllowDevices(w, r, deviceIDs(events)) {
+		return
+	}
+	res := h.ingest(r.Context(), middleware.AppIDFromContext(r.Context()), events)
+	rejected := unsupported + res.rejected
+
+	h.logger.Info("ingested otlp logs",
+		zap.Int("accepted", res.stored+res.sampled),
+		zap.Int("rejected", rejected),
+	)
+
+	resp := &collogspb.ExportLogsServiceResponse{}
+	if rejected > 0 {
+		resp.PartialSuccess = &collogspb.ExportLogsPartialSuccess{
+			RejectedLogRecords: int64(rejected),
+			ErrorMessage:       otlpRejectMessage(unsupported, res.rejected, "log records without exception attributes"),
+		}
+	}
+	writeOTLP(w, resp, isProto)
+}
+
+// IngestOTLPMetrics receives OTLP/HTTP metric exports
+func (h *IngestHandler) IngestOTLPMetrics(w http.ResponseWriter, r *http.Request) {
+	var req colmetricspb.ExportMetricsServiceRequest
+	isProto, ok := readOTLP(w, r, &req)
+	if !ok {
+		return
+	}
+
+	events, unsupported := otlpMetricEvents(&req)
+	metrics.EventsRejected.WithLabelValues("otlp_metric", "unsupported").Add(float64(unsupported))
+	if !middleware.AllowDevices(w, r, deviceIDs(events)) {
+		return
+	}
+	res := h.ingest(r.Context(), middleware.AppIDFromContext(r.Context()), events)
+	rejected := unsupported + res.rejected
+
+	h.logger.Info("ingested otlp metrics",
+		zap.Int("accepted", res.stored+res.sampled),
+		zap.Int("rejected", rejected),
+	)
+
+	resp := &colmetricspb.ExportMetricsServiceResponse{}
+	if rejected > 0 {
+		resp.PartialSuccess = &colmetricspb.ExportMetricsPartialSuccess{
+			RejectedDataPoints: int64(rejected),
+			ErrorMessage:       otlpRejectMessage(unsupported, res.rejected, "data points of metrics other than ozx.* gauges and sums"),
+		}
+	}
+	writeOTLP(w, resp, isProto)
+}
+
+// readOTLP decodes an OTLP request body, which is protobuf or, with
+// Content-Type application/json, OTLP JSON
+func readOTLP(w http.ResponseWriter, r *http.Request, msg proto.Message) (isProto, ok bool) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "failed to read body", http.StatusBadRequest)
+		return false, false
+	}
+
+	isProto = !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json")
+	if isProto {
+		err = proto.Unmarshal(body, msg)
+	} else {
+		err = protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(body, msg)
+	}
+	if err != nil {
+		http.Error(w, "invalid OTLP request: "+err.Error(), http.StatusBadRequest)
+		return isProto, false
+	}
+	return isProto, true
+}
+
+// writeOTLP encodes an OTLP response in the request's format
+func writeOTLP(w http.ResponseWriter, msg proto.Message, isProto bool) {
+	var (
+		body []byte
+		err  error
+	)
+	if isProto {
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		body, err = proto.Marshal(msg)
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+		body, err = protojson.Marshal(msg)
+	}
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.Write(body)
+}
+
+func otlpRejectMessage(unsupported, invalid int, what string) string {
+	var parts []string
+	if unsupported > 0 {
+		parts = append(parts, fmt.Sprintf("%d unsupported (only %s are stored)", unsupported, what))
+	}
+	if invalid > 0 {
+		parts = append(parts, fmt.Sprintf("%d failed validation", invalid))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// otlpLogEvents maps exception log records onto exception and crash events.
+// Fatal records are crashes.
+func otlpLogEvents(req *collogspb.ExportLogsServiceRequest) (events []event, unsupported int) {
+	for _, rl := range req.GetResourceLogs() {
+		resource := newOTLPAttributes(rl.GetResource().GetAttributes())
+		for _, sl := range rl.GetScopeLogs() {
+			for _, rec := range sl.GetLogRecords() {
+				attrs := resource.with(rec.GetAttributes())
+				excType := attrs["exception.type"]
+				message := attrs["exception.message"]
+				stack := attrs["exception.stacktrace"]
+				if excType == "" && message == "" && stack == "" {
+					unsupported++
+					continue
+				}
+				if message == "" {
+					message = rec.GetBody().GetStringValue()
+				}
+
+				fingerprint := attrs[otlpFingerprint]
+				if fingerprint == "" {
+					fingerprint = processor.Fingerprint(excType, stack)
+				}
+
+				ts := rec.GetTimeUnixNano()
+				if ts == 0 {
+					ts = rec.GetObservedTimeUnixNano()
+				}
+				common := attrs.common()
+
+				e := event{timestamp: otlpMillis(ts)}
+				if rec.GetSeverityNumber() >= logspb.SeverityNumber_SEVERITY_NUMBER_FATAL {
+					e.typ = models.EventTypeCrash
+					e.crash = &models.Crash{
+						AppVersion:  common.AppVersion,
+						Platform:    common.Platform,
+						DeviceModel: common.DeviceModel,
+						OSVersion:   common.OSVersion,
+						SessionID:   common.SessionID,
+						DeviceID:    common.DeviceID,
+						Scene:       common.Scene,
+						CrashType:   excType,
+						Fingerprint: fingerprint,
+						Stack:       stack,
+					}
+				} else {
+					e.typ = models.EventTypeException
+					e.exception = &models.Exception{
+						AppVersion:  common.AppVersion,
+						Platform:    common.Platform,
+						DeviceModel: common.DeviceModel,
+						OSVersion:   common.OSVersion,
+						SessionID:   common.SessionID,
+						DeviceID:    common.DeviceID,
+						Scene:       common.Scene,
+						Fingerprint: fingerprint,
+						Message:     message,
+						Stack:       stack,
+						Count:       1,
+					}
+				}
+				events = append(events, e)
+			}
+		}
+	}
+	return events, unsupported
+}
+
+// otlpMetricEvents maps ozx.* gauge and sum data points onto events. Data
+// points of one resource sharing a timestamp and attributes form one event.
+func otlpMetricEvents(req *colmetricspb.ExportMetricsServiceRequest) (events []event, unsupported int) {
+	for _, rm := range req.GetResourceMetrics() {
+		resource := newOTLPAttributes(rm.GetResource().GetAttributes())
+		grouped := make(map[string]int) // group key -> index in events
+
+		for _, sm := range rm.GetScopeMetrics() {
+			for _, m := range sm.GetMetrics() {
+				var points []*metricspb.NumberDataPoint
+				switch data := m.GetData().(type) {
+				case *metricspb.Metric_Gauge:
+					points = data.Gauge.GetDataPoints()
+				case *metricspb.Metric_Sum:
+					points = data.Sum.GetDataPoints()
+				}
+
+				mapping, known := otlpMetrics[m.GetName()]
+				if !known || points == nil {
+					unsupported += otlpDataPointCount(m)
+					continue
+				}
+
+				for _, dp := range points {
+					var value float32
+					switch v := dp.GetValue().(type) {
+					case *metricspb.NumberDataPoint_AsDouble:
+						value = float32(v.AsDouble)
+					case *metricspb.NumberDataPoint_AsInt:
+						value = float32(v.AsInt)
+					default:
+						unsupported++
+						continue
+					}
+
+					attrs := resource.with(dp.GetAttributes())
+					key := string(mapping.typ) + "\x00" + strconv.FormatUint(dp.GetTimeUnixNano(), 10) + "\x00" + attrs.key()
+					i, ok := grouped[key]
+					if !ok {
+						i = len(events)
+						grouped[key] = i
+						events = append(events, newOTLPMetricEvent(mapping.typ, dp.GetTimeUnixNano(), attrs))
+					}
+					mapping.set(&events[i], value)
+				}
+			}
+		}
+	}
+	return events, unsupported
+}
+
+func newOTLPMetricEvent(typ models.EventType, ts uint64, attrs otlpAttributes) event {
+	common := attrs.common()
+	e := event{typ: typ, timestamp: otlpMillis(ts)}
+
+	switch typ {
+	case models.EventTypePerfSample:
+		e.perf = &models.PerfSample{
+			AppVersion:  common.AppVersion,
+			Platform:    common.Platform,
+			DeviceModel: common.DeviceModel,
+			OSVersion:   common.OSVersion,
+			SessionID:   common.SessionID,
+			DeviceID:    common.DeviceID,
+			Scene:       common.Scene,
+		}
+	case models.EventTypeStartup:
+		e.startup = &models.Startup{
+			AppVersion:  common.AppVersion,
+			Platform:    common.Platform,
+			DeviceModel: common.DeviceModel,
+			OSVersion:   common.OSVersion,
+			SessionID:   common.SessionID,
+			DeviceID:    common.DeviceID,
+		}
+	case models.EventTypeSceneLoad:
+		e.sceneLoad = &models.SceneLoad{
+			AppVersion:  common.AppVersion,
+			Platform:    common.Platform,
+			DeviceModel: common.DeviceModel,
+			SessionID:   common.SessionID,
+			DeviceID:    common.DeviceID,
+			SceneName:   common.Scene,
+		}
+	}
+	return e
+}
+
+func otlpDataPointCount(m *metricspb.Metric) int {
+	switch data := m.GetData().(type) {
+	case *metricspb.Metric_Gauge:
+		return len(data.Gauge.GetDataPoints())
+	case *metricspb.Metric_Sum:
+		return len(data.Sum.GetDataPoints())
+	case *metricspb.Metric_Histogram:
+		return len(data.Histogram.GetDataPoints())
+	case *metricspb.Metric_ExponentialHistogram:
+		return len(data.ExponentialHistogram.GetDataPoints())
+	case *metricspb.Metric_Summary:
+		return len(data.Summary.GetDataPoints())
+	}
+	return 0
+}
+
+// otlpMillis converts OTLP nanoseconds to Unix milliseconds; 0 stays 0 so
+// ingest substitutes the receive time
+func otlpMillis(nanos uint64) int64 {
+	return int64(nanos / uint64(time.Millisecond))
+}
+
+// otlpAttributes holds attributes as strings
+type otlpAttributes map[string]string
+
+func newOTLPAttributes(kvs []*commonpb.KeyValue) otlpAttributes {
+	attrs := make(otlpAttributes, len(kvs))
+	attrs.add(kvs)
+	return attrs
+}
+
+func (a otlpAttributes) add(kvs []*commonpb.KeyValue) {
+	for _, kv := range kvs {
+		v := kv.GetValue()
+		switch v.GetValue().(type) {
+		case *commonpb.AnyValue_StringValue:
+			a[kv.GetKey()] = v.GetStringValue()
+		case *commonpb.AnyValue_IntValue:
+			a[kv.GetKey()] = strconv.FormatInt(v.GetIntValue(), 10)
+		case *commonpb.AnyValue_DoubleValue:
+			a[kv.GetKey()] = strconv.FormatFloat(v.GetDoubleValue(), 'g', -1, 64)
+		case *commonpb.AnyValue_BoolValue:
+			a[kv.GetKey()] = strconv.FormatBool(v.GetBoolValue())
+		}
+	}
+}
+
+// with returns a copy overridden by record or data point attributes
+func (a otlpAttributes) with(kvs []*commonpb.KeyValue) otlpAttributes {
+	merged := make(otlpAttributes, len(a)+len(kvs))
+	for k, v := range a {
+		merged[k] = v
+	}
+	merged.add(kvs)
+	return merged
+}
+
+// first returns the first non-empty attribute of keys
+func (a otlpAttributes) first(keys ...string) string {
+	for _, k := range keys {
+		if v := a[k]; v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// common maps OTel semantic conventions onto the common event fields.
+// Server-side clients have no device or session, so the host and service
+// instance stand in for them.
+func (a otlpAttributes) common() models.SessionEvent {
+	platform := a.first("os.type", "os.name")
+	if platform == "darwin" {
+		platform = "macOS"
+	}
+	if platform == "" {
+		platform = "Unknown"
+	}
+
+	return models.SessionEvent{
+		AppVersion:  a["service.version"],
+		Platform:    platform,
+		DeviceModel: a.first("device.model.identifier", "device.model.name", "host.type"),
+		OSVersion:   a["os.version"],
+		SessionID:   a.first("session.id", "service.instance.id"),
+		DeviceID:    a.first("device.id", "host.id", "host.name", "service.instance.id"),
+		Scene:       a[otlpScene],
+	}
+}
+
+// key identifies an attribute set
+func (a otlpAttributes) key() string {
+	keys := make([]string, 0, len(a))
+	for k := range a {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, k := range keys {
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(a[k])
+		b.WriteByte(0)
+	}
+	return b.String()
+}
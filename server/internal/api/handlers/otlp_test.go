@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/warriorguo/ozx_apm/server/internal/models"
+	"github.com/warriorguo/ozx_apm/server/internal/processor"
+)
+
+func otlpString(key, value string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: key, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value}}}
+}
+
+func otlpResource() *resourcepb.Resource {
+	return &resourcepb.Resource{Attributes: []*commonpb.KeyValue{
+		otlpString("service.name", "game-backend"),
+		otlpString("service.version", "2.4.0"),
+		otlpString("service.instance.id", "instance-1"),
+		otlpString("os.type", "linux"),
+		otlpString("os.version", "6.1"),
+		otlpString("host.name", "backend-7"),
+	}}
+}
+
+func TestOTLPLogEvents(t *testing.T) {
+	ts := uint64(time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC).UnixNano())
+	req := &collogspb.ExportLogsServiceRequest{ResourceLogs: []*logspb.ResourceLogs{{
+		Resource: otlpResource(),
+		ScopeLogs: []*logspb.ScopeLogs{{LogRecords: []*logspb.LogRecord{
+			{
+				TimeUnixNano:   ts,
+				SeverityNumber: logspb.SeverityNumber_SEVERITY_NUMBER_ERROR,
+				Attributes: []*commonpb.KeyValue{
+					otlpString("exception.type", "TimeoutError"),
+					otlpString("exception.message", "match service timed out"),
+					otlpString("exception.stacktrace", "at match.go:42\nat main.go:10"),
+					otlpString("session.id", "s1"),
+				},
+			},
+			{
+				ObservedTimeUnixNano: ts,
+				SeverityNumber:       logspb.SeverityNumber_SEVERITY_NUMBER_FATAL,
+				Attributes: []*commonpb.KeyValue{
+					otlpString("exception.type", "panic"),
+					otlpString(otlpFingerprint, "custom"),
+				},
+			},
+			{
+				SeverityNumber: logspb.SeverityNumber_SEVERITY_NUMBER_INFO,
+				Body:           &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: "player joined"}},
+			},
+		}}},
+	}}}
+
+	events, unsupported := otlpLogEvents(req)
+	if unsupported != 1 {
+		t.Errorf("expected 1 unsupported record, got %d", unsupported)
+	}
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(events))
+	}
+
+	exc := events[0].exception
+	if exc == nil {
+		t.Fatalf("expected an exception, got %+v", events[0])
+	}
+	if events[0].timestamp != 1705312800000 {
+		t.Errorf("expected timestamp 1705312800000, got %d", events[0].timestamp)
+	}
+	want := models.Exception{
+		AppVersion:  "2.4.0",
+		Platform:    "linux",
+		OSVersion:   "6.1",
+		SessionID:   "s1",
+		DeviceID:    "backend-7",
+		Fingerprint: processor.Fingerprint("TimeoutError", "at match.go:42\nat main.go:10"),
+		Message:     "match service timed out",
+		Stack:       "at match.go:42\nat main.go:10",
+		Count:       1,
+	}
+	if *exc != want {
+		t.Errorf("exception = %+v, want %+v", *exc, want)
+	}
+
+	crash := events[1].crash
+	if crash == nil {
+		t.Fatalf("expected a crash, got %+v", events[1])
+	}
+	if crash.CrashType != "panic" || crash.Fingerprint != "custom" || crash.SessionID != "instance-1" || events[1].timestamp != 1705312800000 {
+		t.Errorf("unexpected crash %+v at %d", crash, events[1].timestamp)
+	}
+}
+
+func TestOTLPMetricEvents(t *testing.T) {
+	ts := uint64(time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC).UnixNano())
+	point := func(v float64, scene string) *metricspb.NumberDataPoint {
+		return &metricspb.NumberDataPoint{
+			TimeUnixNano: ts,
+			Attributes:   []*commonpb.KeyValue{otlpString(otlpScene, scene)},
+			Value:        &metricspb.NumberDataPoint_AsDouble{AsDouble: v},
+		}
+	}
+	gauge := func(name string, points ...*metricspb.NumberDataPoint) *metricspb.Metric {
+		return &metricspb.Metric{Name: name, Data: &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{DataPoints: points}}}
+	}
+
+	req := &colmetricspb.ExportMetricsServiceRequest{ResourceMetrics: []*metricspb.ResourceMetrics{{
+		Resource: otlpResource(),
+		ScopeMetrics: []*metricspb.ScopeMetrics{{Metrics: []*metricspb.Metric{
+			gauge("ozx.perf.fps", point(58, "Lobby"), point(30, "Battle")),
+			gauge("ozx.perf.mem_mb", point(512, "Lobby")),
+			gauge("http.server.active_requests", point(3, "")),
+			{
+				Name: "ozx.perf.frame_time_ms",
+				Data: &metricspb.Metric_Histogram{Histogram: &metricspb.Histogram{
+					DataPoints: []*metricspb.HistogramDataPoint{{TimeUnixNano: ts}},
+				}},
+			},
+		}}},
+	}}}
+
+	events, unsupported := otlpMetricEvents(req)
+	if unsupported != 2 {
+		t.Errorf("expected 2 unsupported data points, got %d", unsupported)
+	}
+	if len(events) != 2 {
+		t.Fatalf("expected 2 perf samples, got %d", len(events))
+	}
+
+	lobby, battle := events[0].perf, events[1].perf
+	if lobby == nil || battle == nil {
+		t.Fatalf("expected perf samples, got %+v", events)
+	}
+	if lobby.Scene != "Lobby" || lobby.FPS != 58 || lobby.MemMB != 512 {
+		t.Errorf("unexpected lobby sample %+v", lobby)
+	}
+	if battle.Scene != "Battle" || battle.FPS != 30 || battle.MemMB != 0 {
+		t.Errorf("unexpected battle sample %+v", battle)
+	}
+}
+
+func TestIngestHandler_IngestOTLPLogs(t *testing.T) {
+	handler := NewIngestHandler(nil, nil, nil, zap.NewNop())
+
+	req := &collogspb.ExportLogsServiceRequest{ResourceLogs: []*logspb.ResourceLogs{{
+		Resource:  otlpResource(),
+		ScopeLogs: []*logspb.ScopeLogs{{LogRecords: []*logspb.LogRecord{{SeverityNumber: logspb.SeverityNumber_SEVERITY_NUMBER_INFO}}}},
+	}}}
+
+	tests := []struct {
+		name        string
+		contentType string
+		marshal     func(proto.Message) ([]byte, error)
+		unmarshal   func([]byte, proto.Message) error
+	}{
+		{"protobuf", "application/x-protobuf", proto.Marshal, proto.Unmarshal},
+		{"json", "application/json", protojson.Marshal, protojson.Unmarshal},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := tt.marshal(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := httptest.NewRequest(http.MethodPost, "/v1/logs", bytes.NewReader(body))
+			r.Header.Set("Content-Type", tt.contentType)
+			w := httptest.NewRecorder()
+
+			handler.IngestOTLPLogs(w, r)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body)
+			}
+			if got := w.Header().Get("Content-Type"); got != tt.contentType {
+				t.Errorf("expected content type %q, got %q", tt.contentType, got)
+			}
+			var resp collogspb.ExportLogsServiceResponse
+			if err := tt.unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if resp.GetPartialSuccess().GetRejectedLogRecords() != 1 {
+				t.Errorf("expected 1 rejected record, got %+v", resp.GetPartialSuccess())
+			}
+		})
+	}
+}
+
+func TestIngestHandler_IngestOTLPMetrics_Invalid(t *testing.T) {
+	handler := NewIngestHandler(nil, nil, nil, zap.NewNop())
+
+	r := httptest.NewRequest(http.MethodPost, "/v1/metrics", bytes.NewReader([]byte("{not json")))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	handler.IngestOTLPMetrics(w, r)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
@@ -3,11 +3,11 @@ package handlers
 import (
 	"encoding/json"
 	"net/http"
-	"strconv"
-	"time"
 
 	"go.uber.org/zap"
 
+	"github.com/warriorguo/ozx_apm/server/internal/api/middleware"
+	"github.com/warriorguo/ozx_apm/server/internal/api/params"
 	"github.com/warriorguo/ozx_apm/server/internal/models"
 	"github.com/warriorguo/ozx_apm/server/internal/storage"
 )
@@ -25,10 +25,12 @@ func NewQueryHandler(repo *storage.Repository, logger *zap.Logger) *QueryHandler
 }
 
 // parseQueryFilter extracts filter parameters from request
-func parseQueryFilter(r *http.Request) models.QueryFilter {
+func parseQueryFilter(r *http.Request) (models.QueryFilter, error) {
 	q := r.URL.Query()
+	p := params.New(r)
 
 	filter := models.QueryFilter{
+		AppID:       middleware.AppIDFromContext(r.Context()),
 		AppVersion:  q.Get("app_version"),
 		Platform:    q.Get("platform"),
 		DeviceModel: q.Get("device_model"),
@@ -38,42 +40,11 @@ func parseQueryFilter(r *http.Request) models.QueryFilter {
 		NetType:     q.Get("net_type"),
 	}
 
-	// Parse time range (default: last 24 hours)
-	if startStr := q.Get("start_time"); startStr != "" {
-		if t, err := time.Parse(time.RFC3339, startStr); err == nil {
-			filter.StartTime = t
-		}
-	}
-	if filter.StartTime.IsZero() {
-		filter.StartTime = time.Now().Add(-24 * time.Hour)
-	}
+	filter.StartTime, filter.EndTime = p.TimeRange()
+	filter.Limit = p.Limit()
+	filter.Offset = p.Offset()
 
-	if endStr := q.Get("end_time"); endStr != "" {
-		if t, err := time.Parse(time.RFC3339, endStr); err == nil {
-			filter.EndTime = t
-		}
-	}
-	if filter.EndTime.IsZero() {
-		filter.EndTime = time.Now()
-	}
-
-	// Parse pagination
-	if limitStr := q.Get("limit"); limitStr != "" {
-		if limit, err := strconv.Atoi(limitStr); err == nil && limit > 0 {
-			filter.Limit = limit
-		}
-	}
-	if filter.Limit == 0 {
-		filter.Limit = 100
-	}
-
-	if offsetStr := q.Get("offset"); offsetStr != "" {
-		if offset, err := strconv.Atoi(offsetStr); err == nil && offset >= 0 {
-			filter.Offset = offset
-		}
-	}
-
-	return filter
+	return filter, p.Err()
 }
 
 // GetFPSMetrics returns FPS distribution metrics
@@ -83,7 +54,11 @@ func (h *QueryHandler) GetFPSMetrics(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	filter := parseQueryFilter(r)
+	filter, err := parseQueryFilter(r)
+	if err != nil {
+		params.WriteError(w, err)
+		return
+	}
 
 	metrics, err := h.repo.QueryFPSMetrics(r.Context(), filter)
 	if err != nil {
@@ -105,7 +80,11 @@ func (h *QueryHandler) GetStartupMetrics(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	filter := parseQueryFilter(r)
+	filter, err := parseQueryFilter(r)
+	if err != nil {
+		params.WriteError(w, err)
+		return
+	}
 
 	metrics, err := h.repo.QueryStartupMetrics(r.Context(), filter)
 	if err != nil {
@@ -127,7 +106,11 @@ func (h *QueryHandler) GetJankMetrics(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	filter := parseQueryFilter(r)
+	filter, err := parseQueryFilter(r)
+	if err != nil {
+		params.WriteError(w, err)
+		return
+	}
 
 	metrics, err := h.repo.QueryJankMetrics(r.Context(), filter)
 	if err != nil {
@@ -149,7 +132,11 @@ func (h *QueryHandler) GetExceptions(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	filter := parseQueryFilter(r)
+	filter, err := parseQueryFilter(r)
+	if err != nil {
+		params.WriteError(w, err)
+		return
+	}
 
 	exceptions, err := h.repo.QueryExceptions(r.Context(), filter)
 	if err != nil {
@@ -171,7 +158,11 @@ func (h *QueryHandler) GetCrashes(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	filter := parseQueryFilter(r)
+	filter, err := parseQueryFilter(r)
+	if err != nil {
+		params.WriteError(w, err)
+		return
+	}
 
 	crashes, err := h.repo.QueryCrashes(r.Context(), filter)
 	if err != nil {
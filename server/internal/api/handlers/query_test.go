@@ -1,11 +1,17 @@
 package handlers
 
 import (
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"go.uber.org/zap"
+
+	"github.com/warriorguo/ozx_apm/server/internal/api/middleware"
+	"github.com/warriorguo/ozx_apm/server/internal/api/params"
+	"github.com/warriorguo/ozx_apm/server/internal/storage"
 )
 
 func TestQueryHandler_GetFPSMetrics(t *testing.T) {
@@ -116,3 +122,89 @@ func TestNewQueryHandler(t *testing.T) {
 		t.Error("expected non-nil handler")
 	}
 }
+
+func TestParseQueryFilter_AppIDFromAuth(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/v1/metrics/fps?app_id=other-game", nil)
+	req = req.WithContext(middleware.WithAppID(req.Context(), "game-a"))
+
+	filter, err := parseQueryFilter(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if filter.AppID != "game-a" {
+		t.Errorf("expected app id from auth context, got %q", filter.AppID)
+	}
+}
+
+func TestParseQueryFilter_Defaults(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/v1/metrics/fps", nil)
+
+	filter, err := parseQueryFilter(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := filter.EndTime.Sub(filter.StartTime); got != params.DefaultRange {
+		t.Errorf("expected default range %s, got %s", params.DefaultRange, got)
+	}
+	if filter.Limit != params.DefaultLimit || filter.Offset != 0 {
+		t.Errorf("expected limit %d offset 0, got %d %d", params.DefaultLimit, filter.Limit, filter.Offset)
+	}
+}
+
+func TestParseQueryFilter_RelativeRange(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/v1/metrics/fps?start_time=-6h&limit=10&offset=20", nil)
+
+	filter, err := parseQueryFilter(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := filter.EndTime.Sub(filter.StartTime); got != 6*time.Hour {
+		t.Errorf("expected 6h range, got %s", got)
+	}
+	if filter.Limit != 10 || filter.Offset != 20 {
+		t.Errorf("expected limit 10 offset 20, got %d %d", filter.Limit, filter.Offset)
+	}
+}
+
+func TestQueryHandler_InvalidParams(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	// Invalid parameters are rejected before the repository is used, so an
+	// unconnected one will do
+	handler := NewQueryHandler(&storage.Repository{}, logger)
+
+	tests := []struct {
+		name   string
+		query  string
+		fields []string
+	}{
+		{"malformed start", "?start_time=yesterday", []string{"start_time"}},
+		{"end before start", "?start_time=2024-01-02T00:00:00Z&end_time=2024-01-01T00:00:00Z", []string{"end_time"}},
+		{"range too long", "?start_time=-90d", []string{"start_time"}},
+		{"bad pagination", "?limit=0&offset=-1", []string{"limit", "offset"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/v1/metrics/fps"+tt.query, nil)
+			w := httptest.NewRecorder()
+
+			handler.GetFPSMetrics(w, req)
+
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("expected status %d, got %d", http.StatusBadRequest, w.Code)
+			}
+			var resp params.ErrorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("failed to decode: %v", err)
+			}
+			if len(resp.Fields) != len(tt.fields) {
+				t.Fatalf("expected fields %v, got %+v", tt.fields, resp.Fields)
+			}
+			for i, f := range tt.fields {
+				if resp.Fields[i].Field != f {
+					t.Errorf("expected field %s, got %s", f, resp.Fields[i].Field)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	chiMiddleware "github.com/go-chi/chi/v5/middleware"
+	"go.uber.org/zap"
+
+	"github.com/warriorguo/ozx_apm/server/internal/adminauth"
+	"github.com/warriorguo/ozx_apm/server/internal/models"
+)
+
+// SessionCookie holds the admin session token
+const SessionCookie = "ozx_session"
+
+// TokenParser verifies admin session tokens
+type TokenParser interface {
+	ParseToken(token string) (*adminauth.Principal, error)
+}
+
+// AdminAuth rejects requests without a valid session, taken from the session
+// cookie or an "Authorization: Bearer" header, and puts the user into the
+// request context
+func AdminAuth(tokens TokenParser) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token := sessionToken(r)
+			if token == "" {
+				http.Error(w, "authentication required", http.StatusUnauthorized)
+				return
+			}
+
+			p, err := tokens.ParseToken(token)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(adminauth.WithPrincipal(r.Context(), p)))
+		})
+	}
+}
+
+func sessionToken(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	if c, err := r.Cookie(SessionCookie); err == nil {
+		return c.Value
+	}
+	return ""
+}
+
+// RequireRole rejects users without at least role min on the app named by the
+// app_id URL parameter. Routes without one cover all apps and need the role on
+// every app. It must run after routing (in a Group or With) so URL parameters
+// are available.
+func RequireRole(min adminauth.Role) func(http.Handler) http.Handler {
+	return requireRole(min, func(r *http.Request) string { return chi.URLParam(r, "app_id") })
+}
+
+// RequireQueryRole is RequireRole for routes whose handlers scope everything
+// they read to the app_id query parameter, so the app may also come from there.
+// Handlers that ignore the query parameter must use RequireRole instead.
+func RequireQueryRole(min adminauth.Role) func(http.Handler) http.Handler {
+	return requireRole(min, requestAppID)
+}
+
+func requireRole(min adminauth.Role, appID func(r *http.Request) string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p := adminauth.PrincipalFromContext(r.Context())
+			if p == nil {
+				http.Error(w, "authentication required", http.StatusUnauthorized)
+				return
+			}
+			if !p.Can(appID(r), min) {
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func requestAppID(r *http.Request) string {
+	if appID := chi.URLParam(r, "app_id"); appID != "" {
+		return appID
+	}
+	return r.URL.Query().Get("app_id")
+}
+
+// AuditSink stores audit entries
+type AuditSink interface {
+	SaveAuditEntry(ctx context.Context, e models.AuditEntry) error
+}
+
+// Audit records every request it wraps, with the admin user and response
+// status, once the handler has finished. A nil sink only logs.
+func Audit(sink AuditSink, logger *zap.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ww := chiMiddleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			next.ServeHTTP(ww, r)
+
+			entry := models.AuditEntry{
+				Timestamp:  time.Now(),
+				AppID:      requestAppID(r),
+				Username:   "anonymous",
+				Method:     r.Method,
+				Path:       r.URL.Path,
+				Status:     ww.Status(),
+				RemoteAddr: r.RemoteAddr,
+				RequestID:  chiMiddleware.GetReqID(r.Context()),
+			}
+			if entry.Status == 0 {
+				entry.Status = http.StatusOK
+			}
+			if p := adminauth.PrincipalFromContext(r.Context()); p != nil {
+				entry.Username = p.Username
+			}
+
+			logger.Info("audit",
+				zap.String("username", entry.Username),
+				zap.String("app_id", entry.AppID),
+				zap.String("method", entry.Method),
+				zap.String("path", entry.Path),
+				zap.Int("status", entry.Status),
+			)
+			if sink == nil {
+				return
+			}
+			// The client may already be gone; the entry is still recorded
+			if err := sink.SaveAuditEntry(context.WithoutCancel(r.Context()), entry); err != nil {
+				logger.Error("failed to save audit entry", zap.Error(err))
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+
+	"github.com/warriorguo/ozx_apm/server/internal/adminauth"
+	"github.com/warriorguo/ozx_apm/server/internal/models"
+)
+
+type fakeTokens map[string]*adminauth.Principal
+
+func (f fakeTokens) ParseToken(token string) (*adminauth.Principal, error) {
+	if p, ok := f[token]; ok {
+		return p, nil
+	}
+	return nil, adminauth.ErrInvalidToken
+}
+
+func TestAdminAuth(t *testing.T) {
+	tokens := fakeTokens{"good": {Username: "alice"}}
+
+	tests := []struct {
+		name           string
+		setup          func(r *http.Request)
+		expectedStatus int
+	}{
+		{"bearer token", func(r *http.Request) { r.Header.Set("Authorization", "Bearer good") }, http.StatusOK},
+		{"session cookie", func(r *http.Request) { r.AddCookie(&http.Cookie{Name: SessionCookie, Value: "good"}) }, http.StatusOK},
+		{"invalid token", func(r *http.Request) { r.Header.Set("Authorization", "Bearer bad") }, http.StatusUnauthorized},
+		{"no credentials", func(r *http.Request) {}, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var username string
+			handler := AdminAuth(tokens)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				username = adminauth.PrincipalFromContext(r.Context()).Username
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/api/summary", nil)
+			tt.setup(req)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if w.Code == http.StatusOK && username != "alice" {
+				t.Errorf("expected principal alice in context, got %q", username)
+			}
+		})
+	}
+}
+
+func TestRequireRole(t *testing.T) {
+	p := &adminauth.Principal{Username: "bob", Roles: map[string]adminauth.Role{"game-a": adminauth.RoleDeveloper, "game-b": adminauth.RoleAdmin}}
+
+	r := chi.NewRouter()
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(adminauth.WithPrincipal(r.Context(), p)))
+		})
+	})
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	r.With(RequireQueryRole(adminauth.RoleViewer)).Get("/summary", ok)
+	r.With(RequireRole(adminauth.RoleViewer)).Get("/apps", ok)
+	r.With(RequireRole(adminauth.RoleAdmin)).Post("/apps", ok)
+	r.With(RequireRole(adminauth.RoleAdmin)).Post("/apps/{app_id}/keys", ok)
+	r.With(RequireRole(adminauth.RoleDeveloper)).Post("/apps/{app_id}/config", ok)
+
+	tests := []struct {
+		name           string
+		method         string
+		target         string
+		expectedStatus int
+	}{
+		{"viewer on own app", http.MethodGet, "/summary?app_id=game-a", http.StatusOK},
+		{"other app", http.MethodGet, "/summary?app_id=game-c", http.StatusForbidden},
+		{"all apps", http.MethodGet, "/summary", http.StatusForbidden},
+		{"list apps ignores query", http.MethodGet, "/apps?app_id=game-a", http.StatusForbidden},
+		{"create app ignores query", http.MethodPost, "/apps?app_id=game-b", http.StatusForbidden},
+		{"developer route", http.MethodPost, "/apps/game-a/config", http.StatusOK},
+		{"admin route", http.MethodPost, "/apps/game-a/keys", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, nil)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+		})
+	}
+}
+
+func TestRequireRole_Unauthenticated(t *testing.T) {
+	handler := RequireRole(adminauth.RoleViewer)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/summary", nil))
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected status %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+}
+
+type fakeAuditSink struct {
+	entries []models.AuditEntry
+	err     error
+}
+
+func (f *fakeAuditSink) SaveAuditEntry(ctx context.Context, e models.AuditEntry) error {
+	f.entries = append(f.entries, e)
+	return f.err
+}
+
+func TestAudit(t *testing.T) {
+	sink := &fakeAuditSink{}
+
+	r := chi.NewRouter()
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p := &adminauth.Principal{Username: "alice"}
+			next.ServeHTTP(w, r.WithContext(adminauth.WithPrincipal(r.Context(), p)))
+		})
+	})
+	r.With(Audit(sink, zap.NewNop())).Delete("/apps/{app_id}/keys/{key_id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	req := httptest.NewRequest(http.MethodDelete, "/apps/game-a/keys/k1", nil)
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	if len(sink.entries) != 1 {
+		t.Fatalf("expected 1 audit entry, got %d", len(sink.entries))
+	}
+	e := sink.entries[0]
+	if e.Username != "alice" || e.AppID != "game-a" || e.Method != http.MethodDelete || e.Path != "/apps/game-a/keys/k1" || e.Status != http.StatusNotFound {
+		t.Errorf("unexpected audit entry %+v", e)
+	}
+}
+
+func TestAudit_SinkErrorDoesNotFailRequest(t *testing.T) {
+	sink := &fakeAuditSink{err: errors.New("clickhouse down")}
+	handler := Audit(sink, zap.NewNop())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/apps", nil))
+
+	if w.Code != http.StatusCreated {
+		t.Errorf("expected status %d, got %d", http.StatusCreated, w.Code)
+	}
+	if len(sink.entries) != 1 || sink.entries[0].Username != "anonymous" {
+		t.Errorf("expected an anonymous audit entry, got %+v", sink.entries)
+	}
+}
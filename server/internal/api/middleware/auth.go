@@ -1,12 +1,50 @@
 package middleware
 
 import (
+	"context"
+	"crypto/subtle"
 	"net/http"
+	"strings"
 )
 
 const AppKeyHeader = "X-App-Key"
 
+type appIDKey struct{}
+
+// WithAppID returns a copy of ctx carrying the authenticated app ID
+func WithAppID(ctx context.Context, appID string) context.Context {
+	return context.WithValue(ctx, appIDKey{}, appID)
+}
+
+// AppIDFromContext returns the authenticated app ID, or "" when the request
+// was not authenticated
+func AppIDFromContext(ctx context.Context) string {
+	appID, _ := ctx.Value(appIDKey{}).(string)
+	return appID
+}
+
+// KeyLookup resolves an app key to the app it belongs to
+type KeyLookup interface {
+	Lookup(ctx context.Context, appKey string) (appID string, ok bool)
+}
+
+// staticKeys is a KeyLookup over a fixed app_key -> app ID map
+type staticKeys map[string]string
+
+func (k staticKeys) Lookup(_ context.Context, appKey string) (string, bool) {
+	appID, ok := k[appKey]
+	return appID, ok
+}
+
+// Auth authenticates against a fixed app_key -> app ID map
 func Auth(validKeys map[string]string) func(http.Handler) http.Handler {
+	return KeyAuth(staticKeys(validKeys))
+}
+
+// KeyAuth rejects requests without a known app key and puts the app the key
+// belongs to into the request context. App IDs are lowercase everywhere, so
+// an ID configured with capitals is stored and authorized as its lowercase form
+func KeyAuth(keys KeyLookup) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			appKey := r.Header.Get(AppKeyHeader)
@@ -15,11 +53,31 @@ func Auth(validKeys map[string]string) func(http.Handler) http.Handler {
 				return
 			}
 
-			if _, ok := validKeys[appKey]; !ok {
+			appID, ok := keys.Lookup(r.Context(), appKey)
+			if !ok {
 				http.Error(w, "invalid app key", http.StatusUnauthorized)
 				return
 			}
 
+			next.ServeHTTP(w, r.WithContext(WithAppID(r.Context(), strings.ToLower(appID))))
+		})
+	}
+}
+
+// BearerToken rejects requests without "Authorization: Bearer <token>", for
+// clients such as Prometheus scrapers that send a static credential
+func BearerToken(token string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || given == "" {
+				http.Error(w, "missing bearer token", http.StatusUnauthorized)
+				return
+			}
+			if subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+				http.Error(w, "invalid bearer token", http.StatusUnauthorized)
+				return
+			}
 			next.ServeHTTP(w, r)
 		})
 	}
@@ -85,3 +85,63 @@ func TestAuth_AppKeyHeader(t *testing.T) {
 		t.Errorf("expected AppKeyHeader=X-App-Key, got %s", AppKeyHeader)
 	}
 }
+
+func TestAuth_SetsAppID(t *testing.T) {
+	var gotAppID string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAppID = AppIDFromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+	})
+
+	authHandler := Auth(map[string]string{"test-key-1": "TestApp1"})(handler)
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/events", nil)
+	req.Header.Set("X-App-Key", "test-key-1")
+
+	w := httptest.NewRecorder()
+	authHandler.ServeHTTP(w, req)
+
+	if gotAppID != "testapp1" {
+		t.Errorf("expected app id testapp1, got %q", gotAppID)
+	}
+}
+
+func TestAppIDFromContext_Unauthenticated(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/v1/metrics/fps", nil)
+	if appID := AppIDFromContext(req.Context()); appID != "" {
+		t.Errorf("expected empty app id, got %q", appID)
+	}
+}
+
+func TestBearerToken(t *testing.T) {
+	handler := BearerToken("scrape-token")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name           string
+		authorization  string
+		expectedStatus int
+	}{
+		{"valid token", "Bearer scrape-token", http.StatusOK},
+		{"missing header", "", http.StatusUnauthorized},
+		{"wrong token", "Bearer guess", http.StatusUnauthorized},
+		{"other scheme", "Basic scrape-token", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+		})
+	}
+}
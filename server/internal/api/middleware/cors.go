@@ -9,20 +9,26 @@ func CORS(allowedOrigins []string) func(http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			origin := r.Header.Get("Origin")
 
-			// Check if origin is allowed
-			allowed := false
+			// Check if origin is allowed. Credentials are only allowed for
+			// explicitly listed origins, never through the wildcard.
+			allowed, credentials := false, false
 			for _, o := range allowedOrigins {
-				if o == "*" || o == origin {
-					allowed = true
+				if o == origin {
+					allowed, credentials = true, true
 					break
 				}
+				if o == "*" {
+					allowed = true
+				}
 			}
 
 			if allowed {
 				w.Header().Set("Access-Control-Allow-Origin", origin)
 				w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
 				w.Header().Set("Access-Control-Allow-Headers", "Accept, Authorization, Content-Type, X-App-Key")
-				w.Header().Set("Access-Control-Allow-Credentials", "true")
+				if credentials {
+					w.Header().Set("Access-Control-Allow-Credentials", "true")
+				}
 				w.Header().Set("Access-Control-Max-Age", "300")
 			}
 
@@ -144,3 +144,32 @@ func TestCORS_Credentials(t *testing.T) {
 		t.Error("expected Access-Control-Allow-Credentials=true")
 	}
 }
+
+func TestCORS_CredentialsOnlyForListedOrigins(t *testing.T) {
+	tests := []struct {
+		name            string
+		origins         []string
+		wantCredentials string
+	}{
+		{"wildcard", []string{"*"}, ""},
+		{"listed origin", []string{"http://admin.example.com"}, "true"},
+		{"listed origin with wildcard", []string{"*", "http://admin.example.com"}, "true"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := CORS(tt.origins)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/api/test", nil)
+			req.Header.Set("Origin", "http://admin.example.com")
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if got := w.Header().Get("Access-Control-Allow-Credentials"); got != tt.wantCredentials {
+				t.Errorf("expected Access-Control-Allow-Credentials=%q, got %q", tt.wantCredentials, got)
+			}
+		})
+	}
+}
@@ -5,20 +5,45 @@ import (
 	"io"
 	"net/http"
 	"strings"
+
+	"github.com/warriorguo/ozx_apm/server/internal/metrics"
 )
 
 func Decompress(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if strings.Contains(r.Header.Get("Content-Encoding"), "gzip") {
-			gz, err := gzip.NewReader(r.Body)
+			compressed := &countingReader{r: r.Body}
+			gz, err := gzip.NewReader(compressed)
 			if err != nil {
 				http.Error(w, "invalid gzip content", http.StatusBadRequest)
 				return
 			}
 			defer gz.Close()
-			r.Body = io.NopCloser(gz)
+			decompressed := &countingReader{r: gz}
+			r.Body = io.NopCloser(decompressed)
 			r.Header.Del("Content-Encoding")
+
+			defer func() {
+				if compressed.n == 0 {
+					return
+				}
+				metrics.DecompressedBytes.WithLabelValues("compressed").Add(float64(compressed.n))
+				metrics.DecompressedBytes.WithLabelValues("decompressed").Add(float64(decompressed.n))
+				metrics.DecompressionRatio.Observe(float64(decompressed.n) / float64(compressed.n))
+			}()
 		}
 		next.ServeHTTP(w, r)
 	})
 }
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -7,6 +7,10 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/warriorguo/ozx_apm/server/internal/metrics"
 )
 
 func TestDecompress(t *testing.T) {
@@ -178,3 +182,31 @@ func TestDecompress_NoContentEncoding(t *testing.T) {
 		t.Errorf("expected body 'plain data', got %s", w.Body.String())
 	}
 }
+
+func TestDecompress_Metrics(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+	})
+
+	plain := bytes.Repeat([]byte(`{"type":"perf_sample","fps":60}`), 100)
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	gw.Write(plain)
+	gw.Close()
+	compressedLen := buf.Len()
+
+	compressed := metrics.DecompressedBytes.WithLabelValues("compressed")
+	decompressed := metrics.DecompressedBytes.WithLabelValues("decompressed")
+	beforeIn, beforeOut := testutil.ToFloat64(compressed), testutil.ToFloat64(decompressed)
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/events", &buf)
+	req.Header.Set("Content-Encoding", "gzip")
+	Decompress(handler).ServeHTTP(httptest.NewRecorder(), req)
+
+	if got := testutil.ToFloat64(compressed) - beforeIn; got != float64(compressedLen) {
+		t.Errorf("expected %d compressed bytes, got %v", compressedLen, got)
+	}
+	if got := testutil.ToFloat64(decompressed) - beforeOut; got != float64(len(plain)) {
+		t.Errorf("expected %d decompressed bytes, got %v", len(plain), got)
+	}
+}
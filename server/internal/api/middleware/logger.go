@@ -2,30 +2,62 @@ package middleware
 
 import (
 	"net/http"
+	"strconv"
 	"time"
 
+	"github.com/go-chi/chi/v5"
 	chiMiddleware "github.com/go-chi/chi/v5/middleware"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
+
+	"github.com/warriorguo/ozx_apm/server/internal/metrics"
 )
 
+// Logger logs every request and records its count and latency. Metrics are
+// labeled with the chi route pattern rather than the path, so IDs in the URL
+// do not blow up their cardinality. Log lines carry the request ID and, when
+// the request is traced, the trace ID.
 func Logger(logger *zap.Logger) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			start := time.Now()
 			ww := chiMiddleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			metrics.HTTPInFlight.Inc()
 
 			defer func() {
-				logger.Info("request",
+				duration := time.Since(start)
+				metrics.HTTPInFlight.Dec()
+				route := routePattern(r)
+				metrics.HTTPRequests.WithLabelValues(route, r.Method, strconv.Itoa(ww.Status())).Inc()
+				metrics.HTTPRequestDuration.WithLabelValues(route, r.Method).Observe(duration.Seconds())
+
+				fields := []zap.Field{
 					zap.String("method", r.Method),
 					zap.String("path", r.URL.Path),
 					zap.Int("status", ww.Status()),
 					zap.Int("bytes", ww.BytesWritten()),
-					zap.Duration("duration", time.Since(start)),
+					zap.Duration("duration", duration),
 					zap.String("request_id", chiMiddleware.GetReqID(r.Context())),
-				)
+				}
+				// Set when Tracing runs before Logger
+				if sc := trace.SpanContextFromContext(r.Context()); sc.IsValid() {
+					fields = append(fields, zap.String("trace_id", sc.TraceID().String()))
+				}
+				logger.Info("request", fields...)
 			}()
 
 			next.ServeHTTP(ww, r)
 		})
 	}
 }
+
+// routePattern returns the pattern of the route that served r, which is
+// only known once routing is done
+func routePattern(r *http.Request) string {
+	if rctx := chi.RouteContext(r.Context()); rctx != nil {
+		if pattern := rctx.RoutePattern(); pattern != "" {
+			return pattern
+		}
+	}
+	return "unmatched"
+}
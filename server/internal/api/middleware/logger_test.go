@@ -7,8 +7,12 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+
+	"github.com/warriorguo/ozx_apm/server/internal/metrics"
 )
 
 func TestLogger(t *testing.T) {
@@ -120,3 +124,25 @@ func TestLogger_Duration(t *testing.T) {
 		t.Errorf("expected log to contain duration field, log: %s", logOutput)
 	}
 }
+
+func TestLogger_MetricsUseRoutePattern(t *testing.T) {
+	r := chi.NewRouter()
+	r.Use(Logger(zap.NewNop()))
+	r.Get("/sessions/{session_id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	requests := metrics.HTTPRequests.WithLabelValues("/sessions/{session_id}", http.MethodGet, "204")
+	before := testutil.ToFloat64(requests)
+
+	for _, id := range []string{"a", "b"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/sessions/"+id, nil))
+	}
+
+	if got := testutil.ToFloat64(requests) - before; got != 2 {
+		t.Errorf("expected 2 requests counted under the route pattern, got %v", got)
+	}
+	if got := testutil.ToFloat64(metrics.HTTPInFlight); got != 0 {
+		t.Errorf("expected no requests in flight, got %v", got)
+	}
+}
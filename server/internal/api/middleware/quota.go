@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/warriorguo/ozx_apm/server/internal/metrics"
+)
+
+// RequestLimiter decides whether an app's or device's request may proceed and
+// counts the events it delivered
+type RequestLimiter interface {
+	AllowRequest(appID string) (reason string, retryAfter time.Duration)
+	AllowDevice(appID, deviceID string) (reason string, retryAfter time.Duration)
+	AddEvents(appID string, n int)
+}
+
+type quotaKey struct{}
+
+// quotaState is what Quota shares with the handler of a request
+type quotaState struct {
+	limits RequestLimiter
+	appID  string
+	events int
+}
+
+// CountEvents reports how many events a request delivered, for quota
+// accounting. It does nothing outside of Quota.
+func CountEvents(ctx context.Context, n int) {
+	if q, ok := ctx.Value(quotaKey{}).(*quotaState); ok {
+		q.events += n
+	}
+}
+
+// AllowDevices charges a decoded request to each device its events came from.
+// Device IDs are only known once the body is decoded, so handlers call it
+// before storing anything. If a device is throttled it writes the 429 and
+// returns false. It allows everything outside of Quota.
+func AllowDevices(w http.ResponseWriter, r *http.Request, deviceIDs []string) bool {
+	q, ok := r.Context().Value(quotaKey{}).(*quotaState)
+	if !ok {
+		return true
+	}
+	for _, deviceID := range deviceIDs {
+		if reason, wait := q.limits.AllowDevice(q.appID, deviceID); reason != "" {
+			throttle(w, reason, wait)
+			return false
+		}
+	}
+	return true
+}
+
+// Quota rejects throttled requests with 429 and a Retry-After in whole
+// seconds, and charges the events the handler reports through CountEvents to
+// the app. It must run after auth so the app ID is known.
+func Quota(limits RequestLimiter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			appID := AppIDFromContext(r.Context())
+
+			if reason, wait := limits.AllowRequest(appID); reason != "" {
+				throttle(w, reason, wait)
+				return
+			}
+
+			q := &quotaState{limits: limits, appID: appID}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), quotaKey{}, q)))
+			if q.events > 0 {
+				limits.AddEvents(appID, q.events)
+			}
+		})
+	}
+}
+
+func throttle(w http.ResponseWriter, reason string, wait time.Duration) {
+	metrics.Throttled.WithLabelValues(reason).Inc()
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	http.Error(w, "rate limited: "+reason, http.StatusTooManyRequests)
+}
@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type fakeLimiter struct {
+	reason       string
+	deviceReason string
+	wait         time.Duration
+	devices      []string
+	events       map[string]int
+}
+
+func (f *fakeLimiter) AllowRequest(appID string) (string, time.Duration) {
+	return f.reason, f.wait
+}
+
+func (f *fakeLimiter) AllowDevice(appID, deviceID string) (string, time.Duration) {
+	f.devices = append(f.devices, appID+"/"+deviceID)
+	return f.deviceReason, f.wait
+}
+
+func (f *fakeLimiter) AddEvents(appID string, n int) {
+	f.events[appID] += n
+}
+
+func TestQuota_Throttled(t *testing.T) {
+	limiter := &fakeLimiter{reason: "app_rate", wait: 1500 * time.Millisecond, events: map[string]int{}}
+	called := false
+	handler := Quota(limiter)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/events", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("expected status %d, got %d", http.StatusTooManyRequests, w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "2" {
+		t.Errorf("expected Retry-After rounded up to 2, got %q", got)
+	}
+	if called {
+		t.Error("expected throttled request not to reach the handler")
+	}
+}
+
+func TestQuota_DeviceThrottled(t *testing.T) {
+	limiter := &fakeLimiter{deviceReason: "device_rate", wait: time.Second, events: map[string]int{}}
+	stored := false
+	handler := Quota(limiter)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !AllowDevices(w, r, []string{"d1"}) {
+			return
+		}
+		stored = true
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/events", nil)
+	req = req.WithContext(WithAppID(req.Context(), "game-a"))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("expected status %d, got %d", http.StatusTooManyRequests, w.Code)
+	}
+	if stored {
+		t.Error("expected throttled events not to be stored")
+	}
+	if len(limiter.devices) != 1 || limiter.devices[0] != "game-a/d1" {
+		t.Errorf("expected d1 of game-a to be charged, got %v", limiter.devices)
+	}
+}
+
+func TestAllowDevices_OutsideQuota(t *testing.T) {
+	w := httptest.NewRecorder()
+	if !AllowDevices(w, httptest.NewRequest(http.MethodPost, "/v1/events", nil), []string{"d1"}) {
+		t.Error("expected devices to be allowed without Quota")
+	}
+}
+
+func TestQuota_CountsEvents(t *testing.T) {
+	limiter := &fakeLimiter{events: map[string]int{}}
+	handler := Quota(limiter)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		CountEvents(r.Context(), 7)
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/events", nil)
+	req = req.WithContext(WithAppID(req.Context(), "game-a"))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if limiter.events["game-a"] != 7 {
+		t.Errorf("expected 7 events charged to game-a, got %d", limiter.events["game-a"])
+	}
+}
@@ -0,0 +1,222 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	SignatureHeader = "X-Signature"
+	TimestampHeader = "X-Timestamp"
+	OTLPTokenHeader = "X-OTLP-Token"
+)
+
+// SigningMode controls what happens to requests with a bad or missing
+// signature
+type SigningMode string
+
+const (
+	SigningOff     SigningMode = "off"
+	SigningLog     SigningMode = "log"
+	SigningEnforce SigningMode = "enforce"
+)
+
+// SigningKey is an app's request signing secret and enforcement mode, and
+// the static token standing in for signatures on OTLP requests
+type SigningKey struct {
+	Secret    string
+	Mode      SigningMode
+	OTLPToken string
+}
+
+// lowerKeys keys signing keys by lower-cased app ID. Config map keys arrive
+// lower-cased, so app IDs are compared that way.
+func lowerKeys(keys map[string]SigningKey) map[string]SigningKey {
+	byApp := make(map[string]SigningKey, len(keys))
+	for appID, key := range keys {
+		byApp[strings.ToLower(appID)] = key
+	}
+	return byApp
+}
+
+// Signature verifies X-Signature, the hex HMAC-SHA256 of
+// "<X-Timestamp>.<body>" under the app's secret, where X-Timestamp is in Unix
+// seconds. The body is the decompressed body, so this must run after
+// Decompress and after auth has put the app ID into the context.
+//
+// Timestamps more than maxSkew away from the server clock are rejected, as
+// are signatures already seen within replayWindow. Apps without a key or in
+// SigningOff mode are not checked; in SigningLog mode failures are logged and
+// the request is let through.
+func Signature(keys map[string]SigningKey, maxSkew, replayWindow time.Duration, logger *zap.Logger) func(http.Handler) http.Handler {
+	byApp := lowerKeys(keys)
+	replays := newReplayCache(replayWindow)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			appID := AppIDFromContext(r.Context())
+			key, ok := byApp[strings.ToLower(appID)]
+			if !ok || key.Mode == SigningOff || key.Mode == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				http.Error(w, "failed to read body", http.StatusBadRequest)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			if reason := verifySignature(r, body, key.Secret, maxSkew, replays, time.Now()); reason != "" {
+				if key.Mode != SigningEnforce {
+					logger.Warn("request signature check failed",
+						zap.String("app_id", appID),
+						zap.String("reason", reason),
+					)
+				} else {
+					http.Error(w, reason, http.StatusUnauthorized)
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// OTLPToken stands in for Signature on the OTLP receiver, whose exporters
+// can send static headers but cannot sign requests. Apps with a signing mode
+// must send their OTLPToken in X-OTLP-Token; in SigningEnforce mode apps
+// without a token cannot ingest over OTLP at all, rather than bypassing
+// signing through it. Apps without a key or in SigningOff mode are not
+// checked, and SigningLog mode only logs failures.
+func OTLPToken(keys map[string]SigningKey, logger *zap.Logger) func(http.Handler) http.Handler {
+	byApp := lowerKeys(keys)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			appID := AppIDFromContext(r.Context())
+			key, ok := byApp[strings.ToLower(appID)]
+			if !ok || key.Mode == SigningOff || key.Mode == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			status, reason := http.StatusOK, ""
+			token := r.Header.Get(OTLPTokenHeader)
+			switch {
+			case key.OTLPToken == "":
+				status, reason = http.StatusForbidden, "OTLP ingestion requires an otlp_token for apps that sign requests"
+			case token == "":
+				status, reason = http.StatusUnauthorized, "missing OTLP token"
+			case subtle.ConstantTimeCompare([]byte(token), []byte(key.OTLPToken)) != 1:
+				status, reason = http.StatusUnauthorized, "invalid OTLP token"
+			}
+			if reason != "" {
+				if key.Mode != SigningEnforce {
+					logger.Warn("OTLP token check failed",
+						zap.String("app_id", appID),
+						zap.String("reason", reason),
+					)
+				} else {
+					http.Error(w, reason, status)
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// verifySignature returns why a request's signature is not acceptable, or ""
+// if it is
+func verifySignature(r *http.Request, body []byte, secret string, maxSkew time.Duration, replays *replayCache, now time.Time) string {
+	signature := r.Header.Get(SignatureHeader)
+	if signature == "" {
+		return "missing signature"
+	}
+	timestamp := r.Header.Get(TimestampHeader)
+	if timestamp == "" {
+		return "missing timestamp"
+	}
+
+	secs, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return "invalid timestamp"
+	}
+	skew := now.Sub(time.Unix(secs, 0))
+	if skew > maxSkew || skew < -maxSkew {
+		return "timestamp outside allowed clock skew"
+	}
+
+	got, err := hex.DecodeString(signature)
+	if err != nil || !hmac.Equal(got, SignBody(secret, timestamp, body)) {
+		return "invalid signature"
+	}
+
+	if !replays.add(strings.ToLower(AppIDFromContext(r.Context()))+":"+signature, now) {
+		return "replayed request"
+	}
+	return ""
+}
+
+// SignBody returns the HMAC-SHA256 of "<timestamp>.<body>" under secret
+func SignBody(secret, timestamp string, body []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return mac.Sum(nil)
+}
+
+// replayCache remembers signatures for a window so a captured request cannot
+// be resent
+type replayCache struct {
+	window time.Duration
+
+	mu        sync.Mutex
+	seen      map[string]time.Time
+	lastPrune time.Time
+}
+
+func newReplayCache(window time.Duration) *replayCache {
+	return &replayCache{
+		window: window,
+		seen:   make(map[string]time.Time),
+	}
+}
+
+// add records a signature and reports whether it was not already seen within
+// the window
+func (c *replayCache) add(signature string, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if now.Sub(c.lastPrune) > c.window {
+		for sig, seenAt := range c.seen {
+			if now.Sub(seenAt) > c.window {
+				delete(c.seen, sig)
+			}
+		}
+		c.lastPrune = now
+	}
+
+	if seenAt, ok := c.seen[signature]; ok && now.Sub(seenAt) <= c.window {
+		return false
+	}
+	c.seen[signature] = now
+	return true
+}
@@ -0,0 +1,240 @@
+package middleware
+
+import (
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func signedRequest(appID, secret, body string, ts time.Time) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/v1/events", strings.NewReader(body))
+	timestamp := strconv.FormatInt(ts.Unix(), 10)
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, hex.EncodeToString(SignBody(secret, timestamp, []byte(body))))
+	return req.WithContext(WithAppID(req.Context(), appID))
+}
+
+func TestSignature(t *testing.T) {
+	keys := map[string]SigningKey{
+		"enforced": {Secret: "s3cret", Mode: SigningEnforce},
+		"logged":   {Secret: "s3cret", Mode: SigningLog},
+		"off":      {Secret: "s3cret", Mode: SigningOff},
+	}
+	now := time.Now()
+
+	tests := []struct {
+		name           string
+		req            func() *http.Request
+		expectedStatus int
+		expectedReason string
+	}{
+		{
+			name:           "valid signature",
+			req:            func() *http.Request { return signedRequest("enforced", "s3cret", `{"events":[]}`, now) },
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "wrong secret",
+			req:            func() *http.Request { return signedRequest("enforced", "other", `{"events":[]}`, now) },
+			expectedStatus: http.StatusUnauthorized,
+			expectedReason: "invalid signature",
+		},
+		{
+			name:           "stale timestamp",
+			req:            func() *http.Request { return signedRequest("enforced", "s3cret", `{}`, now.Add(-time.Hour)) },
+			expectedStatus: http.StatusUnauthorized,
+			expectedReason: "timestamp outside allowed clock skew",
+		},
+		{
+			name: "tampered body",
+			req: func() *http.Request {
+				req := signedRequest("enforced", "s3cret", `{"a":1}`, now)
+				req.Body = io.NopCloser(strings.NewReader(`{"a":2}`))
+				return req
+			},
+			expectedStatus: http.StatusUnauthorized,
+			expectedReason: "invalid signature",
+		},
+		{
+			name: "missing signature",
+			req: func() *http.Request {
+				req := signedRequest("enforced", "s3cret", `{}`, now)
+				req.Header.Del(SignatureHeader)
+				return req
+			},
+			expectedStatus: http.StatusUnauthorized,
+			expectedReason: "missing signature",
+		},
+		{
+			name: "invalid timestamp",
+			req: func() *http.Request {
+				req := signedRequest("enforced", "s3cret", `{}`, now)
+				req.Header.Set(TimestampHeader, "yesterday")
+				return req
+			},
+			expectedStatus: http.StatusUnauthorized,
+			expectedReason: "invalid timestamp",
+		},
+		{
+			name:           "log mode lets bad signature through",
+			req:            func() *http.Request { return signedRequest("logged", "other", `{}`, now) },
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "off mode is not checked",
+			req:            func() *http.Request { return signedRequest("off", "other", `{}`, now) },
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "app without signing key is not checked",
+			req:            func() *http.Request { return signedRequest("unknown", "other", `{}`, now) },
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotBody string
+			handler := Signature(keys, 5*time.Minute, 10*time.Minute, zap.NewNop())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				b, _ := io.ReadAll(r.Body)
+				gotBody = string(b)
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			req := tt.req()
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if tt.expectedReason != "" && strings.TrimSpace(w.Body.String()) != tt.expectedReason {
+				t.Errorf("expected reason %q, got %q", tt.expectedReason, w.Body.String())
+			}
+			if w.Code == http.StatusOK && tt.name == "valid signature" && gotBody != `{"events":[]}` {
+				t.Errorf("expected body to be passed through, got %q", gotBody)
+			}
+		})
+	}
+}
+
+func TestSignature_MixedCaseAppID(t *testing.T) {
+	// Viper lower-cases the app IDs of the signing config
+	keys := map[string]SigningKey{"mygame": {Secret: "s3cret", Mode: SigningEnforce}}
+	handler := Signature(keys, 5*time.Minute, 10*time.Minute, zap.NewNop())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	unsigned := httptest.NewRequest(http.MethodPost, "/v1/events", strings.NewReader(`{}`))
+	unsigned = unsigned.WithContext(WithAppID(unsigned.Context(), "MyGame"))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, unsigned)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected unsigned MyGame request to be rejected, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, signedRequest("MyGame", "s3cret", `{}`, time.Now()))
+	if w.Code != http.StatusOK {
+		t.Errorf("expected signed MyGame request to pass, got %d", w.Code)
+	}
+
+	// Keys configured in mixed case, as tests and code may pass them, match too
+	keys = map[string]SigningKey{"MyGame": {Secret: "s3cret", Mode: SigningEnforce}}
+	handler = Signature(keys, 5*time.Minute, 10*time.Minute, zap.NewNop())(http.NotFoundHandler())
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, signedRequest("mygame", "other", `{}`, time.Now()))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected mygame request with a bad signature to be rejected, got %d", w.Code)
+	}
+}
+
+func TestSignature_RejectsReplay(t *testing.T) {
+	keys := map[string]SigningKey{"game-a": {Secret: "s3cret", Mode: SigningEnforce}}
+	handler := Signature(keys, 5*time.Minute, 10*time.Minute, zap.NewNop())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	now := time.Now()
+	first := httptest.NewRecorder()
+	handler.ServeHTTP(first, signedRequest("game-a", "s3cret", `{}`, now))
+	if first.Code != http.StatusOK {
+		t.Fatalf("expected first request to pass, got %d", first.Code)
+	}
+
+	replay := httptest.NewRecorder()
+	handler.ServeHTTP(replay, signedRequest("game-a", "s3cret", `{}`, now))
+	if replay.Code != http.StatusUnauthorized {
+		t.Errorf("expected replay to be rejected, got %d", replay.Code)
+	}
+	if strings.TrimSpace(replay.Body.String()) != "replayed request" {
+		t.Errorf("expected replay reason, got %q", replay.Body.String())
+	}
+}
+
+func TestReplayCache_Expires(t *testing.T) {
+	c := newReplayCache(time.Minute)
+	now := time.Now()
+
+	if !c.add("sig", now) {
+		t.Fatal("expected first add to succeed")
+	}
+	if c.add("sig", now.Add(30*time.Second)) {
+		t.Error("expected duplicate within window to be rejected")
+	}
+	if !c.add("sig", now.Add(2*time.Minute)) {
+		t.Error("expected signature to be accepted again after the window")
+	}
+}
+
+func TestOTLPToken(t *testing.T) {
+	keys := map[string]SigningKey{
+		"enforced":  {Secret: "s3cret", Mode: SigningEnforce, OTLPToken: "otlp-token"},
+		"tokenless": {Secret: "s3cret", Mode: SigningEnforce},
+		"logged":    {Secret: "s3cret", Mode: SigningLog},
+		"off":       {Secret: "s3cret", Mode: SigningOff},
+	}
+	handler := OTLPToken(keys, zap.NewNop())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name           string
+		appID          string
+		token          string
+		expectedStatus int
+	}{
+		{"valid token", "enforced", "otlp-token", http.StatusOK},
+		{"mixed case app", "Enforced", "otlp-token", http.StatusOK},
+		{"missing token", "enforced", "", http.StatusUnauthorized},
+		{"wrong token", "enforced", "guess", http.StatusUnauthorized},
+		{"enforced without a token configured", "tokenless", "", http.StatusForbidden},
+		{"log mode lets through", "logged", "", http.StatusOK},
+		{"off", "off", "", http.StatusOK},
+		{"unsigned app", "other", "", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/v1/logs", strings.NewReader(`{}`))
+			if tt.token != "" {
+				req.Header.Set(OTLPTokenHeader, tt.token)
+			}
+			req = req.WithContext(WithAppID(req.Context(), tt.appID))
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+		})
+	}
+}
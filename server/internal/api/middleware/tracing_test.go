@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	chiMiddleware "github.com/go-chi/chi/v5/middleware"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	var logBuf bytes.Buffer
+	core := zapcore.NewCore(zapcore.NewJSONEncoder(zap.NewDevelopmentEncoderConfig()), zapcore.AddSync(&logBuf), zapcore.DebugLevel)
+
+	r := chi.NewRouter()
+	r.Use(chiMiddleware.RequestID)
+	r.Use(Tracing)
+	r.Use(Logger(zap.New(core)))
+	r.Get("/sessions/{session_id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/sessions/abc", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("expected 1 span, got %d", len(spans))
+	}
+	span := spans[0]
+
+	if span.Name() != "GET /sessions/{session_id}" {
+		t.Errorf("expected span named after the route, got %q", span.Name())
+	}
+	if got := span.SpanContext().TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("expected the caller's trace to continue, got trace %s", got)
+	}
+	if span.Status().Code != codes.Error {
+		t.Errorf("expected an error status for a 500, got %v", span.Status())
+	}
+
+	var requestID string
+	for _, kv := range span.Attributes() {
+		if kv.Key == requestIDKey {
+			requestID = kv.Value.AsString()
+		}
+	}
+	if requestID == "" {
+		t.Error("expected the request ID on the span")
+	}
+
+	logOutput := logBuf.String()
+	if !strings.Contains(logOutput, `"trace_id":"4bf92f3577b34da6a3ce929d0e0e4736"`) || !strings.Contains(logOutput, requestID) {
+		t.Errorf("expected the trace and request IDs in the log, got %s", logOutput)
+	}
+}
@@ -0,0 +1,282 @@
+// Package params parses the query parameters shared by the SDK query API and
+// the admin API, so time ranges and pagination have the same formats,
+// defaults and limits everywhere. Malformed values are reported as field
+// errors instead of being ignored.
+package params
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultRange is the time range queried when start_time is omitted
+	DefaultRange = 24 * time.Hour
+	// Retention is how long events are kept
+	Retention = 30 * 24 * time.Hour
+	// MaxRange bounds every query's time range, leaving a day of slack over
+	// Retention for ranges not aligned to it
+	MaxRange = Retention + 24*time.Hour
+
+	// DefaultLimit is the page size when limit or page_size is omitted
+	DefaultLimit = 50
+	// MaxLimit bounds limit and page_size
+	MaxLimit = 1000
+)
+
+// FieldError describes an invalid query parameter
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Errors are the field errors of a request
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, fe := range e {
+		msgs[i] = fe.Field + ": " + fe.Message
+	}
+	return "invalid query parameters: " + strings.Join(msgs, "; ")
+}
+
+// ErrorResponse is the body of a 400 caused by invalid parameters
+type ErrorResponse struct {
+	Error  string       `json:"error"`
+	Fields []FieldError `json:"fields"`
+}
+
+// WriteError responds 400 with err's field errors
+func WriteError(w http.ResponseWriter, err error) {
+	resp := ErrorResponse{Error: "invalid query parameters", Fields: []FieldError{}}
+	var fields Errors
+	if errors.As(err, &fields) {
+		resp.Fields = fields
+	} else {
+		resp.Error = err.Error()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// Parser reads a request's query parameters, collecting an error for each
+// malformed one. Getters return defaults for invalid values, so a handler
+// reads everything it needs and then checks Err once.
+type Parser struct {
+	q    url.Values
+	now  time.Time
+	errs Errors
+}
+
+// New returns a parser for r's query string
+func New(r *http.Request) *Parser {
+	return &Parser{q: r.URL.Query(), now: time.Now()}
+}
+
+// Err returns the field errors found so far, or nil
+func (p *Parser) Err() error {
+	if len(p.errs) == 0 {
+		return nil
+	}
+	return p.errs
+}
+
+func (p *Parser) fail(field, format string, args ...interface{}) {
+	p.errs = append(p.errs, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// TimeRange parses start_time and end_time, defaulting to the DefaultRange
+// before now. Each accepts RFC3339, epoch milliseconds, or a time relative to
+// now such as -6h or -7d.
+func (p *Parser) TimeRange() (start, end time.Time) {
+	start, end, errs := parseRange(p.q.Get("start_time"), p.q.Get("end_time"), p.now, DefaultRange)
+	p.errs = append(p.errs, errs...)
+	return start, end
+}
+
+// Range parses a time range given outside the query string, such as in a
+// JSON body, with the formats and defaults of TimeRange
+func Range(startValue, endValue string, now time.Time) (start, end time.Time, err error) {
+	start, end, errs := parseRange(startValue, endValue, now, DefaultRange)
+	if len(errs) > 0 {
+		return start, end, errs
+	}
+	return start, end, nil
+}
+
+func parseRange(startValue, endValue string, now time.Time, def time.Duration) (start, end time.Time, errs Errors) {
+	end = now
+	if endValue != "" {
+		t, err := ParseTime(endValue, now)
+		if err != nil {
+			errs = append(errs, FieldError{Field: "end_time", Message: err.Error()})
+		} else {
+			end = t
+		}
+	}
+
+	start = end.Add(-def)
+	if startValue != "" {
+		t, err := ParseTime(startValue, now)
+		if err != nil {
+			errs = append(errs, FieldError{Field: "start_time", Message: err.Error()})
+		} else {
+			start = t
+		}
+	}
+
+	// Skip the range checks when a bound is malformed and was defaulted
+	if len(errs) == 0 {
+		if err := CheckRange(start, end); err != nil {
+			errs = err.(Errors)
+		}
+	}
+	return start, end, errs
+}
+
+// CheckRange validates a time range given by other means than query
+// parameters, such as a JSON body
+func CheckRange(start, end time.Time) error {
+	if !end.After(start) {
+		return Errors{{Field: "end_time", Message: "must be after start_time"}}
+	}
+	if end.Sub(start) > MaxRange {
+		return Errors{{Field: "start_time", Message: "time range must not exceed " + formatDays(MaxRange)}}
+	}
+	return nil
+}
+
+// Limit parses limit, between 1 and MaxLimit
+func (p *Parser) Limit() int {
+	return p.Int("limit", DefaultLimit, 1, MaxLimit)
+}
+
+// Offset parses offset, which must not be negative
+func (p *Parser) Offset() int {
+	return p.Int("offset", 0, 0, math.MaxInt)
+}
+
+// Page parses page, starting at 1, and page_size, which has the same bounds
+// as limit
+func (p *Parser) Page() (page, pageSize int) {
+	page = p.Int("page", 1, 1, math.MaxInt)
+	pageSize = p.Int("page_size", DefaultLimit, 1, MaxLimit)
+	return page, pageSize
+}
+
+// Int parses an integer parameter between min and max
+func (p *Parser) Int(field string, def, min, max int) int {
+	v := p.q.Get(field)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		p.fail(field, "must be an integer")
+		return def
+	}
+	if n < min || n > max {
+		if max == math.MaxInt {
+			p.fail(field, "must be at least %d", min)
+		} else {
+			p.fail(field, "must be between %d and %d", min, max)
+		}
+		return def
+	}
+	return n
+}
+
+// Required returns a parameter that must be present
+func (p *Parser) Required(field string) string {
+	v := p.q.Get(field)
+	if v == "" {
+		p.fail(field, "is required")
+	}
+	return v
+}
+
+// OneOf parses a parameter that must be one of allowed, defaulting to def
+func (p *Parser) OneOf(field, def string, allowed ...string) string {
+	v := p.q.Get(field)
+	if v == "" {
+		return def
+	}
+	for _, a := range allowed {
+		if v == a {
+			return v
+		}
+	}
+	p.fail(field, "must be one of %s", strings.Join(allowed, ", "))
+	return def
+}
+
+// Bool parses a boolean parameter such as true, false, 1 or 0
+func (p *Parser) Bool(field string, def bool) bool {
+	v := p.q.Get(field)
+	if v == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		p.fail(field, "must be true or false")
+		return def
+	}
+	return b
+}
+
+// ParseTime parses an RFC3339 time, epoch milliseconds, "now", or a negative
+// duration relative to now such as -30m, -6h or -7d
+func ParseTime(v string, now time.Time) (time.Time, error) {
+	if v == "now" {
+		return now, nil
+	}
+	if strings.HasPrefix(v, "-") {
+		d, err := parseDuration(v[1:])
+		if err != nil {
+			return time.Time{}, err
+		}
+		return now.Add(-d), nil
+	}
+	if ms, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.UnixMilli(ms), nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, errors.New("must be RFC3339, epoch milliseconds or relative to now such as -6h")
+	}
+	return t, nil
+}
+
+// parseDuration extends time.ParseDuration with d and w units
+func parseDuration(v string) (time.Duration, error) {
+	unit := time.Duration(0)
+	switch {
+	case strings.HasSuffix(v, "d"):
+		unit = 24 * time.Hour
+	case strings.HasSuffix(v, "w"):
+		unit = 7 * 24 * time.Hour
+	}
+	if unit != 0 {
+		n, err := strconv.Atoi(v[:len(v)-1])
+		if err == nil && n >= 0 {
+			return time.Duration(n) * unit, nil
+		}
+	} else if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+		return d, nil
+	}
+	return 0, errors.New("must be a relative time such as -30m, -6h or -7d")
+}
+
+func formatDays(d time.Duration) string {
+	return fmt.Sprintf("%d days", int(d/(24*time.Hour)))
+}
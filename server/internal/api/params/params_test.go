@@ -0,0 +1,237 @@
+package params
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newParser(query string) *Parser {
+	return New(httptest.NewRequest(http.MethodGet, "/"+query, nil))
+}
+
+func fields(err error) []string {
+	errs, _ := err.(Errors)
+	names := make([]string, len(errs))
+	for i, fe := range errs {
+		names[i] = fe.Field
+	}
+	return names
+}
+
+func TestParseTime(t *testing.T) {
+	now := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		in   string
+		want time.Time
+	}{
+		{"2024-01-14T10:00:00Z", time.Date(2024, 1, 14, 10, 0, 0, 0, time.UTC)},
+		{"2024-01-14T10:00:00+02:00", time.Date(2024, 1, 14, 8, 0, 0, 0, time.UTC)},
+		{"1705312800000", time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)},
+		{"now", now},
+		{"-30m", now.Add(-30 * time.Minute)},
+		{"-6h", now.Add(-6 * time.Hour)},
+		{"-1h30m", now.Add(-90 * time.Minute)},
+		{"-7d", now.Add(-7 * 24 * time.Hour)},
+		{"-2w", now.Add(-14 * 24 * time.Hour)},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseTime(tt.in, now)
+		if err != nil {
+			t.Errorf("ParseTime(%q): unexpected error: %v", tt.in, err)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("ParseTime(%q) = %s, expected %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseTime_Invalid(t *testing.T) {
+	for _, in := range []string{"yesterday", "2024-01-14", "-6x", "-d", "--6h", "-1.5d"} {
+		if _, err := ParseTime(in, time.Now()); err == nil {
+			t.Errorf("ParseTime(%q): expected error", in)
+		}
+	}
+}
+
+func TestTimeRange_Default(t *testing.T) {
+	p := newParser("")
+	start, end := p.TimeRange()
+	if err := p.Err(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := end.Sub(start); got != DefaultRange {
+		t.Errorf("expected %s, got %s", DefaultRange, got)
+	}
+	if time.Since(end) > time.Minute {
+		t.Errorf("expected end near now, got %s", end)
+	}
+}
+
+func TestTimeRange_DefaultsFromEnd(t *testing.T) {
+	p := newParser("?end_time=2024-01-15T00:00:00Z")
+	start, _ := p.TimeRange()
+	if err := p.Err(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := time.Date(2024, 1, 14, 0, 0, 0, 0, time.UTC); !start.Equal(want) {
+		t.Errorf("expected start %s, got %s", want, start)
+	}
+}
+
+func TestTimeRange_Invalid(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"?start_time=yesterday", []string{"start_time"}},
+		{"?start_time=bad&end_time=worse", []string{"end_time", "start_time"}},
+		{"?start_time=2024-01-02T00:00:00Z&end_time=2024-01-01T00:00:00Z", []string{"end_time"}},
+		{"?start_time=-1h&end_time=-1h", []string{"end_time"}},
+		{"?start_time=-60d", []string{"start_time"}},
+		{"?start_time=-31d", nil},
+	}
+
+	for _, tt := range tests {
+		p := newParser(tt.query)
+		p.TimeRange()
+		got := fields(p.Err())
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: expected errors on %v, got %v", tt.query, tt.want, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: expected errors on %v, got %v", tt.query, tt.want, got)
+			}
+		}
+	}
+}
+
+func TestPagination(t *testing.T) {
+	p := newParser("?limit=200&offset=400&page=3&page_size=25")
+	if got := p.Limit(); got != 200 {
+		t.Errorf("expected limit 200, got %d", got)
+	}
+	if got := p.Offset(); got != 400 {
+		t.Errorf("expected offset 400, got %d", got)
+	}
+	page, pageSize := p.Page()
+	if page != 3 || pageSize != 25 {
+		t.Errorf("expected page 3 size 25, got %d %d", page, pageSize)
+	}
+	if err := p.Err(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	p = newParser("")
+	page, pageSize = p.Page()
+	if p.Limit() != DefaultLimit || p.Offset() != 0 || page != 1 || pageSize != DefaultLimit {
+		t.Errorf("unexpected defaults")
+	}
+}
+
+func TestPagination_Invalid(t *testing.T) {
+	p := newParser("?limit=5000&offset=-1&page=0&page_size=abc")
+	if got := p.Limit(); got != DefaultLimit {
+		t.Errorf("expected default limit for invalid value, got %d", got)
+	}
+	p.Offset()
+	p.Page()
+
+	want := []string{"limit", "offset", "page", "page_size"}
+	got := fields(p.Err())
+	if len(got) != len(want) {
+		t.Fatalf("expected errors on %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("expected errors on %v, got %v", want, got)
+		}
+	}
+}
+
+func TestOneOfAndBool(t *testing.T) {
+	p := newParser("?sort=users&total=false")
+	if got := p.OneOf("sort", "count", "count", "users"); got != "users" {
+		t.Errorf("expected users, got %q", got)
+	}
+	if got := p.OneOf("order", "desc", "asc", "desc"); got != "desc" {
+		t.Errorf("expected default desc, got %q", got)
+	}
+	if p.Bool("total", true) {
+		t.Error("expected total false")
+	}
+	if !p.Bool("missing", true) {
+		t.Error("expected default true")
+	}
+	if err := p.Err(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	p = newParser("?sort=random&total=maybe")
+	if got := p.OneOf("sort", "count", "count", "users"); got != "count" {
+		t.Errorf("expected default for invalid value, got %q", got)
+	}
+	p.Bool("total", true)
+	if got := fields(p.Err()); len(got) != 2 || got[0] != "sort" || got[1] != "total" {
+		t.Errorf("expected errors on sort and total, got %v", got)
+	}
+}
+
+func TestRequired(t *testing.T) {
+	p := newParser("?q=crash")
+	if got := p.Required("q"); got != "crash" {
+		t.Errorf("expected crash, got %q", got)
+	}
+	if err := p.Err(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	p = newParser("?q=")
+	p.Required("q")
+	if got := fields(p.Err()); len(got) != 1 || got[0] != "q" {
+		t.Errorf("expected error on q, got %v", got)
+	}
+}
+
+func TestCheckRange(t *testing.T) {
+	now := time.Now()
+	if err := CheckRange(now.Add(-time.Hour), now); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := CheckRange(now, now.Add(-time.Hour)); err == nil {
+		t.Error("expected error for inverted range")
+	}
+	if err := CheckRange(now.Add(-MaxRange-time.Hour), now); err == nil {
+		t.Error("expected error for range over MaxRange")
+	}
+}
+
+func TestWriteError(t *testing.T) {
+	p := newParser("?limit=x")
+	p.Limit()
+
+	w := httptest.NewRecorder()
+	WriteError(w, p.Err())
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("expected JSON, got %s", ct)
+	}
+
+	var resp ErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode: %v", err)
+	}
+	if len(resp.Fields) != 1 || resp.Fields[0].Field != "limit" || resp.Fields[0].Message != "must be an integer" {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+}
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"net/http"
 	"time"
 
 	"github.com/go-chi/chi/v5"
@@ -8,42 +9,80 @@ import (
 	"github.com/go-chi/httprate"
 	"go.uber.org/zap"
 
+	"github.com/warriorguo/ozx_apm/server/internal/adminauth"
 	"github.com/warriorguo/ozx_apm/server/internal/api/handlers"
 	"github.com/warriorguo/ozx_apm/server/internal/api/middleware"
 	"github.com/warriorguo/ozx_apm/server/internal/config"
+	"github.com/warriorguo/ozx_apm/server/internal/keystore"
+	"github.com/warriorguo/ozx_apm/server/internal/metrics"
+	"github.com/warriorguo/ozx_apm/server/internal/processor"
+	"github.com/warriorguo/ozx_apm/server/internal/quota"
+	"github.com/warriorguo/ozx_apm/server/internal/remoteconfig"
 	"github.com/warriorguo/ozx_apm/server/internal/storage"
 )
 
 // NewRouter creates the SDK ingestion API router (separate from admin API)
-func NewRouter(cfg *config.Config, repo *storage.Repository, logger *zap.Logger) *chi.Mux {
+func NewRouter(cfg *config.Config, repo *storage.Repository, keys *keystore.Store, limits *quota.Limits, remote *remoteconfig.Store, stats *processor.Aggregator, logger *zap.Logger) *chi.Mux {
 	r := chi.NewRouter()
 
 	// Global middleware
 	r.Use(chiMiddleware.RequestID)
 	r.Use(chiMiddleware.RealIP)
+	r.Use(middleware.Tracing)
 	r.Use(middleware.Logger(logger))
 	r.Use(chiMiddleware.Recoverer)
 	r.Use(middleware.Decompress)
 
-	// Rate limiting
+	// Per-IP rate limiting; per-app and per-device limits apply to ingestion
 	if cfg.RateLimit.Enabled {
-		r.Use(httprate.LimitByIP(cfg.RateLimit.RequestsPerMin, time.Minute))
+		r.Use(httprate.Limit(cfg.RateLimit.RequestsPerMin, time.Minute,
+			httprate.WithKeyFuncs(httprate.KeyByIP),
+			httprate.WithLimitHandler(func(w http.ResponseWriter, r *http.Request) {
+				metrics.Throttled.WithLabelValues("ip").Inc()
+				http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+			}),
+		))
 	}
 
 	// Health check (no auth required)
 	healthHandler := handlers.NewHealthHandler(repo)
 	r.Get("/health", healthHandler.Health)
 
+	// Prometheus metrics, here only when there is no admin server to serve them
+	if !cfg.AdminServer.Enabled {
+		mountMetrics(r, cfg.Metrics, stats, nil, logger)
+	}
+
 	// API v1 routes (SDK ingestion)
 	r.Route("/v1", func(r chi.Router) {
 		// Auth middleware for v1 routes
 		if cfg.Auth.Enabled {
-			r.Use(middleware.Auth(cfg.Auth.AppKeys))
+			r.Use(middleware.KeyAuth(keys))
+		}
+
+		// Ingest handler, with optional per-app request signing and quotas
+		var sampler handlers.PerfSampler
+		if remote != nil {
+			sampler = remote
+		}
+		ingestHandler := handlers.NewIngestHandler(repo, sampler, stats, logger)
+		var quotas []func(http.Handler) http.Handler
+		if cfg.RateLimit.QuotasEnabled && limits != nil {
+			quotas = append(quotas, middleware.Quota(limits))
 		}
+		signed, otlpSigned := signing(cfg.Auth.Signing, logger)
+		ingest := append(signed, quotas...)
+		r.With(ingest...).Post("/events", ingestHandler.IngestEvents)
+
+		// OTLP/HTTP receiver; OpenTelemetry exporters cannot sign requests,
+		// so apps that sign send a static token instead
+		otlp := append(otlpSigned, quotas...)
+		r.With(otlp...).Post("/logs", ingestHandler.IngestOTLPLogs)
+		r.With(otlp...).Post("/metrics", ingestHandler.IngestOTLPMetrics)
 
-		// Ingest handler
-		ingestHandler := handlers.NewIngestHandler(repo, logger)
-		r.Post("/events", ingestHandler.IngestEvents)
+		// Remote SDK configuration
+		configHandler := handlers.NewConfigHandler(remote, logger)
+		r.Get("/config", configHandler.GetConfig)
 
 		// Query handlers
 		queryHandler := handlers.NewQueryHandler(repo, logger)
@@ -56,3 +95,55 @@ func NewRouter(cfg *config.Config, repo *storage.Repository, logger *zap.Logger)
 
 	return r
 }
+
+// mountMetrics serves the server's own metrics on /metrics and real-time
+// game KPIs on /metrics/game. They take the configured scrape token, or else
+// an admin session with viewer access to every app when authn is not nil.
+// With neither they are not served at all.
+func mountMetrics(r chi.Router, cfg config.MetricsConfig, stats *processor.Aggregator, authn *adminauth.Authenticator, logger *zap.Logger) {
+	if !cfg.Enabled && !cfg.Game.Enabled {
+		return
+	}
+	if cfg.Token == "" && authn == nil {
+		logger.Warn("metrics endpoints disabled: set metrics.token or enable admin_server.auth")
+		return
+	}
+
+	r.Group(func(r chi.Router) {
+		if cfg.Token != "" {
+			r.Use(middleware.BearerToken(cfg.Token))
+		} else {
+			// The KPIs cover every app, so a role on one app is not enough
+			r.Use(middleware.AdminAuth(authn), middleware.RequireRole(adminauth.RoleViewer))
+		}
+
+		if cfg.Enabled {
+			r.Handle("/metrics", metrics.Handler())
+		}
+		if cfg.Game.Enabled && stats != nil {
+			r.Handle("/metrics/game", metrics.GameHandler(metrics.NewGameCollector(stats, cfg.Game.MaxApps, cfg.Game.MaxVersions, cfg.Game.MaxPlatforms)))
+		}
+	})
+}
+
+// signing returns the request signing middleware for SDK events and its
+// token check for OTLP requests, if any app has a signing mode configured
+func signing(cfg config.SigningConfig, logger *zap.Logger) (events, otlp []func(http.Handler) http.Handler) {
+	if len(cfg.Apps) == 0 {
+		return nil, nil
+	}
+
+	keys := make(map[string]middleware.SigningKey, len(cfg.Apps))
+	for appID, app := range cfg.Apps {
+		keys[appID] = middleware.SigningKey{
+			Secret:    app.Secret,
+			Mode:      middleware.SigningMode(app.Mode),
+			OTLPToken: app.OTLPToken,
+		}
+	}
+	events = []func(http.Handler) http.Handler{
+		middleware.Signature(keys, cfg.MaxSkew, cfg.ReplayWindow, logger),
+	}
+	otlp = []func(http.Handler) http.Handler{middleware.OTLPToken(keys, logger)}
+	return events, otlp
+}
@@ -7,20 +7,27 @@ import (
 	chiMiddleware "github.com/go-chi/chi/v5/middleware"
 	"go.uber.org/zap"
 
+	"github.com/warriorguo/ozx_apm/server/internal/adminauth"
 	"github.com/warriorguo/ozx_apm/server/internal/api/handlers/admin"
 	"github.com/warriorguo/ozx_apm/server/internal/api/middleware"
 	"github.com/warriorguo/ozx_apm/server/internal/config"
+	"github.com/warriorguo/ozx_apm/server/internal/keystore"
+	"github.com/warriorguo/ozx_apm/server/internal/processor"
+	"github.com/warriorguo/ozx_apm/server/internal/quota"
+	"github.com/warriorguo/ozx_apm/server/internal/remoteconfig"
 	"github.com/warriorguo/ozx_apm/server/internal/storage"
 )
 
-// NewAdminRouter creates the admin API router (separate from SDK ingestion API)
-func NewAdminRouter(cfg *config.Config, repo *storage.Repository, logger *zap.Logger) *chi.Mux {
+// NewAdminRouter creates the admin API router (separate from SDK ingestion API).
+// authn is nil when admin auth is disabled.
+func NewAdminRouter(cfg *config.Config, repo *storage.Repository, keys *keystore.Store, limits *quota.Limits, remote *remoteconfig.Store, stats *processor.Aggregator, authn *adminauth.Authenticator, logger *zap.Logger) *chi.Mux {
 	r := chi.NewRouter()
 
 	// Global middleware
 	r.Use(chiMiddleware.RequestID)
 	r.Use(chiMiddleware.RealIP)
 	r.Use(middleware.CORS(cfg.AdminServer.AllowedOrigins))
+	r.Use(middleware.Tracing)
 	r.Use(middleware.Logger(logger))
 	r.Use(chiMiddleware.Recoverer)
 
@@ -30,24 +37,140 @@ func NewAdminRouter(cfg *config.Config, repo *storage.Repository, logger *zap.Lo
 		w.Write([]byte(`{"status":"ok","service":"admin"}`))
 	})
 
+	// Prometheus metrics of both servers
+	mountMetrics(r, cfg.Metrics, stats, authn, logger)
+
+	// Login endpoints
+	if authn != nil {
+		authHandler := admin.NewAuthHandler(authn, logger)
+		r.Route("/auth", func(r chi.Router) {
+			r.Post("/login", authHandler.Login)
+			r.Post("/logout", authHandler.Logout)
+			r.With(middleware.AdminAuth(authn)).Get("/me", authHandler.Me)
+			r.Get("/oidc/login", authHandler.OIDCLogin)
+			r.Get("/oidc/callback", authHandler.OIDCCallback)
+		})
+	}
+
+	// requireRole and requireQueryRole are no-ops when admin auth is disabled
+	requireRole := func(role adminauth.Role) func(http.Handler) http.Handler {
+		if authn == nil {
+			return func(next http.Handler) http.Handler { return next }
+		}
+		return middleware.RequireRole(role)
+	}
+	requireQueryRole := func(role adminauth.Role) func(http.Handler) http.Handler {
+		if authn == nil {
+			return func(next http.Handler) http.Handler { return next }
+		}
+		return middleware.RequireQueryRole(role)
+	}
+
+	var auditSink middleware.AuditSink
+	if repo != nil {
+		auditSink = repo
+	}
+
 	// Admin API routes
 	r.Route("/api", func(r chi.Router) {
-		// Dashboard handlers
-		dashboardHandler := admin.NewDashboardHandler(repo, logger)
-		r.Get("/summary", dashboardHandler.GetSummary)
-		r.Get("/timeseries", dashboardHandler.GetTimeSeries)
-		r.Get("/distribution", dashboardHandler.GetDistribution)
-		r.Get("/versions", dashboardHandler.GetAppVersions)
-		r.Get("/scenes", dashboardHandler.GetScenes)
-
-		// Crash handlers
-		crashHandler := admin.NewCrashHandler(repo, logger)
-		r.Get("/crashes", crashHandler.ListCrashes)
-		r.Get("/crashes/detail", crashHandler.GetCrashDetail)
-
-		// Exception handlers
-		exceptionHandler := admin.NewExceptionHandler(repo, logger)
-		r.Get("/exceptions", exceptionHandler.ListExceptions)
+		if authn != nil {
+			r.Use(middleware.AdminAuth(authn))
+		}
+
+		// Read-only views, all scoped by the app_id query parameter
+		r.Group(func(r chi.Router) {
+			r.Use(requireQueryRole(adminauth.RoleViewer))
+
+			// Dashboard handlers
+			dashboardHandler := admin.NewDashboardHandler(repo, logger)
+			r.Get("/summary", dashboardHandler.GetSummary)
+			r.Get("/timeseries", dashboardHandler.GetTimeSeries)
+			r.Get("/distribution", dashboardHandler.GetDistribution)
+			r.Get("/versions", dashboardHandler.GetAppVersions)
+			r.Get("/scenes", dashboardHandler.GetScenes)
+			r.Get("/scenes/report", dashboardHandler.GetSceneReport)
+			r.Get("/janks/analysis", dashboardHandler.GetJankAnalysis)
+			r.Get("/memory/leaks", dashboardHandler.GetMemoryLeaks)
+
+			// Crash handlers
+			crashHandler := admin.NewCrashHandler(repo, logger)
+			r.Get("/crashes", crashHandler.ListCrashes)
+			r.Get("/crashes/detail", crashHandler.GetCrashDetail)
+			r.Get("/crash-free", crashHandler.GetCrashFreeStats)
+
+			// Exception handlers
+			exceptionHandler := admin.NewExceptionHandler(repo, logger)
+			r.Get("/exceptions", exceptionHandler.ListExceptions)
+
+			// Full-text search over crashes and exceptions
+			searchHandler := admin.NewSearchHandler(repo, logger)
+			r.Get("/search", searchHandler.Search)
+
+			// Session handlers
+			sessionHandler := admin.NewSessionHandler(repo, logger)
+			r.Get("/sessions", sessionHandler.ListSessions)
+			r.Get("/sessions/stats", sessionHandler.GetSessionStats)
+			r.Get("/sessions/{session_id}", sessionHandler.GetSession)
+			r.Get("/sessions/{session_id}/timeline", sessionHandler.GetSessionTimeline)
+
+			// Device handlers
+			deviceHandler := admin.NewDeviceHandler(repo, logger)
+			r.Get("/devices", deviceHandler.SearchDevices)
+			r.Get("/devices/{device_id}", deviceHandler.GetDevice)
+
+			// Release handlers
+			releaseHandler := admin.NewReleaseHandler(repo, logger)
+			r.Get("/releases", releaseHandler.ListReleases)
+			r.Get("/releases/compare", releaseHandler.CompareReleases)
+
+			// Generic metric queries
+			metricQueryHandler := admin.NewMetricQueryHandler(repo, logger)
+			r.Post("/query", metricQueryHandler.Query)
+
+			// Grafana JSON datasource
+			grafanaHandler := admin.NewGrafanaHandler(repo, logger)
+			r.Route("/grafana", func(r chi.Router) {
+				r.Get("/", grafanaHandler.TestDatasource)
+				r.Post("/search", grafanaHandler.Search)
+				r.Post("/query", grafanaHandler.Query)
+				r.Post("/annotations", grafanaHandler.Annotations)
+			})
+
+			// Ingest quota usage
+			quotaHandler := admin.NewQuotaHandler(limits, logger)
+			r.Get("/quotas", quotaHandler.GetQuotas)
+		})
+
+		// Remote SDK configuration
+		remoteConfigHandler := admin.NewRemoteConfigHandler(repo, remote, logger)
+		r.With(requireRole(adminauth.RoleViewer)).Get("/apps/{app_id}/config", remoteConfigHandler.ListConfigs)
+		r.Group(func(r chi.Router) {
+			r.Use(requireRole(adminauth.RoleDeveloper))
+			r.Use(middleware.Audit(auditSink, logger))
+			r.Put("/apps/{app_id}/config", remoteConfigHandler.PutConfig)
+			r.Delete("/apps/{app_id}/config", remoteConfigHandler.DeleteConfig)
+		})
+
+		// Audit log, scoped by the app_id query parameter
+		auditHandler := admin.NewAuditHandler(repo, logger)
+		r.With(requireQueryRole(adminauth.RoleAdmin)).Get("/audit", auditHandler.ListAuditLog)
+
+		// App and API key management. Listing and creating apps span all apps.
+		appHandler := admin.NewAppHandler(repo, keys, logger)
+		r.With(requireRole(adminauth.RoleViewer)).Get("/apps", appHandler.ListApps)
+		r.Group(func(r chi.Router) {
+			r.Use(requireRole(adminauth.RoleAdmin))
+			r.Get("/apps/{app_id}/keys", appHandler.ListKeys)
+
+			// Mutations are audited
+			r.Group(func(r chi.Router) {
+				r.Use(middleware.Audit(auditSink, logger))
+				r.Post("/apps", appHandler.CreateApp)
+				r.Post("/apps/{app_id}/keys", appHandler.CreateKey)
+				r.Post("/apps/{app_id}/keys/{key_id}/rotate", appHandler.RotateKey)
+				r.Delete("/apps/{app_id}/keys/{key_id}", appHandler.RevokeKey)
+			})
+		})
 	})
 
 	// Serve static files for admin UI (if exists)
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"fmt"
 	"net/url"
 	"os"
 	"strconv"
@@ -17,6 +18,8 @@ type Config struct {
 	Auth        AuthConfig        `mapstructure:"auth"`
 	RateLimit   RateLimitConfig   `mapstructure:"ratelimit"`
 	Alert       AlertConfig       `mapstructure:"alert"`
+	Metrics     MetricsConfig     `mapstructure:"metrics"`
+	Tracing     TracingConfig     `mapstructure:"tracing"`
 }
 
 type ServerConfig struct {
@@ -28,12 +31,37 @@ type ServerConfig struct {
 }
 
 type AdminServerConfig struct {
-	Enabled        bool          `mapstructure:"enabled"`
-	Host           string        `mapstructure:"host"`
-	Port           int           `mapstructure:"port"`
-	ReadTimeout    time.Duration `mapstructure:"read_timeout"`
-	WriteTimeout   time.Duration `mapstructure:"write_timeout"`
-	AllowedOrigins []string      `mapstructure:"allowed_origins"`
+	Enabled        bool            `mapstructure:"enabled"`
+	Host           string          `mapstructure:"host"`
+	Port           int             `mapstructure:"port"`
+	ReadTimeout    time.Duration   `mapstructure:"read_timeout"`
+	WriteTimeout   time.Duration   `mapstructure:"write_timeout"`
+	AllowedOrigins []string        `mapstructure:"allowed_origins"`
+	Auth           AdminAuthConfig `mapstructure:"auth"`
+}
+
+// AdminAuthConfig configures login for the admin server
+type AdminAuthConfig struct {
+	Enabled     bool              `mapstructure:"enabled"`
+	TokenSecret string            `mapstructure:"token_secret"` // HMAC key for session tokens
+	SessionTTL  time.Duration     `mapstructure:"session_ttl"`
+	Users       []AdminUserConfig `mapstructure:"users"`
+	OIDC        OIDCConfig        `mapstructure:"oidc"`
+}
+
+// AdminUserConfig is an admin user. Users without a password hash can only
+// log in through OIDC, matched by email.
+type AdminUserConfig struct {
+	Username     string            `mapstructure:"username"`
+	PasswordHash string            `mapstructure:"password_hash"` // bcrypt
+	Roles        map[string]string `mapstructure:"roles"`         // app ID or "*" -> viewer, developer or admin
+}
+
+type OIDCConfig struct {
+	Issuer       string `mapstructure:"issuer"`
+	ClientID     string `mapstructure:"client_id"`
+	ClientSecret string `mapstructure:"client_secret"`
+	RedirectURL  string `mapstructure:"redirect_url"`
 }
 
 type ClickHouseConfig struct {
@@ -47,11 +75,61 @@ type ClickHouseConfig struct {
 type AuthConfig struct {
 	Enabled bool              `mapstructure:"enabled"`
 	AppKeys map[string]string `mapstructure:"app_keys"` // app_key -> app_name
+	// KeyCacheTTL is how long keys managed through the admin API are cached
+	KeyCacheTTL time.Duration `mapstructure:"key_cache_ttl"`
+	Signing     SigningConfig `mapstructure:"signing"`
+}
+
+// SigningConfig configures HMAC request signing for SDK ingestion
+type SigningConfig struct {
+	MaxSkew      time.Duration               `mapstructure:"max_skew"`
+	ReplayWindow time.Duration               `mapstructure:"replay_window"`
+	Apps         map[string]AppSigningConfig `mapstructure:"apps"` // app ID -> signing settings
+}
+
+type AppSigningConfig struct {
+	Secret string `mapstructure:"secret"`
+	Mode   string `mapstructure:"mode"` // off, log or enforce
+	// OTLPToken is sent by OpenTelemetry exporters, which cannot sign
+	// requests, in the X-OTLP-Token header. Without one, apps in enforce
+	// mode cannot ingest over OTLP.
+	OTLPToken string `mapstructure:"otlp_token"`
+}
+
+// validate rejects unknown modes, so a typo cannot silently turn
+// enforcement off
+func (c SigningConfig) validate() error {
+	for appID, app := range c.Apps {
+		switch app.Mode {
+		case "", "off":
+		case "log", "enforce":
+			if app.Secret == "" {
+				return fmt.Errorf("auth.signing.apps.%s: secret required in %s mode", appID, app.Mode)
+			}
+		default:
+			return fmt.Errorf("auth.signing.apps.%s: unknown mode %q", appID, app.Mode)
+		}
+	}
+	return nil
 }
 
 type RateLimitConfig struct {
-	Enabled        bool `mapstructure:"enabled"`
-	RequestsPerMin int  `mapstructure:"requests_per_min"`
+	Enabled        bool `mapstructure:"enabled"`          // per-IP limit
+	RequestsPerMin int  `mapstructure:"requests_per_min"` // per client IP
+
+	// QuotasEnabled turns on the ingest limits below, independently of the
+	// per-IP limit
+	QuotasEnabled bool `mapstructure:"quotas_enabled"`
+
+	// Token buckets for event ingestion; a rate of 0 means unlimited
+	AppRate     float64 `mapstructure:"app_rate"` // requests per second per app
+	AppBurst    int     `mapstructure:"app_burst"`
+	DeviceRate  float64 `mapstructure:"device_rate"` // requests per second per device
+	DeviceBurst int     `mapstructure:"device_burst"`
+
+	// Events accepted per app per UTC day; 0 means unlimited
+	DailyEvents    int64            `mapstructure:"daily_events"`
+	AppDailyEvents map[string]int64 `mapstructure:"app_daily_events"` // app ID -> daily cap override
 }
 
 type AlertConfig struct {
@@ -59,6 +137,53 @@ type AlertConfig struct {
 	WebhookURL string `mapstructure:"webhook_url"`
 }
 
+// MetricsConfig configures the Prometheus /metrics endpoint. It is served by
+// the admin server, or by the SDK server when the admin server is disabled.
+// Scrapers must send Token as a bearer token when it is set; otherwise the
+// admin server requires an admin session when admin auth is enabled, and the
+// endpoints are not served when it is not.
+type MetricsConfig struct {
+	Enabled bool              `mapstructure:"enabled"`
+	Token   string            `mapstructure:"token"`
+	Game    GameMetricsConfig `mapstructure:"game"`
+}
+
+// GameMetricsConfig configures /metrics/game, real-time game KPIs served next
+// to /metrics. Apps beyond the busiest MaxApps, and versions and platforms of
+// an app beyond the busiest MaxVersions and MaxPlatforms, are reported as
+// "other"; 0 means no limit.
+type GameMetricsConfig struct {
+	Enabled      bool `mapstructure:"enabled"`
+	MaxApps      int  `mapstructure:"max_apps"`
+	MaxVersions  int  `mapstructure:"max_versions"`
+	MaxPlatforms int  `mapstructure:"max_platforms"`
+}
+
+// TracingConfig configures OpenTelemetry tracing of requests, ClickHouse
+// queries and alert evaluation
+type TracingConfig struct {
+	Enabled     bool    `mapstructure:"enabled"`
+	Exporter    string  `mapstructure:"exporter"` // otlp or stdout
+	Endpoint    string  `mapstructure:"endpoint"` // OTLP/HTTP host:port; empty uses OTEL_EXPORTER_OTLP_ENDPOINT
+	Insecure    bool    `mapstructure:"insecure"` // plain HTTP to the OTLP endpoint
+	SampleRatio float64 `mapstructure:"sample_ratio"`
+}
+
+func (c TracingConfig) validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	switch c.Exporter {
+	case "otlp", "stdout":
+	default:
+		return fmt.Errorf("tracing.exporter: unknown exporter %q", c.Exporter)
+	}
+	if c.SampleRatio < 0 || c.SampleRatio > 1 {
+		return fmt.Errorf("tracing.sample_ratio: %v is not between 0 and 1", c.SampleRatio)
+	}
+	return nil
+}
+
 func Load() (*Config, error) {
 	viper.SetConfigName("config")
 	viper.SetConfigType("yaml")
@@ -78,7 +203,9 @@ func Load() (*Config, error) {
 	viper.SetDefault("admin_server.port", 8081)
 	viper.SetDefault("admin_server.read_timeout", "30s")
 	viper.SetDefault("admin_server.write_timeout", "30s")
-	viper.SetDefault("admin_server.allowed_origins", []string{"*"})
+	viper.SetDefault("admin_server.allowed_origins", []string{})
+	viper.SetDefault("admin_server.auth.enabled", false)
+	viper.SetDefault("admin_server.auth.session_ttl", "12h")
 
 	viper.SetDefault("clickhouse.host", "localhost")
 	viper.SetDefault("clickhouse.port", 9000)
@@ -87,9 +214,26 @@ func Load() (*Config, error) {
 	viper.SetDefault("clickhouse.password", "")
 
 	viper.SetDefault("auth.enabled", false)
+	viper.SetDefault("auth.key_cache_ttl", "1m")
+	viper.SetDefault("auth.signing.max_skew", "5m")
+	viper.SetDefault("auth.signing.replay_window", "10m")
 	viper.SetDefault("ratelimit.enabled", true)
 	viper.SetDefault("ratelimit.requests_per_min", 1000)
+	viper.SetDefault("ratelimit.quotas_enabled", true)
+	viper.SetDefault("ratelimit.app_rate", 0)
+	viper.SetDefault("ratelimit.app_burst", 100)
+	viper.SetDefault("ratelimit.device_rate", 1)
+	viper.SetDefault("ratelimit.device_burst", 10)
+	viper.SetDefault("ratelimit.daily_events", 0)
 	viper.SetDefault("alert.enabled", false)
+	viper.SetDefault("metrics.enabled", true)
+	viper.SetDefault("metrics.game.enabled", true)
+	viper.SetDefault("metrics.game.max_apps", 10)
+	viper.SetDefault("metrics.game.max_versions", 20)
+	viper.SetDefault("metrics.game.max_platforms", 10)
+	viper.SetDefault("tracing.enabled", false)
+	viper.SetDefault("tracing.exporter", "otlp")
+	viper.SetDefault("tracing.sample_ratio", 1.0)
 
 	// Read environment variables
 	viper.AutomaticEnv()
@@ -102,6 +246,12 @@ func Load() (*Config, error) {
 	if err := viper.Unmarshal(&cfg); err != nil {
 		return nil, err
 	}
+	if err := cfg.Auth.Signing.validate(); err != nil {
+		return nil, err
+	}
+	if err := cfg.Tracing.validate(); err != nil {
+		return nil, err
+	}
 
 	// Override ClickHouse config if DATABASE_URL is set
 	if dbURL := os.Getenv("DATABASE_URL"); dbURL != "" {
@@ -61,11 +61,30 @@ func TestLoad_Defaults(t *testing.T) {
 	if cfg.RateLimit.RequestsPerMin != 1000 {
 		t.Errorf("expected ratelimit.requests_per_min=1000, got %d", cfg.RateLimit.RequestsPerMin)
 	}
+	if !cfg.RateLimit.QuotasEnabled {
+		t.Error("expected ratelimit.quotas_enabled=true by default")
+	}
 
 	// Check alert defaults
 	if cfg.Alert.Enabled {
 		t.Error("expected alert.enabled=false by default")
 	}
+
+	// Check metrics defaults
+	if !cfg.Metrics.Enabled {
+		t.Error("expected metrics.enabled=true by default")
+	}
+	if !cfg.Metrics.Game.Enabled || cfg.Metrics.Game.MaxVersions != 20 || cfg.Metrics.Game.MaxPlatforms != 10 {
+		t.Errorf("expected game metrics on with 20 versions and 10 platforms, got %+v", cfg.Metrics.Game)
+	}
+
+	// Check tracing defaults
+	if cfg.Tracing.Enabled {
+		t.Error("expected tracing.enabled=false by default")
+	}
+	if cfg.Tracing.Exporter != "otlp" || cfg.Tracing.SampleRatio != 1 {
+		t.Errorf("expected otlp exporter sampling everything, got %+v", cfg.Tracing)
+	}
 }
 
 func TestLoad_EnvironmentVariables(t *testing.T) {
@@ -162,6 +181,52 @@ func TestAuthConfig(t *testing.T) {
 	}
 }
 
+func TestSigningConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		app     AppSigningConfig
+		wantErr bool
+	}{
+		{"off without secret", AppSigningConfig{Mode: "off"}, false},
+		{"empty mode", AppSigningConfig{}, false},
+		{"log", AppSigningConfig{Secret: "s", Mode: "log"}, false},
+		{"enforce", AppSigningConfig{Secret: "s", Mode: "enforce"}, false},
+		{"enforce without secret", AppSigningConfig{Mode: "enforce"}, true},
+		{"unknown mode", AppSigningConfig{Secret: "s", Mode: "enfroce"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := SigningConfig{Apps: map[string]AppSigningConfig{"game-a": tt.app}}
+			if err := cfg.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("expected error=%v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestTracingConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     TracingConfig
+		wantErr bool
+	}{
+		{"disabled", TracingConfig{}, false},
+		{"otlp", TracingConfig{Enabled: true, Exporter: "otlp", SampleRatio: 1}, false},
+		{"stdout", TracingConfig{Enabled: true, Exporter: "stdout", SampleRatio: 0.1}, false},
+		{"unknown exporter", TracingConfig{Enabled: true, Exporter: "jaeger", SampleRatio: 1}, true},
+		{"ratio above 1", TracingConfig{Enabled: true, Exporter: "otlp", SampleRatio: 2}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.cfg.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("expected error=%v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
 func TestRateLimitConfig(t *testing.T) {
 	cfg := RateLimitConfig{
 		Enabled:        true,
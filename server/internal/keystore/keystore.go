@@ -0,0 +1,160 @@
+package keystore
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/warriorguo/ozx_apm/server/internal/models"
+)
+
+// KeyPrefix starts every generated key, so leaked keys are easy to grep for
+const KeyPrefix = "ozx_"
+
+// displayPrefixLen is how much of a key is kept in clear for identification
+const displayPrefixLen = len(KeyPrefix) + 8
+
+// Source loads the persisted API keys of an app, or of all apps if appID is
+// empty
+type Source interface {
+	ListAPIKeys(ctx context.Context, appID string) ([]models.APIKey, error)
+}
+
+// Store resolves SDK app keys to app IDs. Persisted keys are cached in memory
+// and reloaded from the source once the cache is older than ttl; keys from
+// static configuration never expire.
+type Store struct {
+	source Source
+	static map[string]string // key hash -> app ID
+	ttl    time.Duration
+	logger *zap.Logger
+
+	mu       sync.RWMutex
+	keys     map[string]models.APIKey // key hash -> key
+	loadedAt time.Time
+
+	// now is replaced in tests
+	now func() time.Time
+}
+
+// New creates a Store. staticKeys maps raw app keys to app IDs, as in
+// AuthConfig.AppKeys. source may be nil, in which case only static keys are
+// accepted.
+func New(source Source, staticKeys map[string]string, ttl time.Duration, logger *zap.Logger) *Store {
+	static := make(map[string]string, len(staticKeys))
+	for key, appID := range staticKeys {
+		static[HashKey(key)] = appID
+	}
+
+	return &Store{
+		source: source,
+		static: static,
+		ttl:    ttl,
+		logger: logger,
+		keys:   make(map[string]models.APIKey),
+		now:    time.Now,
+	}
+}
+
+// Lookup returns the app an app key belongs to, if the key is known and
+// currently active
+func (s *Store) Lookup(ctx context.Context, appKey string) (string, bool) {
+	hash := HashKey(appKey)
+	if appID, ok := s.static[hash]; ok {
+		return appID, true
+	}
+	if s.source == nil {
+		return "", false
+	}
+
+	s.refresh(ctx)
+
+	s.mu.RLock()
+	key, ok := s.keys[hash]
+	s.mu.RUnlock()
+
+	if !ok || !Active(key, s.now()) {
+		return "", false
+	}
+	return key.AppID, true
+}
+
+// Invalidate forces the next Lookup to reload keys from the source
+func (s *Store) Invalidate() {
+	s.mu.Lock()
+	s.loadedAt = time.Time{}
+	s.mu.Unlock()
+}
+
+// refresh reloads the cache if it is stale. A failed reload keeps serving
+// the previous keys so a storage hiccup does not lock every SDK out.
+func (s *Store) refresh(ctx context.Context) {
+	s.mu.RLock()
+	fresh := !s.loadedAt.IsZero() && s.now().Sub(s.loadedAt) < s.ttl
+	s.mu.RUnlock()
+	if fresh {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Another request may have reloaded while we waited for the lock
+	if !s.loadedAt.IsZero() && s.now().Sub(s.loadedAt) < s.ttl {
+		return
+	}
+
+	keys, err := s.source.ListAPIKeys(ctx, "")
+	if err != nil {
+		s.logger.Error("failed to load api keys", zap.Error(err))
+		return
+	}
+
+	s.keys = make(map[string]models.APIKey, len(keys))
+	for _, k := range keys {
+		s.keys[k.Hash] = k
+	}
+	s.loadedAt = s.now()
+}
+
+// Active reports whether a key is neither revoked nor expired at now
+func Active(key models.APIKey, now time.Time) bool {
+	if key.RevokedAt != nil && !now.Before(*key.RevokedAt) {
+		return false
+	}
+	if key.ExpiresAt != nil && !now.Before(*key.ExpiresAt) {
+		return false
+	}
+	return true
+}
+
+// HashKey returns the hex-encoded SHA-256 of an app key
+func HashKey(appKey string) string {
+	sum := sha256.Sum256([]byte(appKey))
+	return hex.EncodeToString(sum[:])
+}
+
+// GenerateKey returns a new random app key and its display prefix
+func GenerateKey() (key, prefix string, err error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", fmt.Errorf("generate key: %w", err)
+	}
+	key = KeyPrefix + hex.EncodeToString(buf)
+	return key, key[:displayPrefixLen], nil
+}
+
+// GenerateID returns a random identifier for apps and keys
+func GenerateID() (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("generate id: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
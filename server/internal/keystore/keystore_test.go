@@ -0,0 +1,146 @@
+package keystore
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/warriorguo/ozx_apm/server/internal/models"
+)
+
+type fakeSource struct {
+	keys  []models.APIKey
+	err   error
+	calls int
+}
+
+func (f *fakeSource) ListAPIKeys(ctx context.Context, appID string) ([]models.APIKey, error) {
+	f.calls++
+	return f.keys, f.err
+}
+
+func newTestStore(source Source, static map[string]string) (*Store, *time.Time) {
+	now := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	s := New(source, static, time.Minute, zap.NewNop())
+	s.now = func() time.Time { return now }
+	return s, &now
+}
+
+func TestStore_StaticKeys(t *testing.T) {
+	s, _ := newTestStore(nil, map[string]string{"config-key": "game-a"})
+
+	if appID, ok := s.Lookup(context.Background(), "config-key"); !ok || appID != "game-a" {
+		t.Errorf("expected game-a, got %q ok=%v", appID, ok)
+	}
+	if _, ok := s.Lookup(context.Background(), "unknown"); ok {
+		t.Error("expected unknown key to be rejected")
+	}
+}
+
+func TestStore_PersistedKeys(t *testing.T) {
+	now := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	past := now.Add(-time.Hour)
+	future := now.Add(time.Hour)
+
+	source := &fakeSource{keys: []models.APIKey{
+		{ID: "k1", AppID: "game-a", Hash: HashKey("active")},
+		{ID: "k2", AppID: "game-a", Hash: HashKey("expiring"), ExpiresAt: &future},
+		{ID: "k3", AppID: "game-a", Hash: HashKey("expired"), ExpiresAt: &past},
+		{ID: "k4", AppID: "game-b", Hash: HashKey("revoked"), RevokedAt: &past},
+	}}
+	s, _ := newTestStore(source, nil)
+
+	tests := []struct {
+		key    string
+		wantOK bool
+	}{
+		{"active", true},
+		{"expiring", true},
+		{"expired", false},
+		{"revoked", false},
+		{"unknown", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			appID, ok := s.Lookup(context.Background(), tt.key)
+			if ok != tt.wantOK {
+				t.Errorf("expected ok=%v, got %v", tt.wantOK, ok)
+			}
+			if ok && appID != "game-a" {
+				t.Errorf("expected game-a, got %q", appID)
+			}
+		})
+	}
+}
+
+func TestStore_CachesUntilTTL(t *testing.T) {
+	source := &fakeSource{keys: []models.APIKey{{ID: "k1", AppID: "game-a", Hash: HashKey("active")}}}
+	s, now := newTestStore(source, nil)
+	ctx := context.Background()
+
+	s.Lookup(ctx, "active")
+	s.Lookup(ctx, "active")
+	if source.calls != 1 {
+		t.Errorf("expected 1 load within ttl, got %d", source.calls)
+	}
+
+	*now = now.Add(2 * time.Minute)
+	s.Lookup(ctx, "active")
+	if source.calls != 2 {
+		t.Errorf("expected reload after ttl, got %d loads", source.calls)
+	}
+
+	s.Invalidate()
+	s.Lookup(ctx, "active")
+	if source.calls != 3 {
+		t.Errorf("expected reload after invalidate, got %d loads", source.calls)
+	}
+}
+
+func TestStore_KeepsKeysOnLoadError(t *testing.T) {
+	source := &fakeSource{keys: []models.APIKey{{ID: "k1", AppID: "game-a", Hash: HashKey("active")}}}
+	s, _ := newTestStore(source, nil)
+	ctx := context.Background()
+
+	if _, ok := s.Lookup(ctx, "active"); !ok {
+		t.Fatal("expected key to be accepted")
+	}
+
+	source.err = errors.New("clickhouse down")
+	s.Invalidate()
+	if _, ok := s.Lookup(ctx, "active"); !ok {
+		t.Error("expected cached key to survive a failed reload")
+	}
+}
+
+func TestGenerateKey(t *testing.T) {
+	key, prefix, err := GenerateKey()
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	if !strings.HasPrefix(key, KeyPrefix) {
+		t.Errorf("expected key to start with %s, got %s", KeyPrefix, key)
+	}
+	if !strings.HasPrefix(key, prefix) || len(prefix) >= len(key) {
+		t.Errorf("expected prefix %q to be a strict prefix of the key", prefix)
+	}
+
+	other, _, _ := GenerateKey()
+	if other == key {
+		t.Error("expected generated keys to differ")
+	}
+}
+
+func TestHashKey(t *testing.T) {
+	if HashKey("a") == HashKey("b") {
+		t.Error("expected different keys to hash differently")
+	}
+	if len(HashKey("a")) != 64 {
+		t.Errorf("expected hex sha-256, got %d chars", len(HashKey("a")))
+	}
+}
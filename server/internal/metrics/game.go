@@ -0,0 +1,89 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/warriorguo/ozx_apm/server/internal/processor"
+)
+
+// GameStats is the source of real-time game KPIs, the Aggregator
+type GameStats interface {
+	Snapshot(maxApps, maxVersions, maxPlatforms int) processor.Snapshot
+}
+
+var (
+	gameCrashesDesc = prometheus.NewDesc(namespace+"_game_crashes",
+		"Crashes in the last minute by app version.", []string{"app_id", "app_version"}, nil)
+	gameExceptionsDesc = prometheus.NewDesc(namespace+"_game_exceptions",
+		"Exceptions in the last minute by app version.", []string{"app_id", "app_version"}, nil)
+	gameJanksDesc = prometheus.NewDesc(namespace+"_game_janks",
+		"Janks in the last minute by app version.", []string{"app_id", "app_version"}, nil)
+	gameSessionsDesc = prometheus.NewDesc(namespace+"_game_active_sessions",
+		"Sessions that sent events in the last minute by app version.", []string{"app_id", "app_version"}, nil)
+	gameFPSDesc = prometheus.NewDesc(namespace+"_game_fps",
+		"FPS over the last minute of perf samples by platform.", []string{"app_id", "platform"}, nil)
+	gameStartupDesc = prometheus.NewDesc(namespace+"_game_startup_tti_seconds",
+		"Startup time to interactive over the last minute by platform.", []string{"app_id", "platform"}, nil)
+)
+
+// gameCollector turns an Aggregator snapshot into gauges on every scrape
+type gameCollector struct {
+	stats        GameStats
+	maxApps      int
+	maxVersions  int
+	maxPlatforms int
+}
+
+// NewGameCollector exports real-time KPIs from stats. Apps, and versions and
+// platforms of an app, beyond the limits are reported as "other" to cap
+// label cardinality; 0 means no limit.
+func NewGameCollector(stats GameStats, maxApps, maxVersions, maxPlatforms int) prometheus.Collector {
+	return &gameCollector{stats: stats, maxApps: maxApps, maxVersions: maxVersions, maxPlatforms: maxPlatforms}
+}
+
+func (c *gameCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- gameCrashesDesc
+	ch <- gameExceptionsDesc
+	ch <- gameJanksDesc
+	ch <- gameSessionsDesc
+	ch <- gameFPSDesc
+	ch <- gameStartupDesc
+}
+
+func (c *gameCollector) Collect(ch chan<- prometheus.Metric) {
+	snapshot := c.stats.Snapshot(c.maxApps, c.maxVersions, c.maxPlatforms)
+
+	for _, v := range snapshot.Versions {
+		ch <- prometheus.MustNewConstMetric(gameCrashesDesc, prometheus.GaugeValue, float64(v.Crashes), v.AppID, v.AppVersion)
+		ch <- prometheus.MustNewConstMetric(gameExceptionsDesc, prometheus.GaugeValue, float64(v.Exceptions), v.AppID, v.AppVersion)
+		ch <- prometheus.MustNewConstMetric(gameJanksDesc, prometheus.GaugeValue, float64(v.Janks), v.AppID, v.AppVersion)
+		ch <- prometheus.MustNewConstMetric(gameSessionsDesc, prometheus.GaugeValue, float64(v.Sessions), v.AppID, v.AppVersion)
+	}
+
+	for _, p := range snapshot.Platforms {
+		ch <- distributionSummary(gameFPSDesc, p.FPS, 1, p.AppID, p.Platform)
+		ch <- distributionSummary(gameStartupDesc, p.StartupTTI, 0.001, p.AppID, p.Platform)
+	}
+}
+
+// distributionSummary exports a distribution as a summary, multiplying
+// values by scale to convert units. Its quantiles and count cover only the
+// last minute, unlike a regular summary's.
+func distributionSummary(desc *prometheus.Desc, d processor.Distribution, scale float64, labels ...string) prometheus.Metric {
+	var quantiles map[float64]float64
+	if d.Count > 0 {
+		quantiles = map[float64]float64{0.1: d.P10 * scale, 0.5: d.P50 * scale, 0.9: d.P90 * scale, 0.99: d.P99 * scale}
+	}
+	return prometheus.MustNewConstSummary(desc, uint64(d.Count), d.Sum*scale, quantiles, labels...)
+}
+
+// GameHandler serves game KPIs from their own registry, apart from the
+// server's operational metrics
+func GameHandler(collector prometheus.Collector) http.Handler {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collector)
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{Registry: registry})
+}
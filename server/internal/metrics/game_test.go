@@ -0,0 +1,73 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/warriorguo/ozx_apm/server/internal/processor"
+)
+
+type staticGameStats struct {
+	snapshot                           processor.Snapshot
+	maxApps, maxVersions, maxPlatforms int
+}
+
+func (s *staticGameStats) Snapshot(maxApps, maxVersions, maxPlatforms int) processor.Snapshot {
+	s.maxApps, s.maxVersions, s.maxPlatforms = maxApps, maxVersions, maxPlatforms
+	return s.snapshot
+}
+
+func TestGameCollector(t *testing.T) {
+	stats := &staticGameStats{snapshot: processor.Snapshot{
+		Versions: []processor.VersionKPIs{
+			{AppID: "game", AppVersion: "1.0.0", Crashes: 2, Exceptions: 5, Janks: 1, Sessions: 40},
+			{AppID: "tools", AppVersion: "1.0.0", Crashes: 1, Sessions: 3},
+		},
+		Platforms: []processor.PlatformKPIs{
+			{
+				AppID:      "game",
+				Platform:   "Android",
+				FPS:        processor.Distribution{Count: 100, Sum: 5200, P10: 24, P50: 58, P90: 60, P99: 60},
+				StartupTTI: processor.Distribution{Count: 1, Sum: 1500, P10: 1500, P50: 1500, P90: 1500, P99: 1500},
+			},
+		},
+	}}
+	collector := NewGameCollector(stats, 5, 20, 10)
+
+	expected := `
+# HELP ozx_apm_game_crashes Crashes in the last minute by app version.
+# TYPE ozx_apm_game_crashes gauge
+ozx_apm_game_crashes{app_id="game",app_version="1.0.0"} 2
+ozx_apm_game_crashes{app_id="tools",app_version="1.0.0"} 1
+# HELP ozx_apm_game_fps FPS over the last minute of perf samples by platform.
+# TYPE ozx_apm_game_fps summary
+ozx_apm_game_fps{app_id="game",platform="Android",quantile="0.1"} 24
+ozx_apm_game_fps{app_id="game",platform="Android",quantile="0.5"} 58
+ozx_apm_game_fps{app_id="game",platform="Android",quantile="0.9"} 60
+ozx_apm_game_fps{app_id="game",platform="Android",quantile="0.99"} 60
+ozx_apm_game_fps_sum{app_id="game",platform="Android"} 5200
+ozx_apm_game_fps_count{app_id="game",platform="Android"} 100
+# HELP ozx_apm_game_startup_tti_seconds Startup time to interactive over the last minute by platform.
+# TYPE ozx_apm_game_startup_tti_seconds summary
+ozx_apm_game_startup_tti_seconds{app_id="game",platform="Android",quantile="0.1"} 1.5
+ozx_apm_game_startup_tti_seconds{app_id="game",platform="Android",quantile="0.5"} 1.5
+ozx_apm_game_startup_tti_seconds{app_id="game",platform="Android",quantile="0.9"} 1.5
+ozx_apm_game_startup_tti_seconds{app_id="game",platform="Android",quantile="0.99"} 1.5
+ozx_apm_game_startup_tti_seconds_sum{app_id="game",platform="Android"} 1.5
+ozx_apm_game_startup_tti_seconds_count{app_id="game",platform="Android"} 1
+`
+	err := testutil.CollectAndCompare(collector, strings.NewReader(expected),
+		"ozx_apm_game_crashes", "ozx_apm_game_fps", "ozx_apm_game_startup_tti_seconds")
+	if err != nil {
+		t.Error(err)
+	}
+	if stats.maxApps != 5 || stats.maxVersions != 20 || stats.maxPlatforms != 10 {
+		t.Errorf("expected the configured limits to be passed on, got %d, %d and %d", stats.maxApps, stats.maxVersions, stats.maxPlatforms)
+	}
+
+	if problems, err := testutil.CollectAndLint(collector); err != nil || len(problems) > 0 {
+		t.Errorf("lint: %v %+v", err, problems)
+	}
+}
@@ -0,0 +1,170 @@
+// Package metrics holds the Prometheus metrics the server exposes about
+// itself on /metrics. Metrics are package-level so any layer can record
+// without threading a registry through constructors.
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "ozx_apm"
+
+// Registry holds every server metric plus the Go runtime and process
+// collectors. It is separate from the client_golang default registry so
+// libraries cannot add metrics behind our back.
+var Registry = prometheus.NewRegistry()
+
+// HTTP
+var (
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by route pattern, method and status code.",
+	}, []string{"route", "method", "code"})
+
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route pattern and method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method"})
+
+	HTTPInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "http_requests_in_flight",
+		Help:      "HTTP requests currently being served.",
+	})
+)
+
+// Ingestion
+var (
+	EventsAccepted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "ingest_events_accepted_total",
+		Help:      "Events that passed validation, by event type. Includes sampled events.",
+	}, []string{"type"})
+
+	EventsSampled = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "ingest_events_sampled_total",
+		Help:      "Accepted events dropped by server-side sampling, by event type.",
+	}, []string{"type"})
+
+	EventsRejected = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "ingest_events_rejected_total",
+		Help:      "Events rejected at decoding or validation, by event type and reason.",
+	}, []string{"type", "reason"})
+
+	DecompressionRatio = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "ingest_decompression_ratio",
+		Help:      "Decompressed to compressed size of gzip request bodies.",
+		Buckets:   []float64{1, 2, 3, 4, 6, 8, 12, 16, 24, 32},
+	})
+
+	DecompressedBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "ingest_body_bytes_total",
+		Help:      "Bytes of gzip request bodies, before (compressed) and after (decompressed) inflating.",
+	}, []string{"stage"})
+
+	Throttled = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "ratelimit_throttled_total",
+		Help:      "Requests rejected with 429, by limit.",
+	}, []string{"reason"})
+)
+
+// ClickHouse
+var (
+	InsertDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "clickhouse_insert_duration_seconds",
+		Help:      "ClickHouse batch insert latency by table.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"table"})
+
+	InsertRows = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "clickhouse_insert_rows_total",
+		Help:      "Rows sent to ClickHouse by table.",
+	}, []string{"table"})
+
+	InsertErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "clickhouse_insert_errors_total",
+		Help:      "Failed ClickHouse batch inserts by table.",
+	}, []string{"table"})
+)
+
+// Alerting
+var (
+	AlertEvaluations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "alert_evaluations_total",
+		Help:      "Alert rule evaluations by rule type.",
+	}, []string{"rule_type"})
+
+	AlertsFired = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "alerts_fired_total",
+		Help:      "Alerts fired by rule type.",
+	}, []string{"rule_type"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests, HTTPRequestDuration, HTTPInFlight,
+		EventsAccepted, EventsSampled, EventsRejected,
+		DecompressionRatio, DecompressedBytes, Throttled,
+		InsertDuration, InsertRows, InsertErrors,
+		AlertEvaluations, AlertsFired,
+	)
+}
+
+// Handler serves the registry in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// ObserveInsert records a ClickHouse batch insert of rows into table that
+// started at start and finished with err
+func ObserveInsert(table string, rows int, start time.Time, err error) {
+	InsertDuration.WithLabelValues(table).Observe(time.Since(start).Seconds())
+	if err != nil {
+		InsertErrors.WithLabelValues(table).Inc()
+		return
+	}
+	InsertRows.WithLabelValues(table).Add(float64(rows))
+}
+
+// ConnPoolStats reports the state of a connection pool
+type ConnPoolStats func() (open, idle, max int)
+
+// RegisterClickHousePool exports the ClickHouse connection pool occupancy,
+// the queue queries wait in when every connection is busy. It must be called
+// at most once.
+func RegisterClickHousePool(stats ConnPoolStats) {
+	gauge := func(name, help string, pick func(open, idle, max int) int) prometheus.Collector {
+		return prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      name,
+			Help:      help,
+		}, func() float64 {
+			return float64(pick(stats()))
+		})
+	}
+	Registry.MustRegister(
+		gauge("clickhouse_conns_open", "Open ClickHouse connections.", func(open, _, _ int) int { return open }),
+		gauge("clickhouse_conns_idle", "Idle ClickHouse connections.", func(_, idle, _ int) int { return idle }),
+		gauge("clickhouse_conns_max", "Maximum open ClickHouse connections.", func(_, _, max int) int { return max }),
+	)
+}
@@ -0,0 +1,59 @@
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestObserveInsert(t *testing.T) {
+	rows := testutil.ToFloat64(InsertRows.WithLabelValues("test_ok"))
+	ObserveInsert("test_ok", 3, time.Now(), nil)
+	if got := testutil.ToFloat64(InsertRows.WithLabelValues("test_ok")) - rows; got != 3 {
+		t.Errorf("expected 3 rows, got %v", got)
+	}
+
+	failures := testutil.ToFloat64(InsertErrors.WithLabelValues("test_err"))
+	ObserveInsert("test_err", 3, time.Now(), errors.New("connection reset"))
+	if got := testutil.ToFloat64(InsertErrors.WithLabelValues("test_err")) - failures; got != 1 {
+		t.Errorf("expected 1 error, got %v", got)
+	}
+	if got := testutil.ToFloat64(InsertRows.WithLabelValues("test_err")); got != 0 {
+		t.Errorf("expected no rows counted for a failed insert, got %v", got)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	Throttled.WithLabelValues("test").Inc()
+
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	body := w.Body.String()
+	for _, want := range []string{
+		`ozx_apm_ratelimit_throttled_total{reason="test"}`,
+		"go_goroutines",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %s in the exposition", want)
+		}
+	}
+}
+
+func TestLint(t *testing.T) {
+	problems, err := testutil.GatherAndLint(Registry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range problems {
+		t.Errorf("%s: %s", p.Metric, p.Text)
+	}
+}
@@ -61,25 +61,243 @@ type DistributionResponse struct {
 	P99     float64              `json:"p99"`
 }
 
+// Scene report types
+
+// Sorts of a scene report. Each ranks the worst scenes first: fps_p5
+// lowest first, the others highest first.
+const (
+	SceneSortSamples    = "samples"
+	SceneSortFPS        = "fps_p5"
+	SceneSortFrameTime  = "frame_time_p95"
+	SceneSortJankRate   = "jank_rate"
+	SceneSortMemory     = "mem_p95"
+	SceneSortLoad       = "load_p95"
+	SceneSortExceptions = "exceptions"
+	SceneSortCrashes    = "crashes"
+)
+
+// SceneSorts lists the sorts of a scene report
+var SceneSorts = []string{
+	SceneSortSamples, SceneSortFPS, SceneSortFrameTime, SceneSortJankRate, SceneSortMemory, SceneSortLoad,
+	SceneSortExceptions, SceneSortCrashes,
+}
+
+// SceneReport summarizes the performance and stability of a scene. Play
+// time adds up, per session, the time between the first and last perf
+// sample taken in the scene.
+type SceneReport struct {
+	Scene          string  `json:"scene"`
+	SampleCount    int64   `json:"sample_count"`
+	SessionCount   int64   `json:"session_count"`
+	PlayMinutes    float64 `json:"play_minutes"`
+	FPSP50         float64 `json:"fps_p50"`
+	FPSP5          float64 `json:"fps_p5"`
+	FrameTimeP95   float64 `json:"frame_time_p95_ms"`
+	MemP95         float64 `json:"mem_p95_mb"`
+	JankCount      int64   `json:"jank_count"`
+	JankRate       float64 `json:"jank_rate_per_min"`
+	LoadCount      int64   `json:"load_count"`
+	LoadP50        float64 `json:"load_p50_ms"`
+	LoadP95        float64 `json:"load_p95_ms"`
+	ActivateP50    float64 `json:"activate_p50_ms"`
+	ActivateP95    float64 `json:"activate_p95_ms"`
+	ExceptionCount int64   `json:"exception_count"`
+	CrashCount     int64   `json:"crash_count"`
+}
+
+type SceneReportResponse struct {
+	TimeRange TimeRange     `json:"time_range"`
+	Sort      string        `json:"sort"`
+	Scenes    []SceneReport `json:"scenes"`
+}
+
+// Jank analysis types
+
+// Causes a jank is classified by, in order of precedence
+const (
+	JankCauseSceneLoad = "scene_load"
+	JankCauseAssetLoad = "asset_load"
+	JankCauseGC        = "gc"
+	JankCauseUnknown   = "unknown"
+)
+
+// JankCauses lists the jank causes in order of precedence
+var JankCauses = []string{JankCauseSceneLoad, JankCauseAssetLoad, JankCauseGC, JankCauseUnknown}
+
+// JankCause is the share of janks classified with a cause
+type JankCause struct {
+	Cause         string  `json:"cause"`
+	Count         int64   `json:"count"`
+	Pct           float64 `json:"pct"`
+	AvgDurationMs float64 `json:"avg_duration_ms"`
+}
+
+// JankGCStats relates janks to the garbage collections of the seconds
+// before them. Correlations are Pearson coefficients with jank duration, 0
+// when there is too little data.
+type JankGCStats struct {
+	Count                int64   `json:"count"`
+	WithGCCount          int64   `json:"with_gc_count"`
+	WithGCPct            float64 `json:"with_gc_pct"`
+	AvgDurationWithGC    float64 `json:"avg_duration_with_gc_ms"`
+	AvgDurationWithoutGC float64 `json:"avg_duration_without_gc_ms"`
+	CorrGCCount          float64 `json:"corr_gc_count"`
+	CorrGCAllocKB        float64 `json:"corr_gc_alloc_kb"`
+}
+
+// JankEventRank is an event recorded before janks, with the number and
+// share of a scene's janks it preceded
+type JankEventRank struct {
+	Event string  `json:"event"`
+	Count int64   `json:"count"`
+	Pct   float64 `json:"pct"`
+}
+
+// JankSceneAnalysis is the GC correlation and most frequent preceding events
+// of a scene's janks
+type JankSceneAnalysis struct {
+	Scene     string          `json:"scene"`
+	GC        JankGCStats     `json:"gc"`
+	TopEvents []JankEventRank `json:"top_events"`
+}
+
+type JankAnalysisResponse struct {
+	TimeRange TimeRange           `json:"time_range"`
+	Total     int64               `json:"total"`
+	Causes    []JankCause         `json:"causes"`
+	GC        JankGCStats         `json:"gc"`
+	Scenes    []JankSceneAnalysis `json:"scenes"`
+}
+
+// Memory analysis types
+
+// MemoryLeakThresholds are what sessions and crashes were judged by. A
+// session is a leak suspect when it has MinSamples readings, grows at least
+// MinGrowthMB and memory does not drop in MinRisePct of its steps.
+type MemoryLeakThresholds struct {
+	MinSamples   int64   `json:"min_samples"`
+	MinGrowthMB  float64 `json:"min_growth_mb"`
+	MinRisePct   float64 `json:"min_rise_pct"`
+	HighMemoryMB float64 `json:"high_memory_mb"`
+}
+
+// MemoryTrend is the memory of a session over time. Slope is the least
+// squares growth per minute, and RisePct the share of consecutive readings
+// where memory did not drop.
+type MemoryTrend struct {
+	SessionID     string  `json:"session_id"`
+	AppVersion    string  `json:"app_version"`
+	Platform      string  `json:"platform"`
+	DeviceModel   string  `json:"device_model"`
+	Samples       int64   `json:"samples"`
+	DurationMin   float64 `json:"duration_min"`
+	StartMB       float64 `json:"start_mb"`
+	EndMB         float64 `json:"end_mb"`
+	PeakMB        float64 `json:"peak_mb"`
+	GrowthMB      float64 `json:"growth_mb"`
+	SlopeMBPerMin float64 `json:"slope_mb_per_min"`
+	RisePct       float64 `json:"rise_pct"`
+	AvgGCAllocKB  float64 `json:"avg_gc_alloc_kb"`
+}
+
+// MemoryLeakGroup sums up the memory trends of the sessions of a scene or
+// an app version
+type MemoryLeakGroup struct {
+	Name             string  `json:"name"`
+	SessionCount     int64   `json:"session_count"`
+	SuspectCount     int64   `json:"suspect_count"`
+	SuspectPct       float64 `json:"suspect_pct"`
+	AvgSlopeMBPerMin float64 `json:"avg_slope_mb_per_min"`
+	P90SlopeMBPerMin float64 `json:"p90_slope_mb_per_min"`
+	AvgGrowthMB      float64 `json:"avg_growth_mb"`
+}
+
+// OOMCrashGroup is a crash group whose sessions ended on high memory
+type OOMCrashGroup struct {
+	Fingerprint  string `json:"fingerprint"`
+	CrashType    string `json:"crash_type"`
+	Count        int64  `json:"count"`
+	SessionCount int64  `json:"session_count"`
+}
+
+// OOMSignals counts the crashes whose session's last memory reading was
+// high, or whose session was a leak suspect, as likely out of memory
+type OOMSignals struct {
+	CrashCount       int64           `json:"crash_count"`
+	HighMemoryCount  int64           `json:"high_memory_count"`
+	HighMemoryPct    float64         `json:"high_memory_pct"`
+	LeakSuspectCount int64           `json:"leak_suspect_count"`
+	LeakSuspectPct   float64         `json:"leak_suspect_pct"`
+	Groups           []OOMCrashGroup `json:"groups"`
+}
+
+type MemoryLeakResponse struct {
+	TimeRange  TimeRange            `json:"time_range"`
+	Thresholds MemoryLeakThresholds `json:"thresholds"`
+	Sessions   []MemoryTrend        `json:"sessions"`
+	Scenes     []MemoryLeakGroup    `json:"scenes"`
+	Versions   []MemoryLeakGroup    `json:"versions"`
+	OOM        OOMSignals           `json:"oom"`
+}
+
 // Crash types
 
+// Sort orders of crash and exception group lists
+const (
+	GroupSortCount     = "count"
+	GroupSortSessions  = "sessions"
+	GroupSortUsers     = "users"
+	GroupSortFirstSeen = "first_seen"
+	GroupSortLastSeen  = "last_seen"
+	GroupSortTrend     = "trend"
+)
+
+// GroupSorts lists the sort orders of group lists
+var GroupSorts = []string{
+	GroupSortCount, GroupSortSessions, GroupSortUsers, GroupSortFirstSeen, GroupSortLastSeen, GroupSortTrend,
+}
+
+// GroupListQuery selects a page of crash or exception groups. Pages are
+// either counted from 1, or reached with the NextCursor of the previous
+// page, which stays stable as new groups appear ahead of it.
+type GroupListQuery struct {
+	AppID      string
+	AppVersion string
+	Platform   string
+	StartTime  time.Time // both zero with a Cursor to continue over its range
+	EndTime    time.Time
+	Sort       string // one of GroupSorts, count when empty
+	Order      string // asc or desc, desc when empty
+	Cursor     string
+	Page       int
+	PageSize   int
+	WithTotal  bool // count all groups, which costs a query
+}
+
 type CrashGroup struct {
 	Fingerprint      string    `json:"fingerprint"`
 	CrashType        string    `json:"crash_type"`
 	SampleMessage    string    `json:"sample_message"`
 	Count            int64     `json:"count"`
 	SessionCount     int64     `json:"session_count"`
+	AffectedUsers    int64     `json:"affected_users"`
 	FirstSeen        time.Time `json:"first_seen"`
 	LastSeen         time.Time `json:"last_seen"`
+	TrendPct         float64   `json:"trend_pct"` // change from the first to the second half of the range
 	AffectedVersions []string  `json:"affected_versions"`
 	TopDevices       []string  `json:"top_devices"`
 }
 
+// CrashListResponse is a page of crash groups. TotalCount is only set when
+// requested, and NextCursor is empty on the last page.
 type CrashListResponse struct {
 	Crashes    []CrashGroup `json:"crashes"`
-	TotalCount int64        `json:"total_count"`
+	TotalCount *int64       `json:"total_count,omitempty"`
 	Page       int          `json:"page"`
 	PageSize   int          `json:"page_size"`
+	Sort       string       `json:"sort"`
+	Order      string       `json:"order"`
+	NextCursor string       `json:"next_cursor,omitempty"`
 }
 
 type CrashDetail struct {
@@ -103,6 +321,8 @@ type CrashOccurrence struct {
 	DeviceModel string    `json:"device_model"`
 	OSVersion   string    `json:"os_version"`
 	Scene       string    `json:"scene"`
+	SessionID   string    `json:"session_id"`
+	TimelineURL string    `json:"timeline_url,omitempty"`
 	Breadcrumbs []string  `json:"breadcrumbs"`
 }
 
@@ -124,17 +344,268 @@ type OSDist struct {
 // Exception types
 
 type ExceptionGroup struct {
-	Fingerprint  string    `json:"fingerprint"`
-	Message      string    `json:"message"`
-	Count        int64     `json:"count"`
-	SessionCount int64     `json:"session_count"`
-	FirstSeen    time.Time `json:"first_seen"`
-	LastSeen     time.Time `json:"last_seen"`
+	Fingerprint   string    `json:"fingerprint"`
+	Message       string    `json:"message"`
+	Count         int64     `json:"count"`
+	SessionCount  int64     `json:"session_count"`
+	AffectedUsers int64     `json:"affected_users"`
+	FirstSeen     time.Time `json:"first_seen"`
+	LastSeen      time.Time `json:"last_seen"`
+	TrendPct      float64   `json:"trend_pct"`
 }
 
+// ExceptionListResponse is a page of exception groups, like
+// CrashListResponse
 type ExceptionListResponse struct {
 	Exceptions []ExceptionGroup `json:"exceptions"`
+	TotalCount *int64           `json:"total_count,omitempty"`
+	Page       int              `json:"page"`
+	PageSize   int              `json:"page_size"`
+	Sort       string           `json:"sort"`
+	Order      string           `json:"order"`
+	NextCursor string           `json:"next_cursor,omitempty"`
+}
+
+// Session types
+
+type SessionSummary struct {
+	SessionID      string    `json:"session_id"`
+	DeviceID       string    `json:"device_id"`
+	UserID         string    `json:"user_id,omitempty"`
+	AppVersion     string    `json:"app_version"`
+	Platform       string    `json:"platform"`
+	DeviceModel    string    `json:"device_model"`
+	OSVersion      string    `json:"os_version"`
+	StartTime      time.Time `json:"start_time"`
+	EndTime        time.Time `json:"end_time"`
+	DurationSec    float64   `json:"duration_sec"`
+	ScenePath      []string  `json:"scene_path"`
+	EventCount     int64     `json:"event_count"`
+	CrashCount     int64     `json:"crash_count"`
+	ExceptionCount int64     `json:"exception_count"`
+	JankCount      int64     `json:"jank_count"`
+	EndedByCrash   bool      `json:"ended_by_crash"`
+}
+
+type SessionListResponse struct {
+	Sessions   []SessionSummary `json:"sessions"`
 	TotalCount int64            `json:"total_count"`
 	Page       int              `json:"page"`
 	PageSize   int              `json:"page_size"`
 }
+
+type SessionStats struct {
+	TimeRange         TimeRange `json:"time_range"`
+	TotalSessions     int64     `json:"total_sessions"`
+	CrashedSessions   int64     `json:"crashed_sessions"`
+	CrashFreeRate     float64   `json:"crash_free_rate"`
+	AvgDurationSec    float64   `json:"avg_duration_sec"`
+	MedianDurationSec float64   `json:"median_duration_sec"`
+}
+
+// TimelineEvent is one entry of a session timeline. Data holds the
+// type-specific fields of the underlying event.
+type TimelineEvent struct {
+	Timestamp time.Time              `json:"timestamp"`
+	Type      EventType              `json:"type"`
+	Scene     string                 `json:"scene,omitempty"`
+	Data      map[string]interface{} `json:"data"`
+}
+
+type SessionTimeline struct {
+	SessionID string          `json:"session_id"`
+	Session   *SessionSummary `json:"session,omitempty"`
+	Events    []TimelineEvent `json:"events"`
+	Truncated bool            `json:"truncated"`
+}
+
+// Crash-free types
+
+type CrashFreeStats struct {
+	Key                  string  `json:"key"`
+	Sessions             int64   `json:"sessions"`
+	CrashedSessions      int64   `json:"crashed_sessions"`
+	CrashFreeSessionsPct float64 `json:"crash_free_sessions_pct"`
+	Users                int64   `json:"users"`
+	CrashedUsers         int64   `json:"crashed_users"`
+	CrashFreeUsersPct    float64 `json:"crash_free_users_pct"`
+}
+
+type CrashFreeResponse struct {
+	TimeRange TimeRange        `json:"time_range"`
+	GroupBy   string           `json:"group_by,omitempty"`
+	UserKey   string           `json:"user_key"`
+	Overall   CrashFreeStats   `json:"overall"`
+	Breakdown []CrashFreeStats `json:"breakdown"`
+}
+
+// Release types
+
+// MetricSummary carries the moments needed to compare a metric across releases
+type MetricSummary struct {
+	Count  int64   `json:"count"`
+	Mean   float64 `json:"mean"`
+	StdDev float64 `json:"stddev"`
+	P50    float64 `json:"p50"`
+	P95    float64 `json:"p95"`
+}
+
+type ReleaseHealth struct {
+	Version              string            `json:"version"`
+	FirstSeen            time.Time         `json:"first_seen"`
+	LastSeen             time.Time         `json:"last_seen"`
+	Sessions             int64             `json:"sessions"`
+	CrashedSessions      int64             `json:"crashed_sessions"`
+	CrashFreeSessionsPct float64           `json:"crash_free_sessions_pct"`
+	Users                int64             `json:"users"`
+	CrashedUsers         int64             `json:"crashed_users"`
+	CrashFreeUsersPct    float64           `json:"crash_free_users_pct"`
+	AdoptionPct          float64           `json:"adoption_pct"`
+	Adoption             []TimeSeriesPoint `json:"adoption"`
+	FPS                  MetricSummary     `json:"fps"`
+	StartupMs            MetricSummary     `json:"startup_ms"`
+	SceneLoadMs          MetricSummary     `json:"scene_load_ms"`
+}
+
+type ReleaseListResponse struct {
+	TimeRange TimeRange       `json:"time_range"`
+	Releases  []ReleaseHealth `json:"releases"`
+}
+
+type MetricDelta struct {
+	Metric      string  `json:"metric"`
+	Base        float64 `json:"base"`
+	Target      float64 `json:"target"`
+	Delta       float64 `json:"delta"`
+	DeltaPct    float64 `json:"delta_pct"`
+	ZScore      float64 `json:"z_score"`
+	Significant bool    `json:"significant"`
+	Regression  bool    `json:"regression"`
+}
+
+type ReleaseComparison struct {
+	TimeRange TimeRange     `json:"time_range"`
+	Base      ReleaseHealth `json:"base"`
+	Target    ReleaseHealth `json:"target"`
+	Deltas    []MetricDelta `json:"deltas"`
+}
+
+// Device types
+
+type DeviceVersion struct {
+	Version    string    `json:"version"`
+	FirstSeen  time.Time `json:"first_seen"`
+	LastSeen   time.Time `json:"last_seen"`
+	Sessions   int64     `json:"sessions"`
+	CrashCount int64     `json:"crash_count"`
+}
+
+type DeviceCrash struct {
+	Timestamp   time.Time `json:"timestamp"`
+	AppVersion  string    `json:"app_version"`
+	Scene       string    `json:"scene"`
+	CrashType   string    `json:"crash_type"`
+	Fingerprint string    `json:"fingerprint"`
+	SessionID   string    `json:"session_id"`
+	TimelineURL string    `json:"timeline_url,omitempty"`
+}
+
+type DeviceException struct {
+	Fingerprint string    `json:"fingerprint"`
+	Message     string    `json:"message"`
+	Count       int64     `json:"count"`
+	LastSeen    time.Time `json:"last_seen"`
+}
+
+type DevicePerfSummary struct {
+	Samples        int64   `json:"samples"`
+	AvgFPS         float64 `json:"avg_fps"`
+	P50FPS         float64 `json:"p50_fps"`
+	AvgMemMB       float64 `json:"avg_mem_mb"`
+	MaxMemMB       float64 `json:"max_mem_mb"`
+	JankCount      int64   `json:"jank_count"`
+	AvgStartupMs   float64 `json:"avg_startup_ms"`
+	AvgSceneLoadMs float64 `json:"avg_scene_load_ms"`
+}
+
+type DeviceHistory struct {
+	DeviceID    string            `json:"device_id"`
+	TimeRange   TimeRange         `json:"time_range"`
+	UserIDs     []string          `json:"user_ids"`
+	Platform    string            `json:"platform"`
+	DeviceModel string            `json:"device_model"`
+	OSVersion   string            `json:"os_version"`
+	Versions    []DeviceVersion   `json:"versions"`
+	Sessions    []SessionSummary  `json:"sessions"`
+	Crashes     []DeviceCrash     `json:"crashes"`
+	Exceptions  []DeviceException `json:"exceptions"`
+	Perf        DevicePerfSummary `json:"perf"`
+}
+
+type DeviceSummary struct {
+	DeviceID       string    `json:"device_id"`
+	Platform       string    `json:"platform"`
+	DeviceModel    string    `json:"device_model"`
+	LastAppVersion string    `json:"last_app_version"`
+	Sessions       int64     `json:"sessions"`
+	CrashCount     int64     `json:"crash_count"`
+	FirstSeen      time.Time `json:"first_seen"`
+	LastSeen       time.Time `json:"last_seen"`
+}
+
+type DeviceSearchResponse struct {
+	UserID  string          `json:"user_id"`
+	Devices []DeviceSummary `json:"devices"`
+}
+
+// App and API key types
+
+type App struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// APIKey is a stored SDK key. Only the SHA-256 hash of the key is kept; the
+// key itself is returned once, when it is issued.
+type APIKey struct {
+	ID        string     `json:"id"`
+	AppID     string     `json:"app_id"`
+	Label     string     `json:"label"`
+	Prefix    string     `json:"prefix"`
+	Hash      string     `json:"-"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+type IssuedAPIKey struct {
+	APIKey APIKey `json:"api_key"`
+	Key    string `json:"key"`
+}
+
+type RotatedAPIKey struct {
+	Previous APIKey       `json:"previous"`
+	Issued   IssuedAPIKey `json:"issued"`
+}
+
+// AuditEntry records a mutating admin API request
+type AuditEntry struct {
+	Timestamp  time.Time `json:"timestamp"`
+	AppID      string    `json:"app_id"`
+	Username   string    `json:"username"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Status     int       `json:"status"`
+	RemoteAddr string    `json:"remote_addr"`
+	RequestID  string    `json:"request_id"`
+}
+
+// QuotaUsage is an app's ingestion for the current UTC day
+type QuotaUsage struct {
+	AppID       string           `json:"app_id"`
+	Day         string           `json:"day"`
+	EventsToday int64            `json:"events_today"`
+	DailyQuota  int64            `json:"daily_quota"` // 0 means unlimited
+	Throttled   map[string]int64 `json:"throttled"`   // reason -> requests
+}
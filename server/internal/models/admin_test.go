@@ -2,6 +2,7 @@ package models
 
 import (
 	"encoding/json"
+	"strings"
 	"testing"
 	"time"
 )
@@ -183,7 +184,7 @@ func TestCrashListResponse_JSON(t *testing.T) {
 			{Fingerprint: "crash-1", CrashType: "SIGSEGV", Count: 100},
 			{Fingerprint: "crash-2", CrashType: "SIGABRT", Count: 50},
 		},
-		TotalCount: 150,
+		TotalCount: int64Ptr(150),
 		Page:       1,
 		PageSize:   20,
 	}
@@ -201,11 +202,28 @@ func TestCrashListResponse_JSON(t *testing.T) {
 	if len(decoded.Crashes) != 2 {
 		t.Errorf("expected 2 crashes, got %d", len(decoded.Crashes))
 	}
-	if decoded.TotalCount != 150 {
-		t.Errorf("expected total_count=150, got %d", decoded.TotalCount)
+	if decoded.TotalCount == nil || *decoded.TotalCount != 150 {
+		t.Errorf("expected total_count=150, got %v", decoded.TotalCount)
 	}
 }
 
+func TestCrashListResponse_WithoutTotal(t *testing.T) {
+	resp := CrashListResponse{Crashes: []CrashGroup{}, Page: 1, PageSize: 20, NextCursor: "abc"}
+
+	data, err := json.Marshal(resp)
+	if err != nil {
+		t.Fatalf("failed to marshal: %v", err)
+	}
+	if strings.Contains(string(data), "total_count") {
+		t.Errorf("expected total_count to be omitted, got %s", data)
+	}
+	if !strings.Contains(string(data), `"next_cursor":"abc"`) {
+		t.Errorf("expected next_cursor, got %s", data)
+	}
+}
+
+func int64Ptr(n int64) *int64 { return &n }
+
 func TestCrashDetail_JSON(t *testing.T) {
 	detail := CrashDetail{
 		Fingerprint:  "crash-123",
@@ -295,7 +313,7 @@ func TestExceptionListResponse_JSON(t *testing.T) {
 			{Fingerprint: "exc-1", Message: "NullReferenceException", Count: 500},
 			{Fingerprint: "exc-2", Message: "IndexOutOfRangeException", Count: 200},
 		},
-		TotalCount: 700,
+		TotalCount: int64Ptr(700),
 		Page:       1,
 		PageSize:   20,
 	}
@@ -313,8 +331,8 @@ func TestExceptionListResponse_JSON(t *testing.T) {
 	if len(decoded.Exceptions) != 2 {
 		t.Errorf("expected 2 exceptions, got %d", len(decoded.Exceptions))
 	}
-	if decoded.TotalCount != 700 {
-		t.Errorf("expected total_count=700, got %d", decoded.TotalCount)
+	if decoded.TotalCount == nil || *decoded.TotalCount != 700 {
+		t.Errorf("expected total_count=700, got %v", decoded.TotalCount)
 	}
 }
 
@@ -368,3 +386,71 @@ func TestPlatformStats_JSON(t *testing.T) {
 		t.Errorf("expected avg_fps=%f, got %f", stats.AvgFPS, decoded.AvgFPS)
 	}
 }
+
+func TestSessionSummary_JSON(t *testing.T) {
+	session := SessionSummary{
+		SessionID:    "session-123",
+		DeviceID:     "device-456",
+		AppVersion:   "1.0.0",
+		Platform:     "Android",
+		StartTime:    time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC),
+		EndTime:      time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC),
+		DurationSec:  1800,
+		ScenePath:    []string{"MainMenu", "GamePlay"},
+		CrashCount:   1,
+		EndedByCrash: true,
+	}
+
+	data, err := json.Marshal(session)
+	if err != nil {
+		t.Fatalf("failed to marshal: %v", err)
+	}
+
+	var decoded SessionSummary
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("failed to unmarshal: %v", err)
+	}
+
+	if decoded.SessionID != session.SessionID {
+		t.Errorf("expected session_id=%s, got %s", session.SessionID, decoded.SessionID)
+	}
+	if decoded.DurationSec != session.DurationSec {
+		t.Errorf("expected duration_sec=%f, got %f", session.DurationSec, decoded.DurationSec)
+	}
+	if !decoded.EndedByCrash {
+		t.Error("expected ended_by_crash=true")
+	}
+	if len(decoded.ScenePath) != 2 {
+		t.Errorf("expected 2 scenes in path, got %d", len(decoded.ScenePath))
+	}
+}
+
+func TestReleaseComparison_JSON(t *testing.T) {
+	cmp := ReleaseComparison{
+		Base:   ReleaseHealth{Version: "1.0.0", Sessions: 1000, FPS: MetricSummary{Count: 500, Mean: 55.2, P50: 58, P95: 60}},
+		Target: ReleaseHealth{Version: "1.1.0", Sessions: 800, FPS: MetricSummary{Count: 400, Mean: 50.1, P50: 52, P95: 59}},
+		Deltas: []MetricDelta{
+			{Metric: "fps_p50", Base: 58, Target: 52, Delta: -6, Significant: true, Regression: true},
+		},
+	}
+
+	data, err := json.Marshal(cmp)
+	if err != nil {
+		t.Fatalf("failed to marshal: %v", err)
+	}
+
+	var decoded ReleaseComparison
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("failed to unmarshal: %v", err)
+	}
+
+	if decoded.Base.FPS.Mean != cmp.Base.FPS.Mean {
+		t.Errorf("expected base fps mean=%f, got %f", cmp.Base.FPS.Mean, decoded.Base.FPS.Mean)
+	}
+	if decoded.Target.Version != "1.1.0" {
+		t.Errorf("expected target version=1.1.0, got %s", decoded.Target.Version)
+	}
+	if len(decoded.Deltas) != 1 || !decoded.Deltas[0].Regression {
+		t.Errorf("expected one regression delta, got %+v", decoded.Deltas)
+	}
+}
@@ -35,4 +35,7 @@ const (
 	EventTypeHTTP       EventType = "http"
 	EventTypeException  EventType = "exception"
 	EventTypeCrash      EventType = "crash"
+
+	EventTypeSessionStart EventType = "session_start"
+	EventTypeSessionEnd   EventType = "session_end"
 )
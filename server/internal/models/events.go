@@ -26,6 +26,7 @@ type RawEvent struct {
 
 // PerfSample represents a performance sample event
 type PerfSample struct {
+	AppID        string    `json:"-" ch:"app_id"`
 	Timestamp    time.Time `json:"-" ch:"timestamp"`
 	AppVersion   string    `json:"app_version" ch:"app_version"`
 	Platform     string    `json:"platform" ch:"platform"`
@@ -39,10 +40,12 @@ type PerfSample struct {
 	MainThreadMs float32   `json:"main_thread_ms" ch:"main_thread_ms"`
 	GCAllocKB    float32   `json:"gc_alloc_kb" ch:"gc_alloc_kb"`
 	MemMB        float32   `json:"mem_mb" ch:"mem_mb"`
+	SampleWeight float32   `json:"-" ch:"sample_weight"` // 1 / sample rate at ingest
 }
 
 // Jank represents a jank event
 type Jank struct {
+	AppID           string    `json:"-" ch:"app_id"`
 	Timestamp       time.Time `json:"-" ch:"timestamp"`
 	AppVersion      string    `json:"app_version" ch:"app_version"`
 	Platform        string    `json:"platform" ch:"platform"`
@@ -60,6 +63,7 @@ type Jank struct {
 
 // Startup represents a startup timing event
 type Startup struct {
+	AppID       string    `json:"-" ch:"app_id"`
 	Timestamp   time.Time `json:"-" ch:"timestamp"`
 	AppVersion  string    `json:"app_version" ch:"app_version"`
 	Platform    string    `json:"platform" ch:"platform"`
@@ -74,6 +78,7 @@ type Startup struct {
 
 // SceneLoad represents a scene load timing event
 type SceneLoad struct {
+	AppID       string    `json:"-" ch:"app_id"`
 	Timestamp   time.Time `json:"-" ch:"timestamp"`
 	AppVersion  string    `json:"app_version" ch:"app_version"`
 	Platform    string    `json:"platform" ch:"platform"`
@@ -87,6 +92,7 @@ type SceneLoad struct {
 
 // Exception represents a non-fatal exception event
 type Exception struct {
+	AppID       string    `json:"-" ch:"app_id"`
 	Timestamp   time.Time `json:"-" ch:"timestamp"`
 	AppVersion  string    `json:"app_version" ch:"app_version"`
 	Platform    string    `json:"platform" ch:"platform"`
@@ -103,6 +109,7 @@ type Exception struct {
 
 // Crash represents a fatal crash event
 type Crash struct {
+	AppID       string    `json:"-" ch:"app_id"`
 	Timestamp   time.Time `json:"-" ch:"timestamp"`
 	AppVersion  string    `json:"app_version" ch:"app_version"`
 	Platform    string    `json:"platform" ch:"platform"`
@@ -116,3 +123,38 @@ type Crash struct {
 	Stack       string    `json:"stack" ch:"stack"`
 	Breadcrumbs []string  `json:"breadcrumbs" ch:"breadcrumbs"`
 }
+
+// SessionEvent represents an explicit session_start or session_end event
+type SessionEvent struct {
+	AppID       string    `json:"-"`
+	Timestamp   time.Time `json:"-"`
+	AppVersion  string    `json:"app_version"`
+	Platform    string    `json:"platform"`
+	DeviceModel string    `json:"device_model"`
+	OSVersion   string    `json:"os_version"`
+	SessionID   string    `json:"session_id"`
+	DeviceID    string    `json:"device_id"`
+	UserID      string    `json:"user_id,omitempty"`
+	Scene       string    `json:"scene,omitempty"`
+}
+
+// Session is one row of apm_sessions. Each ingest batch writes a fragment per
+// session it touches; fragments sharing a session_id are merged at query time.
+type Session struct {
+	AppID          string    `json:"app_id" ch:"app_id"`
+	SessionID      string    `json:"session_id" ch:"session_id"`
+	DeviceID       string    `json:"device_id" ch:"device_id"`
+	UserID         string    `json:"user_id" ch:"user_id"`
+	AppVersion     string    `json:"app_version" ch:"app_version"`
+	Platform       string    `json:"platform" ch:"platform"`
+	DeviceModel    string    `json:"device_model" ch:"device_model"`
+	OSVersion      string    `json:"os_version" ch:"os_version"`
+	StartTime      time.Time `json:"start_time" ch:"start_time"`
+	EndTime        time.Time `json:"end_time" ch:"end_time"`
+	Scenes         []string  `json:"scenes" ch:"scenes"`
+	EventCount     uint32    `json:"event_count" ch:"event_count"`
+	CrashCount     uint32    `json:"crash_count" ch:"crash_count"`
+	ExceptionCount uint32    `json:"exception_count" ch:"exception_count"`
+	JankCount      uint32    `json:"jank_count" ch:"jank_count"`
+	EndedByCrash   bool      `json:"ended_by_crash" ch:"ended_by_crash"`
+}
@@ -216,6 +216,22 @@ func TestCrash_JSON(t *testing.T) {
 	}
 }
 
+func TestSessionEvent_JSON(t *testing.T) {
+	input := `{"type":"session_start","timestamp":1705315800000,"app_version":"1.0.0","platform":"Android","session_id":"session-123","device_id":"device-456","user_id":"user-789"}`
+
+	var decoded SessionEvent
+	if err := json.Unmarshal([]byte(input), &decoded); err != nil {
+		t.Fatalf("failed to unmarshal: %v", err)
+	}
+
+	if decoded.SessionID != "session-123" {
+		t.Errorf("expected session_id=session-123, got %s", decoded.SessionID)
+	}
+	if decoded.UserID != "user-789" {
+		t.Errorf("expected user_id=user-789, got %s", decoded.UserID)
+	}
+}
+
 func TestEventBatch_JSON(t *testing.T) {
 	batch := EventBatch{
 		AppKey: "test-key",
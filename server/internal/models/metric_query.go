@@ -0,0 +1,52 @@
+package models
+
+import "time"
+
+// Filter operators of a MetricFilter
+const (
+	FilterEq     = "eq"
+	FilterNeq    = "neq"
+	FilterIn     = "in"
+	FilterNotIn  = "not_in"
+	FilterPrefix = "prefix"
+)
+
+// MetricQuery aggregates one metric over a time range, optionally grouped by
+// dimensions and bucketed in time
+type MetricQuery struct {
+	AppID       string         `json:"app_id,omitempty"`
+	Metric      string         `json:"metric"`
+	Aggregation string         `json:"aggregation"`        // avg, min, max, pN, count or uniq
+	GroupBy     []string       `json:"group_by,omitempty"` // dimensions
+	Filters     []MetricFilter `json:"filters,omitempty"`  // ANDed
+	Bucket      string         `json:"bucket,omitempty"`   // e.g. 5m or 1h; empty for a table
+	StartTime   time.Time      `json:"start_time"`
+	EndTime     time.Time      `json:"end_time"`
+	Limit       int            `json:"limit,omitempty"` // rows, or series when bucketed
+}
+
+// MetricFilter restricts a dimension. Eq, neq and prefix take one value, in
+// and not_in one or more.
+type MetricFilter struct {
+	Dimension string   `json:"dimension"`
+	Op        string   `json:"op"`
+	Values    []string `json:"values"`
+}
+
+// MetricQueryResult holds a table when the query has no bucket, with a
+// column per group-by dimension followed by "value". A bucketed query
+// returns a series per group instead.
+type MetricQueryResult struct {
+	Metric      string          `json:"metric"`
+	Aggregation string          `json:"aggregation"`
+	Bucket      string          `json:"bucket,omitempty"`
+	Columns     []string        `json:"columns,omitempty"`
+	Rows        [][]interface{} `json:"rows,omitempty"`
+	Series      []MetricSeries  `json:"series,omitempty"`
+}
+
+// MetricSeries is the time series of one group of a bucketed query
+type MetricSeries struct {
+	Group  map[string]string `json:"group"`
+	Points []TimeSeriesPoint `json:"points"`
+}
@@ -4,6 +4,7 @@ import "time"
 
 // QueryFilter contains common filter parameters for queries
 type QueryFilter struct {
+	AppID       string    `json:"app_id,omitempty"`
 	AppVersion  string    `json:"app_version,omitempty"`
 	Platform    string    `json:"platform,omitempty"`
 	DeviceModel string    `json:"device_model,omitempty"`
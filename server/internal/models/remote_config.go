@@ -0,0 +1,60 @@
+package models
+
+import "time"
+
+// RemoteConfig is the SDK configuration served to an app. Rules can target
+// an app version, a platform, both or neither; the most specific matching
+// rule applies as a whole.
+type RemoteConfig struct {
+	AppID      string `json:"app_id"`
+	AppVersion string `json:"app_version"` // empty matches every version
+	Platform   string `json:"platform"`    // empty matches every platform
+
+	// Enabled is the kill switch: when false the SDK stops collecting and
+	// sending events
+	Enabled bool `json:"enabled"`
+
+	// PerfSampleRate is the fraction of perf samples stored at ingest
+	PerfSampleRate float64 `json:"perf_sample_rate"`
+	// MaxPerfSamplesPerMin lowers the sample rate further when the rule's
+	// traffic exceeds it; 0 means no cap
+	MaxPerfSamplesPerMin int64 `json:"max_perf_samples_per_min"`
+
+	SamplingIntervalSeconds float64        `json:"sampling_interval_seconds"`
+	JankThresholdMs         float64        `json:"jank_threshold_ms"`
+	BatchSize               int            `json:"batch_size"`
+	FlushIntervalSeconds    float64        `json:"flush_interval_seconds"`
+	Features                RemoteFeatures `json:"features"`
+
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// RemoteFeatures toggles SDK collectors
+type RemoteFeatures struct {
+	Performance       bool `json:"performance"`
+	JankDetection     bool `json:"jank_detection"`
+	ExceptionCapture  bool `json:"exception_capture"`
+	StartupTiming     bool `json:"startup_timing"`
+	SceneLoadTracking bool `json:"scene_load_tracking"`
+}
+
+// DefaultRemoteConfig returns the configuration used when no rule matches,
+// matching the SDK's built-in defaults
+func DefaultRemoteConfig(appID string) RemoteConfig {
+	return RemoteConfig{
+		AppID:                   appID,
+		Enabled:                 true,
+		PerfSampleRate:          1,
+		SamplingIntervalSeconds: 1,
+		JankThresholdMs:         50,
+		BatchSize:               20,
+		FlushIntervalSeconds:    30,
+		Features: RemoteFeatures{
+			Performance:       true,
+			JankDetection:     true,
+			ExceptionCapture:  true,
+			StartupTiming:     true,
+			SceneLoadTracking: true,
+		},
+	}
+}
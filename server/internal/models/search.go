@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// Kinds of issues a search returns
+const (
+	IssueCrash     = "crash"
+	IssueException = "exception"
+)
+
+// SearchResult is a crash or exception group matching every search term
+type SearchResult struct {
+	Kind        string            `json:"kind"`
+	Fingerprint string            `json:"fingerprint"`
+	Title       string            `json:"title"` // crash type or exception message
+	Count       int64             `json:"count"`
+	LastSeen    time.Time         `json:"last_seen"`
+	Field       string            `json:"field"` // message or stack, where the snippet comes from
+	Snippet     []SnippetFragment `json:"snippet"`
+}
+
+// SnippetFragment is a piece of a snippet. Concatenated, the fragments give
+// the snippet text, with the parts matching a term flagged for highlighting.
+type SnippetFragment struct {
+	Text  string `json:"text"`
+	Match bool   `json:"match,omitempty"`
+}
+
+// SearchResponse holds the groups matching a search, most frequent first
+type SearchResponse struct {
+	Query     string         `json:"query"`
+	Terms     []string       `json:"terms"`
+	TimeRange TimeRange      `json:"time_range"`
+	Results   []SearchResult `json:"results"`
+}
@@ -10,16 +10,36 @@ type RealTimeStats struct {
 	mu sync.RWMutex
 
 	// Per-version crash counts for the last minute
-	CrashCounts map[string]*VersionCrashStats
+	CrashCounts map[VersionKey]*VersionCrashStats
 
 	// Per-version exception counts for the last minute
-	ExceptionCounts map[string]*VersionExceptionStats
+	ExceptionCounts map[VersionKey]*VersionExceptionStats
 
 	// Per-version jank counts for the last minute
-	JankCounts map[string]*VersionJankStats
+	JankCounts map[VersionKey]*VersionJankStats
+
+	// Per-version sessions seen in the last minute, by session ID
+	sessions map[VersionKey]map[string]time.Time
+
+	// Per-platform FPS and startup TTI samples of the last minute
+	fps     map[platformKey]*recentValues
+	startup map[platformKey]*recentValues
+}
+
+// VersionKey identifies a version of an app, as apps share version numbers
+type VersionKey struct {
+	AppID      string
+	AppVersion string
+}
+
+// platformKey identifies a platform of an app
+type platformKey struct {
+	appID    string
+	platform string
 }
 
 type VersionCrashStats struct {
+	AppID      string
 	AppVersion string
 	Count      int64
 	LastSeen   time.Time
@@ -27,6 +47,7 @@ type VersionCrashStats struct {
 }
 
 type VersionExceptionStats struct {
+	AppID      string
 	AppVersion string
 	Count      int64
 	LastSeen   time.Time
@@ -34,6 +55,7 @@ type VersionExceptionStats struct {
 }
 
 type VersionJankStats struct {
+	AppID      string
 	AppVersion string
 	Count      int64
 	LastSeen   time.Time
@@ -50,9 +72,12 @@ type Aggregator struct {
 func NewAggregator() *Aggregator {
 	a := &Aggregator{
 		stats: &RealTimeStats{
-			CrashCounts:     make(map[string]*VersionCrashStats),
-			ExceptionCounts: make(map[string]*VersionExceptionStats),
-			JankCounts:      make(map[string]*VersionJankStats),
+			CrashCounts:     make(map[VersionKey]*VersionCrashStats),
+			ExceptionCounts: make(map[VersionKey]*VersionExceptionStats),
+			JankCounts:      make(map[VersionKey]*VersionJankStats),
+			sessions:        make(map[VersionKey]map[string]time.Time),
+			fps:             make(map[platformKey]*recentValues),
+			startup:         make(map[platformKey]*recentValues),
 		},
 		windowSize:  time.Minute,
 		cleanupTick: 10 * time.Second,
@@ -103,20 +128,41 @@ func (a *Aggregator) cleanup() {
 			delete(a.stats.JankCounts, k)
 		}
 	}
+
+	for version, sessions := range a.stats.sessions {
+		for id, lastSeen := range sessions {
+			if lastSeen.Before(cutoff) {
+				delete(sessions, id)
+			}
+		}
+		if len(sessions) == 0 {
+			delete(a.stats.sessions, version)
+		}
+	}
+
+	for _, samples := range []map[platformKey]*recentValues{a.stats.fps, a.stats.startup} {
+		for k, v := range samples {
+			if v.prune(cutoff) == 0 {
+				delete(samples, k)
+			}
+		}
+	}
 }
 
 // RecordCrash records a crash event for real-time stats
-func (a *Aggregator) RecordCrash(appVersion, sessionID string) {
+func (a *Aggregator) RecordCrash(appID, appVersion, sessionID string) {
 	a.stats.mu.Lock()
 	defer a.stats.mu.Unlock()
 
-	stats, ok := a.stats.CrashCounts[appVersion]
+	key := VersionKey{AppID: appID, AppVersion: appVersion}
+	stats, ok := a.stats.CrashCounts[key]
 	if !ok {
 		stats = &VersionCrashStats{
+			AppID:      appID,
 			AppVersion: appVersion,
 			Sessions:   make(map[string]struct{}),
 		}
-		a.stats.CrashCounts[appVersion] = stats
+		a.stats.CrashCounts[key] = stats
 	}
 
 	stats.Count++
@@ -125,17 +171,19 @@ func (a *Aggregator) RecordCrash(appVersion, sessionID string) {
 }
 
 // RecordException records an exception event for real-time stats
-func (a *Aggregator) RecordException(appVersion, sessionID string) {
+func (a *Aggregator) RecordException(appID, appVersion, sessionID string) {
 	a.stats.mu.Lock()
 	defer a.stats.mu.Unlock()
 
-	stats, ok := a.stats.ExceptionCounts[appVersion]
+	key := VersionKey{AppID: appID, AppVersion: appVersion}
+	stats, ok := a.stats.ExceptionCounts[key]
 	if !ok {
 		stats = &VersionExceptionStats{
+			AppID:      appID,
 			AppVersion: appVersion,
 			Sessions:   make(map[string]struct{}),
 		}
-		a.stats.ExceptionCounts[appVersion] = stats
+		a.stats.ExceptionCounts[key] = stats
 	}
 
 	stats.Count++
@@ -144,17 +192,19 @@ func (a *Aggregator) RecordException(appVersion, sessionID string) {
 }
 
 // RecordJank records a jank event for real-time stats
-func (a *Aggregator) RecordJank(appVersion, sessionID string) {
+func (a *Aggregator) RecordJank(appID, appVersion, sessionID string) {
 	a.stats.mu.Lock()
 	defer a.stats.mu.Unlock()
 
-	stats, ok := a.stats.JankCounts[appVersion]
+	key := VersionKey{AppID: appID, AppVersion: appVersion}
+	stats, ok := a.stats.JankCounts[key]
 	if !ok {
 		stats = &VersionJankStats{
+			AppID:      appID,
 			AppVersion: appVersion,
 			Sessions:   make(map[string]struct{}),
 		}
-		a.stats.JankCounts[appVersion] = stats
+		a.stats.JankCounts[key] = stats
 	}
 
 	stats.Count++
@@ -162,35 +212,44 @@ func (a *Aggregator) RecordJank(appVersion, sessionID string) {
 	stats.Sessions[sessionID] = struct{}{}
 }
 
-// GetCrashRate returns crashes per minute for a version
+// GetCrashRate returns crashes per minute for a version, over all apps
 func (a *Aggregator) GetCrashRate(appVersion string) (count int64, sessions int) {
 	a.stats.mu.RLock()
 	defer a.stats.mu.RUnlock()
 
-	if stats, ok := a.stats.CrashCounts[appVersion]; ok {
-		return stats.Count, len(stats.Sessions)
+	for key, stats := range a.stats.CrashCounts {
+		if key.AppVersion == appVersion {
+			count += stats.Count
+			sessions += len(stats.Sessions)
+		}
 	}
-	return 0, 0
+	return count, sessions
 }
 
-// GetExceptionRate returns exceptions per minute for a version
+// GetExceptionRate returns exceptions per minute for a version, over all apps
 func (a *Aggregator) GetExceptionRate(appVersion string) (count int64, sessions int) {
 	a.stats.mu.RLock()
 	defer a.stats.mu.RUnlock()
 
-	if stats, ok := a.stats.ExceptionCounts[appVersion]; ok {
-		return stats.Count, len(stats.Sessions)
+	for key, stats := range a.stats.ExceptionCounts {
+		if key.AppVersion == appVersion {
+			count += stats.Count
+			sessions += len(stats.Sessions)
+		}
 	}
-	return 0, 0
+	return count, sessions
 }
 
-// GetJankRate returns janks per minute for a version
+// GetJankRate returns janks per minute for a version, over all apps
 func (a *Aggregator) GetJankRate(appVersion string) (count int64, sessions int) {
 	a.stats.mu.RLock()
 	defer a.stats.mu.RUnlock()
 
-	if stats, ok := a.stats.JankCounts[appVersion]; ok {
-		return stats.Count, len(stats.Sessions)
+	for key, stats := range a.stats.JankCounts {
+		if key.AppVersion == appVersion {
+			count += stats.Count
+			sessions += len(stats.Sessions)
+		}
 	}
-	return 0, 0
+	return count, sessions
 }
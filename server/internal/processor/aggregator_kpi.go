@@ -0,0 +1,350 @@
+package processor
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// OtherLabel replaces apps, versions and platforms beyond a snapshot's
+// limits
+const OtherLabel = "other"
+
+// maxRecentValues bounds the samples kept per platform, so a burst of
+// traffic cannot grow the window without limit
+const maxRecentValues = 4096
+
+// RecordSession marks a session as active for real-time stats
+func (a *Aggregator) RecordSession(appID, appVersion, sessionID string) {
+	if sessionID == "" {
+		return
+	}
+	a.stats.mu.Lock()
+	defer a.stats.mu.Unlock()
+
+	key := VersionKey{AppID: appID, AppVersion: appVersion}
+	sessions, ok := a.stats.sessions[key]
+	if !ok {
+		sessions = make(map[string]time.Time)
+		a.stats.sessions[key] = sessions
+	}
+	sessions[sessionID] = time.Now()
+}
+
+// RecordFPS records a perf sample's FPS for real-time percentiles
+func (a *Aggregator) RecordFPS(appID, platform string, fps float32) {
+	a.recordValue(a.stats.fps, platformKey{appID, platform}, float64(fps))
+}
+
+// RecordStartup records a startup's time to interactive for real-time
+// percentiles
+func (a *Aggregator) RecordStartup(appID, platform string, ttiMs float32) {
+	a.recordValue(a.stats.startup, platformKey{appID, platform}, float64(ttiMs))
+}
+
+func (a *Aggregator) recordValue(values map[platformKey]*recentValues, key platformKey, v float64) {
+	a.stats.mu.Lock()
+	defer a.stats.mu.Unlock()
+
+	recent, ok := values[key]
+	if !ok {
+		recent = &recentValues{}
+		values[key] = recent
+	}
+	recent.add(v, time.Now())
+}
+
+// Snapshot is a point-in-time copy of the real-time stats
+type Snapshot struct {
+	Versions  []VersionKPIs
+	Platforms []PlatformKPIs
+}
+
+// VersionKPIs are the last minute's counts for a version of an app
+type VersionKPIs struct {
+	AppID      string
+	AppVersion string
+	Crashes    int64
+	Exceptions int64
+	Janks      int64
+	Sessions   int // active sessions
+}
+
+// PlatformKPIs are the last minute's distributions for a platform of an app
+type PlatformKPIs struct {
+	AppID      string
+	Platform   string
+	FPS        Distribution
+	StartupTTI Distribution // milliseconds
+}
+
+// Distribution summarizes a set of samples. Percentiles are zero without
+// samples.
+type Distribution struct {
+	Count int
+	Sum   float64
+	P10   float64
+	P50   float64
+	P90   float64
+	P99   float64
+}
+
+// Snapshot returns the current stats, ordered by app. Only the maxApps apps
+// with the most active sessions are reported by name, and of each app the
+// maxVersions versions with the most active sessions and the maxPlatforms
+// platforms with the most samples; the rest are folded into OtherLabel. A
+// limit of 0 means no limit.
+func (a *Aggregator) Snapshot(maxApps, maxVersions, maxPlatforms int) Snapshot {
+	a.stats.mu.RLock()
+	defer a.stats.mu.RUnlock()
+
+	app := a.appLabels(maxApps)
+	return Snapshot{
+		Versions:  a.versionKPIs(app, maxVersions),
+		Platforms: a.platformKPIs(app, maxPlatforms),
+	}
+}
+
+// appLabels returns the label of each app: its ID for the limit apps with
+// the most active sessions, OtherLabel for the rest
+func (a *Aggregator) appLabels(limit int) func(appID string) string {
+	if limit <= 0 {
+		return func(appID string) string { return appID }
+	}
+
+	active := make(map[string]int)
+	for key, sessions := range a.stats.sessions {
+		active[key.AppID] += len(sessions)
+	}
+	// Apps whose events carry no session IDs rank last
+	for key := range a.stats.CrashCounts {
+		active[key.AppID] += 0
+	}
+	for key := range a.stats.ExceptionCounts {
+		active[key.AppID] += 0
+	}
+	for key := range a.stats.JankCounts {
+		active[key.AppID] += 0
+	}
+	for _, values := range []map[platformKey]*recentValues{a.stats.fps, a.stats.startup} {
+		for key := range values {
+			active[key.appID] += 0
+		}
+	}
+
+	apps := make([]string, 0, len(active))
+	for appID := range active {
+		apps = append(apps, appID)
+	}
+	sort.Slice(apps, func(i, j int) bool {
+		if active[apps[i]] != active[apps[j]] {
+			return active[apps[i]] > active[apps[j]]
+		}
+		return apps[i] < apps[j]
+	})
+
+	named := make(map[string]bool)
+	for i := 0; i < len(apps) && i < limit; i++ {
+		named[apps[i]] = true
+	}
+	return func(appID string) string {
+		if named[appID] {
+			return appID
+		}
+		return OtherLabel
+	}
+}
+
+func (a *Aggregator) versionKPIs(app func(string) string, limit int) []VersionKPIs {
+	byApp := make(map[string]map[string]*VersionKPIs)
+	get := func(key VersionKey) *VersionKPIs {
+		appID := app(key.AppID)
+		versions, ok := byApp[appID]
+		if !ok {
+			versions = make(map[string]*VersionKPIs)
+			byApp[appID] = versions
+		}
+		k, ok := versions[key.AppVersion]
+		if !ok {
+			k = &VersionKPIs{AppID: appID, AppVersion: key.AppVersion}
+			versions[key.AppVersion] = k
+		}
+		return k
+	}
+	for key, s := range a.stats.CrashCounts {
+		get(key).Crashes += s.Count
+	}
+	for key, s := range a.stats.ExceptionCounts {
+		get(key).Exceptions += s.Count
+	}
+	for key, s := range a.stats.JankCounts {
+		get(key).Janks += s.Count
+	}
+	for key, sessions := range a.stats.sessions {
+		get(key).Sessions += len(sessions)
+	}
+
+	apps := make([]string, 0, len(byApp))
+	for appID := range byApp {
+		apps = append(apps, appID)
+	}
+	sort.Strings(apps)
+
+	var kpis []VersionKPIs
+	for _, appID := range apps {
+		versions := make([]VersionKPIs, 0, len(byApp[appID]))
+		for _, k := range byApp[appID] {
+			versions = append(versions, *k)
+		}
+		sort.Slice(versions, func(i, j int) bool {
+			if versions[i].Sessions != versions[j].Sessions {
+				return versions[i].Sessions > versions[j].Sessions
+			}
+			return versions[i].AppVersion < versions[j].AppVersion
+		})
+
+		if limit > 0 && len(versions) > limit {
+			other := VersionKPIs{AppID: appID, AppVersion: OtherLabel}
+			for _, k := range versions[limit:] {
+				other.Crashes += k.Crashes
+				other.Exceptions += k.Exceptions
+				other.Janks += k.Janks
+				other.Sessions += k.Sessions
+			}
+			versions = append(versions[:limit], other)
+		}
+		kpis = append(kpis, versions...)
+	}
+	return kpis
+}
+
+func (a *Aggregator) platformKPIs(app func(string) string, limit int) []PlatformKPIs {
+	type platformValues struct {
+		platform     string
+		fps, startup []float64
+	}
+	byApp := make(map[string]map[string]*platformValues)
+	get := func(key platformKey) *platformValues {
+		appID := app(key.appID)
+		platforms, ok := byApp[appID]
+		if !ok {
+			platforms = make(map[string]*platformValues)
+			byApp[appID] = platforms
+		}
+		p, ok := platforms[key.platform]
+		if !ok {
+			p = &platformValues{platform: key.platform}
+			platforms[key.platform] = p
+		}
+		return p
+	}
+	for key, recent := range a.stats.fps {
+		p := get(key)
+		p.fps = append(p.fps, recent.values()...)
+	}
+	for key, recent := range a.stats.startup {
+		p := get(key)
+		p.startup = append(p.startup, recent.values()...)
+	}
+
+	apps := make([]string, 0, len(byApp))
+	for appID := range byApp {
+		apps = append(apps, appID)
+	}
+	sort.Strings(apps)
+
+	var kpis []PlatformKPIs
+	for _, appID := range apps {
+		platforms := make([]*platformValues, 0, len(byApp[appID]))
+		for _, p := range byApp[appID] {
+			platforms = append(platforms, p)
+		}
+		sort.Slice(platforms, func(i, j int) bool {
+			ni := len(platforms[i].fps) + len(platforms[i].startup)
+			nj := len(platforms[j].fps) + len(platforms[j].startup)
+			if ni != nj {
+				return ni > nj
+			}
+			return platforms[i].platform < platforms[j].platform
+		})
+
+		if limit > 0 && len(platforms) > limit {
+			other := &platformValues{platform: OtherLabel}
+			for _, p := range platforms[limit:] {
+				other.fps = append(other.fps, p.fps...)
+				other.startup = append(other.startup, p.startup...)
+			}
+			platforms = append(platforms[:limit], other)
+		}
+
+		for _, p := range platforms {
+			kpis = append(kpis, PlatformKPIs{
+				AppID:      appID,
+				Platform:   p.platform,
+				FPS:        distribution(p.fps),
+				StartupTTI: distribution(p.startup),
+			})
+		}
+	}
+	return kpis
+}
+
+// distribution computes nearest-rank percentiles, sorting values in place
+func distribution(values []float64) Distribution {
+	d := Distribution{Count: len(values)}
+	if len(values) == 0 {
+		return d
+	}
+	sort.Float64s(values)
+	for _, v := range values {
+		d.Sum += v
+	}
+	percentile := func(p float64) float64 {
+		rank := int(math.Ceil(p*float64(len(values)))) - 1
+		if rank < 0 {
+			rank = 0
+		}
+		return values[rank]
+	}
+	d.P10 = percentile(0.10)
+	d.P50 = percentile(0.50)
+	d.P90 = percentile(0.90)
+	d.P99 = percentile(0.99)
+	return d
+}
+
+// recentValues holds timestamped samples in arrival order
+type recentValues struct {
+	samples []timedValue
+}
+
+type timedValue struct {
+	v  float64
+	at time.Time
+}
+
+func (r *recentValues) add(v float64, at time.Time) {
+	if len(r.samples) >= maxRecentValues {
+		r.samples = r.samples[1:]
+	}
+	r.samples = append(r.samples, timedValue{v, at})
+}
+
+// prune drops samples older than cutoff and returns how many remain
+func (r *recentValues) prune(cutoff time.Time) int {
+	i := sort.Search(len(r.samples), func(i int) bool { return !r.samples[i].at.Before(cutoff) })
+	if i > 0 {
+		// Copy so the dropped samples' backing array can be freed
+		r.samples = append([]timedValue(nil), r.samples[i:]...)
+	}
+	return len(r.samples)
+}
+
+// values returns a copy of the sample values
+func (r *recentValues) values() []float64 {
+	values := make([]float64, len(r.samples))
+	for i, s := range r.samples {
+		values[i] = s.v
+	}
+	return values
+}
@@ -0,0 +1,107 @@
+package processor
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAggregator_Snapshot(t *testing.T) {
+	a := NewAggregator()
+	defer a.Stop()
+
+	a.RecordSession("game", "1.0.0", "s1")
+	a.RecordSession("game", "1.0.0", "s2")
+	a.RecordSession("game", "1.0.0", "s1")
+	a.RecordCrash("game", "1.0.0", "s1")
+	a.RecordSession("game", "1.1.0", "s3")
+	a.RecordException("game", "1.1.0", "s3")
+	a.RecordSession("game", "0.9.0", "s4")
+	a.RecordJank("game", "0.9.0", "s4")
+	a.RecordSession("game", "", "") // without a session ID nothing is tracked
+
+	// Apps share version numbers but are counted apart
+	a.RecordSession("tools", "1.0.0", "t1")
+	a.RecordCrash("tools", "1.0.0", "t1")
+	a.RecordSession("demo", "2.0.0", "d1")
+
+	for i := 1; i <= 100; i++ {
+		a.RecordFPS("game", "Android", float32(i))
+	}
+	a.RecordFPS("game", "iOS", 60)
+	a.RecordStartup("game", "iOS", 1200)
+	a.RecordStartup("game", "WebGL", 3000)
+	a.RecordFPS("demo", "Android", 30)
+
+	snapshot := a.Snapshot(2, 2, 1)
+
+	want := []VersionKPIs{
+		{AppID: "demo", AppVersion: "2.0.0", Sessions: 1},
+		{AppID: "game", AppVersion: "1.0.0", Crashes: 1, Sessions: 2},
+		{AppID: "game", AppVersion: "0.9.0", Janks: 1, Sessions: 1},
+		{AppID: "game", AppVersion: OtherLabel, Exceptions: 1, Sessions: 1},
+		{AppID: OtherLabel, AppVersion: "1.0.0", Crashes: 1, Sessions: 1},
+	}
+	if len(snapshot.Versions) != len(want) {
+		t.Fatalf("expected %d versions, got %+v", len(want), snapshot.Versions)
+	}
+	for i := range want {
+		if snapshot.Versions[i] != want[i] {
+			t.Errorf("version %d = %+v, want %+v", i, snapshot.Versions[i], want[i])
+		}
+	}
+
+	if len(snapshot.Platforms) != 3 {
+		t.Fatalf("expected demo Android, game Android and game other, got %+v", snapshot.Platforms)
+	}
+	demo, android, other := snapshot.Platforms[0], snapshot.Platforms[1], snapshot.Platforms[2]
+	if demo.AppID != "demo" || demo.Platform != "Android" || demo.FPS.Count != 1 {
+		t.Errorf("unexpected demo platform %+v", demo)
+	}
+	wantFPS := Distribution{Count: 100, Sum: 5050, P10: 10, P50: 50, P90: 90, P99: 99}
+	if android.AppID != "game" || android.Platform != "Android" || android.FPS != wantFPS {
+		t.Errorf("android = %+v, want FPS %+v", android, wantFPS)
+	}
+	if other.AppID != "game" || other.Platform != OtherLabel || other.FPS.Count != 1 || other.StartupTTI.Count != 2 || other.StartupTTI.P50 != 1200 {
+		t.Errorf("unexpected other platform %+v", other)
+	}
+
+	if unlimited := a.Snapshot(0, 0, 0); len(unlimited.Versions) != 5 || len(unlimited.Platforms) != 4 {
+		t.Errorf("expected every app, version and platform without limits, got %+v", unlimited)
+	}
+}
+
+func TestAggregator_CleanupKPIs(t *testing.T) {
+	a := NewAggregator()
+	defer a.Stop()
+
+	a.RecordSession("game", "1.0.0", "s1")
+	a.RecordFPS("game", "Android", 60)
+
+	// Age the recorded entries past the window
+	old := time.Now().Add(-2 * a.windowSize)
+	a.stats.sessions[VersionKey{AppID: "game", AppVersion: "1.0.0"}]["s1"] = old
+	a.stats.fps[platformKey{"game", "Android"}].samples[0].at = old
+
+	a.RecordSession("game", "1.0.0", "s2")
+	a.cleanup()
+
+	snapshot := a.Snapshot(0, 0, 0)
+	if len(snapshot.Versions) != 1 || snapshot.Versions[0].Sessions != 1 {
+		t.Errorf("expected only s2 to stay active, got %+v", snapshot.Versions)
+	}
+	if len(snapshot.Platforms) != 0 {
+		t.Errorf("expected stale FPS samples to be dropped, got %+v", snapshot.Platforms)
+	}
+}
+
+func TestRecentValues_Bounded(t *testing.T) {
+	var r recentValues
+	now := time.Now()
+	for i := 0; i < maxRecentValues+10; i++ {
+		r.add(float64(i), now)
+	}
+	values := r.values()
+	if len(values) != maxRecentValues || values[0] != 10 {
+		t.Errorf("expected the %d newest values, got %d starting at %v", maxRecentValues, len(values), values[0])
+	}
+}
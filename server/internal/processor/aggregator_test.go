@@ -31,9 +31,9 @@ func TestAggregator_RecordCrash(t *testing.T) {
 	defer a.Stop()
 
 	// Record crashes
-	a.RecordCrash("1.0.0", "session1")
-	a.RecordCrash("1.0.0", "session2")
-	a.RecordCrash("1.0.0", "session1") // Same session
+	a.RecordCrash("game", "1.0.0", "session1")
+	a.RecordCrash("game", "1.0.0", "session2")
+	a.RecordCrash("game", "1.0.0", "session1") // Same session
 
 	count, sessions := a.GetCrashRate("1.0.0")
 	if count != 3 {
@@ -44,7 +44,7 @@ func TestAggregator_RecordCrash(t *testing.T) {
 	}
 
 	// Different version
-	a.RecordCrash("2.0.0", "session3")
+	a.RecordCrash("game", "2.0.0", "session3")
 	count, sessions = a.GetCrashRate("2.0.0")
 	if count != 1 {
 		t.Errorf("expected 1 crash for 2.0.0, got %d", count)
@@ -52,6 +52,13 @@ func TestAggregator_RecordCrash(t *testing.T) {
 	if sessions != 1 {
 		t.Errorf("expected 1 session for 2.0.0, got %d", sessions)
 	}
+
+	// The same version of another app adds to the rate
+	a.RecordCrash("tools", "2.0.0", "session4")
+	count, sessions = a.GetCrashRate("2.0.0")
+	if count != 2 || sessions != 2 {
+		t.Errorf("expected 2 crashes in 2 sessions for 2.0.0 over all apps, got %d in %d", count, sessions)
+	}
 }
 
 func TestAggregator_RecordException(t *testing.T) {
@@ -59,9 +66,9 @@ func TestAggregator_RecordException(t *testing.T) {
 	defer a.Stop()
 
 	// Record exceptions
-	a.RecordException("1.0.0", "session1")
-	a.RecordException("1.0.0", "session2")
-	a.RecordException("1.0.0", "session1")
+	a.RecordException("game", "1.0.0", "session1")
+	a.RecordException("game", "1.0.0", "session2")
+	a.RecordException("game", "1.0.0", "session1")
 
 	count, sessions := a.GetExceptionRate("1.0.0")
 	if count != 3 {
@@ -77,9 +84,9 @@ func TestAggregator_RecordJank(t *testing.T) {
 	defer a.Stop()
 
 	// Record janks
-	a.RecordJank("1.0.0", "session1")
-	a.RecordJank("1.0.0", "session2")
-	a.RecordJank("1.0.0", "session1")
+	a.RecordJank("game", "1.0.0", "session1")
+	a.RecordJank("game", "1.0.0", "session2")
+	a.RecordJank("game", "1.0.0", "session1")
 
 	count, sessions := a.GetJankRate("1.0.0")
 	if count != 3 {
@@ -121,9 +128,9 @@ func TestAggregator_Cleanup(t *testing.T) {
 	a.windowSize = 10 * time.Millisecond
 
 	// Record events
-	a.RecordCrash("1.0.0", "session1")
-	a.RecordException("1.0.0", "session1")
-	a.RecordJank("1.0.0", "session1")
+	a.RecordCrash("game", "1.0.0", "session1")
+	a.RecordException("game", "1.0.0", "session1")
+	a.RecordJank("game", "1.0.0", "session1")
 
 	// Verify they exist
 	count, _ := a.GetCrashRate("1.0.0")
@@ -161,7 +168,7 @@ func TestAggregator_Stop(t *testing.T) {
 	a.Stop()
 
 	// Calling methods after stop should not panic
-	a.RecordCrash("1.0.0", "session1")
+	a.RecordCrash("game", "1.0.0", "session1")
 }
 
 func TestAggregator_ConcurrentAccess(t *testing.T) {
@@ -174,9 +181,9 @@ func TestAggregator_ConcurrentAccess(t *testing.T) {
 	for i := 0; i < 10; i++ {
 		go func(id int) {
 			for j := 0; j < 100; j++ {
-				a.RecordCrash("1.0.0", "session1")
-				a.RecordException("1.0.0", "session2")
-				a.RecordJank("1.0.0", "session3")
+				a.RecordCrash("game", "1.0.0", "session1")
+				a.RecordException("game", "1.0.0", "session2")
+				a.RecordJank("game", "1.0.0", "session3")
 			}
 			done <- true
 		}(i)
@@ -0,0 +1,24 @@
+package processor
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"regexp"
+	"strings"
+)
+
+var lineNumberPattern = regexp.MustCompile(`:\d+`)
+
+// Fingerprint groups exceptions reported by clients other than the Unity SDK
+// the same way the SDK does: by exception type and the first stack frame,
+// ignoring line numbers
+func Fingerprint(exceptionType, stack string) string {
+	if exceptionType == "" {
+		exceptionType = "UnknownException"
+	}
+	firstLine, _, _ := strings.Cut(stack, "\n")
+	firstLine = lineNumberPattern.ReplaceAllString(strings.TrimRight(firstLine, "\r"), "")
+
+	sum := md5.Sum([]byte(exceptionType + "|" + firstLine))
+	return hex.EncodeToString(sum[:])[:16]
+}
@@ -0,0 +1,21 @@
+package processor
+
+import "testing"
+
+func TestFingerprint(t *testing.T) {
+	a := Fingerprint("NullReferenceException", "at Player.Update () Player.cs:42\nat Game.Tick ()")
+	b := Fingerprint("NullReferenceException", "at Player.Update () Player.cs:57\nat Other.Path ()")
+	if a != b {
+		t.Errorf("expected line numbers and deeper frames to be ignored, got %s and %s", a, b)
+	}
+	if len(a) != 16 {
+		t.Errorf("expected 16 hex characters, got %q", a)
+	}
+
+	if c := Fingerprint("ArgumentException", "at Player.Update () Player.cs:42"); c == a {
+		t.Error("expected different exception types to differ")
+	}
+	if Fingerprint("", "") != Fingerprint("UnknownException", "") {
+		t.Error("expected an empty type to match the SDK's UnknownException")
+	}
+}
@@ -0,0 +1,92 @@
+package processor
+
+import (
+	"math"
+
+	"github.com/warriorguo/ozx_apm/server/internal/models"
+)
+
+// SignificanceZ is the |z| above which a release delta is flagged as
+// significant (two-sided, 95% confidence)
+const SignificanceZ = 1.96
+
+// ProportionZ returns the two-proportion z-score for x2/n2 against x1/n1
+func ProportionZ(x1, n1, x2, n2 int64) float64 {
+	if n1 == 0 || n2 == 0 {
+		return 0
+	}
+	p1 := float64(x1) / float64(n1)
+	p2 := float64(x2) / float64(n2)
+	pooled := float64(x1+x2) / float64(n1+n2)
+	se := math.Sqrt(pooled * (1 - pooled) * (1/float64(n1) + 1/float64(n2)))
+	if se == 0 {
+		return 0
+	}
+	return (p2 - p1) / se
+}
+
+// MeanZ returns Welch's z-score for the target mean against the base mean.
+// Sample sizes in APM data are large enough that the normal approximation
+// holds.
+func MeanZ(base, target models.MetricSummary) float64 {
+	if base.Count < 2 || target.Count < 2 {
+		return 0
+	}
+	se := math.Sqrt(base.StdDev*base.StdDev/float64(base.Count) + target.StdDev*target.StdDev/float64(target.Count))
+	if se == 0 {
+		return 0
+	}
+	return (target.Mean - base.Mean) / se
+}
+
+// CompareReleases returns the per-metric deltas of target against base.
+// Percentile deltas reuse the mean test of their metric, which is an
+// approximation but keeps the comparison to a single pass over the data.
+func CompareReleases(base, target *models.ReleaseHealth) []models.MetricDelta {
+	sessionsZ := ProportionZ(
+		base.Sessions-base.CrashedSessions, base.Sessions,
+		target.Sessions-target.CrashedSessions, target.Sessions,
+	)
+	usersZ := ProportionZ(
+		base.Users-base.CrashedUsers, base.Users,
+		target.Users-target.CrashedUsers, target.Users,
+	)
+	fpsZ := MeanZ(base.FPS, target.FPS)
+	startupZ := MeanZ(base.StartupMs, target.StartupMs)
+	sceneLoadZ := MeanZ(base.SceneLoadMs, target.SceneLoadMs)
+
+	return []models.MetricDelta{
+		metricDelta("crash_free_sessions", base.CrashFreeSessionsPct, target.CrashFreeSessionsPct, sessionsZ, true),
+		metricDelta("crash_free_users", base.CrashFreeUsersPct, target.CrashFreeUsersPct, usersZ, true),
+		metricDelta("fps_p50", base.FPS.P50, target.FPS.P50, fpsZ, true),
+		metricDelta("fps_p95", base.FPS.P95, target.FPS.P95, fpsZ, true),
+		metricDelta("startup_p50", base.StartupMs.P50, target.StartupMs.P50, startupZ, false),
+		metricDelta("startup_p95", base.StartupMs.P95, target.StartupMs.P95, startupZ, false),
+		metricDelta("scene_load_p50", base.SceneLoadMs.P50, target.SceneLoadMs.P50, sceneLoadZ, false),
+		metricDelta("scene_load_p95", base.SceneLoadMs.P95, target.SceneLoadMs.P95, sceneLoadZ, false),
+	}
+}
+
+// metricDelta builds a delta; higherIsBetter decides which direction of a
+// significant change counts as a regression
+func metricDelta(metric string, base, target, z float64, higherIsBetter bool) models.MetricDelta {
+	d := models.MetricDelta{
+		Metric: metric,
+		Base:   base,
+		Target: target,
+		Delta:  target - base,
+		ZScore: z,
+	}
+	if base != 0 {
+		d.DeltaPct = d.Delta / base * 100
+	}
+	d.Significant = math.Abs(z) >= SignificanceZ
+	if d.Significant {
+		worse := d.Delta < 0
+		if !higherIsBetter {
+			worse = d.Delta > 0
+		}
+		d.Regression = worse
+	}
+	return d
+}
@@ -0,0 +1,137 @@
+package processor
+
+import (
+	"math"
+	"testing"
+
+	"github.com/warriorguo/ozx_apm/server/internal/models"
+)
+
+func TestProportionZ(t *testing.T) {
+	tests := []struct {
+		name           string
+		x1, n1, x2, n2 int64
+		wantSign       int
+		wantSignif     bool
+	}{
+		{"empty base", 0, 0, 90, 100, 0, false},
+		{"identical", 990, 1000, 990, 1000, 0, false},
+		{"small drop small sample", 99, 100, 98, 100, -1, false},
+		{"large drop large sample", 9950, 10000, 9800, 10000, -1, true},
+		{"large gain large sample", 9800, 10000, 9950, 10000, 1, true},
+		{"all crash free", 100, 100, 100, 100, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			z := ProportionZ(tt.x1, tt.n1, tt.x2, tt.n2)
+			if sign(z) != tt.wantSign {
+				t.Errorf("expected sign %d, got z=%f", tt.wantSign, z)
+			}
+			if (math.Abs(z) >= SignificanceZ) != tt.wantSignif {
+				t.Errorf("expected significant=%v, got z=%f", tt.wantSignif, z)
+			}
+		})
+	}
+}
+
+func TestMeanZ(t *testing.T) {
+	tests := []struct {
+		name       string
+		base       models.MetricSummary
+		target     models.MetricSummary
+		wantSign   int
+		wantSignif bool
+	}{
+		{"too few samples", models.MetricSummary{Count: 1, Mean: 60}, models.MetricSummary{Count: 1, Mean: 30}, 0, false},
+		{"zero variance", models.MetricSummary{Count: 10, Mean: 60}, models.MetricSummary{Count: 10, Mean: 60}, 0, false},
+		{"noisy small drop", models.MetricSummary{Count: 20, Mean: 58, StdDev: 10}, models.MetricSummary{Count: 20, Mean: 56, StdDev: 10}, -1, false},
+		{"clear drop", models.MetricSummary{Count: 5000, Mean: 58, StdDev: 8}, models.MetricSummary{Count: 5000, Mean: 55, StdDev: 8}, -1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			z := MeanZ(tt.base, tt.target)
+			if sign(z) != tt.wantSign {
+				t.Errorf("expected sign %d, got z=%f", tt.wantSign, z)
+			}
+			if (math.Abs(z) >= SignificanceZ) != tt.wantSignif {
+				t.Errorf("expected significant=%v, got z=%f", tt.wantSignif, z)
+			}
+		})
+	}
+}
+
+func TestCompareReleases(t *testing.T) {
+	base := &models.ReleaseHealth{
+		Version:              "1.0.0",
+		Sessions:             10000,
+		CrashedSessions:      50,
+		CrashFreeSessionsPct: 99.5,
+		Users:                4000,
+		CrashedUsers:         40,
+		CrashFreeUsersPct:    99,
+		FPS:                  models.MetricSummary{Count: 5000, Mean: 58, StdDev: 8, P50: 60, P95: 60},
+		StartupMs:            models.MetricSummary{Count: 3000, Mean: 2000, StdDev: 500, P50: 1900, P95: 3000},
+		SceneLoadMs:          models.MetricSummary{Count: 3000, Mean: 800, StdDev: 300, P50: 700, P95: 1400},
+	}
+	target := &models.ReleaseHealth{
+		Version:              "1.1.0",
+		Sessions:             10000,
+		CrashedSessions:      200,
+		CrashFreeSessionsPct: 98,
+		Users:                4000,
+		CrashedUsers:         40,
+		CrashFreeUsersPct:    99,
+		FPS:                  models.MetricSummary{Count: 5000, Mean: 58.1, StdDev: 8, P50: 60, P95: 60},
+		StartupMs:            models.MetricSummary{Count: 3000, Mean: 1700, StdDev: 500, P50: 1600, P95: 2600},
+		SceneLoadMs:          models.MetricSummary{Count: 3000, Mean: 900, StdDev: 300, P50: 800, P95: 1600},
+	}
+
+	deltas := CompareReleases(base, target)
+	byMetric := make(map[string]models.MetricDelta)
+	for _, d := range deltas {
+		byMetric[d.Metric] = d
+	}
+
+	tests := []struct {
+		metric         string
+		wantSignif     bool
+		wantRegression bool
+	}{
+		{"crash_free_sessions", true, true},
+		{"crash_free_users", false, false},
+		{"fps_p50", false, false},
+		{"startup_p50", true, false},
+		{"scene_load_p95", true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.metric, func(t *testing.T) {
+			d, ok := byMetric[tt.metric]
+			if !ok {
+				t.Fatalf("missing delta for %s", tt.metric)
+			}
+			if d.Significant != tt.wantSignif {
+				t.Errorf("expected significant=%v, got %v (z=%f)", tt.wantSignif, d.Significant, d.ZScore)
+			}
+			if d.Regression != tt.wantRegression {
+				t.Errorf("expected regression=%v, got %v", tt.wantRegression, d.Regression)
+			}
+		})
+	}
+
+	if d := byMetric["startup_p50"]; d.Delta != -300 {
+		t.Errorf("expected startup_p50 delta=-300, got %f", d.Delta)
+	}
+}
+
+func sign(v float64) int {
+	switch {
+	case v > 0:
+		return 1
+	case v < 0:
+		return -1
+	}
+	return 0
+}
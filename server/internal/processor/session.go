@@ -0,0 +1,150 @@
+package processor
+
+import (
+	"sort"
+	"time"
+
+	"github.com/warriorguo/ozx_apm/server/internal/models"
+)
+
+// SessionBuilder folds the events of a single ingest batch into one
+// apm_sessions fragment per session
+type SessionBuilder struct {
+	sessions map[string]*sessionState
+	order    []string
+}
+
+type sessionState struct {
+	session models.Session
+	scenes  []sceneVisit
+}
+
+type sceneVisit struct {
+	at    time.Time
+	scene string
+}
+
+// sessionContext is the subset of event fields that identifies a session
+type sessionContext struct {
+	AppID       string
+	SessionID   string
+	DeviceID    string
+	AppVersion  string
+	Platform    string
+	DeviceModel string
+	OSVersion   string
+}
+
+func NewSessionBuilder() *SessionBuilder {
+	return &SessionBuilder{
+		sessions: make(map[string]*sessionState),
+	}
+}
+
+func (b *SessionBuilder) observe(c sessionContext, ts time.Time, scene string) *models.Session {
+	st, ok := b.sessions[c.SessionID]
+	if !ok {
+		st = &sessionState{
+			session: models.Session{
+				AppID:       c.AppID,
+				SessionID:   c.SessionID,
+				DeviceID:    c.DeviceID,
+				AppVersion:  c.AppVersion,
+				Platform:    c.Platform,
+				DeviceModel: c.DeviceModel,
+				OSVersion:   c.OSVersion,
+				StartTime:   ts,
+				EndTime:     ts,
+			},
+		}
+		b.sessions[c.SessionID] = st
+		b.order = append(b.order, c.SessionID)
+	}
+
+	s := &st.session
+	if ts.Before(s.StartTime) {
+		s.StartTime = ts
+	}
+	if ts.After(s.EndTime) {
+		s.EndTime = ts
+	}
+	if scene != "" {
+		st.scenes = append(st.scenes, sceneVisit{at: ts, scene: scene})
+	}
+	s.EventCount++
+	return s
+}
+
+// AddPerfSample records a performance sample
+func (b *SessionBuilder) AddPerfSample(e *models.PerfSample) {
+	b.observe(sessionContext{e.AppID, e.SessionID, e.DeviceID, e.AppVersion, e.Platform, e.DeviceModel, e.OSVersion}, e.Timestamp, e.Scene)
+}
+
+// AddJank records a jank event
+func (b *SessionBuilder) AddJank(e *models.Jank) {
+	s := b.observe(sessionContext{e.AppID, e.SessionID, e.DeviceID, e.AppVersion, e.Platform, e.DeviceModel, e.OSVersion}, e.Timestamp, e.Scene)
+	s.JankCount++
+}
+
+// AddStartup records a startup event
+func (b *SessionBuilder) AddStartup(e *models.Startup) {
+	b.observe(sessionContext{e.AppID, e.SessionID, e.DeviceID, e.AppVersion, e.Platform, e.DeviceModel, e.OSVersion}, e.Timestamp, "")
+}
+
+// AddSceneLoad records a scene load event
+func (b *SessionBuilder) AddSceneLoad(e *models.SceneLoad) {
+	b.observe(sessionContext{e.AppID, e.SessionID, e.DeviceID, e.AppVersion, e.Platform, e.DeviceModel, ""}, e.Timestamp, e.SceneName)
+}
+
+// AddException records a non-fatal exception
+func (b *SessionBuilder) AddException(e *models.Exception) {
+	s := b.observe(sessionContext{e.AppID, e.SessionID, e.DeviceID, e.AppVersion, e.Platform, e.DeviceModel, e.OSVersion}, e.Timestamp, e.Scene)
+	count := e.Count
+	if count == 0 {
+		count = 1
+	}
+	s.ExceptionCount += count
+}
+
+// AddCrash records a crash; a crash always ends its session
+func (b *SessionBuilder) AddCrash(e *models.Crash) {
+	s := b.observe(sessionContext{e.AppID, e.SessionID, e.DeviceID, e.AppVersion, e.Platform, e.DeviceModel, e.OSVersion}, e.Timestamp, e.Scene)
+	s.CrashCount++
+	s.EndedByCrash = true
+}
+
+// AddSessionEvent records an explicit session_start or session_end event
+func (b *SessionBuilder) AddSessionEvent(e *models.SessionEvent) {
+	s := b.observe(sessionContext{e.AppID, e.SessionID, e.DeviceID, e.AppVersion, e.Platform, e.DeviceModel, e.OSVersion}, e.Timestamp, e.Scene)
+	if e.UserID != "" {
+		s.UserID = e.UserID
+	}
+}
+
+// Sessions returns the fragments in the order their sessions were first seen
+func (b *SessionBuilder) Sessions() []models.Session {
+	sessions := make([]models.Session, 0, len(b.order))
+	for _, id := range b.order {
+		st := b.sessions[id]
+		s := st.session
+		s.Scenes = scenePath(st.scenes)
+		sessions = append(sessions, s)
+	}
+	return sessions
+}
+
+// scenePath orders scene visits by time and collapses consecutive repeats
+func scenePath(visits []sceneVisit) []string {
+	sort.SliceStable(visits, func(i, j int) bool {
+		return visits[i].at.Before(visits[j].at)
+	})
+
+	path := []string{}
+	for _, v := range visits {
+		if len(path) > 0 && path[len(path)-1] == v.scene {
+			continue
+		}
+		path = append(path, v.scene)
+	}
+	return path
+}
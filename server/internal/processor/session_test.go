@@ -0,0 +1,125 @@
+package processor
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/warriorguo/ozx_apm/server/internal/models"
+)
+
+func TestSessionBuilder_Empty(t *testing.T) {
+	b := NewSessionBuilder()
+
+	sessions := b.Sessions()
+	if len(sessions) != 0 {
+		t.Errorf("expected no sessions, got %d", len(sessions))
+	}
+}
+
+func TestSessionBuilder_FoldsEvents(t *testing.T) {
+	b := NewSessionBuilder()
+	base := time.Now().Add(-time.Hour)
+
+	b.AddSessionEvent(&models.SessionEvent{
+		Timestamp:  base,
+		AppVersion: "1.0.0",
+		Platform:   "Android",
+		SessionID:  "s1",
+		DeviceID:   "d1",
+		UserID:     "u1",
+	})
+	b.AddPerfSample(&models.PerfSample{Timestamp: base.Add(time.Minute), AppVersion: "1.0.0", Platform: "Android", SessionID: "s1", DeviceID: "d1", Scene: "MainMenu"})
+	b.AddSceneLoad(&models.SceneLoad{Timestamp: base.Add(2 * time.Minute), AppVersion: "1.0.0", Platform: "Android", SessionID: "s1", DeviceID: "d1", SceneName: "Level1"})
+	b.AddJank(&models.Jank{Timestamp: base.Add(3 * time.Minute), AppVersion: "1.0.0", Platform: "Android", SessionID: "s1", DeviceID: "d1", Scene: "Level1"})
+	b.AddException(&models.Exception{Timestamp: base.Add(4 * time.Minute), AppVersion: "1.0.0", Platform: "Android", SessionID: "s1", DeviceID: "d1", Scene: "Level1", Count: 3})
+	b.AddException(&models.Exception{Timestamp: base.Add(4 * time.Minute), AppVersion: "1.0.0", Platform: "Android", SessionID: "s1", DeviceID: "d1", Scene: "Level1"})
+	b.AddCrash(&models.Crash{Timestamp: base.Add(5 * time.Minute), AppVersion: "1.0.0", Platform: "Android", SessionID: "s1", DeviceID: "d1", Scene: "Level1"})
+
+	sessions := b.Sessions()
+	if len(sessions) != 1 {
+		t.Fatalf("expected 1 session, got %d", len(sessions))
+	}
+
+	s := sessions[0]
+	if s.SessionID != "s1" || s.DeviceID != "d1" || s.UserID != "u1" {
+		t.Errorf("unexpected identity: %+v", s)
+	}
+	if !s.StartTime.Equal(base) {
+		t.Errorf("expected start %v, got %v", base, s.StartTime)
+	}
+	if !s.EndTime.Equal(base.Add(5 * time.Minute)) {
+		t.Errorf("expected end %v, got %v", base.Add(5*time.Minute), s.EndTime)
+	}
+	if s.EventCount != 7 {
+		t.Errorf("expected 7 events, got %d", s.EventCount)
+	}
+	if s.JankCount != 1 {
+		t.Errorf("expected 1 jank, got %d", s.JankCount)
+	}
+	if s.ExceptionCount != 4 {
+		t.Errorf("expected 4 exceptions, got %d", s.ExceptionCount)
+	}
+	if s.CrashCount != 1 || !s.EndedByCrash {
+		t.Errorf("expected session ended by crash, got crash_count=%d ended_by_crash=%v", s.CrashCount, s.EndedByCrash)
+	}
+
+	wantPath := []string{"MainMenu", "Level1"}
+	if !reflect.DeepEqual(s.Scenes, wantPath) {
+		t.Errorf("expected scene path %v, got %v", wantPath, s.Scenes)
+	}
+}
+
+func TestSessionBuilder_MultipleSessions(t *testing.T) {
+	b := NewSessionBuilder()
+	now := time.Now()
+
+	b.AddPerfSample(&models.PerfSample{Timestamp: now, SessionID: "s2", DeviceID: "d2"})
+	b.AddPerfSample(&models.PerfSample{Timestamp: now, SessionID: "s1", DeviceID: "d1"})
+	b.AddPerfSample(&models.PerfSample{Timestamp: now, SessionID: "s2", DeviceID: "d2"})
+
+	sessions := b.Sessions()
+	if len(sessions) != 2 {
+		t.Fatalf("expected 2 sessions, got %d", len(sessions))
+	}
+	if sessions[0].SessionID != "s2" || sessions[1].SessionID != "s1" {
+		t.Errorf("expected sessions in first-seen order, got %s, %s", sessions[0].SessionID, sessions[1].SessionID)
+	}
+	if sessions[0].EventCount != 2 {
+		t.Errorf("expected 2 events for s2, got %d", sessions[0].EventCount)
+	}
+	if sessions[0].EndedByCrash {
+		t.Error("expected s2 not to be ended by crash")
+	}
+}
+
+func TestScenePath_OrdersAndCollapses(t *testing.T) {
+	now := time.Now()
+	visits := []sceneVisit{
+		{at: now.Add(3 * time.Second), scene: "B"},
+		{at: now, scene: "A"},
+		{at: now.Add(time.Second), scene: "A"},
+		{at: now.Add(4 * time.Second), scene: "A"},
+	}
+
+	got := scenePath(visits)
+	want := []string{"A", "B", "A"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestSessionBuilder_CarriesAppID(t *testing.T) {
+	b := NewSessionBuilder()
+	now := time.Now()
+
+	b.AddPerfSample(&models.PerfSample{AppID: "game-a", Timestamp: now, SessionID: "s1", DeviceID: "d1"})
+
+	sessions := b.Sessions()
+	if len(sessions) != 1 {
+		t.Fatalf("expected 1 session, got %d", len(sessions))
+	}
+	if sessions[0].AppID != "game-a" {
+		t.Errorf("expected app_id=game-a, got %q", sessions[0].AppID)
+	}
+}
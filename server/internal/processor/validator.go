@@ -155,6 +155,26 @@ func (v *Validator) ValidateCrash(c *models.Crash) error {
 	return nil
 }
 
+// ValidateSessionEvent validates a session_start or session_end event
+func (v *Validator) ValidateSessionEvent(e *models.SessionEvent) error {
+	if err := v.validateTimestamp(e.Timestamp); err != nil {
+		return err
+	}
+	if e.AppVersion == "" {
+		return ErrMissingAppVersion
+	}
+	if e.Platform == "" {
+		return ErrMissingPlatform
+	}
+	if e.DeviceID == "" {
+		return ErrMissingDeviceID
+	}
+	if e.SessionID == "" {
+		return ErrMissingSessionID
+	}
+	return nil
+}
+
 func (v *Validator) validateTimestamp(t time.Time) error {
 	if t.IsZero() {
 		return ErrInvalidTimestamp
@@ -332,6 +332,48 @@ func TestValidator_ValidateCrash(t *testing.T) {
 	}
 }
 
+func TestValidator_ValidateSessionEvent(t *testing.T) {
+	v := NewValidator()
+
+	tests := []struct {
+		name    string
+		event   *models.SessionEvent
+		wantErr bool
+	}{
+		{
+			name: "valid session start",
+			event: &models.SessionEvent{
+				Timestamp:  time.Now(),
+				AppVersion: "1.0.0",
+				Platform:   "Android",
+				DeviceID:   "device123",
+				SessionID:  "session123",
+				UserID:     "user123",
+			},
+			wantErr: false,
+		},
+		{
+			name: "missing session id",
+			event: &models.SessionEvent{
+				Timestamp:  time.Now(),
+				AppVersion: "1.0.0",
+				Platform:   "Android",
+				DeviceID:   "device123",
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := v.ValidateSessionEvent(tt.event)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateSessionEvent() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func TestNewValidator(t *testing.T) {
 	v := NewValidator()
 	if v == nil {
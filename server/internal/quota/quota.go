@@ -0,0 +1,242 @@
+package quota
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/warriorguo/ozx_apm/server/internal/config"
+	"github.com/warriorguo/ozx_apm/server/internal/models"
+)
+
+// Reasons a request is throttled
+const (
+	ReasonAppRate    = "app_rate"
+	ReasonDeviceRate = "device_rate"
+	ReasonDailyQuota = "daily_quota"
+)
+
+// pruneThreshold is how many idle buckets may pile up before they are swept
+const pruneThreshold = 10000
+
+// Limits enforces per-app and per-device request rates and per-app daily
+// event caps, and counts what it throttles. State is in memory, so each
+// server instance enforces its own share.
+type Limits struct {
+	app    *buckets
+	device *buckets
+
+	dailyDefault int64
+	dailyByApp   map[string]int64
+
+	mu        sync.Mutex
+	day       string
+	events    map[string]int64
+	throttled map[string]map[string]int64 // app ID -> reason -> requests
+
+	// now is replaced in tests
+	now func() time.Time
+}
+
+func New(cfg config.RateLimitConfig) *Limits {
+	// Config map keys arrive lower-cased, so app IDs are compared that way
+	dailyByApp := make(map[string]int64, len(cfg.AppDailyEvents))
+	for appID, limit := range cfg.AppDailyEvents {
+		dailyByApp[strings.ToLower(appID)] = limit
+	}
+
+	return &Limits{
+		app:          newBuckets(cfg.AppRate, cfg.AppBurst),
+		device:       newBuckets(cfg.DeviceRate, cfg.DeviceBurst),
+		dailyDefault: cfg.DailyEvents,
+		dailyByApp:   dailyByApp,
+		events:       make(map[string]int64),
+		throttled:    make(map[string]map[string]int64),
+		now:          time.Now,
+	}
+}
+
+// AllowRequest takes a token from the app's bucket and checks the app's daily
+// event cap. If the request must be throttled it returns the reason and how
+// long the client should wait.
+func (l *Limits) AllowRequest(appID string) (string, time.Duration) {
+	now := l.now()
+
+	if wait := l.dailyWait(appID, now); wait > 0 {
+		l.recordThrottled(appID, ReasonDailyQuota)
+		return ReasonDailyQuota, wait
+	}
+	if ok, wait := l.app.take(appID, now); !ok {
+		l.recordThrottled(appID, ReasonAppRate)
+		return ReasonAppRate, wait
+	}
+	return "", 0
+}
+
+// AllowDevice takes a token from the bucket of a device of the app, like
+// AllowRequest. Requests are charged to the devices their events came from
+// once they have been decoded.
+func (l *Limits) AllowDevice(appID, deviceID string) (string, time.Duration) {
+	if ok, wait := l.device.take(appID+"/"+deviceID, l.now()); !ok {
+		l.recordThrottled(appID, ReasonDeviceRate)
+		return ReasonDeviceRate, wait
+	}
+	return "", 0
+}
+
+// AddEvents counts accepted events against the app's daily cap
+func (l *Limits) AddEvents(appID string, n int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rollDay(l.now())
+	l.events[appID] += int64(n)
+}
+
+// Usage returns today's event counts and throttled requests per app
+func (l *Limits) Usage() []models.QuotaUsage {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rollDay(l.now())
+
+	apps := make(map[string]bool)
+	for appID := range l.events {
+		apps[appID] = true
+	}
+	for appID := range l.throttled {
+		apps[appID] = true
+	}
+
+	usage := make([]models.QuotaUsage, 0, len(apps))
+	for appID := range apps {
+		throttled := make(map[string]int64, len(l.throttled[appID]))
+		for reason, n := range l.throttled[appID] {
+			throttled[reason] = n
+		}
+		usage = append(usage, models.QuotaUsage{
+			AppID:       appID,
+			Day:         l.day,
+			EventsToday: l.events[appID],
+			DailyQuota:  l.dailyLimit(appID),
+			Throttled:   throttled,
+		})
+	}
+	sort.Slice(usage, func(i, j int) bool { return usage[i].AppID < usage[j].AppID })
+	return usage
+}
+
+// dailyWait returns how long until the app may send events again, or 0 if it
+// is under its cap
+func (l *Limits) dailyWait(appID string, now time.Time) time.Duration {
+	limit := l.dailyLimit(appID)
+	if limit <= 0 {
+		return 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rollDay(now)
+	if l.events[appID] < limit {
+		return 0
+	}
+
+	utc := now.UTC()
+	midnight := time.Date(utc.Year(), utc.Month(), utc.Day()+1, 0, 0, 0, 0, time.UTC)
+	return midnight.Sub(utc)
+}
+
+func (l *Limits) dailyLimit(appID string) int64 {
+	if limit, ok := l.dailyByApp[strings.ToLower(appID)]; ok {
+		return limit
+	}
+	return l.dailyDefault
+}
+
+func (l *Limits) recordThrottled(appID, reason string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rollDay(l.now())
+	if l.throttled[appID] == nil {
+		l.throttled[appID] = make(map[string]int64)
+	}
+	l.throttled[appID][reason]++
+}
+
+// rollDay resets the daily counters at UTC midnight. Callers hold mu.
+func (l *Limits) rollDay(now time.Time) {
+	day := now.UTC().Format("2006-01-02")
+	if day != l.day {
+		l.day = day
+		l.events = make(map[string]int64)
+		l.throttled = make(map[string]map[string]int64)
+	}
+}
+
+// buckets is a set of token buckets sharing one rate and burst
+type buckets struct {
+	rate  float64 // tokens per second; 0 disables limiting
+	burst float64
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastPrune time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newBuckets(rate float64, burst int) *buckets {
+	if burst < 1 {
+		burst = 1
+	}
+	return &buckets{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// take removes a token from key's bucket. If the bucket is empty it returns
+// how long until a token is available.
+func (b *buckets) take(key string, now time.Time) (bool, time.Duration) {
+	if b.rate <= 0 {
+		return true, 0
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.buckets) > pruneThreshold && now.Sub(b.lastPrune) > time.Minute {
+		b.prune(now)
+	}
+
+	bk, ok := b.buckets[key]
+	if !ok {
+		bk = &bucket{tokens: b.burst, last: now}
+		b.buckets[key] = bk
+	}
+
+	bk.tokens = math.Min(b.burst, bk.tokens+now.Sub(bk.last).Seconds()*b.rate)
+	bk.last = now
+
+	if bk.tokens < 1 {
+		wait := time.Duration((1 - bk.tokens) / b.rate * float64(time.Second))
+		return false, wait
+	}
+	bk.tokens--
+	return true, 0
+}
+
+// prune drops buckets that have refilled completely, since a new bucket
+// starts full anyway. Callers hold mu.
+func (b *buckets) prune(now time.Time) {
+	for key, bk := range b.buckets {
+		if bk.tokens+now.Sub(bk.last).Seconds()*b.rate >= b.burst {
+			delete(b.buckets, key)
+		}
+	}
+	b.lastPrune = now
+}
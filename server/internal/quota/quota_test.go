@@ -0,0 +1,141 @@
+package quota
+
+import (
+	"testing"
+	"time"
+
+	"github.com/warriorguo/ozx_apm/server/internal/config"
+)
+
+func newTestLimits(cfg config.RateLimitConfig) (*Limits, *time.Time) {
+	now := time.Date(2024, 1, 15, 23, 59, 0, 0, time.UTC)
+	l := New(cfg)
+	l.now = func() time.Time { return now }
+	return l, &now
+}
+
+func TestLimits_AppRate(t *testing.T) {
+	l, now := newTestLimits(config.RateLimitConfig{AppRate: 1, AppBurst: 2})
+
+	for i := 0; i < 2; i++ {
+		if reason, _ := l.AllowRequest("game-a"); reason != "" {
+			t.Fatalf("request %d: expected burst to be allowed, got %s", i, reason)
+		}
+	}
+
+	reason, wait := l.AllowRequest("game-a")
+	if reason != ReasonAppRate {
+		t.Fatalf("expected %s, got %q", ReasonAppRate, reason)
+	}
+	if wait <= 0 || wait > time.Second {
+		t.Errorf("expected wait within a second, got %v", wait)
+	}
+
+	if reason, _ := l.AllowRequest("game-b"); reason != "" {
+		t.Errorf("expected other apps to have their own bucket, got %s", reason)
+	}
+
+	*now = now.Add(time.Second)
+	if reason, _ := l.AllowRequest("game-a"); reason != "" {
+		t.Errorf("expected bucket to refill, got %s", reason)
+	}
+}
+
+func TestLimits_DeviceRate(t *testing.T) {
+	l, _ := newTestLimits(config.RateLimitConfig{DeviceRate: 0.1, DeviceBurst: 1})
+
+	if reason, _ := l.AllowDevice("game-a", "d1"); reason != "" {
+		t.Fatalf("expected first request to pass, got %s", reason)
+	}
+	reason, wait := l.AllowDevice("game-a", "d1")
+	if reason != ReasonDeviceRate {
+		t.Fatalf("expected %s, got %q", ReasonDeviceRate, reason)
+	}
+	if wait != 10*time.Second {
+		t.Errorf("expected 10s wait, got %v", wait)
+	}
+
+	if reason, _ := l.AllowDevice("game-a", "d2"); reason != "" {
+		t.Errorf("expected other devices to pass, got %s", reason)
+	}
+	if reason, _ := l.AllowDevice("game-b", "d1"); reason != "" {
+		t.Errorf("expected the same device ID of another app to pass, got %s", reason)
+	}
+	if reason, _ := l.AllowRequest("game-a"); reason != "" {
+		t.Errorf("expected the app limit to ignore device limits, got %s", reason)
+	}
+}
+
+func TestLimits_DailyQuota(t *testing.T) {
+	l, now := newTestLimits(config.RateLimitConfig{
+		DailyEvents:    100,
+		AppDailyEvents: map[string]int64{"big-game": 1000},
+	})
+
+	l.AddEvents("game-a", 100)
+	reason, wait := l.AllowRequest("game-a")
+	if reason != ReasonDailyQuota {
+		t.Fatalf("expected %s, got %q", ReasonDailyQuota, reason)
+	}
+	if wait != time.Minute {
+		t.Errorf("expected to wait until UTC midnight, got %v", wait)
+	}
+
+	l.AddEvents("Big-Game", 100)
+	if reason, _ := l.AllowRequest("Big-Game"); reason != "" {
+		t.Errorf("expected per-app override to apply, got %s", reason)
+	}
+
+	*now = now.Add(2 * time.Minute)
+	if reason, _ := l.AllowRequest("game-a"); reason != "" {
+		t.Errorf("expected quota to reset at midnight, got %s", reason)
+	}
+}
+
+func TestLimits_Usage(t *testing.T) {
+	l, _ := newTestLimits(config.RateLimitConfig{AppRate: 1, AppBurst: 1, DailyEvents: 500})
+
+	l.AllowRequest("game-a")
+	l.AddEvents("game-a", 20)
+	l.AllowRequest("game-a")
+	l.AllowRequest("game-a")
+
+	usage := l.Usage()
+	if len(usage) != 1 {
+		t.Fatalf("expected 1 app, got %d", len(usage))
+	}
+	u := usage[0]
+	if u.AppID != "game-a" || u.Day != "2024-01-15" || u.EventsToday != 20 || u.DailyQuota != 500 {
+		t.Errorf("unexpected usage %+v", u)
+	}
+	if u.Throttled[ReasonAppRate] != 2 {
+		t.Errorf("expected 2 throttled requests, got %d", u.Throttled[ReasonAppRate])
+	}
+}
+
+func TestLimits_Unlimited(t *testing.T) {
+	l, _ := newTestLimits(config.RateLimitConfig{})
+
+	l.AddEvents("game-a", 1_000_000)
+	for i := 0; i < 1000; i++ {
+		if reason, _ := l.AllowRequest("game-a"); reason != "" {
+			t.Fatalf("expected zero limits to mean unlimited, got %s", reason)
+		}
+		if reason, _ := l.AllowDevice("game-a", "d1"); reason != "" {
+			t.Fatalf("expected zero limits to mean unlimited, got %s", reason)
+		}
+	}
+}
+
+func TestBuckets_Prune(t *testing.T) {
+	b := newBuckets(1, 1)
+	now := time.Now()
+
+	b.take("a", now)
+	b.take("b", now)
+	b.prune(now.Add(2 * time.Second))
+
+	if len(b.buckets) != 0 {
+		t.Errorf("expected refilled buckets to be pruned, %d left", len(b.buckets))
+	}
+}
@@ -0,0 +1,231 @@
+package remoteconfig
+
+import (
+	"context"
+	"hash/fnv"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/warriorguo/ozx_apm/server/internal/models"
+)
+
+// CacheTTL is how long rules are cached, and so how long a change takes to
+// reach ingest sampling and SDKs
+const CacheTTL = time.Minute
+
+// Source loads the remote config rules of all apps
+type Source interface {
+	ListRemoteConfigs(ctx context.Context, appID string) ([]models.RemoteConfig, error)
+}
+
+// Store resolves remote config for the SDK and for ingest sampling. Rules are
+// cached in memory and reloaded once the cache is older than ttl.
+type Store struct {
+	source Source
+	ttl    time.Duration
+	logger *zap.Logger
+
+	mu       sync.RWMutex
+	rules    map[string][]models.RemoteConfig // app ID -> rules
+	loadedAt time.Time
+
+	// Observed perf samples per rule, for MaxPerfSamplesPerMin
+	rateMu  sync.Mutex
+	windows map[string]*rateWindow
+
+	// now is replaced in tests
+	now func() time.Time
+}
+
+// New creates a Store. source may be nil, in which case every app gets the
+// default configuration.
+func New(source Source, ttl time.Duration, logger *zap.Logger) *Store {
+	return &Store{
+		source:  source,
+		ttl:     ttl,
+		logger:  logger,
+		rules:   make(map[string][]models.RemoteConfig),
+		windows: make(map[string]*rateWindow),
+		now:     time.Now,
+	}
+}
+
+// Resolve returns the configuration for an app version on a platform
+func (s *Store) Resolve(ctx context.Context, appID, appVersion, platform string) models.RemoteConfig {
+	if s.source != nil {
+		s.refresh(ctx)
+	}
+
+	s.mu.RLock()
+	rules := s.rules[appID]
+	s.mu.RUnlock()
+
+	return Resolve(rules, appID, appVersion, platform)
+}
+
+// Invalidate forces the next Resolve to reload rules from the source
+func (s *Store) Invalidate() {
+	s.mu.Lock()
+	s.loadedAt = time.Time{}
+	s.mu.Unlock()
+}
+
+// SamplePerf decides whether a perf sample is stored. Kept samples get a
+// weight of 1 / the effective sample rate so weighted aggregates stay
+// unbiased. The decision is a hash of the sample's session and timestamp, so
+// a retried batch keeps the same samples.
+func (s *Store) SamplePerf(ctx context.Context, sample *models.PerfSample) bool {
+	cfg := s.Resolve(ctx, sample.AppID, sample.AppVersion, sample.Platform)
+
+	rate := cfg.PerfSampleRate
+	if cfg.MaxPerfSamplesPerMin > 0 {
+		observed := s.observe(ruleKey(cfg), s.now())
+		if observed > cfg.MaxPerfSamplesPerMin {
+			rate = math.Min(rate, float64(cfg.MaxPerfSamplesPerMin)/float64(observed))
+		}
+	}
+
+	if rate >= 1 {
+		sample.SampleWeight = 1
+		return true
+	}
+	if !Keep(sample.SessionID+"/"+strconv.FormatInt(sample.Timestamp.UnixMilli(), 10), rate) {
+		return false
+	}
+	sample.SampleWeight = float32(1 / rate)
+	return true
+}
+
+// refresh reloads the rules if the cache is stale. A failed reload keeps
+// serving the previous rules.
+func (s *Store) refresh(ctx context.Context) {
+	s.mu.RLock()
+	fresh := !s.loadedAt.IsZero() && s.now().Sub(s.loadedAt) < s.ttl
+	s.mu.RUnlock()
+	if fresh {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Another request may have reloaded while we waited for the lock
+	if !s.loadedAt.IsZero() && s.now().Sub(s.loadedAt) < s.ttl {
+		return
+	}
+
+	configs, err := s.source.ListRemoteConfigs(ctx, "")
+	if err != nil {
+		s.logger.Error("failed to load remote configs", zap.Error(err))
+		return
+	}
+
+	s.rules = make(map[string][]models.RemoteConfig)
+	for _, c := range configs {
+		s.rules[c.AppID] = append(s.rules[c.AppID], c)
+	}
+	s.loadedAt = s.now()
+}
+
+// observe counts a sample against a rule and returns the larger of this
+// minute's and last minute's counts
+func (s *Store) observe(key string, now time.Time) int64 {
+	s.rateMu.Lock()
+	defer s.rateMu.Unlock()
+
+	w, ok := s.windows[key]
+	if !ok {
+		w = &rateWindow{}
+		s.windows[key] = w
+	}
+	return w.add(now)
+}
+
+// Resolve picks the most specific rule matching a version and platform: an
+// exact version and platform beats an exact version, which beats an exact
+// platform, which beats the app-wide rule. Without a match the default
+// configuration applies.
+func Resolve(rules []models.RemoteConfig, appID, appVersion, platform string) models.RemoteConfig {
+	best, bestScore := -1, -1
+	for i, r := range rules {
+		if r.AppVersion != "" && r.AppVersion != appVersion {
+			continue
+		}
+		if r.Platform != "" && r.Platform != platform {
+			continue
+		}
+
+		score := 0
+		if r.AppVersion != "" {
+			score += 2
+		}
+		if r.Platform != "" {
+			score++
+		}
+		if score > bestScore {
+			best, bestScore = i, score
+		}
+	}
+
+	if best < 0 {
+		return models.DefaultRemoteConfig(appID)
+	}
+	return rules[best]
+}
+
+// Keep deterministically keeps a fraction rate of keys
+func Keep(key string, rate float64) bool {
+	if rate >= 1 {
+		return true
+	}
+	if rate <= 0 {
+		return false
+	}
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return float64(mix(h.Sum64()))/float64(math.MaxUint64) < rate
+}
+
+// mix spreads FNV's output over the whole range; keys differing only in
+// their last characters otherwise cluster (splitmix64 finalizer)
+func mix(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+func ruleKey(cfg models.RemoteConfig) string {
+	return cfg.AppID + "\x00" + cfg.AppVersion + "\x00" + cfg.Platform
+}
+
+// rateWindow counts events in the current and previous minute
+type rateWindow struct {
+	minute   int64
+	current  int64
+	previous int64
+}
+
+func (w *rateWindow) add(now time.Time) int64 {
+	minute := now.Unix() / 60
+	switch {
+	case minute == w.minute:
+	case minute == w.minute+1:
+		w.previous, w.current = w.current, 0
+	default:
+		w.previous, w.current = 0, 0
+	}
+	w.minute = minute
+	w.current++
+
+	if w.previous > w.current {
+		return w.previous
+	}
+	return w.current
+}
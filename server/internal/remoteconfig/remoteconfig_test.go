@@ -0,0 +1,170 @@
+package remoteconfig
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/warriorguo/ozx_apm/server/internal/models"
+)
+
+type fakeSource struct {
+	configs []models.RemoteConfig
+	err     error
+	calls   int
+}
+
+func (f *fakeSource) ListRemoteConfigs(ctx context.Context, appID string) ([]models.RemoteConfig, error) {
+	f.calls++
+	return f.configs, f.err
+}
+
+func newTestStore(source Source) (*Store, *time.Time) {
+	now := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	s := New(source, time.Minute, zap.NewNop())
+	s.now = func() time.Time { return now }
+	return s, &now
+}
+
+func rule(appVersion, platform string, rate float64) models.RemoteConfig {
+	cfg := models.DefaultRemoteConfig("game-a")
+	cfg.AppVersion = appVersion
+	cfg.Platform = platform
+	cfg.PerfSampleRate = rate
+	return cfg
+}
+
+func TestResolve_Specificity(t *testing.T) {
+	rules := []models.RemoteConfig{
+		rule("", "", 0.9),
+		rule("", "Android", 0.8),
+		rule("1.0.0", "", 0.7),
+		rule("1.0.0", "Android", 0.6),
+	}
+
+	tests := []struct {
+		name       string
+		appVersion string
+		platform   string
+		want       float64
+	}{
+		{"version and platform", "1.0.0", "Android", 0.6},
+		{"version only", "1.0.0", "iOS", 0.7},
+		{"platform only", "2.0.0", "Android", 0.8},
+		{"app-wide", "2.0.0", "iOS", 0.9},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Resolve(rules, "game-a", tt.appVersion, tt.platform)
+			if got.PerfSampleRate != tt.want {
+				t.Errorf("expected rate %v, got %v", tt.want, got.PerfSampleRate)
+			}
+		})
+	}
+}
+
+func TestResolve_Default(t *testing.T) {
+	got := Resolve([]models.RemoteConfig{rule("1.0.0", "", 0.5)}, "game-a", "2.0.0", "iOS")
+	if !got.Enabled || got.PerfSampleRate != 1 || got.AppID != "game-a" {
+		t.Errorf("expected default config, got %+v", got)
+	}
+}
+
+func TestKeep_Fraction(t *testing.T) {
+	const n = 20000
+	kept := 0
+	for i := 0; i < n; i++ {
+		if Keep(fmt.Sprintf("session-%d", i), 0.25) {
+			kept++
+		}
+	}
+	if frac := float64(kept) / n; math.Abs(frac-0.25) > 0.02 {
+		t.Errorf("expected about 25%% kept, got %.3f", frac)
+	}
+
+	if !Keep("any", 1) || Keep("any", 0) {
+		t.Error("expected rate 1 to keep and rate 0 to drop")
+	}
+	if Keep("same", 0.5) != Keep("same", 0.5) {
+		t.Error("expected deterministic decisions")
+	}
+}
+
+func TestStore_SamplePerfWeight(t *testing.T) {
+	s, _ := newTestStore(&fakeSource{configs: []models.RemoteConfig{rule("", "", 0.5)}})
+
+	kept := 0
+	for i := 0; i < 1000; i++ {
+		sample := &models.PerfSample{
+			AppID:     "game-a",
+			SessionID: fmt.Sprintf("session-%d", i),
+			Timestamp: time.UnixMilli(int64(i)),
+		}
+		if s.SamplePerf(context.Background(), sample) {
+			kept++
+			if sample.SampleWeight != 2 {
+				t.Fatalf("expected weight 2, got %v", sample.SampleWeight)
+			}
+		}
+	}
+	if kept == 0 || kept == 1000 {
+		t.Errorf("expected some samples dropped, kept %d", kept)
+	}
+}
+
+func TestStore_SamplePerfCap(t *testing.T) {
+	capped := rule("", "", 1)
+	capped.MaxPerfSamplesPerMin = 100
+	s, _ := newTestStore(&fakeSource{configs: []models.RemoteConfig{capped}})
+
+	kept := 0
+	for i := 0; i < 1000; i++ {
+		sample := &models.PerfSample{
+			AppID:     "game-a",
+			SessionID: fmt.Sprintf("session-%d", i),
+			Timestamp: time.UnixMilli(int64(i)),
+		}
+		if s.SamplePerf(context.Background(), sample) {
+			kept++
+		}
+	}
+	// The rate falls as traffic grows, so the first 100 are all kept and the
+	// rest only thinly
+	if kept < 100 || kept > 500 {
+		t.Errorf("expected the cap to thin samples, kept %d", kept)
+	}
+}
+
+func TestStore_RefreshKeepsRulesOnError(t *testing.T) {
+	source := &fakeSource{configs: []models.RemoteConfig{rule("", "", 0.5)}}
+	s, now := newTestStore(source)
+
+	if got := s.Resolve(context.Background(), "game-a", "", ""); got.PerfSampleRate != 0.5 {
+		t.Fatalf("expected rate 0.5, got %v", got.PerfSampleRate)
+	}
+
+	// Cached within the TTL
+	s.Resolve(context.Background(), "game-a", "", "")
+	if source.calls != 1 {
+		t.Errorf("expected 1 load, got %d", source.calls)
+	}
+
+	*now = now.Add(2 * time.Minute)
+	source.err = errors.New("clickhouse down")
+	if got := s.Resolve(context.Background(), "game-a", "", ""); got.PerfSampleRate != 0.5 {
+		t.Errorf("expected cached rate 0.5 after failed reload, got %v", got.PerfSampleRate)
+	}
+
+	source.err = nil
+	source.configs = nil
+	s.Invalidate()
+	if got := s.Resolve(context.Background(), "game-a", "", ""); got.PerfSampleRate != 1 {
+		t.Errorf("expected default rate after invalidate, got %v", got.PerfSampleRate)
+	}
+}
@@ -52,7 +52,7 @@ func NewClickHouseClient(cfg *config.ClickHouseConfig, logger *zap.Logger) (*Cli
 				zap.String("database", cfg.Database),
 			)
 			return &ClickHouseClient{
-				conn:   conn,
+				conn:   tracedConn{conn},
 				logger: logger,
 			}, nil
 		}
@@ -74,6 +74,11 @@ func (c *ClickHouseClient) Conn() driver.Conn {
 	return c.conn
 }
 
+// Stats reports the connection pool
+func (c *ClickHouseClient) Stats() driver.Stats {
+	return c.conn.Stats()
+}
+
 func (c *ClickHouseClient) Ping(ctx context.Context) error {
 	return c.conn.Ping(ctx)
 }
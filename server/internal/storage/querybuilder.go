@@ -0,0 +1,644 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+)
+
+// errUnsafeQuery is wrapped by every error of selectQuery.Build
+var errUnsafeQuery = errors.New("unsafe query")
+
+// table is a table queries may read. Only the constants below exist.
+type table string
+
+const (
+	tablePerfSamples   table = "apm_perf_samples"
+	tableJanks         table = "apm_janks"
+	tableStartups      table = "apm_startups"
+	tableSceneLoads    table = "apm_scene_loads"
+	tableExceptions    table = "apm_exceptions"
+	tableCrashes       table = "apm_crashes"
+	tableSessions      table = "apm_sessions"
+	tableApps          table = "apm_apps"
+	tableAPIKeys       table = "apm_api_keys"
+	tableAuditLog      table = "apm_audit_log"
+	tableRemoteConfigs table = "apm_remote_configs"
+)
+
+// tableColumns whitelists the columns of each table. It must match
+// schemaStatements, which TestTableColumns checks.
+var tableColumns = map[table][]string{
+	tablePerfSamples: {
+		"app_id", "timestamp", "app_version", "platform", "device_model", "os_version", "session_id", "device_id",
+		"scene", "fps", "frame_time_ms", "main_thread_ms", "gc_alloc_kb", "mem_mb", "sample_weight",
+	},
+	tableJanks: {
+		"app_id", "timestamp", "app_version", "platform", "device_model", "os_version", "session_id", "device_id",
+		"scene", "duration_ms", "max_frame_ms", "recent_gc_count", "recent_gc_alloc_kb", "recent_events",
+	},
+	tableStartups: {
+		"app_id", "timestamp", "app_version", "platform", "device_model", "os_version", "session_id", "device_id",
+		"phase1_ms", "phase2_ms", "tti_ms",
+	},
+	tableSceneLoads: {
+		"app_id", "timestamp", "app_version", "platform", "device_model", "session_id", "device_id",
+		"scene_name", "load_ms", "activate_ms",
+	},
+	tableExceptions: {
+		"app_id", "timestamp", "app_version", "platform", "device_model", "os_version", "session_id", "device_id",
+		"scene", "fingerprint", "message", "stack", "count",
+	},
+	tableCrashes: {
+		"app_id", "timestamp", "app_version", "platform", "device_model", "os_version", "session_id", "device_id",
+		"scene", "crash_type", "fingerprint", "stack", "breadcrumbs",
+	},
+	tableSessions: {
+		"app_id", "session_id", "device_id", "user_id", "app_version", "platform", "device_model", "os_version",
+		"start_time", "end_time", "scenes", "event_count", "crash_count", "exception_count", "jank_count", "ended_by_crash",
+	},
+	tableApps:    {"id", "name", "created_at", "updated_at"},
+	tableAPIKeys: {"id", "app_id", "label", "prefix", "key_hash", "created_at", "expires_at", "revoked_at", "updated_at"},
+	tableAuditLog: {
+		"timestamp", "app_id", "username", "method", "path", "status", "remote_addr", "request_id",
+	},
+	tableRemoteConfigs: {"app_id", "app_version", "platform", "config", "deleted", "updated_at"},
+}
+
+// queryFunctions whitelists the functions expressions may call
+var queryFunctions = map[string]bool{
+	"any": true, "anyIf": true, "argMax": true, "argMaxIf": true, "argMin": true, "arrayAvg": true,
+	"arrayDifference": true, "arrayDistinct": true, "arrayExists": true, "arrayFlatten": true,
+	"arrayJoin": true, "arrayMap": true, "arrayPopBack": true, "arrayPopFront": true, "arraySort": true,
+	"arrayZip": true, "avg": true, "avgIf": true, "avgWeighted": true, "corr": true, "count": true,
+	"countIf": true, "covarPop": true, "greatest": true, "groupArray": true, "groupUniqArrayIf": true,
+	"has": true, "hasToken": true, "ifNotFinite": true, "lower": true, "max": true, "min": true,
+	"multiIf": true, "multiSearchAnyCaseInsensitive": true, "notEmpty": true, "now": true, "pow": true,
+	"quantile": true, "quantileTDigestWeighted": true, "replaceRegexpOne": true, "round": true,
+	"sqrt": true, "startsWith": true, "sum": true, "sumIf": true, "toDate": true, "toFloat64": true,
+	"toInt64": true, "toStartOfInterval": true, "toString": true, "toUInt64": true,
+	"toUnixTimestamp64Milli": true, "topK": true, "tupleElement": true, "uniqExact": true,
+	"uniqExactIf": true, "varPop": true,
+}
+
+// queryKeywords whitelists the keywords expressions may contain
+var queryKeywords = map[string]bool{
+	"AND": true, "AS": true, "ASC": true, "DESC": true, "DISTINCT": true, "IN": true, "INTERVAL": true,
+	"IS": true, "LIKE": true, "NOT": true, "NULL": true, "OR": true,
+	"SECOND": true, "MINUTE": true, "HOUR": true, "DAY": true,
+}
+
+// intervalUnits are the units an interval is written in, largest first
+var intervalUnits = []struct {
+	name string
+	size time.Duration
+}{
+	{"DAY", 24 * time.Hour},
+	{"HOUR", time.Hour},
+	{"MINUTE", time.Minute},
+	{"SECOND", time.Second},
+}
+
+// intervalSQL writes d as a ClickHouse interval in the largest unit that
+// divides it, e.g. INTERVAL 5 MINUTE
+func intervalSQL(d time.Duration) (string, error) {
+	if d < time.Second || d%time.Second != 0 {
+		return "", fmt.Errorf("%w: interval %s is not a whole number of seconds", errUnsafeQuery, d)
+	}
+	for _, u := range intervalUnits {
+		if d%u.size == 0 {
+			return fmt.Sprintf("INTERVAL %d %s", d/u.size, u.name), nil
+		}
+	}
+	panic("unreachable")
+}
+
+// selectQuery builds a SELECT statement. Tables come from the table
+// constants and intervals from durations; every expression is checked to
+// only name whitelisted columns, functions and keywords, or aliases of the
+// query, and values are always bound as args. Mistakes are reported by
+// Build rather than by each method, so queries can be chained.
+type selectQuery struct {
+	from     table
+	sub      *selectQuery
+	final    bool
+	distinct bool
+	columns  []boundExpr
+	where    []condition
+	groupBy  []string
+	having   []condition
+	orderBy  []string
+	limitBy  int
+	limitOf  []string
+	limit    int
+	offset   int
+	err      error
+}
+
+// boundExpr is an expression with the args of its placeholders
+type boundExpr struct {
+	expr string
+	args []interface{}
+}
+
+type condition struct {
+	expr string
+	args []interface{}
+	sub  *selectQuery // appended to expr in parentheses
+}
+
+// newQuery starts a query reading t
+func newQuery(t table) *selectQuery {
+	return &selectQuery{from: t}
+}
+
+// newSubquery starts a query reading the rows of sub. The outer query may
+// name the columns sub selects, by alias or by column.
+func newSubquery(sub *selectQuery) *selectQuery {
+	return &selectQuery{sub: sub}
+}
+
+// Select appends expressions to the selected columns
+func (q *selectQuery) Select(exprs ...string) *selectQuery {
+	for _, e := range exprs {
+		q.columns = append(q.columns, boundExpr{expr: e})
+	}
+	return q
+}
+
+// SelectArgs appends an expression with placeholders to the selected
+// columns. expr must contain one ? per arg.
+func (q *selectQuery) SelectArgs(expr string, args ...interface{}) *selectQuery {
+	q.columns = append(q.columns, boundExpr{expr: expr, args: args})
+	return q
+}
+
+// SelectBucket appends column rounded down to the start of its interval of
+// size every, as alias
+func (q *selectQuery) SelectBucket(column string, every time.Duration, alias string) *selectQuery {
+	interval, err := intervalSQL(every)
+	if err != nil {
+		q.fail(err)
+		return q
+	}
+	return q.Select(fmt.Sprintf("toStartOfInterval(%s, %s) AS %s", column, interval, alias))
+}
+
+// Distinct selects distinct rows
+func (q *selectQuery) Distinct() *selectQuery {
+	q.distinct = true
+	return q
+}
+
+// Final reads a ReplacingMergeTree table with duplicates merged
+func (q *selectQuery) Final() *selectQuery {
+	q.final = true
+	return q
+}
+
+// Where adds a condition, ANDed with the others. cond must contain one ?
+// per arg.
+func (q *selectQuery) Where(cond string, args ...interface{}) *selectQuery {
+	q.where = append(q.where, condition{expr: cond, args: args})
+	return q
+}
+
+// Between restricts column to the time range, bounds included
+func (q *selectQuery) Between(column string, start, end time.Time) *selectQuery {
+	return q.Where(column+" >= ?", start).Where(column+" <= ?", end)
+}
+
+// WithinLast restricts column to the last d before the server's clock
+func (q *selectQuery) WithinLast(column string, d time.Duration) *selectQuery {
+	interval, err := intervalSQL(d)
+	if err != nil {
+		q.fail(err)
+		return q
+	}
+	return q.Where(column + " >= now() - " + interval)
+}
+
+// Filter restricts column to value, unless value is empty
+func (q *selectQuery) Filter(column, value string) *selectQuery {
+	if value == "" {
+		return q
+	}
+	return q.Where(column+" = ?", value)
+}
+
+// WhereIn restricts columns to the rows sub selects
+func (q *selectQuery) WhereIn(columns []string, sub *selectQuery) *selectQuery {
+	q.where = append(q.where, condition{expr: "(" + strings.Join(columns, ", ") + ") IN ", sub: sub})
+	return q
+}
+
+// GroupBy appends grouping expressions
+func (q *selectQuery) GroupBy(exprs ...string) *selectQuery {
+	q.groupBy = append(q.groupBy, exprs...)
+	return q
+}
+
+// Having adds a condition on the groups, ANDed with the others. cond must
+// contain one ? per arg.
+func (q *selectQuery) Having(cond string, args ...interface{}) *selectQuery {
+	q.having = append(q.having, condition{expr: cond, args: args})
+	return q
+}
+
+// OrderBy appends ordering expressions, e.g. "cnt DESC"
+func (q *selectQuery) OrderBy(exprs ...string) *selectQuery {
+	q.orderBy = append(q.orderBy, exprs...)
+	return q
+}
+
+// LimitBy returns at most n rows for each value of exprs, e.g. the top
+// rows of each group when ordered
+func (q *selectQuery) LimitBy(n int, exprs ...string) *selectQuery {
+	if n <= 0 || len(exprs) == 0 {
+		q.fail(fmt.Errorf("%w: limit %d by %v", errUnsafeQuery, n, exprs))
+	}
+	q.limitBy = n
+	q.limitOf = exprs
+	return q
+}
+
+// Limit returns at most n rows
+func (q *selectQuery) Limit(n int) *selectQuery {
+	if n <= 0 {
+		q.fail(fmt.Errorf("%w: limit %d is not positive", errUnsafeQuery, n))
+	}
+	q.limit = n
+	return q
+}
+
+// Offset skips the first n rows
+func (q *selectQuery) Offset(n int) *selectQuery {
+	if n < 0 {
+		q.fail(fmt.Errorf("%w: offset %d is negative", errUnsafeQuery, n))
+	}
+	q.offset = n
+	return q
+}
+
+func (q *selectQuery) fail(err error) {
+	if q.err == nil {
+		q.err = err
+	}
+}
+
+// Build checks q and returns its SQL and args
+func (q *selectQuery) Build() (string, []interface{}, error) {
+	if q.err != nil {
+		return "", nil, q.err
+	}
+	if len(q.columns) == 0 {
+		return "", nil, fmt.Errorf("%w: no columns selected", errUnsafeQuery)
+	}
+
+	var sb strings.Builder
+	var args []interface{}
+
+	// Args are bound in the order their clauses are written: the columns',
+	// the subquery's, the conditions', then the limits and offset
+	columns := make([]string, len(q.columns))
+	for i, c := range q.columns {
+		columns[i] = c.expr
+		args = append(args, c.args...)
+	}
+
+	names := make(map[string]bool)
+	var from string
+	if q.sub != nil {
+		subSQL, subArgs, err := q.sub.Build()
+		if err != nil {
+			return "", nil, err
+		}
+		for _, name := range q.sub.outputs() {
+			names[name] = true
+		}
+		from = "(" + subSQL + ")"
+		args = append(args, subArgs...)
+	} else {
+		columns, ok := tableColumns[q.from]
+		if !ok {
+			return "", nil, fmt.Errorf("%w: unknown table %q", errUnsafeQuery, q.from)
+		}
+		for _, c := range columns {
+			names[c] = true
+		}
+		from = string(q.from)
+	}
+	for _, alias := range q.aliases() {
+		names[alias] = true
+	}
+
+	check := func(clause, expr string, placeholders int) error {
+		n, err := checkExpr(expr, names)
+		if err != nil {
+			return fmt.Errorf("%w: %s %q: %v", errUnsafeQuery, clause, expr, err)
+		}
+		if n != placeholders {
+			return fmt.Errorf("%w: %s %q has %d placeholders for %d args", errUnsafeQuery, clause, expr, n, placeholders)
+		}
+		return nil
+	}
+
+	for _, c := range q.columns {
+		if err := check("column", c.expr, len(c.args)); err != nil {
+			return "", nil, err
+		}
+	}
+	sb.WriteString("SELECT ")
+	if q.distinct {
+		sb.WriteString("DISTINCT ")
+	}
+	sb.WriteString(strings.Join(columns, ", "))
+	sb.WriteString(" FROM ")
+	sb.WriteString(from)
+	if q.final {
+		sb.WriteString(" FINAL")
+	}
+
+	conditions := func(keyword string, conds []condition) error {
+		if len(conds) == 0 {
+			return nil
+		}
+		exprs := make([]string, len(conds))
+		for i, c := range conds {
+			if err := check("condition", c.expr, len(c.args)); err != nil {
+				return err
+			}
+			expr := c.expr
+			args = append(args, c.args...)
+			if c.sub != nil {
+				subSQL, subArgs, err := c.sub.Build()
+				if err != nil {
+					return err
+				}
+				expr += "(" + subSQL + ")"
+				args = append(args, subArgs...)
+			} else if hasKeyword(expr, "OR") {
+				expr = "(" + expr + ")"
+			}
+			exprs[i] = expr
+		}
+		sb.WriteString(" " + keyword + " ")
+		sb.WriteString(strings.Join(exprs, " AND "))
+		return nil
+	}
+	list := func(keyword string, exprs []string) error {
+		if len(exprs) == 0 {
+			return nil
+		}
+		for _, e := range exprs {
+			if err := check(strings.ToLower(keyword), e, 0); err != nil {
+				return err
+			}
+		}
+		sb.WriteString(" " + keyword + " ")
+		sb.WriteString(strings.Join(exprs, ", "))
+		return nil
+	}
+
+	if err := conditions("WHERE", q.where); err != nil {
+		return "", nil, err
+	}
+	if err := list("GROUP BY", q.groupBy); err != nil {
+		return "", nil, err
+	}
+	if err := conditions("HAVING", q.having); err != nil {
+		return "", nil, err
+	}
+	if err := list("ORDER BY", q.orderBy); err != nil {
+		return "", nil, err
+	}
+	if q.limitBy > 0 {
+		sb.WriteString(" LIMIT ?")
+		args = append(args, q.limitBy)
+		if err := list("BY", q.limitOf); err != nil {
+			return "", nil, err
+		}
+	}
+
+	if q.limit > 0 {
+		sb.WriteString(" LIMIT ?")
+		args = append(args, q.limit)
+	}
+	if q.offset > 0 {
+		sb.WriteString(" OFFSET ?")
+		args = append(args, q.offset)
+	}
+
+	return sb.String(), args, nil
+}
+
+// aliases returns the names the selected columns declare with AS
+func (q *selectQuery) aliases() []string {
+	var names []string
+	for _, c := range q.columns {
+		if alias := columnAlias(c.expr); alias != "" {
+			names = append(names, alias)
+		}
+	}
+	return names
+}
+
+// outputs returns the names an outer query can read from q's rows: the
+// alias of each column, or the column itself if it is a bare identifier
+func (q *selectQuery) outputs() []string {
+	var names []string
+	for _, c := range q.columns {
+		if alias := columnAlias(c.expr); alias != "" {
+			names = append(names, alias)
+		} else if toks, err := lexExpr(c.expr); err == nil && len(toks) == 1 && toks[0].kind == tokIdent {
+			names = append(names, toks[0].text)
+		}
+	}
+	return names
+}
+
+// columnAlias returns the name expr ends with "AS name", or ""
+func columnAlias(expr string) string {
+	toks, err := lexExpr(expr)
+	if err != nil || len(toks) < 2 {
+		return ""
+	}
+	last, as := toks[len(toks)-1], toks[len(toks)-2]
+	if last.kind != tokIdent || as.kind != tokIdent || !strings.EqualFold(as.text, "AS") {
+		return ""
+	}
+	return last.text
+}
+
+// hasKeyword reports whether expr contains keyword outside string literals
+func hasKeyword(expr, keyword string) bool {
+	toks, _ := lexExpr(expr)
+	for _, t := range toks {
+		if t.kind == tokIdent && strings.EqualFold(t.text, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkExpr checks that every identifier of expr is a known function, a
+// keyword, one of names or a lambda parameter, and returns the number of
+// placeholders it contains
+func checkExpr(expr string, names map[string]bool) (int, error) {
+	toks, err := lexExpr(expr)
+	if err != nil {
+		return 0, err
+	}
+
+	placeholders := 0
+	params := make(map[string]bool)
+	for i, t := range toks {
+		switch t.kind {
+		case tokPlaceholder:
+			placeholders++
+		case tokIdent:
+			next := ""
+			if i+1 < len(toks) {
+				next = toks[i+1].text
+			}
+			switch {
+			case next == "(":
+				if !queryFunctions[t.text] {
+					return 0, fmt.Errorf("function %s is not allowed", t.text)
+				}
+			case next == "->":
+				params[t.text] = true
+			case queryKeywords[strings.ToUpper(t.text)]:
+			case i > 0 && strings.EqualFold(toks[i-1].text, "AS"):
+				// an alias being declared
+			case names[t.text], params[t.text]:
+			default:
+				return 0, fmt.Errorf("unknown column %s", t.text)
+			}
+		}
+	}
+	return placeholders, nil
+}
+
+type tokenKind int
+
+const (
+	tokIdent tokenKind = iota
+	tokNumber
+	tokString
+	tokPlaceholder
+	tokSymbol
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+// exprSymbols are the operators and punctuation expressions may contain,
+// two-character ones first
+var exprSymbols = []string{"->", "!=", "<=", ">=", "<>", "+", "-", "*", "/", "%", "=", "<", ">", "(", ")", ",", "."}
+
+// lexExpr splits an expression into tokens. It rejects comments, statement
+// separators, quoted identifiers and string literals with escapes, so an
+// expression cannot end early or smuggle in another one.
+func lexExpr(expr string) ([]token, error) {
+	var toks []token
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case c == '_' || isLetter(c):
+			j := i + 1
+			for j < len(expr) && (expr[j] == '_' || isLetter(expr[j]) || isDigit(expr[j])) {
+				j++
+			}
+			toks = append(toks, token{tokIdent, expr[i:j]})
+			i = j
+		case isDigit(c):
+			j := i + 1
+			for j < len(expr) && (isDigit(expr[j]) || expr[j] == '.') {
+				j++
+			}
+			toks = append(toks, token{tokNumber, expr[i:j]})
+			i = j
+		case c == '\'':
+			j := strings.IndexByte(expr[i+1:], '\'')
+			if j < 0 {
+				return nil, errors.New("unterminated string")
+			}
+			lit := expr[i : i+j+2]
+			if strings.ContainsAny(lit, "\\\n") {
+				return nil, errors.New("escapes are not allowed in strings")
+			}
+			toks = append(toks, token{tokString, lit})
+			i += j + 2
+		case c == '?':
+			toks = append(toks, token{tokPlaceholder, "?"})
+			i++
+		case strings.HasPrefix(expr[i:], "--") || strings.HasPrefix(expr[i:], "/*"):
+			return nil, errors.New("comments are not allowed")
+		default:
+			matched := false
+			for _, s := range exprSymbols {
+				if strings.HasPrefix(expr[i:], s) {
+					toks = append(toks, token{tokSymbol, s})
+					i += len(s)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("unexpected %q", c)
+			}
+		}
+	}
+	return toks, nil
+}
+
+func isLetter(c byte) bool { return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' }
+func isDigit(c byte) bool  { return c >= '0' && c <= '9' }
+
+// query runs q
+func (r *Repository) query(ctx context.Context, q *selectQuery) (driver.Rows, error) {
+	sql, args, err := q.Build()
+	if err != nil {
+		return nil, err
+	}
+	return r.client.conn.Query(ctx, sql, args...)
+}
+
+// queryEach runs q and calls scan for each row. It stops at the first
+// error, from scan or from reading the rows.
+func (r *Repository) queryEach(ctx context.Context, q *selectQuery, scan func(rows driver.Rows) error) error {
+	rows, err := r.query(ctx, q)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// queryRow runs q for a single row. A query that does not build fails on
+// Scan, as a query ClickHouse rejects would.
+func (r *Repository) queryRow(ctx context.Context, q *selectQuery) rowScanner {
+	sql, args, err := q.Build()
+	if err != nil {
+		return errRow{err}
+	}
+	return r.client.conn.QueryRow(ctx, sql, args...)
+}
+
+type errRow struct{ err error }
+
+func (r errRow) Scan(dest ...interface{}) error { return r.err }
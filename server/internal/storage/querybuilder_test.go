@@ -0,0 +1,503 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"go.uber.org/zap"
+
+	"github.com/warriorguo/ozx_apm/server/internal/models"
+)
+
+func TestSelectQuery_Build(t *testing.T) {
+	start := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	end := start.Add(24 * time.Hour)
+
+	query, args, err := newQuery(tableCrashes).
+		Select("fingerprint", "count() as cnt").
+		Between("timestamp", start, end).
+		Filter("app_id", "game").
+		Filter("platform", "").
+		Where("has(?, app_version)", []string{"1.0.0"}).
+		GroupBy("fingerprint").
+		OrderBy("cnt DESC").
+		Limit(20).
+		Offset(40).
+		Build()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := "SELECT fingerprint, count() as cnt FROM apm_crashes " +
+		"WHERE timestamp >= ? AND timestamp <= ? AND app_id = ? AND has(?, app_version) " +
+		"GROUP BY fingerprint ORDER BY cnt DESC LIMIT ? OFFSET ?"
+	if query != want {
+		t.Errorf("unexpected query:\n got: %s\nwant: %s", query, want)
+	}
+	wantArgs := []interface{}{start, end, "game", []string{"1.0.0"}, 20, 40}
+	if !reflect.DeepEqual(args, wantArgs) {
+		t.Errorf("expected args %v, got %v", wantArgs, args)
+	}
+}
+
+func TestSelectQuery_Subqueries(t *testing.T) {
+	start := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+
+	sessions := newQuery(tableSessions).
+		Select("session_id", "sum(crash_count) as crashes").
+		Where("start_time >= ?", start).
+		GroupBy("session_id")
+	devices := newQuery(tableSessions).
+		Final().
+		Distinct().
+		Select("session_id").
+		Filter("device_id", "d1")
+
+	query, args, err := newSubquery(sessions).
+		SelectBucket("session_id", time.Hour, "t").
+		Select("countIf(crashes > 0 OR session_id = '')").
+		Where("crashes > ? OR crashes = 0", 1).
+		WhereIn([]string{"session_id"}, devices).
+		Build()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := "SELECT toStartOfInterval(session_id, INTERVAL 1 HOUR) AS t, countIf(crashes > 0 OR session_id = '') " +
+		"FROM (SELECT session_id, sum(crash_count) as crashes FROM apm_sessions WHERE start_time >= ? GROUP BY session_id) " +
+		"WHERE (crashes > ? OR crashes = 0) AND (session_id) IN (SELECT DISTINCT session_id FROM apm_sessions FINAL WHERE device_id = ?)"
+	if query != want {
+		t.Errorf("unexpected query:\n got: %s\nwant: %s", query, want)
+	}
+	wantArgs := []interface{}{start, 1, "d1"}
+	if !reflect.DeepEqual(args, wantArgs) {
+		t.Errorf("expected args %v, got %v", wantArgs, args)
+	}
+}
+
+func TestSelectQuery_ArgsAndHaving(t *testing.T) {
+	mid := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+
+	query, args, err := newQuery(tableCrashes).
+		Select("fingerprint").
+		SelectArgs("countIf(timestamp >= ?) AS recent", mid).
+		Filter("app_id", "game").
+		GroupBy("fingerprint").
+		Having("(recent, fingerprint) < (?, ?)", 5, "fp").
+		OrderBy("recent DESC").
+		Limit(10).
+		Build()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := "SELECT fingerprint, countIf(timestamp >= ?) AS recent FROM apm_crashes WHERE app_id = ? " +
+		"GROUP BY fingerprint HAVING (recent, fingerprint) < (?, ?) ORDER BY recent DESC LIMIT ?"
+	if query != want {
+		t.Errorf("unexpected query:\n got: %s\nwant: %s", query, want)
+	}
+	wantArgs := []interface{}{mid, "game", 5, "fp", 10}
+	if !reflect.DeepEqual(args, wantArgs) {
+		t.Errorf("expected args %v, got %v", wantArgs, args)
+	}
+}
+
+func TestSelectQuery_Rejects(t *testing.T) {
+	tests := []struct {
+		name  string
+		query func() *selectQuery
+	}{
+		{"unknown table", func() *selectQuery { return newQuery("apm_users").Select("id") }},
+		{"no columns", func() *selectQuery { return newQuery(tableCrashes) }},
+		{"column of another table", func() *selectQuery { return newQuery(tableCrashes).Select("fps") }},
+		{"unknown function", func() *selectQuery { return newQuery(tableCrashes).Select("sleep(3)") }},
+		{"statement separator", func() *selectQuery {
+			return newQuery(tableCrashes).Select("count()").Where("app_id = 'a'; DROP TABLE apm_crashes")
+		}},
+		{"comment", func() *selectQuery { return newQuery(tableCrashes).Select("count()").Where("app_id = ? -- x", "a") }},
+		{"block comment", func() *selectQuery { return newQuery(tableCrashes).Select("count() /* x */") }},
+		{"quoted identifier", func() *selectQuery { return newQuery(tableCrashes).Select("`app_id`") }},
+		{"escaped string", func() *selectQuery { return newQuery(tableCrashes).Select("count()").Where(`app_id = 'a\' OR 1=1'`) }},
+		{"unterminated string", func() *selectQuery { return newQuery(tableCrashes).Select("count()").Where("app_id = 'a") }},
+		{"interpolated value", func() *selectQuery {
+			return newQuery(tableCrashes).Select("count()").Where("app_id = game")
+		}},
+		{"missing arg", func() *selectQuery { return newQuery(tableCrashes).Select("count()").Where("app_id = ?") }},
+		{"extra arg", func() *selectQuery { return newQuery(tableCrashes).Select("count()").Where("app_id = 'a'", "b") }},
+		{"placeholder in column", func() *selectQuery { return newQuery(tableCrashes).Select("has(?, app_id)") }},
+		{"bad having", func() *selectQuery {
+			return newQuery(tableCrashes).Select("fingerprint").GroupBy("fingerprint").Having("count() > ?")
+		}},
+		{"bad order", func() *selectQuery { return newQuery(tableCrashes).Select("count()").OrderBy("rand()") }},
+		{"zero limit", func() *selectQuery { return newQuery(tableCrashes).Select("count()").Limit(0) }},
+		{"limit by nothing", func() *selectQuery { return newQuery(tableCrashes).Select("count()").LimitBy(3) }},
+		{"bad limit by", func() *selectQuery {
+			return newQuery(tableCrashes).Select("fingerprint").LimitBy(3, "rand()")
+		}},
+		{"negative offset", func() *selectQuery { return newQuery(tableCrashes).Select("count()").Offset(-1) }},
+		{"sub-second interval", func() *selectQuery {
+			return newQuery(tableCrashes).SelectBucket("timestamp", 500*time.Millisecond, "t")
+		}},
+		{"column outside subquery", func() *selectQuery {
+			return newSubquery(newQuery(tableCrashes).Select("fingerprint")).Select("stack")
+		}},
+		{"bad subquery", func() *selectQuery {
+			return newSubquery(newQuery(tableCrashes).Select("fps")).Select("count()")
+		}},
+		{"bad in subquery", func() *selectQuery {
+			return newQuery(tableCrashes).Select("count()").WhereIn([]string{"fingerprint"}, newQuery(tableCrashes))
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, _, err := tt.query().Build()
+			if !errors.Is(err, errUnsafeQuery) {
+				t.Errorf("expected an unsafe query error, got %v for %s", err, query)
+			}
+		})
+	}
+}
+
+func TestSelectQuery_LambdasAndAliases(t *testing.T) {
+	_, _, err := newQuery(tableSessions).
+		Select("arrayMap(x -> x.2, groupArray((start_time, scenes))) as path", "min(start_time) as started").
+		OrderBy("started DESC").
+		Build()
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestIntervalSQL(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{time.Second, "INTERVAL 1 SECOND"},
+		{90 * time.Second, "INTERVAL 90 SECOND"},
+		{5 * time.Minute, "INTERVAL 5 MINUTE"},
+		{time.Hour, "INTERVAL 1 HOUR"},
+		{36 * time.Hour, "INTERVAL 36 HOUR"},
+		{30 * 24 * time.Hour, "INTERVAL 30 DAY"},
+	}
+	for _, tt := range tests {
+		got, err := intervalSQL(tt.d)
+		if err != nil || got != tt.want {
+			t.Errorf("intervalSQL(%s) = %q, %v, expected %q", tt.d, got, err, tt.want)
+		}
+	}
+
+	for _, d := range []time.Duration{0, -time.Hour, 1500 * time.Millisecond} {
+		if _, err := intervalSQL(d); !errors.Is(err, errUnsafeQuery) {
+			t.Errorf("intervalSQL(%s): expected an error, got %v", d, err)
+		}
+	}
+}
+
+// TestTableColumns checks the whitelist against the schema
+func TestTableColumns(t *testing.T) {
+	create := regexp.MustCompile(`^CREATE TABLE IF NOT EXISTS (\w+) \(`)
+	column := regexp.MustCompile(`^\s+(\w+) [A-Z]`)
+
+	seen := make(map[table]bool)
+	for _, stmt := range schemaStatements {
+		lines := strings.Split(stmt, "\n")
+		m := create.FindStringSubmatch(lines[0])
+		if m == nil {
+			continue
+		}
+		tbl := table(m[1])
+		seen[tbl] = true
+
+		var columns []string
+		for _, line := range lines[1:] {
+			if c := column.FindStringSubmatch(line); c != nil && !strings.HasPrefix(strings.TrimSpace(line), "INDEX ") {
+				columns = append(columns, c[1])
+			}
+		}
+		if !reflect.DeepEqual(columns, tableColumns[tbl]) {
+			t.Errorf("%s: schema has columns %v, whitelist %v", tbl, columns, tableColumns[tbl])
+		}
+	}
+	for tbl := range tableColumns {
+		if !seen[tbl] {
+			t.Errorf("%s is whitelisted but not in the schema", tbl)
+		}
+	}
+}
+
+// recordingConn records the queries it is sent and serves empty results
+type recordingConn struct {
+	fakeConn
+	queries *[]string
+	args    *[][]interface{}
+}
+
+func (c recordingConn) Query(ctx context.Context, query string, args ...any) (driver.Rows, error) {
+	*c.queries = append(*c.queries, query)
+	*c.args = append(*c.args, args)
+	return fakeRows{}, nil
+}
+
+func (c recordingConn) QueryRow(ctx context.Context, query string, args ...any) driver.Row {
+	*c.queries = append(*c.queries, query)
+	*c.args = append(*c.args, args)
+	return emptyRow{}
+}
+
+type emptyRow struct{ driver.Row }
+
+func (emptyRow) Scan(dest ...any) error { return nil }
+func (emptyRow) Err() error             { return nil }
+
+// errRows serves n rows, then fails with err
+type errRows struct {
+	driver.Rows
+	n   *int
+	err error
+}
+
+func (r errRows) Next() bool {
+	*r.n--
+	return *r.n >= 0
+}
+func (r errRows) Scan(dest ...any) error { return nil }
+func (r errRows) Close() error           { return nil }
+func (r errRows) Err() error             { return r.err }
+
+type errRowsConn struct {
+	fakeConn
+	rows errRows
+}
+
+func (c errRowsConn) Query(ctx context.Context, query string, args ...any) (driver.Rows, error) {
+	return c.rows, nil
+}
+
+func TestRepository_QueryEach(t *testing.T) {
+	query := newQuery(tableCrashes).Select("count()")
+	broken := errors.New("connection reset")
+
+	// A failed read of the rows is not a short result
+	n := 2
+	repo := NewRepository(&ClickHouseClient{conn: errRowsConn{rows: errRows{n: &n, err: broken}}}, zap.NewNop())
+	read := 0
+	err := repo.queryEach(context.Background(), query, func(rows driver.Rows) error { read++; return nil })
+	if !errors.Is(err, broken) || read != 2 {
+		t.Errorf("expected 2 rows then %v, got %d rows and %v", broken, read, err)
+	}
+
+	// Nor is a row that fails to scan
+	n = 2
+	repo = NewRepository(&ClickHouseClient{conn: errRowsConn{rows: errRows{n: &n}}}, zap.NewNop())
+	read = 0
+	err = repo.queryEach(context.Background(), query, func(rows driver.Rows) error { read++; return broken })
+	if !errors.Is(err, broken) || read != 1 {
+		t.Errorf("expected to stop at the first scan error, got %d rows and %v", read, err)
+	}
+}
+
+func newRecordingRepository() (*Repository, *[]string, *[][]interface{}) {
+	queries, args := &[]string{}, &[][]interface{}{}
+	conn := recordingConn{queries: queries, args: args}
+	return NewRepository(&ClickHouseClient{conn: conn}, zap.NewNop()), queries, args
+}
+
+// TestRepository_QueriesBuild runs every read of the repository, so a query
+// the builder rejects shows up as one that was never sent
+func TestRepository_QueriesBuild(t *testing.T) {
+	ctx := context.Background()
+	end := time.Now()
+	start := end.Add(-24 * time.Hour)
+	filter := models.QueryFilter{StartTime: start, EndTime: end, AppID: "game", AppVersion: "1.0.0", Platform: "Android", DeviceModel: "Pixel", Scene: "Menu", Limit: 10}
+
+	tests := []struct {
+		name    string
+		queries int
+		run     func(r *Repository) error
+	}{
+		{"QueryFPSMetrics", 1, func(r *Repository) error { _, err := r.QueryFPSMetrics(ctx, filter); return err }},
+		{"QueryStartupMetrics", 1, func(r *Repository) error { _, err := r.QueryStartupMetrics(ctx, filter); return err }},
+		{"QueryJankMetrics", 1, func(r *Repository) error { _, err := r.QueryJankMetrics(ctx, filter); return err }},
+		{"QueryExceptions", 1, func(r *Repository) error { _, err := r.QueryExceptions(ctx, filter); return err }},
+		{"QueryCrashes", 1, func(r *Repository) error { _, err := r.QueryCrashes(ctx, filter); return err }},
+		{"GetDashboardSummary", 7, func(r *Repository) error {
+			_, err := r.GetDashboardSummary(ctx, "game", start, end, "1.0.0", "Android")
+			return err
+		}},
+		{"GetDistribution", 2, func(r *Repository) error {
+			_, err := r.GetDistribution(ctx, "game", "frame_time", start, end, "1.0.0", "Android", "Menu")
+			return err
+		}},
+		{"GetJankAnalysis", 3, func(r *Repository) error {
+			_, err := r.GetJankAnalysis(ctx, "game", start, end, "1.0.0", "Android", "Menu", 20, 10)
+			return err
+		}},
+		{"GetMemoryLeaks", 8, func(r *Repository) error {
+			_, err := r.GetMemoryLeaks(ctx, "game", start, end, "1.0.0", "Android", "Menu", 100, 0, 20)
+			return err
+		}},
+		{"GetSceneReport", 6, func(r *Repository) error {
+			_, err := r.GetSceneReport(ctx, "game", start, end, "1.0.0", "Android", models.SceneSortJankRate, 20)
+			return err
+		}},
+		{"GetAppVersions", 1, func(r *Repository) error { _, err := r.GetAppVersions(ctx, "game"); return err }},
+		{"GetScenes", 1, func(r *Repository) error { _, err := r.GetScenes(ctx, "game", "1.0.0"); return err }},
+		{"GetCrashGroups", 2, func(r *Repository) error {
+			_, err := r.GetCrashGroups(ctx, models.GroupListQuery{
+				AppID: "game", StartTime: start, EndTime: end, AppVersion: "1.0.0", Platform: "Android",
+				Sort: models.GroupSortFirstSeen, Order: "asc", Page: 2, PageSize: 20, WithTotal: true,
+			})
+			return err
+		}},
+		{"GetCrashDetail", 4, func(r *Repository) error { _, err := r.GetCrashDetail(ctx, "game", "fp", start, end); return err }},
+		{"GetExceptionGroups", 1, func(r *Repository) error {
+			q := models.GroupListQuery{AppID: "game", StartTime: start, EndTime: end, Sort: models.GroupSortTrend, PageSize: 20}
+			q.Cursor = groupCursor{
+				Sort: models.GroupSortTrend, Order: "desc", Key: 12.5, Fingerprint: "fp",
+				Start: start.UnixMilli(), End: end.UnixMilli(), Filters: groupFilters(q),
+			}.encode()
+			_, err := r.GetExceptionGroups(ctx, q)
+			return err
+		}},
+		{"SearchIssues", 2, func(r *Repository) error {
+			_, err := r.SearchIssues(ctx, "game", []string{"inventorypanel"}, "", start, end, 20)
+			return err
+		}},
+		{"GetSessions", 2, func(r *Repository) error {
+			_, _, err := r.GetSessions(ctx, "game", start, end, "1.0.0", "Android", 1, 20)
+			return err
+		}},
+		{"GetSession", 1, func(r *Repository) error { _, err := r.GetSession(ctx, "game", "s1"); return err }},
+		{"GetSessionStats", 1, func(r *Repository) error {
+			_, err := r.GetSessionStats(ctx, "game", start, end, "1.0.0", "Android")
+			return err
+		}},
+		{"GetCrashFreeStats", 1, func(r *Repository) error {
+			_, err := r.GetCrashFreeStats(ctx, "game", start, end, "1.0.0", "Android", "day", "user_id")
+			return err
+		}},
+		{"GetSessionTimeline", 6, func(r *Repository) error {
+			_, _, err := r.GetSessionTimeline(ctx, "game", "s1", start, end, 100)
+			return err
+		}},
+		{"GetDeviceHistory", 9, func(r *Repository) error { _, err := r.GetDeviceHistory(ctx, "game", "d1", start, end); return err }},
+		{"FindDevicesByUser", 1, func(r *Repository) error { _, err := r.FindDevicesByUser(ctx, "game", "u1", start, end); return err }},
+		{"GetReleases", 1, func(r *Repository) error {
+			_, err := r.GetReleases(ctx, "game", start, end, "Android", time.Hour, []string{"1.0.0"}, 10)
+			return err
+		}},
+		{"fillReleaseLifetime", 1, func(r *Repository) error {
+			return r.fillReleaseLifetime(ctx, "game", nil, nil, []string{"1.0.0"}, "Android")
+		}},
+		{"fillReleaseAdoption", 1, func(r *Repository) error {
+			return r.fillReleaseAdoption(ctx, nil, nil, time.Hour, newQuery(tableSessions).Filter("app_id", "game"))
+		}},
+		{"metricSummaries", 1, func(r *Repository) error {
+			_, err := r.metricSummaries(ctx, newQuery(tableStartups).Filter("app_id", "game"), "phase1_ms + phase2_ms + tti_ms", "")
+			return err
+		}},
+		{"metricSummaries weighted", 1, func(r *Repository) error {
+			_, err := r.metricSummaries(ctx, newQuery(tablePerfSamples).Filter("app_id", "game"), "fps", "sample_weight")
+			return err
+		}},
+		{"ListApps", 1, func(r *Repository) error { _, err := r.ListApps(ctx); return err }},
+		{"GetApp", 1, func(r *Repository) error { _, err := r.GetApp(ctx, "game"); return err }},
+		{"ListAPIKeys", 1, func(r *Repository) error { _, err := r.ListAPIKeys(ctx, "game"); return err }},
+		{"GetAPIKey", 1, func(r *Repository) error { _, err := r.GetAPIKey(ctx, "game", "k1"); return err }},
+		{"GetAuditLog", 1, func(r *Repository) error { _, err := r.GetAuditLog(ctx, "game", start, end, 100); return err }},
+		{"ListRemoteConfigs", 1, func(r *Repository) error { _, err := r.ListRemoteConfigs(ctx, "game"); return err }},
+	}
+
+	for metric := range timeSeriesMetrics {
+		metric := metric
+		tests = append(tests, struct {
+			name    string
+			queries int
+			run     func(r *Repository) error
+		}{"GetTimeSeries " + metric, 1, func(r *Repository) error {
+			_, err := r.GetTimeSeries(ctx, "game", metric, start, end, time.Hour, "1.0.0", "Android")
+			return err
+		}})
+	}
+	for metric := range crashFreeSeriesMetrics {
+		metric := metric
+		tests = append(tests, struct {
+			name    string
+			queries int
+			run     func(r *Repository) error
+		}{"GetTimeSeries " + metric, 1, func(r *Repository) error {
+			_, err := r.GetTimeSeries(ctx, "game", metric, start, end, 5*time.Minute, "1.0.0", "Android")
+			return err
+		}})
+	}
+	for metric := range distributionMetrics {
+		metric := metric
+		tests = append(tests, struct {
+			name    string
+			queries int
+			run     func(r *Repository) error
+		}{"GetDistribution " + metric, 2, func(r *Repository) error {
+			_, err := r.GetDistribution(ctx, "game", metric, start, end, "1.0.0", "Android", "")
+			return err
+		}})
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, queries, _ := newRecordingRepository()
+			if err := tt.run(repo); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(*queries) != tt.queries {
+				t.Errorf("expected %d queries, sent %d: %v", tt.queries, len(*queries), *queries)
+			}
+		})
+	}
+}
+
+func TestGetTimeSeries_CrashFreeUsers(t *testing.T) {
+	repo, queries, args := newRecordingRepository()
+	start := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	end := start.Add(6 * time.Hour)
+
+	if _, err := repo.GetTimeSeries(context.Background(), "game", "crash_free_users", start, end, 5*time.Minute, "", "iOS"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := "SELECT toStartOfInterval(started, INTERVAL 5 MINUTE) AS t, " +
+		"(uniqExact(device) - uniqExactIf(device, crashes > 0)) / uniqExact(device) * 100 " +
+		"FROM (SELECT session_id, any(device_id) as device, min(start_time) as started, sum(crash_count) as crashes " +
+		"FROM apm_sessions WHERE start_time >= ? AND start_time <= ? AND app_id = ? AND platform = ? GROUP BY session_id) " +
+		"GROUP BY t ORDER BY t"
+	if len(*queries) != 1 || (*queries)[0] != want {
+		t.Errorf("unexpected queries:\n got: %v\nwant: %s", *queries, want)
+	}
+	wantArgs := []interface{}{start, end, "game", "iOS"}
+	if len(*args) != 1 || !reflect.DeepEqual((*args)[0], wantArgs) {
+		t.Errorf("expected args %v, got %v", wantArgs, *args)
+	}
+
+	if _, err := repo.GetTimeSeries(context.Background(), "game", "fps", start, end, 1500*time.Millisecond, "", ""); !errors.Is(err, errUnsafeQuery) {
+		t.Errorf("expected a sub-second interval to be rejected, got %v", err)
+	}
+}
+
+func TestDistributionBuckets(t *testing.T) {
+	buckets, expr := distributionBuckets("fps", []int{15, 30})
+
+	if want := []string{"0-15", "15-30", "30+"}; !slices.Equal(buckets, want) {
+		t.Errorf("expected buckets %v, got %v", want, buckets)
+	}
+	if want := "multiIf(fps < 15, '0-15', fps < 30, '15-30', '30+')"; expr != want {
+		t.Errorf("expected %s, got %s", want, expr)
+	}
+}
@@ -3,11 +3,12 @@ package storage
 import (
 	"context"
 	"fmt"
-	"strings"
+	"slices"
 	"time"
 
 	"go.uber.org/zap"
 
+	"github.com/warriorguo/ozx_apm/server/internal/metrics"
 	"github.com/warriorguo/ozx_apm/server/internal/models"
 )
 
@@ -32,10 +33,11 @@ func (r *Repository) Migrate(ctx context.Context) error {
 }
 
 // InsertPerfSamples batch inserts performance samples
-func (r *Repository) InsertPerfSamples(ctx context.Context, samples []models.PerfSample) error {
+func (r *Repository) InsertPerfSamples(ctx context.Context, samples []models.PerfSample) (err error) {
 	if len(samples) == 0 {
 		return nil
 	}
+	defer func(start time.Time) { metrics.ObserveInsert("apm_perf_samples", len(samples), start, err) }(time.Now())
 
 	batch, err := r.client.conn.PrepareBatch(ctx, "INSERT INTO apm_perf_samples")
 	if err != nil {
@@ -43,7 +45,12 @@ func (r *Repository) InsertPerfSamples(ctx context.Context, samples []models.Per
 	}
 
 	for _, s := range samples {
+		weight := s.SampleWeight
+		if weight == 0 {
+			weight = 1
+		}
 		err := batch.Append(
+			s.AppID,
 			s.Timestamp,
 			s.AppVersion,
 			s.Platform,
@@ -57,6 +64,7 @@ func (r *Repository) InsertPerfSamples(ctx context.Context, samples []models.Per
 			s.MainThreadMs,
 			s.GCAllocKB,
 			s.MemMB,
+			weight,
 		)
 		if err != nil {
 			return fmt.Errorf("append to batch: %w", err)
@@ -67,10 +75,11 @@ func (r *Repository) InsertPerfSamples(ctx context.Context, samples []models.Per
 }
 
 // InsertJanks batch inserts jank events
-func (r *Repository) InsertJanks(ctx context.Context, janks []models.Jank) error {
+func (r *Repository) InsertJanks(ctx context.Context, janks []models.Jank) (err error) {
 	if len(janks) == 0 {
 		return nil
 	}
+	defer func(start time.Time) { metrics.ObserveInsert("apm_janks", len(janks), start, err) }(time.Now())
 
 	batch, err := r.client.conn.PrepareBatch(ctx, "INSERT INTO apm_janks")
 	if err != nil {
@@ -79,6 +88,7 @@ func (r *Repository) InsertJanks(ctx context.Context, janks []models.Jank) error
 
 	for _, j := range janks {
 		err := batch.Append(
+			j.AppID,
 			j.Timestamp,
 			j.AppVersion,
 			j.Platform,
@@ -102,10 +112,11 @@ func (r *Repository) InsertJanks(ctx context.Context, janks []models.Jank) error
 }
 
 // InsertStartups batch inserts startup events
-func (r *Repository) InsertStartups(ctx context.Context, startups []models.Startup) error {
+func (r *Repository) InsertStartups(ctx context.Context, startups []models.Startup) (err error) {
 	if len(startups) == 0 {
 		return nil
 	}
+	defer func(start time.Time) { metrics.ObserveInsert("apm_startups", len(startups), start, err) }(time.Now())
 
 	batch, err := r.client.conn.PrepareBatch(ctx, "INSERT INTO apm_startups")
 	if err != nil {
@@ -114,6 +125,7 @@ func (r *Repository) InsertStartups(ctx context.Context, startups []models.Start
 
 	for _, s := range startups {
 		err := batch.Append(
+			s.AppID,
 			s.Timestamp,
 			s.AppVersion,
 			s.Platform,
@@ -134,10 +146,11 @@ func (r *Repository) InsertStartups(ctx context.Context, startups []models.Start
 }
 
 // InsertSceneLoads batch inserts scene load events
-func (r *Repository) InsertSceneLoads(ctx context.Context, loads []models.SceneLoad) error {
+func (r *Repository) InsertSceneLoads(ctx context.Context, loads []models.SceneLoad) (err error) {
 	if len(loads) == 0 {
 		return nil
 	}
+	defer func(start time.Time) { metrics.ObserveInsert("apm_scene_loads", len(loads), start, err) }(time.Now())
 
 	batch, err := r.client.conn.PrepareBatch(ctx, "INSERT INTO apm_scene_loads")
 	if err != nil {
@@ -146,6 +159,7 @@ func (r *Repository) InsertSceneLoads(ctx context.Context, loads []models.SceneL
 
 	for _, l := range loads {
 		err := batch.Append(
+			l.AppID,
 			l.Timestamp,
 			l.AppVersion,
 			l.Platform,
@@ -165,10 +179,11 @@ func (r *Repository) InsertSceneLoads(ctx context.Context, loads []models.SceneL
 }
 
 // InsertExceptions batch inserts exception events
-func (r *Repository) InsertExceptions(ctx context.Context, exceptions []models.Exception) error {
+func (r *Repository) InsertExceptions(ctx context.Context, exceptions []models.Exception) (err error) {
 	if len(exceptions) == 0 {
 		return nil
 	}
+	defer func(start time.Time) { metrics.ObserveInsert("apm_exceptions", len(exceptions), start, err) }(time.Now())
 
 	batch, err := r.client.conn.PrepareBatch(ctx, "INSERT INTO apm_exceptions")
 	if err != nil {
@@ -177,6 +192,7 @@ func (r *Repository) InsertExceptions(ctx context.Context, exceptions []models.E
 
 	for _, e := range exceptions {
 		err := batch.Append(
+			e.AppID,
 			e.Timestamp,
 			e.AppVersion,
 			e.Platform,
@@ -199,10 +215,11 @@ func (r *Repository) InsertExceptions(ctx context.Context, exceptions []models.E
 }
 
 // InsertCrashes batch inserts crash events
-func (r *Repository) InsertCrashes(ctx context.Context, crashes []models.Crash) error {
+func (r *Repository) InsertCrashes(ctx context.Context, crashes []models.Crash) (err error) {
 	if len(crashes) == 0 {
 		return nil
 	}
+	defer func(start time.Time) { metrics.ObserveInsert("apm_crashes", len(crashes), start, err) }(time.Now())
 
 	batch, err := r.client.conn.PrepareBatch(ctx, "INSERT INTO apm_crashes")
 	if err != nil {
@@ -211,6 +228,7 @@ func (r *Repository) InsertCrashes(ctx context.Context, crashes []models.Crash)
 
 	for _, c := range crashes {
 		err := batch.Append(
+			c.AppID,
 			c.Timestamp,
 			c.AppVersion,
 			c.Platform,
@@ -232,45 +250,71 @@ func (r *Repository) InsertCrashes(ctx context.Context, crashes []models.Crash)
 	return batch.Send()
 }
 
+// InsertSessions batch inserts session fragments
+func (r *Repository) InsertSessions(ctx context.Context, sessions []models.Session) (err error) {
+	if len(sessions) == 0 {
+		return nil
+	}
+	defer func(start time.Time) { metrics.ObserveInsert("apm_sessions", len(sessions), start, err) }(time.Now())
+
+	batch, err := r.client.conn.PrepareBatch(ctx, "INSERT INTO apm_sessions")
+	if err != nil {
+		return fmt.Errorf("prepare batch: %w", err)
+	}
+
+	for _, s := range sessions {
+		scenes := s.Scenes
+		if scenes == nil {
+			scenes = []string{}
+		}
+		err := batch.Append(
+			s.AppID,
+			s.SessionID,
+			s.DeviceID,
+			s.UserID,
+			s.AppVersion,
+			s.Platform,
+			s.DeviceModel,
+			s.OSVersion,
+			s.StartTime,
+			s.EndTime,
+			scenes,
+			s.EventCount,
+			s.CrashCount,
+			s.ExceptionCount,
+			s.JankCount,
+			s.EndedByCrash,
+		)
+		if err != nil {
+			return fmt.Errorf("append to batch: %w", err)
+		}
+	}
+
+	return batch.Send()
+}
+
 // Query methods
 
 func (r *Repository) QueryFPSMetrics(ctx context.Context, filter models.QueryFilter) ([]models.FPSMetrics, error) {
-	query := `
-		SELECT
-			app_version,
-			platform,
-			scene,
-			count() as count,
-			toFloat64(avg(fps)) as avg_fps,
-			toFloat64(quantile(0.5)(fps)) as p50_fps,
-			toFloat64(quantile(0.9)(fps)) as p90_fps,
-			toFloat64(quantile(0.95)(fps)) as p95_fps,
-			toFloat64(quantile(0.99)(fps)) as p99_fps
-		FROM apm_perf_samples
-		WHERE timestamp >= ? AND timestamp <= ?
-	`
-	args := []interface{}{filter.StartTime, filter.EndTime}
-
-	if filter.AppVersion != "" {
-		query += " AND app_version = ?"
-		args = append(args, filter.AppVersion)
-	}
-	if filter.Platform != "" {
-		query += " AND platform = ?"
-		args = append(args, filter.Platform)
-	}
-	if filter.Scene != "" {
-		query += " AND scene = ?"
-		args = append(args, filter.Scene)
-	}
-
-	query += " GROUP BY app_version, platform, scene ORDER BY count DESC"
-
+	q := filterQuery(tablePerfSamples, filter).
+		Select(
+			"app_version",
+			"platform",
+			"scene",
+			"toUInt64(round(sum(sample_weight))) as count",
+			"toFloat64(avgWeighted(fps, sample_weight)) as avg_fps",
+			"toFloat64("+quantileOf("0.5", "fps", "sample_weight")+") as p50_fps",
+			"toFloat64("+quantileOf("0.9", "fps", "sample_weight")+") as p90_fps",
+			"toFloat64("+quantileOf("0.95", "fps", "sample_weight")+") as p95_fps",
+			"toFloat64("+quantileOf("0.99", "fps", "sample_weight")+") as p99_fps",
+		).
+		GroupBy("app_version", "platform", "scene").
+		OrderBy("count DESC")
 	if filter.Limit > 0 {
-		query += fmt.Sprintf(" LIMIT %d", filter.Limit)
+		q.Limit(filter.Limit)
 	}
 
-	rows, err := r.client.conn.Query(ctx, query, args...)
+	rows, err := r.query(ctx, q)
 	if err != nil {
 		return nil, err
 	}
@@ -299,38 +343,25 @@ func (r *Repository) QueryFPSMetrics(ctx context.Context, filter models.QueryFil
 }
 
 func (r *Repository) QueryStartupMetrics(ctx context.Context, filter models.QueryFilter) ([]models.StartupMetrics, error) {
-	query := `
-		SELECT
-			app_version,
-			platform,
-			count() as count,
-			toFloat64(avg(phase1_ms)) as avg_phase1,
-			toFloat64(avg(phase2_ms)) as avg_phase2,
-			toFloat64(avg(tti_ms)) as avg_tti,
-			toFloat64(quantile(0.5)(phase1_ms + phase2_ms + tti_ms)) as p50_total,
-			toFloat64(quantile(0.95)(phase1_ms + phase2_ms + tti_ms)) as p95_total,
-			toFloat64(quantile(0.99)(phase1_ms + phase2_ms + tti_ms)) as p99_total
-		FROM apm_startups
-		WHERE timestamp >= ? AND timestamp <= ?
-	`
-	args := []interface{}{filter.StartTime, filter.EndTime}
-
-	if filter.AppVersion != "" {
-		query += " AND app_version = ?"
-		args = append(args, filter.AppVersion)
-	}
-	if filter.Platform != "" {
-		query += " AND platform = ?"
-		args = append(args, filter.Platform)
-	}
-
-	query += " GROUP BY app_version, platform ORDER BY count DESC"
-
+	q := filterQuery(tableStartups, filter).
+		Select(
+			"app_version",
+			"platform",
+			"count() as count",
+			"toFloat64(avg(phase1_ms)) as avg_phase1",
+			"toFloat64(avg(phase2_ms)) as avg_phase2",
+			"toFloat64(avg(tti_ms)) as avg_tti",
+			"toFloat64(quantile(0.5)(phase1_ms + phase2_ms + tti_ms)) as p50_total",
+			"toFloat64(quantile(0.95)(phase1_ms + phase2_ms + tti_ms)) as p95_total",
+			"toFloat64(quantile(0.99)(phase1_ms + phase2_ms + tti_ms)) as p99_total",
+		).
+		GroupBy("app_version", "platform").
+		OrderBy("count DESC")
 	if filter.Limit > 0 {
-		query += fmt.Sprintf(" LIMIT %d", filter.Limit)
+		q.Limit(filter.Limit)
 	}
 
-	rows, err := r.client.conn.Query(ctx, query, args...)
+	rows, err := r.query(ctx, q)
 	if err != nil {
 		return nil, err
 	}
@@ -359,40 +390,23 @@ func (r *Repository) QueryStartupMetrics(ctx context.Context, filter models.Quer
 }
 
 func (r *Repository) QueryJankMetrics(ctx context.Context, filter models.QueryFilter) ([]models.JankMetrics, error) {
-	query := `
-		SELECT
-			app_version,
-			platform,
-			scene,
-			count() as count,
-			toFloat64(avg(duration_ms)) as avg_duration,
-			toFloat64(max(max_frame_ms)) as max_duration,
-			uniqExact(session_id) as session_count
-		FROM apm_janks
-		WHERE timestamp >= ? AND timestamp <= ?
-	`
-	args := []interface{}{filter.StartTime, filter.EndTime}
-
-	if filter.AppVersion != "" {
-		query += " AND app_version = ?"
-		args = append(args, filter.AppVersion)
-	}
-	if filter.Platform != "" {
-		query += " AND platform = ?"
-		args = append(args, filter.Platform)
-	}
-	if filter.Scene != "" {
-		query += " AND scene = ?"
-		args = append(args, filter.Scene)
-	}
-
-	query += " GROUP BY app_version, platform, scene ORDER BY count DESC"
-
+	q := filterQuery(tableJanks, filter).
+		Select(
+			"app_version",
+			"platform",
+			"scene",
+			"count() as count",
+			"toFloat64(avg(duration_ms)) as avg_duration",
+			"toFloat64(max(max_frame_ms)) as max_duration",
+			"uniqExact(session_id) as session_count",
+		).
+		GroupBy("app_version", "platform", "scene").
+		OrderBy("count DESC")
 	if filter.Limit > 0 {
-		query += fmt.Sprintf(" LIMIT %d", filter.Limit)
+		q.Limit(filter.Limit)
 	}
 
-	rows, err := r.client.conn.Query(ctx, query, args...)
+	rows, err := r.query(ctx, q)
 	if err != nil {
 		return nil, err
 	}
@@ -419,38 +433,25 @@ func (r *Repository) QueryJankMetrics(ctx context.Context, filter models.QueryFi
 }
 
 func (r *Repository) QueryExceptions(ctx context.Context, filter models.QueryFilter) ([]models.ExceptionSummary, error) {
-	query := `
-		SELECT
-			fingerprint,
-			any(message) as message,
-			app_version,
-			platform,
-			sum(count) as count,
-			uniqExact(session_id) as session_count,
-			min(timestamp) as first_seen,
-			max(timestamp) as last_seen,
-			any(stack) as sample_stack
-		FROM apm_exceptions
-		WHERE timestamp >= ? AND timestamp <= ?
-	`
-	args := []interface{}{filter.StartTime, filter.EndTime}
-
-	if filter.AppVersion != "" {
-		query += " AND app_version = ?"
-		args = append(args, filter.AppVersion)
-	}
-	if filter.Platform != "" {
-		query += " AND platform = ?"
-		args = append(args, filter.Platform)
-	}
-
-	query += " GROUP BY fingerprint, app_version, platform ORDER BY count DESC"
-
+	q := filterQuery(tableExceptions, filter).
+		Select(
+			"fingerprint",
+			"any(message) as message",
+			"app_version",
+			"platform",
+			"sum(count) as count",
+			"uniqExact(session_id) as session_count",
+			"min(timestamp) as first_seen",
+			"max(timestamp) as last_seen",
+			"any(stack) as sample_stack",
+		).
+		GroupBy("fingerprint", "app_version", "platform").
+		OrderBy("count DESC")
 	if filter.Limit > 0 {
-		query += fmt.Sprintf(" LIMIT %d", filter.Limit)
+		q.Limit(filter.Limit)
 	}
 
-	rows, err := r.client.conn.Query(ctx, query, args...)
+	rows, err := r.query(ctx, q)
 	if err != nil {
 		return nil, err
 	}
@@ -479,38 +480,25 @@ func (r *Repository) QueryExceptions(ctx context.Context, filter models.QueryFil
 }
 
 func (r *Repository) QueryCrashes(ctx context.Context, filter models.QueryFilter) ([]models.CrashSummary, error) {
-	query := `
-		SELECT
-			fingerprint,
-			any(crash_type) as crash_type,
-			app_version,
-			platform,
-			count() as count,
-			uniqExact(session_id) as session_count,
-			min(timestamp) as first_seen,
-			max(timestamp) as last_seen,
-			any(stack) as sample_stack
-		FROM apm_crashes
-		WHERE timestamp >= ? AND timestamp <= ?
-	`
-	args := []interface{}{filter.StartTime, filter.EndTime}
-
-	if filter.AppVersion != "" {
-		query += " AND app_version = ?"
-		args = append(args, filter.AppVersion)
-	}
-	if filter.Platform != "" {
-		query += " AND platform = ?"
-		args = append(args, filter.Platform)
-	}
-
-	query += " GROUP BY fingerprint, app_version, platform ORDER BY count DESC"
-
+	q := filterQuery(tableCrashes, filter).
+		Select(
+			"fingerprint",
+			"any(crash_type) as crash_type",
+			"app_version",
+			"platform",
+			"count() as count",
+			"uniqExact(session_id) as session_count",
+			"min(timestamp) as first_seen",
+			"max(timestamp) as last_seen",
+			"any(stack) as sample_stack",
+		).
+		GroupBy("fingerprint", "app_version", "platform").
+		OrderBy("count DESC")
 	if filter.Limit > 0 {
-		query += fmt.Sprintf(" LIMIT %d", filter.Limit)
+		q.Limit(filter.Limit)
 	}
 
-	rows, err := r.client.conn.Query(ctx, query, args...)
+	rows, err := r.query(ctx, q)
 	if err != nil {
 		return nil, err
 	}
@@ -538,35 +526,17 @@ func (r *Repository) QueryCrashes(ctx context.Context, filter models.QueryFilter
 	return results, nil
 }
 
-// buildWhereClause is a helper to build WHERE clauses with filters
-func buildWhereClause(filter models.QueryFilter) (string, []interface{}) {
-	var conditions []string
-	var args []interface{}
-
-	conditions = append(conditions, "timestamp >= ?")
-	args = append(args, filter.StartTime)
-	conditions = append(conditions, "timestamp <= ?")
-	args = append(args, filter.EndTime)
-
-	if filter.AppVersion != "" {
-		conditions = append(conditions, "app_version = ?")
-		args = append(args, filter.AppVersion)
-	}
-	if filter.Platform != "" {
-		conditions = append(conditions, "platform = ?")
-		args = append(args, filter.Platform)
-	}
-	if filter.DeviceModel != "" {
-		conditions = append(conditions, "device_model = ?")
-		args = append(args, filter.DeviceModel)
-	}
-	if filter.Scene != "" {
-		conditions = append(conditions, "scene = ?")
-		args = append(args, filter.Scene)
-	}
-
-	return "WHERE " + strings.Join(conditions, " AND "), args
+// filterQuery starts a query of t restricted by filter. Filters on a
+// column t does not have are ignored.
+func filterQuery(t table, filter models.QueryFilter) *selectQuery {
+	q := newQuery(t).
+		Between("timestamp", filter.StartTime, filter.EndTime).
+		Filter("app_id", filter.AppID).
+		Filter("app_version", filter.AppVersion).
+		Filter("platform", filter.Platform).
+		Filter("device_model", filter.DeviceModel)
+	if slices.Contains(tableColumns[t], "scene") {
+		q.Filter("scene", filter.Scene)
+	}
+	return q
 }
-
-// Ensure time import is used
-var _ = time.Now
@@ -3,38 +3,36 @@ package storage
 import (
 	"context"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/warriorguo/ozx_apm/server/internal/models"
 )
 
+// retention is how long event tables keep rows, as set by their TTL
+const retention = 30 * 24 * time.Hour
+
 // GetDashboardSummary returns aggregated metrics for the dashboard
-func (r *Repository) GetDashboardSummary(ctx context.Context, startTime, endTime time.Time, appVersion, platform string) (*models.DashboardSummary, error) {
+func (r *Repository) GetDashboardSummary(ctx context.Context, appID string, startTime, endTime time.Time, appVersion, platform string) (*models.DashboardSummary, error) {
 	summary := &models.DashboardSummary{
 		TopVersions:  []models.VersionStats{},
 		TopPlatforms: []models.PlatformStats{},
 	}
 
-	// Build WHERE clause
-	whereClause := "WHERE timestamp >= ? AND timestamp <= ?"
-	args := []interface{}{startTime, endTime}
-
-	if appVersion != "" {
-		whereClause += " AND app_version = ?"
-		args = append(args, appVersion)
-	}
-	if platform != "" {
-		whereClause += " AND platform = ?"
-		args = append(args, platform)
+	scoped := func(t table) *selectQuery {
+		return newQuery(t).
+			Between("timestamp", startTime, endTime).
+			Filter("app_id", appID).
+			Filter("app_version", appVersion).
+			Filter("platform", platform)
 	}
 
 	// Get session count from perf_samples (unique sessions)
-	sessionQuery := fmt.Sprintf(`
-		SELECT uniqExact(session_id) as sessions, count() as events, avg(fps) as avg_fps
-		FROM apm_perf_samples %s
-	`, whereClause)
-
-	row := r.client.conn.QueryRow(ctx, sessionQuery, args...)
+	row := r.queryRow(ctx, scoped(tablePerfSamples).Select(
+		"uniqExact(session_id) as sessions",
+		"toInt64(round(sum(sample_weight))) as events",
+		"avgWeighted(fps, sample_weight) as avg_fps",
+	))
 	var events int64
 	var avgFPS float64
 	if err := row.Scan(&summary.TotalSessions, &events, &avgFPS); err == nil {
@@ -43,24 +41,16 @@ func (r *Repository) GetDashboardSummary(ctx context.Context, startTime, endTime
 	}
 
 	// Get crash count
-	crashQuery := fmt.Sprintf(`SELECT count() FROM apm_crashes %s`, whereClause)
-	row = r.client.conn.QueryRow(ctx, crashQuery, args...)
-	row.Scan(&summary.CrashCount)
+	r.queryRow(ctx, scoped(tableCrashes).Select("count()")).Scan(&summary.CrashCount)
 
 	// Get exception count
-	excQuery := fmt.Sprintf(`SELECT sum(count) FROM apm_exceptions %s`, whereClause)
-	row = r.client.conn.QueryRow(ctx, excQuery, args...)
-	row.Scan(&summary.ExceptionCount)
+	r.queryRow(ctx, scoped(tableExceptions).Select("sum(count)")).Scan(&summary.ExceptionCount)
 
 	// Get jank count
-	jankQuery := fmt.Sprintf(`SELECT count() FROM apm_janks %s`, whereClause)
-	row = r.client.conn.QueryRow(ctx, jankQuery, args...)
-	row.Scan(&summary.JankCount)
+	r.queryRow(ctx, scoped(tableJanks).Select("count()")).Scan(&summary.JankCount)
 
 	// Get avg startup time
-	startupQuery := fmt.Sprintf(`SELECT avg(phase1_ms + phase2_ms + tti_ms) FROM apm_startups %s`, whereClause)
-	row = r.client.conn.QueryRow(ctx, startupQuery, args...)
-	row.Scan(&summary.AvgStartupMs)
+	r.queryRow(ctx, scoped(tableStartups).Select("avg(phase1_ms + phase2_ms + tti_ms)")).Scan(&summary.AvgStartupMs)
 
 	// Calculate crash rate
 	if summary.TotalSessions > 0 {
@@ -68,17 +58,13 @@ func (r *Repository) GetDashboardSummary(ctx context.Context, startTime, endTime
 	}
 
 	// Get top versions
-	versionQuery := fmt.Sprintf(`
-		SELECT
-			app_version,
-			uniqExact(session_id) as session_count
-		FROM apm_perf_samples %s
-		GROUP BY app_version
-		ORDER BY session_count DESC
-		LIMIT 5
-	`, whereClause)
-
-	rows, err := r.client.conn.Query(ctx, versionQuery, args...)
+	versionQuery := scoped(tablePerfSamples).
+		Select("app_version", "uniqExact(session_id) as session_count").
+		GroupBy("app_version").
+		OrderBy("session_count DESC").
+		Limit(5)
+
+	rows, err := r.query(ctx, versionQuery)
 	if err == nil {
 		defer rows.Close()
 		for rows.Next() {
@@ -89,18 +75,13 @@ func (r *Repository) GetDashboardSummary(ctx context.Context, startTime, endTime
 	}
 
 	// Get top platforms
-	platformQuery := fmt.Sprintf(`
-		SELECT
-			platform,
-			uniqExact(session_id) as session_count,
-			avg(fps) as avg_fps
-		FROM apm_perf_samples %s
-		GROUP BY platform
-		ORDER BY session_count DESC
-		LIMIT 5
-	`, whereClause)
-
-	rows, err = r.client.conn.Query(ctx, platformQuery, args...)
+	platformQuery := scoped(tablePerfSamples).
+		Select("platform", "uniqExact(session_id) as session_count", "avgWeighted(fps, sample_weight) as avg_fps").
+		GroupBy("platform").
+		OrderBy("session_count DESC").
+		Limit(5)
+
+	rows, err = r.query(ctx, platformQuery)
 	if err == nil {
 		defer rows.Close()
 		for rows.Next() {
@@ -113,69 +94,66 @@ func (r *Repository) GetDashboardSummary(ctx context.Context, startTime, endTime
 	return summary, nil
 }
 
-// GetTimeSeries returns time series data for a metric
-func (r *Repository) GetTimeSeries(ctx context.Context, metric string, startTime, endTime time.Time, interval, appVersion, platform string) ([]models.TimeSeriesPoint, error) {
-	var query string
-	whereClause := "WHERE timestamp >= ? AND timestamp <= ?"
-	args := []interface{}{startTime, endTime}
-
-	if appVersion != "" {
-		whereClause += " AND app_version = ?"
-		args = append(args, appVersion)
-	}
-	if platform != "" {
-		whereClause += " AND platform = ?"
-		args = append(args, platform)
-	}
+// timeSeriesMetrics are the metrics of GetTimeSeries, as the table and
+// aggregate bucketed by timestamp
+var timeSeriesMetrics = map[string]struct {
+	table table
+	value string
+}{
+	"fps":          {tablePerfSamples, "avgWeighted(fps, sample_weight)"},
+	"frame_time":   {tablePerfSamples, "avgWeighted(frame_time_ms, sample_weight)"},
+	"crashes":      {tableCrashes, "count()"},
+	"crash_count":  {tableCrashes, "count()"},
+	"exceptions":   {tableExceptions, "sum(count)"},
+	"janks":        {tableJanks, "count()"},
+	"jank_count":   {tableJanks, "count()"},
+	"sessions":     {tablePerfSamples, "uniqExact(session_id)"},
+	"startup":      {tableStartups, "avg(phase1_ms + phase2_ms + tti_ms)"},
+	"startup_time": {tableStartups, "avg(phase1_ms + phase2_ms + tti_ms)"},
+}
 
-	switch metric {
-	case "fps":
-		query = fmt.Sprintf(`
-			SELECT toStartOfInterval(timestamp, INTERVAL %s) as t, avg(fps)
-			FROM apm_perf_samples %s
-			GROUP BY t ORDER BY t
-		`, interval, whereClause)
-	case "frame_time":
-		query = fmt.Sprintf(`
-			SELECT toStartOfInterval(timestamp, INTERVAL %s) as t, avg(frame_time_ms)
-			FROM apm_perf_samples %s
-			GROUP BY t ORDER BY t
-		`, interval, whereClause)
-	case "crashes", "crash_count":
-		query = fmt.Sprintf(`
-			SELECT toStartOfInterval(timestamp, INTERVAL %s) as t, count()
-			FROM apm_crashes %s
-			GROUP BY t ORDER BY t
-		`, interval, whereClause)
-	case "exceptions":
-		query = fmt.Sprintf(`
-			SELECT toStartOfInterval(timestamp, INTERVAL %s) as t, sum(count)
-			FROM apm_exceptions %s
-			GROUP BY t ORDER BY t
-		`, interval, whereClause)
-	case "janks", "jank_count":
-		query = fmt.Sprintf(`
-			SELECT toStartOfInterval(timestamp, INTERVAL %s) as t, count()
-			FROM apm_janks %s
-			GROUP BY t ORDER BY t
-		`, interval, whereClause)
-	case "sessions":
-		query = fmt.Sprintf(`
-			SELECT toStartOfInterval(timestamp, INTERVAL %s) as t, uniqExact(session_id)
-			FROM apm_perf_samples %s
-			GROUP BY t ORDER BY t
-		`, interval, whereClause)
-	case "startup", "startup_time":
-		query = fmt.Sprintf(`
-			SELECT toStartOfInterval(timestamp, INTERVAL %s) as t, avg(phase1_ms + phase2_ms + tti_ms)
-			FROM apm_startups %s
-			GROUP BY t ORDER BY t
-		`, interval, whereClause)
-	default:
-		return nil, fmt.Errorf("unknown metric: %s", metric)
-	}
+// crashFreeSeriesMetrics are the session-derived metrics of GetTimeSeries,
+// as the columns each session contributes and the rate over them. They are
+// bucketed by session start.
+var crashFreeSeriesMetrics = map[string]struct {
+	columns []string
+	value   string
+}{
+	"crash_free_sessions": {
+		[]string{"session_id", "min(start_time) as started", "sum(crash_count) as crashes"},
+		"(count() - countIf(crashes > 0)) / count() * 100",
+	},
+	"crash_free_users": {
+		[]string{"session_id", "any(device_id) as device", "min(start_time) as started", "sum(crash_count) as crashes"},
+		"(uniqExact(device) - uniqExactIf(device, crashes > 0)) / uniqExact(device) * 100",
+	},
+}
 
-	rows, err := r.client.conn.Query(ctx, query, args...)
+// GetTimeSeries returns time series data for a metric in buckets of interval
+func (r *Repository) GetTimeSeries(ctx context.Context, appID, metric string, startTime, endTime time.Time, interval time.Duration, appVersion, platform string) ([]models.TimeSeriesPoint, error) {
+	// Filters apply to the query reading the table
+	var query, table *selectQuery
+	if m, ok := timeSeriesMetrics[metric]; ok {
+		query = newQuery(m.table).
+			SelectBucket("timestamp", interval, "t").
+			Select(m.value).
+			Between("timestamp", startTime, endTime)
+		table = query
+	} else if m, ok := crashFreeSeriesMetrics[metric]; ok {
+		table = newQuery(tableSessions).
+			Select(m.columns...).
+			Between("start_time", startTime, endTime).
+			GroupBy("session_id")
+		query = newSubquery(table).
+			SelectBucket("started", interval, "t").
+			Select(m.value)
+	} else {
+		return nil, invalidQuery("metric", "unknown metric %q", metric)
+	}
+	table.Filter("app_id", appID).Filter("app_version", appVersion).Filter("platform", platform)
+	query.GroupBy("t").OrderBy("t")
+
+	rows, err := r.query(ctx, query)
 	if err != nil {
 		return nil, err
 	}
@@ -193,88 +171,73 @@ func (r *Repository) GetTimeSeries(ctx context.Context, metric string, startTime
 	return points, nil
 }
 
-// GetDistribution returns distribution data for a metric
-func (r *Repository) GetDistribution(ctx context.Context, metric string, startTime, endTime time.Time, appVersion, platform, scene string) (*models.DistributionResponse, error) {
-	whereClause := "WHERE timestamp >= ? AND timestamp <= ?"
-	args := []interface{}{startTime, endTime}
+// distributionMetrics are the metrics of GetDistribution, as the table,
+// the value bucketed, the count of each bucket, the weight of a row in
+// percentiles and the bucket bounds
+var distributionMetrics = map[string]struct {
+	table  table
+	value  string
+	count  string
+	weight string
+	bounds []int
+}{
+	"fps":        {tablePerfSamples, "fps", "toInt64(round(sum(sample_weight)))", "sample_weight", []int{15, 30, 45, 60}},
+	"frame_time": {tablePerfSamples, "frame_time_ms", "toInt64(round(sum(sample_weight)))", "sample_weight", []int{16, 33, 50, 100}},
+	"startup":    {tableStartups, "phase1_ms + phase2_ms + tti_ms", "count()", "", []int{1000, 2000, 3000, 5000}},
+}
 
-	if appVersion != "" {
-		whereClause += " AND app_version = ?"
-		args = append(args, appVersion)
-	}
-	if platform != "" {
-		whereClause += " AND platform = ?"
-		args = append(args, platform)
-	}
-	if scene != "" {
-		whereClause += " AND scene = ?"
-		args = append(args, scene)
+// distributionBuckets names the buckets between bounds, e.g. 0-15 and 60+,
+// and returns the expression that assigns value to one
+func distributionBuckets(value string, bounds []int) ([]string, string) {
+	buckets := make([]string, 0, len(bounds)+1)
+	branches := make([]string, 0, 2*len(bounds)+1)
+	lower := 0
+	for _, bound := range bounds {
+		name := fmt.Sprintf("%d-%d", lower, bound)
+		buckets = append(buckets, name)
+		branches = append(branches, fmt.Sprintf("%s < %d", value, bound), "'"+name+"'")
+		lower = bound
+	}
+	last := fmt.Sprintf("%d+", lower)
+	buckets = append(buckets, last)
+	branches = append(branches, "'"+last+"'")
+	return buckets, "multiIf(" + strings.Join(branches, ", ") + ")"
+}
+
+// GetDistribution returns distribution data for a metric
+func (r *Repository) GetDistribution(ctx context.Context, appID, metric string, startTime, endTime time.Time, appVersion, platform, scene string) (*models.DistributionResponse, error) {
+	m, ok := distributionMetrics[metric]
+	if !ok {
+		return nil, invalidQuery("metric", "unknown metric %q", metric)
 	}
+	buckets, bucketExpr := distributionBuckets(m.value, m.bounds)
 
-	var valueColumn, table string
-	var buckets []string
-
-	switch metric {
-	case "fps":
-		table = "apm_perf_samples"
-		valueColumn = "fps"
-		buckets = []string{"0-15", "15-30", "30-45", "45-60", "60+"}
-	case "frame_time":
-		table = "apm_perf_samples"
-		valueColumn = "frame_time_ms"
-		buckets = []string{"0-16", "16-33", "33-50", "50-100", "100+"}
-	case "startup":
-		table = "apm_startups"
-		valueColumn = "phase1_ms + phase2_ms + tti_ms"
-		buckets = []string{"0-1000", "1000-2000", "2000-3000", "3000-5000", "5000+"}
-	default:
-		return nil, fmt.Errorf("unknown metric: %s", metric)
+	scoped := func() *selectQuery {
+		return newQuery(m.table).
+			Between("timestamp", startTime, endTime).
+			Filter("app_id", appID).
+			Filter("app_version", appVersion).
+			Filter("platform", platform).
+			Filter("scene", scene)
 	}
 
 	// Get percentiles
-	pctQuery := fmt.Sprintf(`
-		SELECT
-			quantile(0.5)(%s) as p50,
-			quantile(0.9)(%s) as p90,
-			quantile(0.95)(%s) as p95,
-			quantile(0.99)(%s) as p99
-		FROM %s %s
-	`, valueColumn, valueColumn, valueColumn, valueColumn, table, whereClause)
+	pctQuery := scoped().Select(
+		quantileOf("0.5", m.value, m.weight)+" as p50",
+		quantileOf("0.9", m.value, m.weight)+" as p90",
+		quantileOf("0.95", m.value, m.weight)+" as p95",
+		quantileOf("0.99", m.value, m.weight)+" as p99",
+	)
 
 	resp := &models.DistributionResponse{Metric: metric, Buckets: []models.DistributionBucket{}}
-	row := r.client.conn.QueryRow(ctx, pctQuery, args...)
+	row := r.queryRow(ctx, pctQuery)
 	row.Scan(&resp.P50, &resp.P90, &resp.P95, &resp.P99)
 
-	// Build bucket query based on metric
-	var bucketQuery string
-	switch metric {
-	case "fps":
-		bucketQuery = fmt.Sprintf(`
-			SELECT
-				multiIf(fps < 15, '0-15', fps < 30, '15-30', fps < 45, '30-45', fps < 60, '45-60', '60+') as bucket,
-				count() as cnt
-			FROM %s %s
-			GROUP BY bucket
-		`, table, whereClause)
-	case "frame_time":
-		bucketQuery = fmt.Sprintf(`
-			SELECT
-				multiIf(frame_time_ms < 16, '0-16', frame_time_ms < 33, '16-33', frame_time_ms < 50, '33-50', frame_time_ms < 100, '50-100', '100+') as bucket,
-				count() as cnt
-			FROM %s %s
-			GROUP BY bucket
-		`, table, whereClause)
-	case "startup":
-		bucketQuery = fmt.Sprintf(`
-			SELECT
-				multiIf(%s < 1000, '0-1000', %s < 2000, '1000-2000', %s < 3000, '2000-3000', %s < 5000, '3000-5000', '5000+') as bucket,
-				count() as cnt
-			FROM %s %s
-			GROUP BY bucket
-		`, valueColumn, valueColumn, valueColumn, valueColumn, table, whereClause)
-	}
+	bucketQuery := scoped().
+		Select(bucketExpr+" as bucket", m.count+" as cnt").
+		GroupBy("bucket")
 
-	rows, err := r.client.conn.Query(ctx, bucketQuery, args...)
+	rows, err := r.query(ctx, bucketQuery)
 	if err != nil {
 		return resp, nil
 	}
@@ -307,17 +270,17 @@ func (r *Repository) GetDistribution(ctx context.Context, metric string, startTi
 	return resp, nil
 }
 
-// GetAppVersions returns list of app versions
-func (r *Repository) GetAppVersions(ctx context.Context) ([]string, error) {
-	query := `
-		SELECT DISTINCT app_version
-		FROM apm_perf_samples
-		WHERE timestamp >= now() - INTERVAL 30 DAY
-		ORDER BY app_version DESC
-		LIMIT 50
-	`
-
-	rows, err := r.client.conn.Query(ctx, query)
+// GetAppVersions returns list of app versions, most recently released first
+func (r *Repository) GetAppVersions(ctx context.Context, appID string) ([]string, error) {
+	query := newQuery(tablePerfSamples).
+		Select("app_version").
+		WithinLast("timestamp", retention).
+		Filter("app_id", appID).
+		GroupBy("app_version").
+		OrderBy("min(timestamp) DESC").
+		Limit(50)
+
+	rows, err := r.query(ctx, query)
 	if err != nil {
 		return nil, err
 	}
@@ -334,24 +297,18 @@ func (r *Repository) GetAppVersions(ctx context.Context) ([]string, error) {
 }
 
 // GetScenes returns list of scenes
-func (r *Repository) GetScenes(ctx context.Context, appVersion string) ([]string, error) {
-	whereClause := "WHERE timestamp >= now() - INTERVAL 30 DAY"
-	var args []interface{}
-
-	if appVersion != "" {
-		whereClause += " AND app_version = ?"
-		args = append(args, appVersion)
-	}
-
-	query := fmt.Sprintf(`
-		SELECT DISTINCT scene
-		FROM apm_perf_samples
-		%s AND scene != ''
-		ORDER BY scene
-		LIMIT 100
-	`, whereClause)
-
-	rows, err := r.client.conn.Query(ctx, query, args...)
+func (r *Repository) GetScenes(ctx context.Context, appID, appVersion string) ([]string, error) {
+	query := newQuery(tablePerfSamples).
+		Distinct().
+		Select("scene").
+		WithinLast("timestamp", retention).
+		Filter("app_id", appID).
+		Filter("app_version", appVersion).
+		Where("scene != ''").
+		OrderBy("scene").
+		Limit(100)
+
+	rows, err := r.query(ctx, query)
 	if err != nil {
 		return nil, err
 	}
@@ -367,126 +324,60 @@ func (r *Repository) GetScenes(ctx context.Context, appVersion string) ([]string
 	return scenes, nil
 }
 
-// GetCrashGroups returns grouped crash data
-func (r *Repository) GetCrashGroups(ctx context.Context, startTime, endTime time.Time, appVersion, platform string, page, pageSize int) ([]models.CrashGroup, int64, error) {
-	whereClause := "WHERE timestamp >= ? AND timestamp <= ?"
-	args := []interface{}{startTime, endTime}
-
-	if appVersion != "" {
-		whereClause += " AND app_version = ?"
-		args = append(args, appVersion)
-	}
-	if platform != "" {
-		whereClause += " AND platform = ?"
-		args = append(args, platform)
-	}
-
-	// Get total count
-	countQuery := fmt.Sprintf(`SELECT count(DISTINCT fingerprint) FROM apm_crashes %s`, whereClause)
-	var totalCount int64
-	r.client.conn.QueryRow(ctx, countQuery, args...).Scan(&totalCount)
-
-	// Get crash groups
-	offset := (page - 1) * pageSize
-	query := fmt.Sprintf(`
-		SELECT
-			fingerprint,
-			any(crash_type) as crash_type,
-			count() as cnt,
-			uniqExact(session_id) as session_count,
-			min(timestamp) as first_seen,
-			max(timestamp) as last_seen,
-			groupArray(DISTINCT app_version) as versions,
-			topK(5)(device_model) as devices
-		FROM apm_crashes
-		%s
-		GROUP BY fingerprint
-		ORDER BY cnt DESC
-		LIMIT %d OFFSET %d
-	`, whereClause, pageSize, offset)
-
-	rows, err := r.client.conn.Query(ctx, query, args...)
-	if err != nil {
-		return nil, 0, err
-	}
-	defer rows.Close()
-
-	crashes := []models.CrashGroup{}
-	for rows.Next() {
-		var c models.CrashGroup
-		var versions, devices []string
-		if err := rows.Scan(&c.Fingerprint, &c.CrashType, &c.Count, &c.SessionCount, &c.FirstSeen, &c.LastSeen, &versions, &devices); err != nil {
-			continue
-		}
-		if versions == nil {
-			versions = []string{}
-		}
-		if devices == nil {
-			devices = []string{}
-		}
-		c.AffectedVersions = versions
-		c.TopDevices = devices
-		crashes = append(crashes, c)
+// GetCrashDetail returns detailed crash information
+func (r *Repository) GetCrashDetail(ctx context.Context, appID, fingerprint string, startTime, endTime time.Time) (*models.CrashDetail, error) {
+	scoped := func() *selectQuery {
+		return newQuery(tableCrashes).
+			Where("fingerprint = ?", fingerprint).
+			Between("timestamp", startTime, endTime).
+			Filter("app_id", appID)
 	}
 
-	return crashes, totalCount, nil
-}
-
-// GetCrashDetail returns detailed crash information
-func (r *Repository) GetCrashDetail(ctx context.Context, fingerprint string, startTime, endTime time.Time) (*models.CrashDetail, error) {
 	// Get basic info and sample stack
-	query := `
-		SELECT
-			fingerprint,
-			any(crash_type),
-			any(stack),
-			count(),
-			uniqExact(session_id),
-			min(timestamp),
-			max(timestamp)
-		FROM apm_crashes
-		WHERE fingerprint = ? AND timestamp >= ? AND timestamp <= ?
-		GROUP BY fingerprint
-	`
+	query := scoped().
+		Select(
+			"fingerprint",
+			"any(crash_type)",
+			"any(stack)",
+			"count()",
+			"uniqExact(session_id)",
+			"min(timestamp)",
+			"max(timestamp)",
+		).
+		GroupBy("fingerprint")
 
 	detail := &models.CrashDetail{
-		Occurrences:  []models.CrashOccurrence{},
-		VersionDist:  []models.VersionDist{},
-		DeviceDist:   []models.DeviceDist{},
+		Occurrences: []models.CrashOccurrence{},
+		VersionDist: []models.VersionDist{},
+		DeviceDist:  []models.DeviceDist{},
 	}
-	row := r.client.conn.QueryRow(ctx, query, fingerprint, startTime, endTime)
+	row := r.queryRow(ctx, query)
 	if err := row.Scan(&detail.Fingerprint, &detail.CrashType, &detail.Stack, &detail.Count, &detail.SessionCount, &detail.FirstSeen, &detail.LastSeen); err != nil {
 		return nil, err
 	}
 
 	// Get recent occurrences
-	occQuery := `
-		SELECT timestamp, app_version, platform, device_model, os_version, scene, breadcrumbs
-		FROM apm_crashes
-		WHERE fingerprint = ? AND timestamp >= ? AND timestamp <= ?
-		ORDER BY timestamp DESC
-		LIMIT 10
-	`
-
-	rows, err := r.client.conn.Query(ctx, occQuery, fingerprint, startTime, endTime)
+	occQuery := scoped().
+		Select("timestamp", "app_version", "platform", "device_model", "os_version", "scene", "session_id", "breadcrumbs").
+		OrderBy("timestamp DESC").
+		Limit(10)
+
+	rows, err := r.query(ctx, occQuery)
 	if err == nil {
 		defer rows.Close()
 		for rows.Next() {
 			var occ models.CrashOccurrence
-			rows.Scan(&occ.Timestamp, &occ.AppVersion, &occ.Platform, &occ.DeviceModel, &occ.OSVersion, &occ.Scene, &occ.Breadcrumbs)
+			rows.Scan(&occ.Timestamp, &occ.AppVersion, &occ.Platform, &occ.DeviceModel, &occ.OSVersion, &occ.Scene, &occ.SessionID, &occ.Breadcrumbs)
 			detail.Occurrences = append(detail.Occurrences, occ)
 		}
 	}
 
 	// Get version distribution
-	versionQuery := `
-		SELECT app_version, count() as cnt
-		FROM apm_crashes
-		WHERE fingerprint = ? AND timestamp >= ? AND timestamp <= ?
-		GROUP BY app_version
-		ORDER BY cnt DESC
-	`
-	rows, err = r.client.conn.Query(ctx, versionQuery, fingerprint, startTime, endTime)
+	versionQuery := scoped().
+		Select("app_version", "count() as cnt").
+		GroupBy("app_version").
+		OrderBy("cnt DESC")
+	rows, err = r.query(ctx, versionQuery)
 	if err == nil {
 		defer rows.Close()
 		for rows.Next() {
@@ -497,15 +388,12 @@ func (r *Repository) GetCrashDetail(ctx context.Context, fingerprint string, sta
 	}
 
 	// Get device distribution
-	deviceQuery := `
-		SELECT device_model, count() as cnt
-		FROM apm_crashes
-		WHERE fingerprint = ? AND timestamp >= ? AND timestamp <= ?
-		GROUP BY device_model
-		ORDER BY cnt DESC
-		LIMIT 10
-	`
-	rows, err = r.client.conn.Query(ctx, deviceQuery, fingerprint, startTime, endTime)
+	deviceQuery := scoped().
+		Select("device_model", "count() as cnt").
+		GroupBy("device_model").
+		OrderBy("cnt DESC").
+		Limit(10)
+	rows, err = r.query(ctx, deviceQuery)
 	if err == nil {
 		defer rows.Close()
 		for rows.Next() {
@@ -517,57 +405,3 @@ func (r *Repository) GetCrashDetail(ctx context.Context, fingerprint string, sta
 
 	return detail, nil
 }
-
-// GetExceptionGroups returns grouped exception data
-func (r *Repository) GetExceptionGroups(ctx context.Context, startTime, endTime time.Time, appVersion, platform string, page, pageSize int) ([]models.ExceptionGroup, int64, error) {
-	whereClause := "WHERE timestamp >= ? AND timestamp <= ?"
-	args := []interface{}{startTime, endTime}
-
-	if appVersion != "" {
-		whereClause += " AND app_version = ?"
-		args = append(args, appVersion)
-	}
-	if platform != "" {
-		whereClause += " AND platform = ?"
-		args = append(args, platform)
-	}
-
-	// Get total count
-	countQuery := fmt.Sprintf(`SELECT count(DISTINCT fingerprint) FROM apm_exceptions %s`, whereClause)
-	var totalCount int64
-	r.client.conn.QueryRow(ctx, countQuery, args...).Scan(&totalCount)
-
-	// Get exception groups
-	offset := (page - 1) * pageSize
-	query := fmt.Sprintf(`
-		SELECT
-			fingerprint,
-			any(message) as message,
-			sum(count) as cnt,
-			uniqExact(session_id) as session_count,
-			min(timestamp) as first_seen,
-			max(timestamp) as last_seen
-		FROM apm_exceptions
-		%s
-		GROUP BY fingerprint
-		ORDER BY cnt DESC
-		LIMIT %d OFFSET %d
-	`, whereClause, pageSize, offset)
-
-	rows, err := r.client.conn.Query(ctx, query, args...)
-	if err != nil {
-		return nil, 0, err
-	}
-	defer rows.Close()
-
-	exceptions := []models.ExceptionGroup{}
-	for rows.Next() {
-		var e models.ExceptionGroup
-		if err := rows.Scan(&e.Fingerprint, &e.Message, &e.Count, &e.SessionCount, &e.FirstSeen, &e.LastSeen); err != nil {
-			continue
-		}
-		exceptions = append(exceptions, e)
-	}
-
-	return exceptions, totalCount, nil
-}
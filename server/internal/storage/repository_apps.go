@@ -0,0 +1,156 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/warriorguo/ozx_apm/server/internal/models"
+)
+
+// SaveApp inserts a new version of an app row
+func (r *Repository) SaveApp(ctx context.Context, app models.App) error {
+	batch, err := r.client.conn.PrepareBatch(ctx, "INSERT INTO apm_apps")
+	if err != nil {
+		return fmt.Errorf("prepare batch: %w", err)
+	}
+
+	if err := batch.Append(app.ID, app.Name, app.CreatedAt, time.Now()); err != nil {
+		return fmt.Errorf("append to batch: %w", err)
+	}
+
+	return batch.Send()
+}
+
+// ListApps returns all apps ordered by ID
+func (r *Repository) ListApps(ctx context.Context) ([]models.App, error) {
+	query := newQuery(tableApps).
+		Final().
+		Select("id", "name", "created_at").
+		OrderBy("id")
+
+	rows, err := r.query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	apps := []models.App{}
+	for rows.Next() {
+		var a models.App
+		if err := rows.Scan(&a.ID, &a.Name, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		apps = append(apps, a)
+	}
+
+	return apps, rows.Err()
+}
+
+// GetApp returns an app, or nil if it does not exist
+func (r *Repository) GetApp(ctx context.Context, id string) (*models.App, error) {
+	query := newQuery(tableApps).
+		Final().
+		Select("id", "name", "created_at").
+		Where("id = ?", id)
+
+	rows, err := r.query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	var a models.App
+	if err := rows.Scan(&a.ID, &a.Name, &a.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// SaveAPIKey inserts a new version of an API key row
+func (r *Repository) SaveAPIKey(ctx context.Context, key models.APIKey) error {
+	batch, err := r.client.conn.PrepareBatch(ctx, "INSERT INTO apm_api_keys")
+	if err != nil {
+		return fmt.Errorf("prepare batch: %w", err)
+	}
+
+	err = batch.Append(
+		key.ID,
+		key.AppID,
+		key.Label,
+		key.Prefix,
+		key.Hash,
+		key.CreatedAt,
+		key.ExpiresAt,
+		key.RevokedAt,
+		time.Now(),
+	)
+	if err != nil {
+		return fmt.Errorf("append to batch: %w", err)
+	}
+
+	return batch.Send()
+}
+
+// ListAPIKeys returns the API keys of an app, or of all apps if appID is
+// empty, including expired and revoked keys
+func (r *Repository) ListAPIKeys(ctx context.Context, appID string) ([]models.APIKey, error) {
+	query := newQuery(tableAPIKeys).
+		Final().
+		Select(apiKeyColumns...).
+		Filter("app_id", appID).
+		OrderBy("app_id", "created_at")
+
+	rows, err := r.query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+
+	return keys, rows.Err()
+}
+
+// GetAPIKey returns an app's API key, or nil if it does not exist
+func (r *Repository) GetAPIKey(ctx context.Context, appID, keyID string) (*models.APIKey, error) {
+	query := newQuery(tableAPIKeys).
+		Final().
+		Select(apiKeyColumns...).
+		Where("app_id = ?", appID).
+		Where("id = ?", keyID)
+
+	rows, err := r.query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	k, err := scanAPIKey(rows)
+	if err != nil {
+		return nil, err
+	}
+	return &k, nil
+}
+
+// apiKeyColumns are the columns scanAPIKey reads
+var apiKeyColumns = []string{"id", "app_id", "label", "prefix", "key_hash", "created_at", "expires_at", "revoked_at"}
+
+func scanAPIKey(row rowScanner) (models.APIKey, error) {
+	var k models.APIKey
+	err := row.Scan(&k.ID, &k.AppID, &k.Label, &k.Prefix, &k.Hash, &k.CreatedAt, &k.ExpiresAt, &k.RevokedAt)
+	return k, err
+}
@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/warriorguo/ozx_apm/server/internal/models"
+)
+
+// SaveAuditEntry records a mutating admin request
+func (r *Repository) SaveAuditEntry(ctx context.Context, e models.AuditEntry) error {
+	batch, err := r.client.conn.PrepareBatch(ctx, "INSERT INTO apm_audit_log")
+	if err != nil {
+		return fmt.Errorf("prepare batch: %w", err)
+	}
+
+	err = batch.Append(
+		e.Timestamp,
+		e.AppID,
+		e.Username,
+		e.Method,
+		e.Path,
+		uint16(e.Status),
+		e.RemoteAddr,
+		e.RequestID,
+	)
+	if err != nil {
+		return fmt.Errorf("append to batch: %w", err)
+	}
+
+	return batch.Send()
+}
+
+// GetAuditLog returns audit entries within the time range, newest first
+func (r *Repository) GetAuditLog(ctx context.Context, appID string, startTime, endTime time.Time, limit int) ([]models.AuditEntry, error) {
+	query := newQuery(tableAuditLog).
+		Select("timestamp", "app_id", "username", "method", "path", "status", "remote_addr", "request_id").
+		Between("timestamp", startTime, endTime).
+		Filter("app_id", appID).
+		OrderBy("timestamp DESC").
+		Limit(limit)
+
+	rows, err := r.query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []models.AuditEntry{}
+	for rows.Next() {
+		var e models.AuditEntry
+		var status uint16
+		if err := rows.Scan(&e.Timestamp, &e.AppID, &e.Username, &e.Method, &e.Path, &status, &e.RemoteAddr, &e.RequestID); err != nil {
+			return nil, err
+		}
+		e.Status = int(status)
+		entries = append(entries, e)
+	}
+
+	return entries, rows.Err()
+}
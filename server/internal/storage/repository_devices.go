@@ -0,0 +1,203 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+
+	"github.com/warriorguo/ozx_apm/server/internal/models"
+)
+
+// deviceHistoryLimit caps each list in a device history
+const deviceHistoryLimit = 50
+
+// GetDeviceHistory returns everything recorded for a device within the time
+// range, or nil if the device has no data in it
+func (r *Repository) GetDeviceHistory(ctx context.Context, appID, deviceID string, startTime, endTime time.Time) (*models.DeviceHistory, error) {
+	history := &models.DeviceHistory{
+		DeviceID:   deviceID,
+		TimeRange:  models.TimeRange{Start: startTime, End: endTime},
+		UserIDs:    []string{},
+		Versions:   []models.DeviceVersion{},
+		Sessions:   []models.SessionSummary{},
+		Crashes:    []models.DeviceCrash{},
+		Exceptions: []models.DeviceException{},
+	}
+
+	sessionsIn := func() *selectQuery {
+		return newQuery(tableSessions).
+			Where("device_id = ?", deviceID).
+			Between("start_time", startTime, endTime).
+			Filter("app_id", appID)
+	}
+	eventsIn := func(t table) *selectQuery {
+		return newQuery(t).
+			Where("device_id = ?", deviceID).
+			Between("timestamp", startTime, endTime).
+			Filter("app_id", appID)
+	}
+
+	// Identity as last reported by the device
+	identityQuery := sessionsIn().Select(
+		"argMax(platform, end_time)",
+		"argMax(device_model, end_time)",
+		"argMaxIf(os_version, end_time, os_version != '')",
+		"groupUniqArrayIf(user_id, user_id != '')",
+	)
+	row := r.queryRow(ctx, identityQuery)
+	if err := row.Scan(&history.Platform, &history.DeviceModel, &history.OSVersion, &history.UserIDs); err != nil {
+		return nil, err
+	}
+
+	// Versions played
+	versionQuery := sessionsIn().
+		Select("app_version", "min(start_time)", "max(end_time)", "uniqExact(session_id)", "toInt64(sum(crash_count))").
+		GroupBy("app_version").
+		OrderBy("min(start_time) DESC")
+	err := r.queryEach(ctx, versionQuery, func(rows driver.Rows) error {
+		var v models.DeviceVersion
+		var sessions uint64
+		if err := rows.Scan(&v.Version, &v.FirstSeen, &v.LastSeen, &sessions, &v.CrashCount); err != nil {
+			return err
+		}
+		v.Sessions = int64(sessions)
+		history.Versions = append(history.Versions, v)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Recent sessions
+	sessionQuery := sessionsIn().
+		Select(sessionColumns...).
+		GroupBy("session_id").
+		OrderBy("started DESC").
+		Limit(deviceHistoryLimit)
+	err = r.queryEach(ctx, sessionQuery, func(rows driver.Rows) error {
+		s, err := scanSession(rows)
+		if err != nil {
+			return err
+		}
+		history.Sessions = append(history.Sessions, s)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Recent crashes
+	crashQuery := eventsIn(tableCrashes).
+		Select("timestamp", "app_version", "scene", "crash_type", "fingerprint", "session_id").
+		OrderBy("timestamp DESC").
+		Limit(deviceHistoryLimit)
+	err = r.queryEach(ctx, crashQuery, func(rows driver.Rows) error {
+		var c models.DeviceCrash
+		if err := rows.Scan(&c.Timestamp, &c.AppVersion, &c.Scene, &c.CrashType, &c.Fingerprint, &c.SessionID); err != nil {
+			return err
+		}
+		history.Crashes = append(history.Crashes, c)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Exceptions grouped by fingerprint
+	excQuery := eventsIn(tableExceptions).
+		Select("fingerprint", "any(message)", "toInt64(sum(count))", "max(timestamp) as last_seen").
+		GroupBy("fingerprint").
+		OrderBy("last_seen DESC").
+		Limit(deviceHistoryLimit)
+	err = r.queryEach(ctx, excQuery, func(rows driver.Rows) error {
+		var e models.DeviceException
+		if err := rows.Scan(&e.Fingerprint, &e.Message, &e.Count, &e.LastSeen); err != nil {
+			return err
+		}
+		history.Exceptions = append(history.Exceptions, e)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Performance summary
+	perf := &history.Perf
+	perfQuery := eventsIn(tablePerfSamples).Select(
+		"toInt64(round(sum(sample_weight)))",
+		"ifNotFinite(avgWeighted(fps, sample_weight), 0)",
+		"ifNotFinite(toFloat64("+quantileOf("0.5", "fps", "sample_weight")+"), 0)",
+		"ifNotFinite(avgWeighted(mem_mb, sample_weight), 0)",
+		"toFloat64(max(mem_mb))",
+	)
+	row = r.queryRow(ctx, perfQuery)
+	if err := row.Scan(&perf.Samples, &perf.AvgFPS, &perf.P50FPS, &perf.AvgMemMB, &perf.MaxMemMB); err != nil {
+		return nil, err
+	}
+
+	if err := r.queryRow(ctx, eventsIn(tableJanks).Select("toInt64(count())")).Scan(&perf.JankCount); err != nil {
+		return nil, err
+	}
+	if err := r.queryRow(ctx, eventsIn(tableStartups).Select("ifNotFinite(avg(phase1_ms + phase2_ms + tti_ms), 0)")).Scan(&perf.AvgStartupMs); err != nil {
+		return nil, err
+	}
+	if err := r.queryRow(ctx, eventsIn(tableSceneLoads).Select("ifNotFinite(avg(load_ms), 0)")).Scan(&perf.AvgSceneLoadMs); err != nil {
+		return nil, err
+	}
+
+	if deviceHistoryEmpty(history) {
+		return nil, nil
+	}
+	return history, nil
+}
+
+// FindDevicesByUser returns the devices a user_id has played on within the
+// time range, most recently active first
+func (r *Repository) FindDevicesByUser(ctx context.Context, appID, userID string, startTime, endTime time.Time) ([]models.DeviceSummary, error) {
+	query := newQuery(tableSessions).
+		Select(
+			"device_id",
+			"argMax(platform, end_time)",
+			"argMax(device_model, end_time)",
+			"argMax(app_version, end_time)",
+			"uniqExact(session_id)",
+			"toInt64(sum(crash_count))",
+			"min(start_time)",
+			"max(end_time) as last_seen",
+		).
+		Where("user_id = ?", userID).
+		Between("start_time", startTime, endTime).
+		Filter("app_id", appID).
+		GroupBy("device_id").
+		OrderBy("last_seen DESC").
+		Limit(deviceHistoryLimit)
+
+	rows, err := r.query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	devices := []models.DeviceSummary{}
+	for rows.Next() {
+		var d models.DeviceSummary
+		var sessions uint64
+		if err := rows.Scan(&d.DeviceID, &d.Platform, &d.DeviceModel, &d.LastAppVersion, &sessions, &d.CrashCount, &d.FirstSeen, &d.LastSeen); err != nil {
+			return nil, err
+		}
+		d.Sessions = int64(sessions)
+		devices = append(devices, d)
+	}
+
+	return devices, rows.Err()
+}
+
+// deviceHistoryEmpty reports whether a history has no data in any table
+func deviceHistoryEmpty(h *models.DeviceHistory) bool {
+	return len(h.Versions) == 0 &&
+		len(h.Crashes) == 0 &&
+		len(h.Exceptions) == 0 &&
+		h.Perf.Samples == 0 &&
+		h.Perf.JankCount == 0
+}
@@ -0,0 +1,303 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+
+	"github.com/warriorguo/ozx_apm/server/internal/models"
+)
+
+// groupTable describes how the events of a fingerprinted table add up to
+// a group's occurrences
+type groupTable struct {
+	table      table
+	count      string // occurrences
+	countSince string // occurrences from ? on
+}
+
+var (
+	crashGroups     = groupTable{tableCrashes, "count()", "countIf(timestamp >= ?)"}
+	exceptionGroups = groupTable{tableExceptions, "sum(count)", "sumIf(count, timestamp >= ?)"}
+)
+
+// groupSortKeys are the expressions groups are sorted by. Keys are floats,
+// so a cursor holds any of them.
+var groupSortKeys = map[string]string{
+	models.GroupSortCount:     "cnt",
+	models.GroupSortSessions:  "session_count",
+	models.GroupSortUsers:     "affected_users",
+	models.GroupSortFirstSeen: "toUnixTimestamp64Milli(first_seen)",
+	models.GroupSortLastSeen:  "toUnixTimestamp64Milli(last_seen)",
+	models.GroupSortTrend:     "trend_pct",
+}
+
+// groupCursor is the position of the last group of a page, in the list of
+// a time range and filters. Clients get it as opaque base64 JSON and only
+// hand it back.
+type groupCursor struct {
+	Sort        string  `json:"s"`
+	Order       string  `json:"o"`
+	Key         float64 `json:"k"`
+	Fingerprint string  `json:"f"`
+	Start       int64   `json:"t0"` // Unix milliseconds
+	End         int64   `json:"t1"`
+	Filters     string  `json:"h"` // groupFilters of the list
+}
+
+// groupFilters hashes the filters of a list, so a cursor cannot continue a
+// list with other filters
+func groupFilters(q models.GroupListQuery) string {
+	sum := sha256.Sum256([]byte(strings.Join([]string{q.AppID, q.AppVersion, q.Platform}, "\x00")))
+	return hex.EncodeToString(sum[:8])
+}
+
+func (c groupCursor) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeGroupCursor(s string) (groupCursor, error) {
+	var c groupCursor
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err == nil {
+		err = json.Unmarshal(data, &c)
+	}
+	if err != nil || c.Fingerprint == "" {
+		return c, invalidQuery("cursor", "malformed cursor")
+	}
+	return c, nil
+}
+
+// groupPage reads one page of a group list. Groups are ordered by their
+// sort key, then by fingerprint so ties keep their order, and a page starts
+// either at an offset or after the cursor's group. One group more than the
+// page size is read to know whether another page follows.
+type groupPage struct {
+	q      models.GroupListQuery
+	after  *groupCursor
+	rows   int
+	last   groupCursor
+	cursor string // of the next page
+}
+
+func newGroupPage(q models.GroupListQuery) (*groupPage, error) {
+	if q.Sort == "" {
+		q.Sort = models.GroupSortCount
+	}
+	if q.Order == "" {
+		q.Order = "desc"
+	}
+	if q.Page == 0 {
+		q.Page = 1
+	}
+	if _, ok := groupSortKeys[q.Sort]; !ok {
+		return nil, invalidQuery("sort", "unknown sort %q", q.Sort)
+	}
+	if q.Order != "asc" && q.Order != "desc" {
+		return nil, invalidQuery("order", "must be asc or desc")
+	}
+
+	p := &groupPage{q: q}
+	if q.Cursor != "" {
+		if q.Page > 1 {
+			return nil, invalidQuery("cursor", "cannot be combined with page")
+		}
+		c, err := decodeGroupCursor(q.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		if c.Sort != q.Sort || c.Order != q.Order {
+			return nil, invalidQuery("cursor", "was returned for sort %s %s", c.Sort, c.Order)
+		}
+		if c.Filters != groupFilters(q) {
+			return nil, invalidQuery("cursor", "was returned for other filters")
+		}
+		// A cursor continues over its list's time range, which defaults
+		// would have moved on from
+		if q.StartTime.IsZero() && q.EndTime.IsZero() {
+			q.StartTime, q.EndTime = time.UnixMilli(c.Start).UTC(), time.UnixMilli(c.End).UTC()
+		} else if q.StartTime.UnixMilli() != c.Start || q.EndTime.UnixMilli() != c.End {
+			return nil, invalidQuery("cursor", "was returned for another time range")
+		}
+		p.q = q
+		p.after = &c
+	}
+	return p, nil
+}
+
+func (p *groupPage) scoped(g groupTable) *selectQuery {
+	return newQuery(g.table).
+		Between("timestamp", p.q.StartTime, p.q.EndTime).
+		Filter("app_id", p.q.AppID).
+		Filter("app_version", p.q.AppVersion).
+		Filter("platform", p.q.Platform)
+}
+
+// query selects fingerprint, cnt, session_count, affected_users,
+// first_seen, last_seen, trend_pct, then columns, then sort_key
+func (p *groupPage) query(g groupTable, columns ...string) *selectQuery {
+	// The trend compares the occurrences of both halves of the range
+	mid := p.q.StartTime.Add(p.q.EndTime.Sub(p.q.StartTime) / 2)
+
+	query := p.scoped(g).
+		Select(
+			"fingerprint",
+			"toInt64("+g.count+") AS cnt",
+			"toInt64(uniqExact(session_id)) AS session_count",
+			"toInt64(uniqExact(device_id)) AS affected_users",
+			"min(timestamp) AS first_seen",
+			"max(timestamp) AS last_seen",
+		).
+		SelectArgs(fmt.Sprintf("round((2 * toFloat64(%[1]s) - cnt) / greatest(cnt - %[1]s, 1) * 100, 1) AS trend_pct", g.countSince), mid, mid).
+		Select(columns...).
+		Select("toFloat64(" + groupSortKeys[p.q.Sort] + ") AS sort_key").
+		GroupBy("fingerprint")
+
+	dir, cmp := "DESC", "<"
+	if p.q.Order == "asc" {
+		dir, cmp = "ASC", ">"
+	}
+	if p.after != nil {
+		query.Having("(sort_key, fingerprint) "+cmp+" (?, ?)", p.after.Key, p.after.Fingerprint)
+	} else {
+		query.Offset((p.q.Page - 1) * p.q.PageSize)
+	}
+	return query.OrderBy("sort_key "+dir, "fingerprint "+dir).Limit(p.q.PageSize + 1)
+}
+
+// add counts a scanned group and reports whether it belongs to the page.
+// The one past the page size only sets the cursor of the next page.
+func (p *groupPage) add(key float64, fingerprint string) bool {
+	p.rows++
+	if p.rows > p.q.PageSize {
+		p.cursor = p.last.encode()
+		return false
+	}
+	p.last = groupCursor{
+		Sort:        p.q.Sort,
+		Order:       p.q.Order,
+		Key:         key,
+		Fingerprint: fingerprint,
+		Start:       p.q.StartTime.UnixMilli(),
+		End:         p.q.EndTime.UnixMilli(),
+		Filters:     groupFilters(p.q),
+	}
+	return true
+}
+
+// groupTotal counts the groups of the whole list, if the query asks for it
+func (r *Repository) groupTotal(ctx context.Context, g groupTable, p *groupPage) (*int64, error) {
+	if !p.q.WithTotal {
+		return nil, nil
+	}
+	var total int64
+	if err := r.queryRow(ctx, p.scoped(g).Select("toInt64(count(DISTINCT fingerprint))")).Scan(&total); err != nil {
+		return nil, err
+	}
+	return &total, nil
+}
+
+// GetCrashGroups returns a page of crash groups. Invalid sorts and cursors
+// fail with an *InvalidQueryError.
+func (r *Repository) GetCrashGroups(ctx context.Context, q models.GroupListQuery) (*models.CrashListResponse, error) {
+	page, err := newGroupPage(q)
+	if err != nil {
+		return nil, err
+	}
+
+	query := page.query(crashGroups,
+		"any(crash_type) AS crash_type",
+		"groupArray(DISTINCT app_version) AS versions",
+		"topK(5)(device_model) AS devices",
+	)
+	crashes := []models.CrashGroup{}
+	err = r.queryEach(ctx, query, func(rows driver.Rows) error {
+		var c models.CrashGroup
+		var versions, devices []string
+		var key float64
+		if err := rows.Scan(&c.Fingerprint, &c.Count, &c.SessionCount, &c.AffectedUsers, &c.FirstSeen, &c.LastSeen, &c.TrendPct,
+			&c.CrashType, &versions, &devices, &key); err != nil {
+			return err
+		}
+		if !page.add(key, c.Fingerprint) {
+			return nil
+		}
+		if versions == nil {
+			versions = []string{}
+		}
+		if devices == nil {
+			devices = []string{}
+		}
+		c.AffectedVersions = versions
+		c.TopDevices = devices
+		crashes = append(crashes, c)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	total, err := r.groupTotal(ctx, crashGroups, page)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.CrashListResponse{
+		Crashes:    crashes,
+		TotalCount: total,
+		Page:       page.q.Page,
+		PageSize:   page.q.PageSize,
+		Sort:       page.q.Sort,
+		Order:      page.q.Order,
+		NextCursor: page.cursor,
+	}, nil
+}
+
+// GetExceptionGroups returns a page of exception groups, like
+// GetCrashGroups
+func (r *Repository) GetExceptionGroups(ctx context.Context, q models.GroupListQuery) (*models.ExceptionListResponse, error) {
+	page, err := newGroupPage(q)
+	if err != nil {
+		return nil, err
+	}
+
+	exceptions := []models.ExceptionGroup{}
+	err = r.queryEach(ctx, page.query(exceptionGroups, "any(message) AS message"), func(rows driver.Rows) error {
+		var e models.ExceptionGroup
+		var key float64
+		if err := rows.Scan(&e.Fingerprint, &e.Count, &e.SessionCount, &e.AffectedUsers, &e.FirstSeen, &e.LastSeen, &e.TrendPct,
+			&e.Message, &key); err != nil {
+			return err
+		}
+		if page.add(key, e.Fingerprint) {
+			exceptions = append(exceptions, e)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	total, err := r.groupTotal(ctx, exceptionGroups, page)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.ExceptionListResponse{
+		Exceptions: exceptions,
+		TotalCount: total,
+		Page:       page.q.Page,
+		PageSize:   page.q.PageSize,
+		Sort:       page.q.Sort,
+		Order:      page.q.Order,
+		NextCursor: page.cursor,
+	}, nil
+}
@@ -0,0 +1,118 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/warriorguo/ozx_apm/server/internal/models"
+)
+
+func TestGetExceptionGroups_Query(t *testing.T) {
+	repo, queries, args := newRecordingRepository()
+	start := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	end := start.Add(24 * time.Hour)
+	mid := start.Add(12 * time.Hour)
+	query := models.GroupListQuery{AppID: "game", Sort: models.GroupSortUsers, Order: "asc", PageSize: 20}
+	// The cursor's time range applies when the query has none
+	query.Cursor = groupCursor{
+		Sort: models.GroupSortUsers, Order: "asc", Key: 42, Fingerprint: "fp",
+		Start: start.UnixMilli(), End: end.UnixMilli(), Filters: groupFilters(query),
+	}.encode()
+
+	resp, err := repo.GetExceptionGroups(context.Background(), query)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.TotalCount != nil || resp.NextCursor != "" || resp.Sort != models.GroupSortUsers || resp.Order != "asc" {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+
+	want := "SELECT fingerprint, toInt64(sum(count)) AS cnt, toInt64(uniqExact(session_id)) AS session_count, " +
+		"toInt64(uniqExact(device_id)) AS affected_users, min(timestamp) AS first_seen, max(timestamp) AS last_seen, " +
+		"round((2 * toFloat64(sumIf(count, timestamp >= ?)) - cnt) / greatest(cnt - sumIf(count, timestamp >= ?), 1) * 100, 1) AS trend_pct, " +
+		"any(message) AS message, toFloat64(affected_users) AS sort_key " +
+		"FROM apm_exceptions WHERE timestamp >= ? AND timestamp <= ? AND app_id = ? " +
+		"GROUP BY fingerprint HAVING (sort_key, fingerprint) > (?, ?) " +
+		"ORDER BY sort_key ASC, fingerprint ASC LIMIT ?"
+	if len(*queries) != 1 || (*queries)[0] != want {
+		t.Errorf("unexpected queries:\n got: %v\nwant: %s", *queries, want)
+	}
+	wantArgs := []interface{}{mid, mid, start, end, "game", float64(42), "fp", 21}
+	if len(*args) != 1 || !reflect.DeepEqual((*args)[0], wantArgs) {
+		t.Errorf("expected args %v, got %v", wantArgs, *args)
+	}
+}
+
+func TestGroupPage_Cursor(t *testing.T) {
+	start := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	end := start.Add(24 * time.Hour)
+	query := models.GroupListQuery{AppID: "game", StartTime: start, EndTime: end, Sort: models.GroupSortLastSeen, PageSize: 2}
+	page, err := newGroupPage(query)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !page.add(3, "a") || !page.add(2, "b") {
+		t.Fatal("expected the first two groups on the page")
+	}
+	if page.cursor != "" {
+		t.Errorf("expected no cursor before the page overflows, got %q", page.cursor)
+	}
+	if page.add(1, "c") {
+		t.Error("expected the third group to be left for the next page")
+	}
+
+	next, err := newGroupPage(models.GroupListQuery{AppID: "game", Sort: models.GroupSortLastSeen, Cursor: page.cursor, PageSize: 2})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := groupCursor{
+		Sort: models.GroupSortLastSeen, Order: "desc", Key: 2, Fingerprint: "b",
+		Start: start.UnixMilli(), End: end.UnixMilli(), Filters: groupFilters(query),
+	}
+	if next.after == nil || *next.after != want {
+		t.Errorf("expected the next page after %+v, got %+v", want, next.after)
+	}
+	if !next.q.StartTime.Equal(start) || !next.q.EndTime.Equal(end) {
+		t.Errorf("expected the cursor's range, got %v to %v", next.q.StartTime, next.q.EndTime)
+	}
+}
+
+func TestGroupPage_Invalid(t *testing.T) {
+	start := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	end := start.Add(24 * time.Hour)
+	cursor := groupCursor{
+		Sort: models.GroupSortCount, Order: "desc", Key: 10, Fingerprint: "fp",
+		Start: start.UnixMilli(), End: end.UnixMilli(), Filters: groupFilters(models.GroupListQuery{AppID: "game"}),
+	}.encode()
+
+	tests := []struct {
+		name  string
+		query models.GroupListQuery
+		field string
+	}{
+		{"unknown sort", models.GroupListQuery{Sort: "stack"}, "sort"},
+		{"unknown order", models.GroupListQuery{Order: "up"}, "order"},
+		{"malformed cursor", models.GroupListQuery{Cursor: "not a cursor"}, "cursor"},
+		{"cursor of another sort", models.GroupListQuery{AppID: "game", Sort: models.GroupSortTrend, Cursor: cursor}, "cursor"},
+		{"cursor of another order", models.GroupListQuery{AppID: "game", Order: "asc", Cursor: cursor}, "cursor"},
+		{"cursor and page", models.GroupListQuery{AppID: "game", Cursor: cursor, Page: 3}, "cursor"},
+		{"cursor of another app", models.GroupListQuery{AppID: "other", Cursor: cursor}, "cursor"},
+		{"cursor of another platform", models.GroupListQuery{AppID: "game", Platform: "iOS", Cursor: cursor}, "cursor"},
+		{"cursor of another range", models.GroupListQuery{
+			AppID: "game", StartTime: start.Add(time.Hour), EndTime: end.Add(time.Hour), Cursor: cursor,
+		}, "cursor"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newGroupPage(tt.query)
+			var invalid *InvalidQueryError
+			if !errors.As(err, &invalid) || invalid.Field != tt.field {
+				t.Errorf("expected an invalid %s, got %v", tt.field, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package storage
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+
+	"github.com/warriorguo/ozx_apm/server/internal/models"
+)
+
+// jankCauseKeywords classify a jank by the events recorded before it. A
+// jank is a scene or asset load if any of its events contains one of the
+// keywords, ignoring case; loads take precedence over GC.
+var jankCauseKeywords = map[string][]string{
+	models.JankCauseSceneLoad: {"sceneload", "scene_load", "scene load", "loadscene", "load scene"},
+	models.JankCauseAssetLoad: {
+		"assetload", "asset_load", "asset load", "loadasset", "load asset", "assetbundle", "addressable",
+		"resources.load", "instantiate",
+	},
+}
+
+// jankEvent strips the time the SDK prefixes events with, as in
+// "12.34:Opened shop", so the same event ranks together across janks
+const jankEvent = "replaceRegexpOne(e, '^[0-9.]+:', '')"
+
+// jankGCColumns select the models.JankGCStats of a group of janks
+var jankGCColumns = []string{
+	"toInt64(count())",
+	"toInt64(countIf(recent_gc_count > 0))",
+	"ifNotFinite(avgIf(duration_ms, recent_gc_count > 0), 0)",
+	"ifNotFinite(avgIf(duration_ms, recent_gc_count = 0), 0)",
+	"ifNotFinite(corr(toFloat64(duration_ms), toFloat64(recent_gc_count)), 0)",
+	"ifNotFinite(corr(toFloat64(duration_ms), toFloat64(recent_gc_alloc_kb)), 0)",
+}
+
+// scanJankGC scans dest followed by jankGCColumns into gc
+func scanJankGC(scan func(dest ...interface{}) error, gc *models.JankGCStats, dest ...interface{}) error {
+	dest = append(dest, &gc.Count, &gc.WithGCCount, &gc.AvgDurationWithGC, &gc.AvgDurationWithoutGC, &gc.CorrGCCount, &gc.CorrGCAllocKB)
+	if err := scan(dest...); err != nil {
+		return err
+	}
+	gc.WithGCPct = pct(gc.WithGCCount, gc.Count)
+	return nil
+}
+
+// pct returns n as a percentage of total
+func pct(n, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) / float64(total) * 100
+}
+
+// jankEvents counts the distinct events preceding each jank of scenes,
+// keeping the top most frequent of each scene
+func jankEvents(q *selectQuery, scenes []string, top int) *selectQuery {
+	return q.
+		Select(
+			"scene",
+			"arrayJoin(arrayDistinct(arrayMap(e -> "+jankEvent+", recent_events))) AS event",
+			"toInt64(count()) AS cnt",
+		).
+		Where("has(?, scene)", scenes).
+		Where("notEmpty(recent_events)").
+		GroupBy("scene", "event").
+		OrderBy("scene", "cnt DESC", "event").
+		LimitBy(top, "scene")
+}
+
+// GetJankAnalysis classifies janks by cause, relates them to GC activity,
+// and ranks the events preceding them in the limit scenes with the most
+// janks, topEvents per scene
+func (r *Repository) GetJankAnalysis(ctx context.Context, appID string, startTime, endTime time.Time, appVersion, platform, scene string, limit, topEvents int) (*models.JankAnalysisResponse, error) {
+	scoped := func() *selectQuery {
+		return newQuery(tableJanks).
+			Between("timestamp", startTime, endTime).
+			Filter("app_id", appID).
+			Filter("app_version", appVersion).
+			Filter("platform", platform).
+			Filter("scene", scene)
+	}
+
+	resp := &models.JankAnalysisResponse{
+		Causes: []models.JankCause{},
+		Scenes: []models.JankSceneAnalysis{},
+	}
+
+	// Causes
+	var cause []string
+	var causeArgs []interface{}
+	for _, c := range []string{models.JankCauseSceneLoad, models.JankCauseAssetLoad} {
+		cause = append(cause, "arrayExists(e -> multiSearchAnyCaseInsensitive(e, ?), recent_events), '"+c+"'")
+		causeArgs = append(causeArgs, jankCauseKeywords[c])
+	}
+	cause = append(cause, "recent_gc_count > 0, '"+models.JankCauseGC+"'", "'"+models.JankCauseUnknown+"'")
+
+	causes := make(map[string]models.JankCause)
+	causeQuery := scoped().
+		SelectArgs("multiIf("+strings.Join(cause, ", ")+") AS cause", causeArgs...).
+		Select("toInt64(count())", "avg(duration_ms)").
+		GroupBy("cause")
+	err := r.queryEach(ctx, causeQuery, func(rows driver.Rows) error {
+		var c models.JankCause
+		if err := rows.Scan(&c.Cause, &c.Count, &c.AvgDurationMs); err != nil {
+			return err
+		}
+		causes[c.Cause] = c
+		resp.Total += c.Count
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range models.JankCauses {
+		c := causes[name]
+		c.Cause = name
+		c.Pct = pct(c.Count, resp.Total)
+		resp.Causes = append(resp.Causes, c)
+	}
+
+	// GC correlation, overall and per scene
+	if err := scanJankGC(r.queryRow(ctx, scoped().Select(jankGCColumns...)).Scan, &resp.GC); err != nil {
+		return nil, err
+	}
+
+	index := make(map[string]int)
+	sceneQuery := scoped().
+		Select("scene").
+		Select(jankGCColumns...).
+		Where("scene != ''").
+		GroupBy("scene").
+		OrderBy("count() DESC", "scene").
+		Limit(limit)
+	err = r.queryEach(ctx, sceneQuery, func(rows driver.Rows) error {
+		s := models.JankSceneAnalysis{TopEvents: []models.JankEventRank{}}
+		if err := scanJankGC(rows.Scan, &s.GC, &s.Scene); err != nil {
+			return err
+		}
+		index[s.Scene] = len(resp.Scenes)
+		resp.Scenes = append(resp.Scenes, s)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Scenes) == 0 {
+		return resp, nil
+	}
+
+	// Events preceding janks
+	scenes := make([]string, len(resp.Scenes))
+	for i, s := range resp.Scenes {
+		scenes[i] = s.Scene
+	}
+	err = r.queryEach(ctx, jankEvents(scoped(), scenes, topEvents), func(rows driver.Rows) error {
+		var name string
+		var e models.JankEventRank
+		if err := rows.Scan(&name, &e.Event, &e.Count); err != nil {
+			return err
+		}
+		i, ok := index[name]
+		if !ok || e.Event == "" {
+			return nil
+		}
+		e.Pct = pct(e.Count, resp.Scenes[i].GC.Count)
+		resp.Scenes[i].TopEvents = append(resp.Scenes[i].TopEvents, e)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/warriorguo/ozx_apm/server/internal/models"
+)
+
+func TestGetJankAnalysis_CauseQuery(t *testing.T) {
+	repo, queries, args := newRecordingRepository()
+	end := time.Now()
+	start := end.Add(-24 * time.Hour)
+
+	resp, err := repo.GetJankAnalysis(context.Background(), "game", start, end, "", "", "", 10, 5)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Without scenes there are no events to rank
+	if len(*queries) != 3 {
+		t.Fatalf("expected 3 queries, sent %d", len(*queries))
+	}
+	if !strings.HasPrefix((*queries)[0], "SELECT multiIf(arrayExists(e -> multiSearchAnyCaseInsensitive(e, ?), recent_events), 'scene_load', "+
+		"arrayExists(e -> multiSearchAnyCaseInsensitive(e, ?), recent_events), 'asset_load', recent_gc_count > 0, 'gc', 'unknown') AS cause") {
+		t.Errorf("unexpected cause query: %s", (*queries)[0])
+	}
+	if got := (*args)[0][:2]; !reflect.DeepEqual(got, []interface{}{jankCauseKeywords[models.JankCauseSceneLoad], jankCauseKeywords[models.JankCauseAssetLoad]}) {
+		t.Errorf("expected the cause keywords first, got %v", got)
+	}
+
+	var causes []string
+	for _, c := range resp.Causes {
+		causes = append(causes, c.Cause)
+	}
+	if !reflect.DeepEqual(causes, models.JankCauses) {
+		t.Errorf("expected every cause in order, got %v", causes)
+	}
+}
+
+func TestJankEvents(t *testing.T) {
+	query, args, err := jankEvents(newQuery(tableJanks).Filter("app_id", "game"), []string{"Battle", "Menu"}, 5).Build()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := "SELECT scene, arrayJoin(arrayDistinct(arrayMap(e -> replaceRegexpOne(e, '^[0-9.]+:', ''), recent_events))) AS event, " +
+		"toInt64(count()) AS cnt FROM apm_janks WHERE app_id = ? AND has(?, scene) AND notEmpty(recent_events) " +
+		"GROUP BY scene, event ORDER BY scene, cnt DESC, event LIMIT ? BY scene"
+	if query != want {
+		t.Errorf("unexpected query:\n got: %s\nwant: %s", query, want)
+	}
+	if !reflect.DeepEqual(args, []interface{}{"game", []string{"Battle", "Menu"}, 5}) {
+		t.Errorf("unexpected args: %v", args)
+	}
+}
+
+func TestPct(t *testing.T) {
+	if got := pct(1, 4); got != 25 {
+		t.Errorf("expected 25, got %v", got)
+	}
+	if got := pct(0, 0); got != 0 {
+		t.Errorf("expected 0 without a total, got %v", got)
+	}
+}
@@ -0,0 +1,184 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+
+	"github.com/warriorguo/ozx_apm/server/internal/models"
+)
+
+// A session is only judged with leakMinSamples memory readings, and rises
+// monotonically when memory does not drop in leakMinRisePct of its steps,
+// which tolerates the odd collection
+const (
+	leakMinSamples = 5
+	leakMinRisePct = 90
+)
+
+// memoryMinutes is a sample's time in minutes, the unit of slopes
+const memoryMinutes = "toUnixTimestamp64Milli(timestamp) / 60000"
+
+// memoryTrends groups perf samples by keys into the columns of a
+// models.MemoryTrend: samples, minutes, start_mb, end_mb, peak_mb,
+// growth_mb, slope, rise_pct and avg_gc_alloc_kb
+func memoryTrends(q *selectQuery, keys ...string) *selectQuery {
+	return q.
+		Select(keys...).
+		Select(
+			"toInt64(count()) AS samples",
+			"(toUnixTimestamp64Milli(max(timestamp)) - toUnixTimestamp64Milli(min(timestamp))) / 60000 AS minutes",
+			"toFloat64(argMin(mem_mb, timestamp)) AS start_mb",
+			"toFloat64(argMax(mem_mb, timestamp)) AS end_mb",
+			"toFloat64(max(mem_mb)) AS peak_mb",
+			"end_mb - start_mb AS growth_mb",
+			// The least squares slope of memory over time
+			"ifNotFinite(covarPop("+memoryMinutes+", mem_mb) / varPop("+memoryMinutes+"), 0) AS slope",
+			"ifNotFinite(arrayAvg(d -> d >= 0, arrayPopFront(arrayDifference(arrayMap(x -> x.2, "+
+				"arraySort(groupArray((timestamp, mem_mb))))))), 0) * 100 AS rise_pct",
+			"avg(gc_alloc_kb) AS avg_gc_alloc_kb",
+		).
+		GroupBy(keys...)
+}
+
+// leakSuspect holds for the memoryTrends rows of leak suspects, given
+// leakSuspectArgs
+const leakSuspect = "samples >= ? AND growth_mb >= ? AND rise_pct >= ?"
+
+func leakSuspectArgs(t models.MemoryLeakThresholds) []interface{} {
+	return []interface{}{t.MinSamples, t.MinGrowthMB, t.MinRisePct}
+}
+
+// GetMemoryLeaks returns the memory trends of the sessions suspected of
+// leaking, steepest first, and how many sessions of each scene and app
+// version are suspects. Crashes count as likely out of memory when their
+// session's last reading is at least highMemoryMB, or the 95th percentile
+// of readings when highMemoryMB is 0. At most limit of each are returned.
+func (r *Repository) GetMemoryLeaks(ctx context.Context, appID string, startTime, endTime time.Time, appVersion, platform, scene string, minGrowthMB, highMemoryMB float64, limit int) (*models.MemoryLeakResponse, error) {
+	scoped := func(t table) *selectQuery {
+		return newQuery(t).
+			Between("timestamp", startTime, endTime).
+			Filter("app_id", appID).
+			Filter("app_version", appVersion).
+			Filter("platform", platform)
+	}
+
+	if highMemoryMB == 0 {
+		// Without samples the quantile is NaN, which JSON cannot encode
+		query := scoped(tablePerfSamples).Select("ifNotFinite(toFloat64(" + quantileOf("0.95", "mem_mb", "sample_weight") + "), 0)")
+		if err := r.queryRow(ctx, query).Scan(&highMemoryMB); err != nil {
+			return nil, err
+		}
+	}
+
+	resp := &models.MemoryLeakResponse{
+		Thresholds: models.MemoryLeakThresholds{
+			MinSamples:   leakMinSamples,
+			MinGrowthMB:  minGrowthMB,
+			MinRisePct:   leakMinRisePct,
+			HighMemoryMB: highMemoryMB,
+		},
+		Sessions: []models.MemoryTrend{},
+		OOM:      models.OOMSignals{Groups: []models.OOMCrashGroup{}},
+	}
+	suspectArgs := leakSuspectArgs(resp.Thresholds)
+
+	// Leak suspects
+	sessions := newSubquery(memoryTrends(scoped(tablePerfSamples).Filter("scene", scene),
+		"session_id", "app_version", "platform", "device_model")).
+		Select(
+			"session_id", "app_version", "platform", "device_model", "samples", "minutes",
+			"start_mb", "end_mb", "peak_mb", "growth_mb", "slope", "rise_pct", "avg_gc_alloc_kb",
+		).
+		Where(leakSuspect, suspectArgs...).
+		OrderBy("slope DESC", "session_id").
+		Limit(limit)
+	if err := r.queryEach(ctx, sessions, func(rows driver.Rows) error {
+		var s models.MemoryTrend
+		if err := rows.Scan(&s.SessionID, &s.AppVersion, &s.Platform, &s.DeviceModel, &s.Samples, &s.DurationMin,
+			&s.StartMB, &s.EndMB, &s.PeakMB, &s.GrowthMB, &s.SlopeMBPerMin, &s.RisePct, &s.AvgGCAllocKB); err != nil {
+			return err
+		}
+		resp.Sessions = append(resp.Sessions, s)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	// Suspicion per scene and version, from the trend of each session in it
+	groups := func(key string, perf *selectQuery) ([]models.MemoryLeakGroup, error) {
+		query := newSubquery(memoryTrends(perf, "session_id", key)).
+			Select(key, "toInt64(count()) AS sessions").
+			SelectArgs("toInt64(countIf("+leakSuspect+")) AS suspects", suspectArgs...).
+			Select("avg(slope)", "quantile(0.9)(slope)", "avg(growth_mb)").
+			GroupBy(key).
+			OrderBy("suspects DESC", "sessions DESC", key).
+			Limit(limit)
+		result := []models.MemoryLeakGroup{}
+		err := r.queryEach(ctx, query, func(rows driver.Rows) error {
+			var g models.MemoryLeakGroup
+			if err := rows.Scan(&g.Name, &g.SessionCount, &g.SuspectCount, &g.AvgSlopeMBPerMin, &g.P90SlopeMBPerMin, &g.AvgGrowthMB); err != nil {
+				return err
+			}
+			g.SuspectPct = pct(g.SuspectCount, g.SessionCount)
+			result = append(result, g)
+			return nil
+		})
+		return result, err
+	}
+	var err error
+	if resp.Scenes, err = groups("scene", scoped(tablePerfSamples).Filter("scene", scene).Where("scene != ''")); err != nil {
+		return nil, err
+	}
+	if resp.Versions, err = groups("app_version", scoped(tablePerfSamples).Filter("scene", scene)); err != nil {
+		return nil, err
+	}
+
+	// Crashes after high memory or in leaking sessions, judged by the
+	// readings of the whole session
+	highMemory := newSubquery(memoryTrends(scoped(tablePerfSamples), "session_id")).
+		Select("session_id").
+		Where("end_mb >= ?", highMemoryMB)
+	leaking := newSubquery(memoryTrends(scoped(tablePerfSamples), "session_id")).
+		Select("session_id").
+		Where(leakSuspect, suspectArgs...)
+	crashes := func() *selectQuery {
+		return scoped(tableCrashes).Filter("scene", scene)
+	}
+
+	oom := &resp.OOM
+	for _, count := range []struct {
+		query *selectQuery
+		n     *int64
+	}{
+		{crashes(), &oom.CrashCount},
+		{crashes().WhereIn([]string{"session_id"}, highMemory), &oom.HighMemoryCount},
+		{crashes().WhereIn([]string{"session_id"}, leaking), &oom.LeakSuspectCount},
+	} {
+		if err := r.queryRow(ctx, count.query.Select("toInt64(count())")).Scan(count.n); err != nil {
+			return nil, err
+		}
+	}
+	oom.HighMemoryPct = pct(oom.HighMemoryCount, oom.CrashCount)
+	oom.LeakSuspectPct = pct(oom.LeakSuspectCount, oom.CrashCount)
+
+	oomGroups := crashes().
+		WhereIn([]string{"session_id"}, highMemory).
+		Select("fingerprint", "any(crash_type)", "toInt64(count()) AS cnt", "toInt64(uniqExact(session_id))").
+		GroupBy("fingerprint").
+		OrderBy("cnt DESC", "fingerprint").
+		Limit(limit)
+	if err := r.queryEach(ctx, oomGroups, func(rows driver.Rows) error {
+		var g models.OOMCrashGroup
+		if err := rows.Scan(&g.Fingerprint, &g.CrashType, &g.Count, &g.SessionCount); err != nil {
+			return err
+		}
+		oom.Groups = append(oom.Groups, g)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetMemoryLeaks_Queries(t *testing.T) {
+	repo, queries, args := newRecordingRepository()
+	end := time.Now()
+	start := end.Add(-24 * time.Hour)
+
+	resp, err := repo.GetMemoryLeaks(context.Background(), "game", start, end, "", "", "", 100, 512, 10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// A given high memory threshold is not computed
+	if len(*queries) != 7 {
+		t.Fatalf("expected 7 queries, sent %d", len(*queries))
+	}
+	if resp.Thresholds.HighMemoryMB != 512 || resp.Thresholds.MinGrowthMB != 100 {
+		t.Errorf("unexpected thresholds: %+v", resp.Thresholds)
+	}
+
+	want := "SELECT session_id, app_version, platform, device_model, samples, minutes, start_mb, end_mb, peak_mb, " +
+		"growth_mb, slope, rise_pct, avg_gc_alloc_kb FROM (SELECT session_id, app_version, platform, device_model, "
+	if !strings.HasPrefix((*queries)[0], want) {
+		t.Errorf("unexpected sessions query: %s", (*queries)[0])
+	}
+	if !strings.HasSuffix((*queries)[0], " WHERE samples >= ? AND growth_mb >= ? AND rise_pct >= ? ORDER BY slope DESC, session_id LIMIT ?") {
+		t.Errorf("expected leak suspects steepest first, got %s", (*queries)[0])
+	}
+	wantArgs := []interface{}{int64(leakMinSamples), float64(100), float64(leakMinRisePct), 10}
+	if got := (*args)[0][len((*args)[0])-4:]; !reflect.DeepEqual(got, wantArgs) {
+		t.Errorf("expected args %v, got %v", wantArgs, got)
+	}
+
+	high := (*queries)[4]
+	if !strings.HasPrefix(high, "SELECT toInt64(count()) FROM apm_crashes WHERE") ||
+		!strings.Contains(high, "(session_id) IN (SELECT session_id FROM (SELECT session_id, toInt64(count()) AS samples") ||
+		!strings.HasSuffix(high, "WHERE end_mb >= ?)") {
+		t.Errorf("unexpected high memory crash query: %s", high)
+	}
+}
+
+func TestGetMemoryLeaks_EmptyWindow(t *testing.T) {
+	repo, queries, args := newRecordingRepository()
+	end := time.Now()
+	start := end.Add(-time.Hour)
+
+	resp, err := repo.GetMemoryLeaks(context.Background(), "game", start, end, "", "", "", 100, 0, 10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The 95th percentile of no readings is NaN, which must not reach the
+	// response or the queries
+	if !strings.HasPrefix((*queries)[0], "SELECT ifNotFinite(toFloat64(quantileTDigestWeighted(0.95)(mem_mb, toUInt64(round(sample_weight * 100)))), 0) FROM apm_perf_samples") {
+		t.Errorf("expected the threshold to default to 0, got %s", (*queries)[0])
+	}
+	if resp.Thresholds.HighMemoryMB != 0 {
+		t.Errorf("expected no high memory threshold, got %v", resp.Thresholds.HighMemoryMB)
+	}
+	if _, err := json.Marshal(resp); err != nil {
+		t.Errorf("expected the response to encode, got %v", err)
+	}
+	high := (*args)[5]
+	if got := high[len(high)-1]; got != float64(0) {
+		t.Errorf("expected high memory bound as 0, got %v", got)
+	}
+}
+
+func TestMemoryTrends_Build(t *testing.T) {
+	query, _, err := memoryTrends(newQuery(tablePerfSamples), "session_id").Build()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(query, "ifNotFinite(covarPop(toUnixTimestamp64Milli(timestamp) / 60000, mem_mb) / "+
+		"varPop(toUnixTimestamp64Milli(timestamp) / 60000), 0) AS slope") {
+		t.Errorf("expected a least squares slope, got %s", query)
+	}
+	if !strings.HasSuffix(query, "FROM apm_perf_samples GROUP BY session_id") {
+		t.Errorf("unexpected query: %s", query)
+	}
+}
@@ -0,0 +1,335 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/warriorguo/ozx_apm/server/internal/models"
+)
+
+// maxFilterValues bounds the values of an in or not_in filter
+const maxFilterValues = 100
+
+// maxBuckets bounds the points of each series of a bucketed query
+const maxBuckets = 1000
+
+// InvalidQueryError reports a MetricQuery field that is not allowed
+type InvalidQueryError struct {
+	Field   string
+	Message string
+}
+
+func (e *InvalidQueryError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+func invalidQuery(field, format string, args ...interface{}) error {
+	return &InvalidQueryError{Field: field, Message: fmt.Sprintf(format, args...)}
+}
+
+// queryMetric is a metric MetricQuery can aggregate. Only identifiers from
+// this whitelist are ever written into SQL; values are bound as args.
+type queryMetric struct {
+	table  table
+	value  string // aggregated by avg, min, max and pN; empty for event counts
+	weight string // sample weight column of sampled tables
+	count  string // count aggregation, count() when empty
+	dims   map[string]string
+}
+
+var (
+	perfDims = map[string]string{
+		"app_version": "app_version", "platform": "platform", "device_model": "device_model",
+		"os_version": "os_version", "scene": "scene",
+	}
+	startupDims = map[string]string{
+		"app_version": "app_version", "platform": "platform", "device_model": "device_model",
+		"os_version": "os_version",
+	}
+	sceneLoadDims = map[string]string{
+		"app_version": "app_version", "platform": "platform", "device_model": "device_model",
+		"scene": "scene_name",
+	}
+	crashDims = map[string]string{
+		"app_version": "app_version", "platform": "platform", "device_model": "device_model",
+		"os_version": "os_version", "scene": "scene", "crash_type": "crash_type", "fingerprint": "fingerprint",
+	}
+	exceptionDims = map[string]string{
+		"app_version": "app_version", "platform": "platform", "device_model": "device_model",
+		"os_version": "os_version", "scene": "scene", "fingerprint": "fingerprint",
+	}
+)
+
+var queryMetrics = map[string]queryMetric{
+	"fps":             {table: tablePerfSamples, value: "fps", weight: "sample_weight", dims: perfDims},
+	"frame_time":      {table: tablePerfSamples, value: "frame_time_ms", weight: "sample_weight", dims: perfDims},
+	"main_thread":     {table: tablePerfSamples, value: "main_thread_ms", weight: "sample_weight", dims: perfDims},
+	"gc_alloc":        {table: tablePerfSamples, value: "gc_alloc_kb", weight: "sample_weight", dims: perfDims},
+	"mem":             {table: tablePerfSamples, value: "mem_mb", weight: "sample_weight", dims: perfDims},
+	"startup":         {table: tableStartups, value: "phase1_ms + phase2_ms + tti_ms", dims: startupDims},
+	"tti":             {table: tableStartups, value: "tti_ms", dims: startupDims},
+	"scene_load":      {table: tableSceneLoads, value: "load_ms", dims: sceneLoadDims},
+	"scene_activate":  {table: tableSceneLoads, value: "activate_ms", dims: sceneLoadDims},
+	"jank_duration":   {table: tableJanks, value: "duration_ms", dims: perfDims},
+	"jank_max_frame":  {table: tableJanks, value: "max_frame_ms", dims: perfDims},
+	"jank_count":      {table: tableJanks, dims: perfDims},
+	"crash_count":     {table: tableCrashes, dims: crashDims},
+	"exception_count": {table: tableExceptions, count: "sum(count)", dims: exceptionDims},
+}
+
+// queryBuckets maps bucket names to their sizes
+var queryBuckets = map[string]time.Duration{
+	"1m":  time.Minute,
+	"5m":  5 * time.Minute,
+	"15m": 15 * time.Minute,
+	"1h":  time.Hour,
+	"6h":  6 * time.Hour,
+	"1d":  24 * time.Hour,
+}
+
+// QueryMetrics lists the metrics QueryMetric accepts
+func QueryMetrics() []string {
+	names := make([]string, 0, len(queryMetrics))
+	for name := range queryMetrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// QueryMetric runs a generic metric query. Queries naming a metric,
+// aggregation, dimension, operator or bucket that is not allowed fail with
+// an *InvalidQueryError.
+func (r *Repository) QueryMetric(ctx context.Context, q models.MetricQuery) (*models.MetricQueryResult, error) {
+	query, args, err := buildMetricQuery(q)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.client.conn.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := &models.MetricQueryResult{Metric: q.Metric, Aggregation: q.Aggregation, Bucket: q.Bucket}
+	if q.Bucket == "" {
+		result.Columns = append(append([]string{}, q.GroupBy...), "value")
+		result.Rows = [][]interface{}{}
+	} else {
+		result.Series = []models.MetricSeries{}
+	}
+	series := make(map[string]int)
+
+	for rows.Next() {
+		var t time.Time
+		var value float64
+		group := make([]string, len(q.GroupBy))
+
+		dest := make([]interface{}, 0, len(group)+2)
+		if q.Bucket != "" {
+			dest = append(dest, &t)
+		}
+		for i := range group {
+			dest = append(dest, &group[i])
+		}
+		dest = append(dest, &value)
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+
+		if q.Bucket == "" {
+			row := make([]interface{}, 0, len(group)+1)
+			for _, g := range group {
+				row = append(row, g)
+			}
+			result.Rows = append(result.Rows, append(row, value))
+			continue
+		}
+
+		key := strings.Join(group, "\x00")
+		i, ok := series[key]
+		if !ok {
+			labels := make(map[string]string, len(group))
+			for j, dim := range q.GroupBy {
+				labels[dim] = group[j]
+			}
+			i = len(result.Series)
+			series[key] = i
+			result.Series = append(result.Series, models.MetricSeries{Group: labels, Points: []models.TimeSeriesPoint{}})
+		}
+		result.Series[i].Points = append(result.Series[i].Points, models.TimeSeriesPoint{Timestamp: t, Value: value})
+	}
+
+	return result, rows.Err()
+}
+
+// buildMetricQuery validates q and returns its SQL and args
+func buildMetricQuery(q models.MetricQuery) (string, []interface{}, error) {
+	metric, ok := queryMetrics[q.Metric]
+	if !ok {
+		return "", nil, invalidQuery("metric", "must be one of %s", strings.Join(QueryMetrics(), ", "))
+	}
+
+	agg, err := aggregation(metric, q.Aggregation)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if q.Limit <= 0 {
+		return "", nil, invalidQuery("limit", "must be positive")
+	}
+
+	groupCols := make([]string, len(q.GroupBy))
+	seen := make(map[string]bool)
+	for i, dim := range q.GroupBy {
+		col, ok := metric.dims[dim]
+		if !ok {
+			return "", nil, invalidQuery(fmt.Sprintf("group_by[%d]", i), "%s cannot be grouped by %q", q.Metric, dim)
+		}
+		if seen[dim] {
+			return "", nil, invalidQuery(fmt.Sprintf("group_by[%d]", i), "%q is repeated", dim)
+		}
+		seen[dim] = true
+		groupCols[i] = col
+	}
+
+	conds := make([]string, len(q.Filters))
+	condArgs := make([]interface{}, len(q.Filters))
+	for i, f := range q.Filters {
+		cond, arg, err := filterCondition(metric, f, fmt.Sprintf("filters[%d]", i))
+		if err != nil {
+			return "", nil, err
+		}
+		conds[i], condArgs[i] = cond, arg
+	}
+	scoped := func() *selectQuery {
+		sq := newQuery(metric.table).Between("timestamp", q.StartTime, q.EndTime).Filter("app_id", q.AppID)
+		for i, cond := range conds {
+			sq.Where(cond, condArgs[i])
+		}
+		return sq
+	}
+	query := scoped()
+
+	selects := make([]string, len(q.GroupBy))
+	for i, dim := range q.GroupBy {
+		selects[i] = groupCols[i] + " AS " + dim
+	}
+	value := "toFloat64(" + agg + ") AS value"
+
+	if q.Bucket == "" {
+		query.Select(append(selects, value)...)
+		if len(q.GroupBy) > 0 {
+			query.GroupBy(q.GroupBy...).OrderBy("value DESC")
+		}
+		return query.Limit(q.Limit).Build()
+	}
+
+	size, ok := queryBuckets[q.Bucket]
+	if !ok {
+		names := make([]string, 0, len(queryBuckets))
+		for name := range queryBuckets {
+			names = append(names, name)
+		}
+		sort.Slice(names, func(i, j int) bool { return queryBuckets[names[i]] < queryBuckets[names[j]] })
+		return "", nil, invalidQuery("bucket", "must be one of %s", strings.Join(names, ", "))
+	}
+	if q.EndTime.Sub(q.StartTime)/size > maxBuckets {
+		return "", nil, invalidQuery("bucket", "%s buckets would exceed %d points per series", q.Bucket, maxBuckets)
+	}
+
+	query.SelectBucket("timestamp", size, "t").Select(append(selects, value)...)
+	if len(q.GroupBy) > 0 {
+		// Keep the limit groups with the largest value over the whole range
+		top := scoped().Select(groupCols...).GroupBy(groupCols...).OrderBy(agg + " DESC").Limit(q.Limit)
+		query.WhereIn(groupCols, top)
+	}
+	return query.GroupBy(append([]string{"t"}, q.GroupBy...)...).OrderBy("t").Build()
+}
+
+// aggregation returns the SQL aggregate of name over metric
+func aggregation(metric queryMetric, name string) (string, error) {
+	switch name {
+	case "count":
+		switch {
+		case metric.count != "":
+			return metric.count, nil
+		case metric.weight != "":
+			return "round(sum(" + metric.weight + "))", nil
+		}
+		return "count()", nil
+	case "uniq":
+		// Distinct devices, e.g. the users a crash affected
+		return "uniqExact(device_id)", nil
+	}
+
+	if metric.value == "" {
+		return "", invalidQuery("aggregation", "must be count or uniq for event counts")
+	}
+	switch name {
+	case "avg":
+		if metric.weight != "" {
+			return "avgWeighted(" + metric.value + ", " + metric.weight + ")", nil
+		}
+		return "avg(" + metric.value + ")", nil
+	case "min":
+		return "min(" + metric.value + ")", nil
+	case "max":
+		return "max(" + metric.value + ")", nil
+	}
+	if p, ok := strings.CutPrefix(name, "p"); ok {
+		if n, err := strconv.Atoi(p); err == nil && n >= 1 && n <= 99 && p == strconv.Itoa(n) {
+			return quantileOf(strconv.FormatFloat(float64(n)/100, 'f', -1, 64), metric.value, metric.weight), nil
+		}
+	}
+	return "", invalidQuery("aggregation", "must be avg, min, max, count, uniq or p1 to p99")
+}
+
+// quantileOf returns the level quantile of value, counting each row weight
+// times when weight is set. Weighted quantiles only take whole weights, so
+// weights are scaled to keep two decimals.
+func quantileOf(level, value, weight string) string {
+	if weight == "" {
+		return "quantile(" + level + ")(" + value + ")"
+	}
+	return "quantileTDigestWeighted(" + level + ")(" + value + ", toUInt64(round(" + weight + " * 100)))"
+}
+
+// filterCondition returns the condition of f with its single arg
+func filterCondition(metric queryMetric, f models.MetricFilter, field string) (string, interface{}, error) {
+	col, ok := metric.dims[f.Dimension]
+	if !ok {
+		return "", nil, invalidQuery(field+".dimension", "cannot filter on %q", f.Dimension)
+	}
+
+	switch f.Op {
+	case models.FilterEq, models.FilterNeq, models.FilterPrefix:
+		if len(f.Values) != 1 {
+			return "", nil, invalidQuery(field+".values", "%s takes one value", f.Op)
+		}
+	case models.FilterIn, models.FilterNotIn:
+		if len(f.Values) == 0 || len(f.Values) > maxFilterValues {
+			return "", nil, invalidQuery(field+".values", "%s takes 1 to %d values", f.Op, maxFilterValues)
+		}
+	default:
+		return "", nil, invalidQuery(field+".op", "must be eq, neq, in, not_in or prefix")
+	}
+
+	switch f.Op {
+	case models.FilterEq:
+		return col + " = ?", f.Values[0], nil
+	case models.FilterNeq:
+		return col + " != ?", f.Values[0], nil
+	case models.FilterPrefix:
+		return "startsWith(" + col + ", ?)", f.Values[0], nil
+	case models.FilterIn:
+		return "has(?, " + col + ")", f.Values, nil
+	default:
+		return "NOT has(?, " + col + ")", f.Values, nil
+	}
+}
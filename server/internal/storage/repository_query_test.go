@@ -0,0 +1,185 @@
+package storage
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/warriorguo/ozx_apm/server/internal/models"
+)
+
+func TestBuildMetricQuery_Table(t *testing.T) {
+	start := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	end := start.Add(24 * time.Hour)
+
+	query, args, err := buildMetricQuery(models.MetricQuery{
+		AppID:       "game",
+		Metric:      "fps",
+		Aggregation: "p95",
+		GroupBy:     []string{"platform", "scene"},
+		Filters: []models.MetricFilter{
+			{Dimension: "app_version", Op: models.FilterIn, Values: []string{"1.0.0", "1.1.0"}},
+			{Dimension: "device_model", Op: models.FilterPrefix, Values: []string{"Pixel"}},
+		},
+		StartTime: start,
+		EndTime:   end,
+		Limit:     10,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := "SELECT platform AS platform, scene AS scene, toFloat64(quantileTDigestWeighted(0.95)(fps, toUInt64(round(sample_weight * 100)))) AS value FROM apm_perf_samples " +
+		"WHERE timestamp >= ? AND timestamp <= ? AND app_id = ? AND has(?, app_version) AND startsWith(device_model, ?) " +
+		"GROUP BY platform, scene ORDER BY value DESC LIMIT ?"
+	if query != want {
+		t.Errorf("unexpected query:\n got: %s\nwant: %s", query, want)
+	}
+
+	wantArgs := []interface{}{start, end, "game", []string{"1.0.0", "1.1.0"}, "Pixel", 10}
+	if !reflect.DeepEqual(args, wantArgs) {
+		t.Errorf("expected args %v, got %v", wantArgs, args)
+	}
+}
+
+func TestBuildMetricQuery_Series(t *testing.T) {
+	start := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	end := start.Add(6 * time.Hour)
+
+	query, args, err := buildMetricQuery(models.MetricQuery{
+		Metric:      "scene_load",
+		Aggregation: "avg",
+		GroupBy:     []string{"scene"},
+		Filters:     []models.MetricFilter{{Dimension: "platform", Op: models.FilterNeq, Values: []string{"WebGL"}}},
+		Bucket:      "1h",
+		StartTime:   start,
+		EndTime:     end,
+		Limit:       5,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	where := "WHERE timestamp >= ? AND timestamp <= ? AND platform != ?"
+	want := "SELECT toStartOfInterval(timestamp, INTERVAL 1 HOUR) AS t, scene_name AS scene, toFloat64(avg(load_ms)) AS value " +
+		"FROM apm_scene_loads " + where +
+		" AND (scene_name) IN (SELECT scene_name FROM apm_scene_loads " + where + " GROUP BY scene_name ORDER BY avg(load_ms) DESC LIMIT ?)" +
+		" GROUP BY t, scene ORDER BY t"
+	if query != want {
+		t.Errorf("unexpected query:\n got: %s\nwant: %s", query, want)
+	}
+
+	wantArgs := []interface{}{start, end, "WebGL", start, end, "WebGL", 5}
+	if !reflect.DeepEqual(args, wantArgs) {
+		t.Errorf("expected args %v, got %v", wantArgs, args)
+	}
+}
+
+func TestBuildMetricQuery_Aggregations(t *testing.T) {
+	tests := []struct {
+		metric, aggregation string
+		want                string
+	}{
+		{"fps", "avg", "avgWeighted(fps, sample_weight)"},
+		{"fps", "count", "round(sum(sample_weight))"},
+		{"mem", "max", "max(mem_mb)"},
+		{"frame_time", "p95", "quantileTDigestWeighted(0.95)(frame_time_ms, toUInt64(round(sample_weight * 100)))"},
+		{"startup", "p50", "quantile(0.5)(phase1_ms + phase2_ms + tti_ms)"},
+		{"jank_duration", "p99", "quantile(0.99)(duration_ms)"},
+		{"crash_count", "count", "count()"},
+		{"crash_count", "uniq", "uniqExact(device_id)"},
+		{"exception_count", "count", "sum(count)"},
+	}
+
+	for _, tt := range tests {
+		query, _, err := buildMetricQuery(models.MetricQuery{
+			Metric:      tt.metric,
+			Aggregation: tt.aggregation,
+			StartTime:   time.Now().Add(-time.Hour),
+			EndTime:     time.Now(),
+			Limit:       1,
+		})
+		if err != nil {
+			t.Errorf("%s %s: unexpected error: %v", tt.aggregation, tt.metric, err)
+			continue
+		}
+		if !strings.Contains(query, "toFloat64("+tt.want+") AS value") {
+			t.Errorf("%s %s: expected %s in %s", tt.aggregation, tt.metric, tt.want, query)
+		}
+		if strings.Contains(query, "GROUP BY") {
+			t.Errorf("%s %s: expected no GROUP BY without dimensions: %s", tt.aggregation, tt.metric, query)
+		}
+	}
+}
+
+func TestBuildMetricQuery_Invalid(t *testing.T) {
+	valid := func() models.MetricQuery {
+		return models.MetricQuery{
+			Metric:      "fps",
+			Aggregation: "avg",
+			StartTime:   time.Now().Add(-24 * time.Hour),
+			EndTime:     time.Now(),
+			Limit:       10,
+		}
+	}
+
+	tests := []struct {
+		name  string
+		edit  func(q *models.MetricQuery)
+		field string
+	}{
+		{"unknown metric", func(q *models.MetricQuery) { q.Metric = "fps; DROP TABLE apm_crashes" }, "metric"},
+		{"unknown aggregation", func(q *models.MetricQuery) { q.Aggregation = "median" }, "aggregation"},
+		{"percentile out of range", func(q *models.MetricQuery) { q.Aggregation = "p100" }, "aggregation"},
+		{"padded percentile", func(q *models.MetricQuery) { q.Aggregation = "p090" }, "aggregation"},
+		{"value aggregation of a count", func(q *models.MetricQuery) { q.Metric = "crash_count" }, "aggregation"},
+		{"unknown dimension", func(q *models.MetricQuery) { q.GroupBy = []string{"platform", "session_id"} }, "group_by[1]"},
+		{"dimension missing from table", func(q *models.MetricQuery) { q.Metric = "startup"; q.GroupBy = []string{"scene"} }, "group_by[0]"},
+		{"repeated dimension", func(q *models.MetricQuery) { q.GroupBy = []string{"platform", "platform"} }, "group_by[1]"},
+		{"filter dimension", func(q *models.MetricQuery) {
+			q.Filters = []models.MetricFilter{{Dimension: "1=1 OR app_id", Op: models.FilterEq, Values: []string{"x"}}}
+		}, "filters[0].dimension"},
+		{"filter op", func(q *models.MetricQuery) {
+			q.Filters = []models.MetricFilter{{Dimension: "platform", Op: "like", Values: []string{"x"}}}
+		}, "filters[0].op"},
+		{"eq with two values", func(q *models.MetricQuery) {
+			q.Filters = []models.MetricFilter{{Dimension: "platform", Op: models.FilterEq, Values: []string{"a", "b"}}}
+		}, "filters[0].values"},
+		{"empty in", func(q *models.MetricQuery) {
+			q.Filters = []models.MetricFilter{{Dimension: "platform", Op: models.FilterIn}}
+		}, "filters[0].values"},
+		{"unknown bucket", func(q *models.MetricQuery) { q.Bucket = "2h" }, "bucket"},
+		{"too many buckets", func(q *models.MetricQuery) { q.Bucket = "1m" }, "bucket"},
+		{"no limit", func(q *models.MetricQuery) { q.Limit = 0 }, "limit"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := valid()
+			tt.edit(&q)
+
+			_, _, err := buildMetricQuery(q)
+			var invalid *InvalidQueryError
+			if !errors.As(err, &invalid) {
+				t.Fatalf("expected InvalidQueryError, got %v", err)
+			}
+			if invalid.Field != tt.field {
+				t.Errorf("expected field %s, got %s (%s)", tt.field, invalid.Field, invalid.Message)
+			}
+		})
+	}
+}
+
+func TestQueryMetrics(t *testing.T) {
+	names := QueryMetrics()
+	if len(names) != len(queryMetrics) {
+		t.Fatalf("expected %d metrics, got %d", len(queryMetrics), len(names))
+	}
+	for i := 1; i < len(names); i++ {
+		if names[i-1] >= names[i] {
+			t.Errorf("expected sorted names, got %v", names)
+		}
+	}
+}
@@ -0,0 +1,268 @@
+package storage
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/warriorguo/ozx_apm/server/internal/models"
+)
+
+// GetReleases returns release health for the versions seen within the time
+// range, newest release first. If versions is non-empty only those versions
+// are returned; otherwise the limit versions with the most sessions are.
+// interval controls the bucket size of the adoption curve.
+func (r *Repository) GetReleases(ctx context.Context, appID string, startTime, endTime time.Time, platform string, interval time.Duration, versions []string, limit int) ([]models.ReleaseHealth, error) {
+	// Adoption needs every version in the denominator, so sessionsIn does
+	// not apply the version restriction
+	sessionsIn := func() *selectQuery {
+		return newQuery(tableSessions).
+			Between("start_time", startTime, endTime).
+			Filter("app_id", appID).
+			Filter("platform", platform)
+	}
+
+	perSession := sessionsIn().
+		Select(
+			"session_id",
+			"any(app_version) as version",
+			"any(device_id) as device",
+			"sum(crash_count) as crashes",
+		).
+		GroupBy("session_id")
+	if len(versions) > 0 {
+		perSession.Where("has(?, app_version)", versions)
+	}
+
+	query := newSubquery(perSession).
+		Select(
+			"version",
+			"count() as sessions",
+			"countIf(crashes > 0) as crashed_sessions",
+			"uniqExactIf(device, device != '') as users",
+			"uniqExactIf(device, device != '' AND crashes > 0) as crashed_users",
+		).
+		GroupBy("version").
+		OrderBy("sessions DESC").
+		Limit(limit)
+
+	rows, err := r.query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	releases := []models.ReleaseHealth{}
+	index := make(map[string]int)
+	for rows.Next() {
+		var rel models.ReleaseHealth
+		var sessions, crashedSessions, users, crashedUsers uint64
+		if err := rows.Scan(&rel.Version, &sessions, &crashedSessions, &users, &crashedUsers); err != nil {
+			return nil, err
+		}
+		rel.Sessions = int64(sessions)
+		rel.CrashedSessions = int64(crashedSessions)
+		rel.Users = int64(users)
+		rel.CrashedUsers = int64(crashedUsers)
+		rel.CrashFreeSessionsPct = crashFreeRate(rel.Sessions, rel.CrashedSessions)
+		rel.CrashFreeUsersPct = crashFreeRate(rel.Users, rel.CrashedUsers)
+		rel.Adoption = []models.TimeSeriesPoint{}
+		index[rel.Version] = len(releases)
+		releases = append(releases, rel)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(releases) == 0 {
+		return releases, nil
+	}
+
+	found := make([]string, 0, len(releases))
+	for _, rel := range releases {
+		found = append(found, rel.Version)
+	}
+
+	if err := r.fillReleaseLifetime(ctx, appID, releases, index, found, platform); err != nil {
+		return nil, err
+	}
+	if err := r.fillReleaseAdoption(ctx, releases, index, interval, sessionsIn()); err != nil {
+		return nil, err
+	}
+
+	perfIn := func(t table) *selectQuery {
+		return newQuery(t).
+			Between("timestamp", startTime, endTime).
+			Where("has(?, app_version)", found).
+			Filter("app_id", appID).
+			Filter("platform", platform)
+	}
+
+	fps, err := r.metricSummaries(ctx, perfIn(tablePerfSamples), "fps", "sample_weight")
+	if err != nil {
+		return nil, err
+	}
+	startup, err := r.metricSummaries(ctx, perfIn(tableStartups), "phase1_ms + phase2_ms + tti_ms", "")
+	if err != nil {
+		return nil, err
+	}
+	sceneLoad, err := r.metricSummaries(ctx, perfIn(tableSceneLoads), "load_ms", "")
+	if err != nil {
+		return nil, err
+	}
+	for i := range releases {
+		releases[i].FPS = fps[releases[i].Version]
+		releases[i].StartupMs = startup[releases[i].Version]
+		releases[i].SceneLoadMs = sceneLoad[releases[i].Version]
+	}
+
+	sort.SliceStable(releases, func(i, j int) bool {
+		return releases[i].FirstSeen.After(releases[j].FirstSeen)
+	})
+
+	return releases, nil
+}
+
+// fillReleaseLifetime sets first/last seen over all retained data, not just
+// the requested range, so a release's age is independent of the query window
+func (r *Repository) fillReleaseLifetime(ctx context.Context, appID string, releases []models.ReleaseHealth, index map[string]int, versions []string, platform string) error {
+	query := newQuery(tableSessions).
+		Select("app_version", "min(start_time)", "max(end_time)").
+		Where("has(?, app_version)", versions).
+		Filter("app_id", appID).
+		Filter("platform", platform).
+		GroupBy("app_version")
+
+	rows, err := r.query(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var version string
+		var firstSeen, lastSeen time.Time
+		if err := rows.Scan(&version, &firstSeen, &lastSeen); err != nil {
+			return err
+		}
+		if i, ok := index[version]; ok {
+			releases[i].FirstSeen = firstSeen
+			releases[i].LastSeen = lastSeen
+		}
+	}
+	return rows.Err()
+}
+
+// fillReleaseAdoption sets each release's share of sessions per interval and
+// over the whole range, counting the sessions sessions reads
+func (r *Repository) fillReleaseAdoption(ctx context.Context, releases []models.ReleaseHealth, index map[string]int, interval time.Duration, sessions *selectQuery) error {
+	sessions.
+		Select("session_id", "any(app_version) as version", "min(start_time) as started").
+		GroupBy("session_id")
+	query := newSubquery(sessions).
+		SelectBucket("started", interval, "t").
+		Select("version", "count()").
+		GroupBy("t", "version").
+		OrderBy("t")
+
+	rows, err := r.query(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var buckets []adoptionBucket
+	for rows.Next() {
+		var b adoptionBucket
+		var count uint64
+		if err := rows.Scan(&b.t, &b.version, &count); err != nil {
+			return err
+		}
+		b.sessions = int64(count)
+		buckets = append(buckets, b)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	curves, shares := adoptionCurves(buckets)
+	for version, i := range index {
+		if curve, ok := curves[version]; ok {
+			releases[i].Adoption = curve
+		}
+		releases[i].AdoptionPct = shares[version]
+	}
+	return nil
+}
+
+type adoptionBucket struct {
+	t        time.Time
+	version  string
+	sessions int64
+}
+
+// adoptionCurves turns per-interval session counts (ordered by time) into
+// each version's share of sessions per interval and over all intervals
+func adoptionCurves(buckets []adoptionBucket) (map[string][]models.TimeSeriesPoint, map[string]float64) {
+	bucketTotals := make(map[time.Time]int64)
+	versionTotals := make(map[string]int64)
+	var total int64
+	for _, b := range buckets {
+		bucketTotals[b.t] += b.sessions
+		versionTotals[b.version] += b.sessions
+		total += b.sessions
+	}
+
+	curves := make(map[string][]models.TimeSeriesPoint)
+	for _, b := range buckets {
+		curves[b.version] = append(curves[b.version], models.TimeSeriesPoint{
+			Timestamp: b.t,
+			Value:     float64(b.sessions) / float64(bucketTotals[b.t]) * 100,
+		})
+	}
+
+	shares := make(map[string]float64)
+	for version, sessions := range versionTotals {
+		shares[version] = float64(sessions) / float64(total) * 100
+	}
+	return curves, shares
+}
+
+// metricSummaries returns per-version moments and percentiles of value over
+// the rows samples reads, each counting weight times when weight is set
+func (r *Repository) metricSummaries(ctx context.Context, samples *selectQuery, value, weight string) (map[string]models.MetricSummary, error) {
+	w, quantileWeight := "1", ""
+	if weight != "" {
+		w, quantileWeight = weight, "w"
+	}
+	samples.Select("app_version", "toFloat64("+value+") as v", "toFloat64("+w+") as w")
+	query := newSubquery(samples).
+		Select(
+			"app_version",
+			"toUInt64(round(sum(w)))",
+			"avgWeighted(v, w)",
+			// The sample standard deviation, with weights as frequencies
+			"ifNotFinite(sqrt((sum(w * v * v) - pow(sum(w * v), 2) / sum(w)) / (sum(w) - 1)), 0)",
+			quantileOf("0.5", "v", quantileWeight),
+			quantileOf("0.95", "v", quantileWeight),
+		).
+		GroupBy("app_version")
+
+	rows, err := r.query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	summaries := make(map[string]models.MetricSummary)
+	for rows.Next() {
+		var version string
+		var count uint64
+		var s models.MetricSummary
+		if err := rows.Scan(&version, &count, &s.Mean, &s.StdDev, &s.P50, &s.P95); err != nil {
+			return nil, err
+		}
+		s.Count = int64(count)
+		summaries[version] = s
+	}
+	return summaries, rows.Err()
+}
@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/warriorguo/ozx_apm/server/internal/models"
+)
+
+// SaveRemoteConfig inserts a new version of a remote config rule
+func (r *Repository) SaveRemoteConfig(ctx context.Context, cfg models.RemoteConfig) error {
+	return r.writeRemoteConfig(ctx, cfg, false)
+}
+
+// DeleteRemoteConfig removes a remote config rule
+func (r *Repository) DeleteRemoteConfig(ctx context.Context, appID, appVersion, platform string) error {
+	return r.writeRemoteConfig(ctx, models.RemoteConfig{
+		AppID:      appID,
+		AppVersion: appVersion,
+		Platform:   platform,
+		UpdatedAt:  time.Now(),
+	}, true)
+}
+
+func (r *Repository) writeRemoteConfig(ctx context.Context, cfg models.RemoteConfig, deleted bool) error {
+	settings, err := json.Marshal(cfg)
+	if err != nil {
+		return fmt.Errorf("marshal config: %w", err)
+	}
+
+	batch, err := r.client.conn.PrepareBatch(ctx, "INSERT INTO apm_remote_configs")
+	if err != nil {
+		return fmt.Errorf("prepare batch: %w", err)
+	}
+
+	var deletedFlag uint8
+	if deleted {
+		deletedFlag = 1
+	}
+	if err := batch.Append(cfg.AppID, cfg.AppVersion, cfg.Platform, string(settings), deletedFlag, cfg.UpdatedAt); err != nil {
+		return fmt.Errorf("append to batch: %w", err)
+	}
+
+	return batch.Send()
+}
+
+// ListRemoteConfigs returns the remote config rules of an app, or of all
+// apps if appID is empty
+func (r *Repository) ListRemoteConfigs(ctx context.Context, appID string) ([]models.RemoteConfig, error) {
+	query := newQuery(tableRemoteConfigs).
+		Final().
+		Select("config").
+		Where("deleted = 0").
+		Filter("app_id", appID).
+		OrderBy("app_id", "app_version", "platform")
+
+	rows, err := r.query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	configs := []models.RemoteConfig{}
+	for rows.Next() {
+		var settings string
+		if err := rows.Scan(&settings); err != nil {
+			return nil, err
+		}
+		var cfg models.RemoteConfig
+		if err := json.Unmarshal([]byte(settings), &cfg); err != nil {
+			return nil, fmt.Errorf("unmarshal config: %w", err)
+		}
+		configs = append(configs, cfg)
+	}
+
+	return configs, rows.Err()
+}
@@ -0,0 +1,187 @@
+package storage
+
+import (
+	"context"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+
+	"github.com/warriorguo/ozx_apm/server/internal/models"
+)
+
+// sceneBadness orders a scene report: the higher, the worse the scene
+var sceneBadness = map[string]func(s *models.SceneReport) float64{
+	models.SceneSortSamples: func(s *models.SceneReport) float64 { return float64(s.SampleCount) },
+	models.SceneSortFPS: func(s *models.SceneReport) float64 {
+		// Scenes without perf samples have no FPS to rank them by
+		if s.SampleCount == 0 {
+			return math.Inf(-1)
+		}
+		return -s.FPSP5
+	},
+	models.SceneSortFrameTime:  func(s *models.SceneReport) float64 { return s.FrameTimeP95 },
+	models.SceneSortJankRate:   func(s *models.SceneReport) float64 { return s.JankRate },
+	models.SceneSortMemory:     func(s *models.SceneReport) float64 { return s.MemP95 },
+	models.SceneSortLoad:       func(s *models.SceneReport) float64 { return s.LoadP95 },
+	models.SceneSortExceptions: func(s *models.SceneReport) float64 { return float64(s.ExceptionCount) },
+	models.SceneSortCrashes:    func(s *models.SceneReport) float64 { return float64(s.CrashCount) },
+}
+
+// GetSceneReport returns the performance, load times and stability of each
+// scene, for at most limit scenes ranked worst first by sortBy, one of
+// models.SceneSorts. Scenes are named by perf samples, janks, exceptions and
+// crashes, and by the scene loads of the same name.
+func (r *Repository) GetSceneReport(ctx context.Context, appID string, startTime, endTime time.Time, appVersion, platform, sortBy string, limit int) ([]models.SceneReport, error) {
+	badness, ok := sceneBadness[sortBy]
+	if !ok {
+		return nil, invalidQuery("sort", "unknown sort %q", sortBy)
+	}
+
+	scoped := func(t table, scene string) *selectQuery {
+		return newQuery(t).
+			Between("timestamp", startTime, endTime).
+			Filter("app_id", appID).
+			Filter("app_version", appVersion).
+			Filter("platform", platform).
+			Where(scene + " != ''")
+	}
+
+	scenes := make(map[string]*models.SceneReport)
+	scene := func(name string) *models.SceneReport {
+		s, ok := scenes[name]
+		if !ok {
+			s = &models.SceneReport{Scene: name}
+			scenes[name] = s
+		}
+		return s
+	}
+
+	// Perf sample percentiles
+	perf := scoped(tablePerfSamples, "scene").
+		Select(
+			"scene",
+			"toInt64(round(sum(sample_weight)))",
+			"toInt64(uniqExact(session_id))",
+			"toFloat64("+quantileOf("0.5", "fps", "sample_weight")+")",
+			"toFloat64("+quantileOf("0.05", "fps", "sample_weight")+")",
+			"toFloat64("+quantileOf("0.95", "frame_time_ms", "sample_weight")+")",
+			"toFloat64("+quantileOf("0.95", "mem_mb", "sample_weight")+")",
+		).
+		GroupBy("scene")
+	if err := r.queryEach(ctx, perf, func(rows driver.Rows) error {
+		var row models.SceneReport
+		if err := rows.Scan(&row.Scene, &row.SampleCount, &row.SessionCount, &row.FPSP50, &row.FPSP5, &row.FrameTimeP95, &row.MemP95); err != nil {
+			return err
+		}
+		s := scene(row.Scene)
+		s.SampleCount, s.SessionCount = row.SampleCount, row.SessionCount
+		s.FPSP50, s.FPSP5, s.FrameTimeP95, s.MemP95 = row.FPSP50, row.FPSP5, row.FrameTimeP95, row.MemP95
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	// Play time, from the spans of each visit to the scene: the time between
+	// two consecutive samples of a session counts when both are in the same
+	// scene, so time spent in other scenes between visits does not. Samples
+	// without a scene are kept so they end a visit.
+	sessionSamples := newQuery(tablePerfSamples).
+		Between("timestamp", startTime, endTime).
+		Filter("app_id", appID).
+		Filter("app_version", appVersion).
+		Filter("platform", platform).
+		Select(
+			"arraySort(groupArray((toUnixTimestamp64Milli(timestamp), scene))) AS samples",
+			"arrayMap(x -> tupleElement(x, 2), samples) AS scenes",
+			"arrayDifference(arrayMap(x -> tupleElement(x, 1), samples)) AS gaps",
+		).
+		GroupBy("session_id")
+	steps := newSubquery(sessionSamples).
+		Select("arrayJoin(arrayZip(arrayPopBack(scenes), arrayPopFront(scenes), arrayPopFront(gaps))) AS step")
+	playTime := newSubquery(steps).
+		Select("tupleElement(step, 1) AS scene", "sumIf(tupleElement(step, 3), tupleElement(step, 1) = tupleElement(step, 2)) / 60000").
+		GroupBy("scene").
+		Having("scene != ''")
+	if err := r.queryEach(ctx, playTime, func(rows driver.Rows) error {
+		var name string
+		var minutes float64
+		if err := rows.Scan(&name, &minutes); err != nil {
+			return err
+		}
+		scene(name).PlayMinutes = minutes
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	// Load and activation times
+	loads := scoped(tableSceneLoads, "scene_name").
+		Select(
+			"scene_name",
+			"toInt64(count())",
+			"toFloat64(quantile(0.5)(load_ms))",
+			"toFloat64(quantile(0.95)(load_ms))",
+			"toFloat64(quantile(0.5)(activate_ms))",
+			"toFloat64(quantile(0.95)(activate_ms))",
+		).
+		GroupBy("scene_name")
+	if err := r.queryEach(ctx, loads, func(rows driver.Rows) error {
+		var row models.SceneReport
+		if err := rows.Scan(&row.Scene, &row.LoadCount, &row.LoadP50, &row.LoadP95, &row.ActivateP50, &row.ActivateP95); err != nil {
+			return err
+		}
+		s := scene(row.Scene)
+		s.LoadCount, s.LoadP50, s.LoadP95 = row.LoadCount, row.LoadP50, row.LoadP95
+		s.ActivateP50, s.ActivateP95 = row.ActivateP50, row.ActivateP95
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	// Event counts
+	for _, events := range []struct {
+		table table
+		count string
+		set   func(s *models.SceneReport, n int64)
+	}{
+		{tableJanks, "count()", func(s *models.SceneReport, n int64) { s.JankCount = n }},
+		{tableExceptions, "sum(count)", func(s *models.SceneReport, n int64) { s.ExceptionCount = n }},
+		{tableCrashes, "count()", func(s *models.SceneReport, n int64) { s.CrashCount = n }},
+	} {
+		query := scoped(events.table, "scene").
+			Select("scene", "toInt64("+events.count+")").
+			GroupBy("scene")
+		if err := r.queryEach(ctx, query, func(rows driver.Rows) error {
+			var name string
+			var n int64
+			if err := rows.Scan(&name, &n); err != nil {
+				return err
+			}
+			events.set(scene(name), n)
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	report := make([]models.SceneReport, 0, len(scenes))
+	for _, s := range scenes {
+		if s.PlayMinutes > 0 {
+			s.JankRate = float64(s.JankCount) / s.PlayMinutes
+		}
+		report = append(report, *s)
+	}
+	sort.Slice(report, func(i, j int) bool {
+		bi, bj := badness(&report[i]), badness(&report[j])
+		if bi != bj {
+			return bi > bj
+		}
+		return report[i].Scene < report[j].Scene
+	})
+	if len(report) > limit {
+		report = report[:limit]
+	}
+	return report, nil
+}
@@ -0,0 +1,59 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/warriorguo/ozx_apm/server/internal/models"
+)
+
+func TestGetSceneReport_PlayTimeQuery(t *testing.T) {
+	repo, queries, _ := newRecordingRepository()
+	end := time.Now()
+	start := end.Add(-24 * time.Hour)
+
+	if _, err := repo.GetSceneReport(context.Background(), "game", start, end, "", "", models.SceneSortSamples, 10); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(*queries) != 6 {
+		t.Fatalf("expected 6 queries, sent %d", len(*queries))
+	}
+	want := "SELECT tupleElement(step, 1) AS scene, sumIf(tupleElement(step, 3), tupleElement(step, 1) = tupleElement(step, 2)) / 60000 " +
+		"FROM (SELECT arrayJoin(arrayZip(arrayPopBack(scenes), arrayPopFront(scenes), arrayPopFront(gaps))) AS step " +
+		"FROM (SELECT arraySort(groupArray((toUnixTimestamp64Milli(timestamp), scene))) AS samples, " +
+		"arrayMap(x -> tupleElement(x, 2), samples) AS scenes, arrayDifference(arrayMap(x -> tupleElement(x, 1), samples)) AS gaps " +
+		"FROM apm_perf_samples WHERE timestamp >= ? AND timestamp <= ? AND app_id = ? GROUP BY session_id)) " +
+		"GROUP BY scene HAVING scene != ''"
+	if (*queries)[1] != want {
+		t.Errorf("unexpected play time query:\n got: %s\nwant: %s", (*queries)[1], want)
+	}
+	if !strings.Contains((*queries)[2], "FROM apm_scene_loads WHERE") {
+		t.Errorf("expected scene loads to be read third, got %s", (*queries)[2])
+	}
+
+	_, err := repo.GetSceneReport(context.Background(), "game", start, end, "", "", "name", 10)
+	var invalid *InvalidQueryError
+	if !errors.As(err, &invalid) || invalid.Field != "sort" {
+		t.Errorf("expected an invalid sort, got %v", err)
+	}
+}
+
+func TestSceneBadness(t *testing.T) {
+	smooth := &models.SceneReport{Scene: "menu", SampleCount: 100, FPSP5: 55}
+	choppy := &models.SceneReport{Scene: "battle", SampleCount: 100, FPSP5: 20}
+	unsampled := &models.SceneReport{Scene: "loading"}
+
+	fps := sceneBadness[models.SceneSortFPS]
+	if !(fps(choppy) > fps(smooth) && fps(smooth) > fps(unsampled)) {
+		t.Error("expected the lowest FPS first and scenes without samples last")
+	}
+	for _, s := range models.SceneSorts {
+		if sceneBadness[s] == nil {
+			t.Errorf("sort %s has no order", s)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package storage
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+
+	"github.com/warriorguo/ozx_apm/server/internal/models"
+)
+
+// maxSearchTerms bounds the terms of a search
+const maxSearchTerms = 8
+
+// A snippet keeps snippetContext bytes before its first match and is at
+// most snippetLength bytes long
+const (
+	snippetContext = 60
+	snippetLength  = 240
+)
+
+// issueSearch describes how a table of issues is searched. A term matches
+// a whole token of a token column, or any part of an ngram column, which
+// is what their bloom filter indexes on lower(column) can skip granules
+// for.
+type issueSearch struct {
+	kind    string
+	table   table
+	title   string
+	count   string
+	message string
+	tokens  []string // columns with a tokenbf_v1 index
+	ngrams  []string // columns with an ngrambf_v1 index
+}
+
+var issueSearches = []issueSearch{
+	{
+		kind:    models.IssueCrash,
+		table:   tableCrashes,
+		title:   "any(crash_type)",
+		count:   "count()",
+		message: "''", // crashes only have a stack
+		ngrams:  []string{"stack"},
+	},
+	{
+		kind:    models.IssueException,
+		table:   tableExceptions,
+		title:   "argMax(message, timestamp)",
+		count:   "sum(count)",
+		message: "argMax(message, timestamp)",
+		tokens:  []string{"message"},
+		ngrams:  []string{"stack"},
+	},
+}
+
+// SearchTerms splits a search into the lowercased terms a match must all
+// contain. Like ClickHouse's token indexes, terms are runs of ASCII letters
+// and digits or of other characters, and ASCII punctuation and spaces
+// separate them. Repeated terms are dropped.
+func SearchTerms(q string) []string {
+	terms := []string{}
+	seen := make(map[string]bool)
+	for _, f := range strings.FieldsFunc(q, isSearchSeparator) {
+		t := asciiLower(f)
+		if !seen[t] {
+			seen[t] = true
+			terms = append(terms, t)
+		}
+	}
+	return terms
+}
+
+func isSearchSeparator(r rune) bool {
+	return r < utf8.RuneSelf && !isLetter(byte(r)) && !isDigit(byte(r))
+}
+
+// asciiLower lowercases ASCII letters only, as ClickHouse's lower does, so
+// offsets into the result are offsets into s
+func asciiLower(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'A' && r <= 'Z' {
+			return r + 'a' - 'A'
+		}
+		return r
+	}, s)
+}
+
+// SearchIssues returns the crash and exception groups whose events contain
+// every term, most frequent first. kind restricts the search to crashes or
+// exceptions when set. Searches without terms or with more than
+// maxSearchTerms fail with an *InvalidQueryError.
+func (r *Repository) SearchIssues(ctx context.Context, appID string, terms []string, kind string, startTime, endTime time.Time, limit int) ([]models.SearchResult, error) {
+	if len(terms) == 0 {
+		return nil, invalidQuery("q", "must contain a word to search for")
+	}
+	if len(terms) > maxSearchTerms {
+		return nil, invalidQuery("q", "must not contain more than %d words", maxSearchTerms)
+	}
+
+	results := []models.SearchResult{}
+	for _, s := range issueSearches {
+		if kind != "" && kind != s.kind {
+			continue
+		}
+
+		query := newQuery(s.table).
+			Select(
+				"fingerprint",
+				s.title+" AS title",
+				"toInt64("+s.count+") AS cnt",
+				"max(timestamp) AS last_seen",
+				s.message+" AS sample_message",
+				"argMax(stack, timestamp) AS sample_stack",
+			).
+			Between("timestamp", startTime, endTime).
+			Filter("app_id", appID)
+		for _, t := range terms {
+			var match []string
+			var args []interface{}
+			for _, c := range s.tokens {
+				match = append(match, "hasToken(lower("+c+"), ?)")
+				args = append(args, t)
+			}
+			for _, c := range s.ngrams {
+				match = append(match, "lower("+c+") LIKE ?")
+				args = append(args, "%"+t+"%")
+			}
+			query.Where(strings.Join(match, " OR "), args...)
+		}
+		query.GroupBy("fingerprint").OrderBy("cnt DESC").Limit(limit)
+
+		err := r.queryEach(ctx, query, func(rows driver.Rows) error {
+			res := models.SearchResult{Kind: s.kind}
+			var message, stack string
+			if err := rows.Scan(&res.Fingerprint, &res.Title, &res.Count, &res.LastSeen, &message, &stack); err != nil {
+				return err
+			}
+			res.Field, res.Snippet = "message", snippet(message, terms)
+			if res.Snippet == nil {
+				res.Field, res.Snippet = "stack", snippet(stack, terms)
+			}
+			if res.Snippet == nil {
+				res.Snippet = []models.SnippetFragment{{Text: truncate(stack, snippetLength)}}
+			}
+			results = append(results, res)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Count != results[j].Count {
+			return results[i].Count > results[j].Count
+		}
+		return results[i].LastSeen.After(results[j].LastSeen)
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+// snippet cuts text around the first match of any term, ignoring ASCII
+// case, and splits it into fragments with the matches flagged. It returns
+// nil if no term matches.
+func snippet(text string, terms []string) []models.SnippetFragment {
+	lower := asciiLower(text)
+	first := -1
+	for _, t := range terms {
+		if i := strings.Index(lower, t); i >= 0 && (first < 0 || i < first) {
+			first = i
+		}
+	}
+	if first < 0 {
+		return nil
+	}
+
+	start := max(0, first-snippetContext)
+	for start > 0 && !utf8.RuneStart(text[start]) {
+		start--
+	}
+	end := min(len(text), start+snippetLength)
+	for end < len(text) && !utf8.RuneStart(text[end]) {
+		end--
+	}
+
+	var frags []models.SnippetFragment
+	plain := func(s string) {
+		if s == "" {
+			return
+		}
+		if n := len(frags); n > 0 && !frags[n-1].Match {
+			frags[n-1].Text += s
+			return
+		}
+		frags = append(frags, models.SnippetFragment{Text: s})
+	}
+
+	if start > 0 {
+		plain("…")
+	}
+	i := start
+	for i < end {
+		// The earliest match, and the longest of those starting there
+		at, n := -1, 0
+		for _, t := range terms {
+			j := strings.Index(lower[i:end], t)
+			if j >= 0 && (at < 0 || j < at || j == at && len(t) > n) {
+				at, n = j, len(t)
+			}
+		}
+		if at < 0 {
+			break
+		}
+		plain(text[i : i+at])
+		frags = append(frags, models.SnippetFragment{Text: text[i+at : i+at+n], Match: true})
+		i += at + n
+	}
+	plain(text[i:end])
+	if end < len(text) {
+		plain("…")
+	}
+	return frags
+}
+
+// truncate cuts s to at most n bytes without splitting a character
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n] + "…"
+}
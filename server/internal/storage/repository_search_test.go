@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/warriorguo/ozx_apm/server/internal/models"
+)
+
+func TestSearchTerms(t *testing.T) {
+	tests := []struct {
+		q    string
+		want []string
+	}{
+		{"NullReferenceException", []string{"nullreferenceexception"}},
+		{"  InventoryPanel.OnClick()  inventorypanel", []string{"inventorypanel", "onclick"}},
+		{"Ошибка загрузки", []string{"Ошибка", "загрузки"}},
+		{"--", []string{}},
+	}
+
+	for _, tt := range tests {
+		if got := SearchTerms(tt.q); !slices.Equal(got, tt.want) {
+			t.Errorf("SearchTerms(%q) = %q, want %q", tt.q, got, tt.want)
+		}
+	}
+}
+
+func TestSnippet(t *testing.T) {
+	frags := snippet("NullReferenceException: Object reference not set in InventoryPanel.Refresh", []string{"inventorypanel", "nullreferenceexception"})
+	want := []models.SnippetFragment{
+		{Text: "NullReferenceException", Match: true},
+		{Text: ": Object reference not set in "},
+		{Text: "InventoryPanel", Match: true},
+		{Text: ".Refresh"},
+	}
+	if !reflect.DeepEqual(frags, want) {
+		t.Errorf("unexpected fragments: %+v", frags)
+	}
+
+	if frags := snippet("IndexOutOfRangeException", []string{"inventory"}); frags != nil {
+		t.Errorf("expected no snippet without a match, got %+v", frags)
+	}
+
+	// Long text is cut around the first match, on character boundaries
+	text := strings.Repeat("é", 100) + "Crash" + strings.Repeat("ü", 200)
+	frags = snippet(text, []string{"crash"})
+	if len(frags) != 3 || !frags[1].Match || frags[1].Text != "Crash" {
+		t.Fatalf("unexpected fragments: %+v", frags)
+	}
+	if !strings.HasPrefix(frags[0].Text, "…") || !strings.HasSuffix(frags[2].Text, "…") {
+		t.Errorf("expected ellipses on both sides, got %+v", frags)
+	}
+	for _, f := range frags {
+		if !utf8.ValidString(f.Text) {
+			t.Errorf("fragment %q splits a character", f.Text)
+		}
+	}
+	if n := len(strings.TrimSuffix(strings.TrimPrefix(frags[0].Text+frags[1].Text+frags[2].Text, "…"), "…")); n > snippetLength {
+		t.Errorf("expected at most %d bytes, got %d", snippetLength, n)
+	}
+}
+
+func TestSearchIssues_Query(t *testing.T) {
+	repo, queries, args := newRecordingRepository()
+	start := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	end := start.Add(24 * time.Hour)
+
+	if _, err := repo.SearchIssues(context.Background(), "game", []string{"nullreferenceexception", "inventorypanel"}, models.IssueException, start, end, 20); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := "SELECT fingerprint, argMax(message, timestamp) AS title, toInt64(sum(count)) AS cnt, max(timestamp) AS last_seen, " +
+		"argMax(message, timestamp) AS sample_message, argMax(stack, timestamp) AS sample_stack FROM apm_exceptions " +
+		"WHERE timestamp >= ? AND timestamp <= ? AND app_id = ? " +
+		"AND (hasToken(lower(message), ?) OR lower(stack) LIKE ?) AND (hasToken(lower(message), ?) OR lower(stack) LIKE ?) " +
+		"GROUP BY fingerprint ORDER BY cnt DESC LIMIT ?"
+	if len(*queries) != 1 || (*queries)[0] != want {
+		t.Errorf("unexpected queries:\n got: %v\nwant: %s", *queries, want)
+	}
+	wantArgs := []interface{}{start, end, "game", "nullreferenceexception", "%nullreferenceexception%", "inventorypanel", "%inventorypanel%", 20}
+	if len(*args) != 1 || !reflect.DeepEqual((*args)[0], wantArgs) {
+		t.Errorf("expected args %v, got %v", wantArgs, *args)
+	}
+}
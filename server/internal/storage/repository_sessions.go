@@ -0,0 +1,422 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+
+	"github.com/warriorguo/ozx_apm/server/internal/models"
+)
+
+// sessionColumns merges apm_sessions fragments into one row per session.
+// It must be used with GROUP BY session_id. Aggregates are deliberately left
+// unaliased so they never shadow the raw columns in a WHERE clause.
+var sessionColumns = []string{
+	"session_id",
+	"any(device_id)",
+	"anyIf(user_id, user_id != '')",
+	"any(app_version)",
+	"any(platform)",
+	"any(device_model)",
+	"anyIf(os_version, os_version != '')",
+	"min(start_time) as started",
+	"max(end_time) as ended",
+	"arrayFlatten(arrayMap(x -> x.2, arraySort(groupArray((start_time, scenes)))))",
+	"toInt64(sum(event_count))",
+	"toInt64(sum(crash_count))",
+	"toInt64(sum(exception_count))",
+	"toInt64(sum(jank_count))",
+	"max(ended_by_crash)",
+}
+
+// GetSessions returns merged sessions that started within the time range
+func (r *Repository) GetSessions(ctx context.Context, appID string, startTime, endTime time.Time, appVersion, platform string, page, pageSize int) ([]models.SessionSummary, int64, error) {
+	scoped := func() *selectQuery {
+		return newQuery(tableSessions).
+			Between("start_time", startTime, endTime).
+			Filter("app_id", appID).
+			Filter("app_version", appVersion).
+			Filter("platform", platform)
+	}
+
+	// Get total count
+	var totalCount int64
+	if err := r.queryRow(ctx, scoped().Select("toInt64(count(DISTINCT session_id))")).Scan(&totalCount); err != nil {
+		return nil, 0, err
+	}
+
+	query := scoped().
+		Select(sessionColumns...).
+		GroupBy("session_id").
+		OrderBy("started DESC").
+		Limit(pageSize).
+		Offset((page - 1) * pageSize)
+
+	sessions := []models.SessionSummary{}
+	err := r.queryEach(ctx, query, func(rows driver.Rows) error {
+		s, err := scanSession(rows)
+		if err != nil {
+			return err
+		}
+		sessions = append(sessions, s)
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return sessions, totalCount, nil
+}
+
+// GetSession returns a single merged session, or nil if it does not exist
+func (r *Repository) GetSession(ctx context.Context, appID, sessionID string) (*models.SessionSummary, error) {
+	query := newQuery(tableSessions).
+		Select(sessionColumns...).
+		Where("session_id = ?", sessionID).
+		Filter("app_id", appID).
+		GroupBy("session_id")
+
+	rows, err := r.query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	s, err := scanSession(rows)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// GetSessionStats returns crash-free session rate and session length statistics
+func (r *Repository) GetSessionStats(ctx context.Context, appID string, startTime, endTime time.Time, appVersion, platform string) (*models.SessionStats, error) {
+	perSession := newQuery(tableSessions).
+		Select(
+			"session_id",
+			"sum(crash_count) as crashes",
+			"(toUnixTimestamp64Milli(max(end_time)) - toUnixTimestamp64Milli(min(start_time))) / 1000 as duration_sec",
+		).
+		Between("start_time", startTime, endTime).
+		Filter("app_id", appID).
+		Filter("app_version", appVersion).
+		Filter("platform", platform).
+		GroupBy("session_id")
+	query := newSubquery(perSession).Select(
+		"count() as sessions",
+		"countIf(crashes > 0) as crashed",
+		"ifNotFinite(avg(duration_sec), 0) as avg_duration",
+		"ifNotFinite(quantile(0.5)(duration_sec), 0) as median_duration",
+	)
+
+	stats := &models.SessionStats{
+		TimeRange: models.TimeRange{Start: startTime, End: endTime},
+	}
+	row := r.queryRow(ctx, query)
+	var sessions, crashed uint64
+	if err := row.Scan(&sessions, &crashed, &stats.AvgDurationSec, &stats.MedianDurationSec); err != nil {
+		return nil, err
+	}
+
+	stats.TotalSessions = int64(sessions)
+	stats.CrashedSessions = int64(crashed)
+	stats.CrashFreeRate = crashFreeRate(stats.TotalSessions, stats.CrashedSessions)
+
+	return stats, nil
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanSession(row rowScanner) (models.SessionSummary, error) {
+	var s models.SessionSummary
+	var scenes []string
+	if err := row.Scan(
+		&s.SessionID,
+		&s.DeviceID,
+		&s.UserID,
+		&s.AppVersion,
+		&s.Platform,
+		&s.DeviceModel,
+		&s.OSVersion,
+		&s.StartTime,
+		&s.EndTime,
+		&scenes,
+		&s.EventCount,
+		&s.CrashCount,
+		&s.ExceptionCount,
+		&s.JankCount,
+		&s.EndedByCrash,
+	); err != nil {
+		return s, err
+	}
+
+	s.DurationSec = s.EndTime.Sub(s.StartTime).Seconds()
+	s.ScenePath = collapseScenes(scenes)
+	return s, nil
+}
+
+// collapseScenes drops consecutive repeats left where batch fragments meet
+func collapseScenes(scenes []string) []string {
+	path := []string{}
+	for _, scene := range scenes {
+		if len(path) > 0 && path[len(path)-1] == scene {
+			continue
+		}
+		path = append(path, scene)
+	}
+	return path
+}
+
+// crashFreeRate returns the percentage of units without a crash
+func crashFreeRate(total, crashed int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(total-crashed) / float64(total) * 100
+}
+
+// crashFreeGroupColumns maps the supported crash-free breakdowns onto columns
+// of the per-session subquery in GetCrashFreeStats
+var crashFreeGroupColumns = map[string]string{
+	"":         "'all'",
+	"version":  "version",
+	"platform": "plat",
+	"day":      "toString(day)",
+}
+
+// crashFreeUserColumns maps the supported user identities onto apm_sessions
+// aggregates
+var crashFreeUserColumns = map[string]string{
+	"device_id": "any(device_id)",
+	"user_id":   "anyIf(user_id, user_id != '')",
+}
+
+// GetCrashFreeStats returns crash-free session and user rates, optionally
+// broken down by version, platform or day. userKey selects whether users
+// are identified by device_id or user_id.
+func (r *Repository) GetCrashFreeStats(ctx context.Context, appID string, startTime, endTime time.Time, appVersion, platform, groupBy, userKey string) ([]models.CrashFreeStats, error) {
+	groupColumn, ok := crashFreeGroupColumns[groupBy]
+	if !ok {
+		return nil, fmt.Errorf("unknown group_by: %s", groupBy)
+	}
+	userColumn, ok := crashFreeUserColumns[userKey]
+	if !ok {
+		return nil, fmt.Errorf("unknown user_key: %s", userKey)
+	}
+
+	perSession := newQuery(tableSessions).
+		Select(
+			"session_id",
+			"any(app_version) as version",
+			"any(platform) as plat",
+			"toDate(min(start_time)) as day",
+			userColumn+" as ukey",
+			"sum(crash_count) as crashes",
+		).
+		Between("start_time", startTime, endTime).
+		Filter("app_id", appID).
+		Filter("app_version", appVersion).
+		Filter("platform", platform).
+		GroupBy("session_id")
+	query := newSubquery(perSession).
+		Select(
+			groupColumn+" as grp",
+			"count() as sessions",
+			"countIf(crashes > 0) as crashed_sessions",
+			"uniqExactIf(ukey, ukey != '') as users",
+			"uniqExactIf(ukey, ukey != '' AND crashes > 0) as crashed_users",
+		).
+		GroupBy("grp").
+		OrderBy("grp")
+
+	rows, err := r.query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := []models.CrashFreeStats{}
+	for rows.Next() {
+		var s models.CrashFreeStats
+		var sessions, crashedSessions, users, crashedUsers uint64
+		if err := rows.Scan(&s.Key, &sessions, &crashedSessions, &users, &crashedUsers); err != nil {
+			return nil, err
+		}
+		s.Sessions = int64(sessions)
+		s.CrashedSessions = int64(crashedSessions)
+		s.Users = int64(users)
+		s.CrashedUsers = int64(crashedUsers)
+		s.CrashFreeSessionsPct = crashFreeRate(s.Sessions, s.CrashedSessions)
+		s.CrashFreeUsersPct = crashFreeRate(s.Users, s.CrashedUsers)
+		stats = append(stats, s)
+	}
+
+	return stats, nil
+}
+
+// GetSessionTimeline returns every stored event of a session within the time
+// range, merged into one stream ordered by time. At most limit events are
+// read from each table; truncated reports whether any table hit the limit.
+func (r *Repository) GetSessionTimeline(ctx context.Context, appID, sessionID string, startTime, endTime time.Time, limit int) ([]models.TimelineEvent, bool, error) {
+	var streams [][]models.TimelineEvent
+	truncated := false
+
+	read := func(t table, columns []string, scan func(rows rowScanner) (models.TimelineEvent, error)) error {
+		query := newQuery(t).
+			Select(columns...).
+			Where("session_id = ?", sessionID).
+			Between("timestamp", startTime, endTime).
+			Filter("app_id", appID).
+			OrderBy("timestamp").
+			Limit(limit)
+		rows, err := r.query(ctx, query)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		events := []models.TimelineEvent{}
+		for rows.Next() {
+			e, err := scan(rows)
+			if err != nil {
+				return err
+			}
+			events = append(events, e)
+		}
+		if len(events) >= limit {
+			truncated = true
+		}
+		streams = append(streams, events)
+		return rows.Err()
+	}
+
+	if err := read(tablePerfSamples, []string{"timestamp", "scene", "fps", "frame_time_ms", "main_thread_ms", "gc_alloc_kb", "mem_mb"}, func(rows rowScanner) (models.TimelineEvent, error) {
+		var p models.PerfSample
+		err := rows.Scan(&p.Timestamp, &p.Scene, &p.FPS, &p.FrameTimeMs, &p.MainThreadMs, &p.GCAllocKB, &p.MemMB)
+		return models.TimelineEvent{
+			Timestamp: p.Timestamp,
+			Type:      models.EventTypePerfSample,
+			Scene:     p.Scene,
+			Data: map[string]interface{}{
+				"fps":            p.FPS,
+				"frame_time_ms":  p.FrameTimeMs,
+				"main_thread_ms": p.MainThreadMs,
+				"gc_alloc_kb":    p.GCAllocKB,
+				"mem_mb":         p.MemMB,
+			},
+		}, err
+	}); err != nil {
+		return nil, false, err
+	}
+
+	if err := read(tableJanks, []string{"timestamp", "scene", "duration_ms", "max_frame_ms", "recent_gc_count", "recent_gc_alloc_kb", "recent_events"}, func(rows rowScanner) (models.TimelineEvent, error) {
+		var j models.Jank
+		err := rows.Scan(&j.Timestamp, &j.Scene, &j.DurationMs, &j.MaxFrameMs, &j.RecentGCCount, &j.RecentGCAllocKB, &j.RecentEvents)
+		return models.TimelineEvent{
+			Timestamp: j.Timestamp,
+			Type:      models.EventTypeJank,
+			Scene:     j.Scene,
+			Data: map[string]interface{}{
+				"duration_ms":        j.DurationMs,
+				"max_frame_ms":       j.MaxFrameMs,
+				"recent_gc_count":    j.RecentGCCount,
+				"recent_gc_alloc_kb": j.RecentGCAllocKB,
+				"recent_events":      j.RecentEvents,
+			},
+		}, err
+	}); err != nil {
+		return nil, false, err
+	}
+
+	if err := read(tableStartups, []string{"timestamp", "phase1_ms", "phase2_ms", "tti_ms"}, func(rows rowScanner) (models.TimelineEvent, error) {
+		var s models.Startup
+		err := rows.Scan(&s.Timestamp, &s.Phase1Ms, &s.Phase2Ms, &s.TTIMs)
+		return models.TimelineEvent{
+			Timestamp: s.Timestamp,
+			Type:      models.EventTypeStartup,
+			Data: map[string]interface{}{
+				"phase1_ms": s.Phase1Ms,
+				"phase2_ms": s.Phase2Ms,
+				"tti_ms":    s.TTIMs,
+			},
+		}, err
+	}); err != nil {
+		return nil, false, err
+	}
+
+	if err := read(tableSceneLoads, []string{"timestamp", "scene_name", "load_ms", "activate_ms"}, func(rows rowScanner) (models.TimelineEvent, error) {
+		var s models.SceneLoad
+		err := rows.Scan(&s.Timestamp, &s.SceneName, &s.LoadMs, &s.ActivateMs)
+		return models.TimelineEvent{
+			Timestamp: s.Timestamp,
+			Type:      models.EventTypeSceneLoad,
+			Scene:     s.SceneName,
+			Data: map[string]interface{}{
+				"load_ms":     s.LoadMs,
+				"activate_ms": s.ActivateMs,
+			},
+		}, err
+	}); err != nil {
+		return nil, false, err
+	}
+
+	if err := read(tableExceptions, []string{"timestamp", "scene", "fingerprint", "message", "stack", "count"}, func(rows rowScanner) (models.TimelineEvent, error) {
+		var e models.Exception
+		err := rows.Scan(&e.Timestamp, &e.Scene, &e.Fingerprint, &e.Message, &e.Stack, &e.Count)
+		return models.TimelineEvent{
+			Timestamp: e.Timestamp,
+			Type:      models.EventTypeException,
+			Scene:     e.Scene,
+			Data: map[string]interface{}{
+				"fingerprint": e.Fingerprint,
+				"message":     e.Message,
+				"stack":       e.Stack,
+				"count":       e.Count,
+			},
+		}, err
+	}); err != nil {
+		return nil, false, err
+	}
+
+	if err := read(tableCrashes, []string{"timestamp", "scene", "crash_type", "fingerprint", "stack", "breadcrumbs"}, func(rows rowScanner) (models.TimelineEvent, error) {
+		var c models.Crash
+		err := rows.Scan(&c.Timestamp, &c.Scene, &c.CrashType, &c.Fingerprint, &c.Stack, &c.Breadcrumbs)
+		return models.TimelineEvent{
+			Timestamp: c.Timestamp,
+			Type:      models.EventTypeCrash,
+			Scene:     c.Scene,
+			Data: map[string]interface{}{
+				"crash_type":  c.CrashType,
+				"fingerprint": c.Fingerprint,
+				"stack":       c.Stack,
+				"breadcrumbs": c.Breadcrumbs,
+			},
+		}, err
+	}); err != nil {
+		return nil, false, err
+	}
+
+	return mergeTimeline(streams...), truncated, nil
+}
+
+// mergeTimeline merges per-table event streams into one stream ordered by
+// time. Events with equal timestamps keep the order of the streams, so a
+// crash is listed after the samples recorded in the same millisecond.
+func mergeTimeline(streams ...[]models.TimelineEvent) []models.TimelineEvent {
+	merged := []models.TimelineEvent{}
+	for _, s := range streams {
+		merged = append(merged, s...)
+	}
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].Timestamp.Before(merged[j].Timestamp)
+	})
+	return merged
+}
@@ -7,6 +7,7 @@ import (
 const schemaSQL = `
 -- Performance samples (sampled data)
 CREATE TABLE IF NOT EXISTS apm_perf_samples (
+    app_id String,
     timestamp DateTime64(3),
     app_version String,
     platform String,
@@ -19,13 +20,15 @@ CREATE TABLE IF NOT EXISTS apm_perf_samples (
     frame_time_ms Float32,
     main_thread_ms Float32,
     gc_alloc_kb Float32,
-    mem_mb Float32
+    mem_mb Float32,
+    sample_weight Float32 DEFAULT 1
 ) ENGINE = MergeTree()
 PARTITION BY toYYYYMMDD(timestamp)
-ORDER BY (app_version, platform, timestamp);
+ORDER BY (app_id, app_version, platform, timestamp);
 
 -- Jank events
 CREATE TABLE IF NOT EXISTS apm_janks (
+    app_id String,
     timestamp DateTime64(3),
     app_version String,
     platform String,
@@ -41,10 +44,11 @@ CREATE TABLE IF NOT EXISTS apm_janks (
     recent_events Array(String)
 ) ENGINE = MergeTree()
 PARTITION BY toYYYYMMDD(timestamp)
-ORDER BY (app_version, scene, timestamp);
+ORDER BY (app_id, app_version, scene, timestamp);
 
 -- Startup events
 CREATE TABLE IF NOT EXISTS apm_startups (
+    app_id String,
     timestamp DateTime64(3),
     app_version String,
     platform String,
@@ -57,10 +61,11 @@ CREATE TABLE IF NOT EXISTS apm_startups (
     tti_ms Float32
 ) ENGINE = MergeTree()
 PARTITION BY toYYYYMMDD(timestamp)
-ORDER BY (app_version, platform, timestamp);
+ORDER BY (app_id, app_version, platform, timestamp);
 
 -- Scene loads
 CREATE TABLE IF NOT EXISTS apm_scene_loads (
+    app_id String,
     timestamp DateTime64(3),
     app_version String,
     platform String,
@@ -72,10 +77,11 @@ CREATE TABLE IF NOT EXISTS apm_scene_loads (
     activate_ms Float32
 ) ENGINE = MergeTree()
 PARTITION BY toYYYYMMDD(timestamp)
-ORDER BY (app_version, scene_name, timestamp);
+ORDER BY (app_id, app_version, scene_name, timestamp);
 
 -- Exceptions (non-fatal)
 CREATE TABLE IF NOT EXISTS apm_exceptions (
+    app_id String,
     timestamp DateTime64(3),
     app_version String,
     platform String,
@@ -87,13 +93,16 @@ CREATE TABLE IF NOT EXISTS apm_exceptions (
     fingerprint String,
     message String,
     stack String,
-    count UInt32
+    count UInt32,
+    INDEX idx_message_tokens lower(message) TYPE tokenbf_v1(32768, 3, 0) GRANULARITY 4,
+    INDEX idx_stack_ngrams lower(stack) TYPE ngrambf_v1(4, 65536, 3, 0) GRANULARITY 4
 ) ENGINE = MergeTree()
 PARTITION BY toYYYYMMDD(timestamp)
-ORDER BY (app_version, fingerprint, timestamp);
+ORDER BY (app_id, app_version, fingerprint, timestamp);
 
 -- Crashes
 CREATE TABLE IF NOT EXISTS apm_crashes (
+    app_id String,
     timestamp DateTime64(3),
     app_version String,
     platform String,
@@ -105,14 +114,86 @@ CREATE TABLE IF NOT EXISTS apm_crashes (
     crash_type String,
     fingerprint String,
     stack String,
-    breadcrumbs Array(String)
+    breadcrumbs Array(String),
+    INDEX idx_stack_ngrams lower(stack) TYPE ngrambf_v1(4, 65536, 3, 0) GRANULARITY 4
 ) ENGINE = MergeTree()
 PARTITION BY toYYYYMMDD(timestamp)
-ORDER BY (app_version, fingerprint, timestamp);
+ORDER BY (app_id, app_version, fingerprint, timestamp);
+
+-- Sessions (one fragment per session per ingest batch, merged at query time)
+CREATE TABLE IF NOT EXISTS apm_sessions (
+    app_id String,
+    session_id String,
+    device_id String,
+    user_id String,
+    app_version String,
+    platform String,
+    device_model String,
+    os_version String,
+    start_time DateTime64(3),
+    end_time DateTime64(3),
+    scenes Array(String),
+    event_count UInt32,
+    crash_count UInt32,
+    exception_count UInt32,
+    jank_count UInt32,
+    ended_by_crash UInt8
+) ENGINE = MergeTree()
+PARTITION BY toYYYYMMDD(start_time)
+ORDER BY (app_id, app_version, session_id, start_time);
+
+-- Apps (latest version of each row wins)
+CREATE TABLE IF NOT EXISTS apm_apps (
+    id String,
+    name String,
+    created_at DateTime64(3),
+    updated_at DateTime64(3)
+) ENGINE = ReplacingMergeTree(updated_at)
+ORDER BY id;
+
+-- API keys, stored hashed (latest version of each row wins)
+CREATE TABLE IF NOT EXISTS apm_api_keys (
+    id String,
+    app_id String,
+    label String,
+    prefix String,
+    key_hash String,
+    created_at DateTime64(3),
+    expires_at Nullable(DateTime64(3)),
+    revoked_at Nullable(DateTime64(3)),
+    updated_at DateTime64(3)
+) ENGINE = ReplacingMergeTree(updated_at)
+ORDER BY (app_id, id);
+
+-- Audit log of mutating admin requests
+CREATE TABLE IF NOT EXISTS apm_audit_log (
+    timestamp DateTime64(3),
+    app_id String,
+    username String,
+    method LowCardinality(String),
+    path String,
+    status UInt16,
+    remote_addr String,
+    request_id String
+) ENGINE = MergeTree()
+PARTITION BY toYYYYMM(timestamp)
+ORDER BY (app_id, timestamp);
+
+-- Remote SDK configuration rules, settings stored as JSON (latest version of each row wins)
+CREATE TABLE IF NOT EXISTS apm_remote_configs (
+    app_id String,
+    app_version String,
+    platform String,
+    config String,
+    deleted UInt8,
+    updated_at DateTime64(3)
+) ENGINE = ReplacingMergeTree(updated_at)
+ORDER BY (app_id, app_version, platform);
 `
 
 var schemaStatements = []string{
 	`CREATE TABLE IF NOT EXISTS apm_perf_samples (
+    app_id String,
     timestamp DateTime64(3),
     app_version String,
     platform String,
@@ -125,12 +206,14 @@ var schemaStatements = []string{
     frame_time_ms Float32,
     main_thread_ms Float32,
     gc_alloc_kb Float32,
-    mem_mb Float32
+    mem_mb Float32,
+    sample_weight Float32 DEFAULT 1
 ) ENGINE = MergeTree()
 PARTITION BY toYYYYMMDD(timestamp)
-ORDER BY (app_version, platform, timestamp)`,
+ORDER BY (app_id, app_version, platform, timestamp)`,
 
 	`CREATE TABLE IF NOT EXISTS apm_janks (
+    app_id String,
     timestamp DateTime64(3),
     app_version String,
     platform String,
@@ -146,9 +229,10 @@ ORDER BY (app_version, platform, timestamp)`,
     recent_events Array(String)
 ) ENGINE = MergeTree()
 PARTITION BY toYYYYMMDD(timestamp)
-ORDER BY (app_version, scene, timestamp)`,
+ORDER BY (app_id, app_version, scene, timestamp)`,
 
 	`CREATE TABLE IF NOT EXISTS apm_startups (
+    app_id String,
     timestamp DateTime64(3),
     app_version String,
     platform String,
@@ -161,9 +245,10 @@ ORDER BY (app_version, scene, timestamp)`,
     tti_ms Float32
 ) ENGINE = MergeTree()
 PARTITION BY toYYYYMMDD(timestamp)
-ORDER BY (app_version, platform, timestamp)`,
+ORDER BY (app_id, app_version, platform, timestamp)`,
 
 	`CREATE TABLE IF NOT EXISTS apm_scene_loads (
+    app_id String,
     timestamp DateTime64(3),
     app_version String,
     platform String,
@@ -175,9 +260,10 @@ ORDER BY (app_version, platform, timestamp)`,
     activate_ms Float32
 ) ENGINE = MergeTree()
 PARTITION BY toYYYYMMDD(timestamp)
-ORDER BY (app_version, scene_name, timestamp)`,
+ORDER BY (app_id, app_version, scene_name, timestamp)`,
 
 	`CREATE TABLE IF NOT EXISTS apm_exceptions (
+    app_id String,
     timestamp DateTime64(3),
     app_version String,
     platform String,
@@ -189,12 +275,15 @@ ORDER BY (app_version, scene_name, timestamp)`,
     fingerprint String,
     message String,
     stack String,
-    count UInt32
+    count UInt32,
+    INDEX idx_message_tokens lower(message) TYPE tokenbf_v1(32768, 3, 0) GRANULARITY 4,
+    INDEX idx_stack_ngrams lower(stack) TYPE ngrambf_v1(4, 65536, 3, 0) GRANULARITY 4
 ) ENGINE = MergeTree()
 PARTITION BY toYYYYMMDD(timestamp)
-ORDER BY (app_version, fingerprint, timestamp)`,
+ORDER BY (app_id, app_version, fingerprint, timestamp)`,
 
 	`CREATE TABLE IF NOT EXISTS apm_crashes (
+    app_id String,
     timestamp DateTime64(3),
     app_version String,
     platform String,
@@ -206,10 +295,96 @@ ORDER BY (app_version, fingerprint, timestamp)`,
     crash_type String,
     fingerprint String,
     stack String,
-    breadcrumbs Array(String)
+    breadcrumbs Array(String),
+    INDEX idx_stack_ngrams lower(stack) TYPE ngrambf_v1(4, 65536, 3, 0) GRANULARITY 4
 ) ENGINE = MergeTree()
 PARTITION BY toYYYYMMDD(timestamp)
-ORDER BY (app_version, fingerprint, timestamp)`,
+ORDER BY (app_id, app_version, fingerprint, timestamp)`,
+
+	`CREATE TABLE IF NOT EXISTS apm_sessions (
+    app_id String,
+    session_id String,
+    device_id String,
+    user_id String,
+    app_version String,
+    platform String,
+    device_model String,
+    os_version String,
+    start_time DateTime64(3),
+    end_time DateTime64(3),
+    scenes Array(String),
+    event_count UInt32,
+    crash_count UInt32,
+    exception_count UInt32,
+    jank_count UInt32,
+    ended_by_crash UInt8
+) ENGINE = MergeTree()
+PARTITION BY toYYYYMMDD(start_time)
+ORDER BY (app_id, app_version, session_id, start_time)`,
+
+	`CREATE TABLE IF NOT EXISTS apm_apps (
+    id String,
+    name String,
+    created_at DateTime64(3),
+    updated_at DateTime64(3)
+) ENGINE = ReplacingMergeTree(updated_at)
+ORDER BY id`,
+
+	`CREATE TABLE IF NOT EXISTS apm_api_keys (
+    id String,
+    app_id String,
+    label String,
+    prefix String,
+    key_hash String,
+    created_at DateTime64(3),
+    expires_at Nullable(DateTime64(3)),
+    revoked_at Nullable(DateTime64(3)),
+    updated_at DateTime64(3)
+) ENGINE = ReplacingMergeTree(updated_at)
+ORDER BY (app_id, id)`,
+
+	`CREATE TABLE IF NOT EXISTS apm_audit_log (
+    timestamp DateTime64(3),
+    app_id String,
+    username String,
+    method LowCardinality(String),
+    path String,
+    status UInt16,
+    remote_addr String,
+    request_id String
+) ENGINE = MergeTree()
+PARTITION BY toYYYYMM(timestamp)
+ORDER BY (app_id, timestamp)`,
+
+	`CREATE TABLE IF NOT EXISTS apm_remote_configs (
+    app_id String,
+    app_version String,
+    platform String,
+    config String,
+    deleted UInt8,
+    updated_at DateTime64(3)
+) ENGINE = ReplacingMergeTree(updated_at)
+ORDER BY (app_id, app_version, platform)`,
+
+	// Upgrade tables created before multi-tenancy. The sort key of an existing
+	// MergeTree table cannot be changed, so upgraded tables keep their old
+	// ORDER BY and app-scoped queries on them fall back to a partition scan.
+	`ALTER TABLE apm_perf_samples ADD COLUMN IF NOT EXISTS app_id String FIRST`,
+	`ALTER TABLE apm_janks ADD COLUMN IF NOT EXISTS app_id String FIRST`,
+	`ALTER TABLE apm_startups ADD COLUMN IF NOT EXISTS app_id String FIRST`,
+	`ALTER TABLE apm_scene_loads ADD COLUMN IF NOT EXISTS app_id String FIRST`,
+	`ALTER TABLE apm_exceptions ADD COLUMN IF NOT EXISTS app_id String FIRST`,
+	`ALTER TABLE apm_crashes ADD COLUMN IF NOT EXISTS app_id String FIRST`,
+	`ALTER TABLE apm_sessions ADD COLUMN IF NOT EXISTS app_id String FIRST`,
+
+	// Perf samples stored before server-side sampling each count once
+	`ALTER TABLE apm_perf_samples ADD COLUMN IF NOT EXISTS sample_weight Float32 DEFAULT 1`,
+
+	// Full-text search indexes. They only cover parts written after they are
+	// added; older parts are still searched, just without skipping.
+	`ALTER TABLE apm_exceptions ADD INDEX IF NOT EXISTS idx_message_tokens lower(message) TYPE tokenbf_v1(32768, 3, 0) GRANULARITY 4`,
+	`ALTER TABLE apm_exceptions ADD INDEX IF NOT EXISTS idx_stack_ngrams lower(stack) TYPE ngrambf_v1(4, 65536, 3, 0) GRANULARITY 4`,
+	`ALTER TABLE apm_crashes ADD INDEX IF NOT EXISTS idx_stack_ngrams lower(stack) TYPE ngrambf_v1(4, 65536, 3, 0) GRANULARITY 4`,
 }
 
 func (c *ClickHouseClient) Migrate(ctx context.Context) error {
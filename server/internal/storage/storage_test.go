@@ -3,6 +3,7 @@ package storage
 import (
 	"context"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -94,6 +95,11 @@ func TestClickHouseClient_Migrate(t *testing.T) {
 		"apm_scene_loads",
 		"apm_exceptions",
 		"apm_crashes",
+		"apm_sessions",
+		"apm_apps",
+		"apm_api_keys",
+		"apm_audit_log",
+		"apm_remote_configs",
 	}
 
 	for _, table := range tables {
@@ -498,7 +504,7 @@ func TestRepository_Ping(t *testing.T) {
 	}
 }
 
-func TestBuildWhereClause(t *testing.T) {
+func TestFilterQuery(t *testing.T) {
 	tests := []struct {
 		name     string
 		filter   models.QueryFilter
@@ -521,6 +527,15 @@ func TestBuildWhereClause(t *testing.T) {
 			},
 			wantArgs: 3,
 		},
+		{
+			name: "with app id",
+			filter: models.QueryFilter{
+				StartTime: time.Now().Add(-time.Hour),
+				EndTime:   time.Now(),
+				AppID:     "game-a",
+			},
+			wantArgs: 3,
+		},
 		{
 			name: "with all filters",
 			filter: models.QueryFilter{
@@ -537,14 +552,128 @@ func TestBuildWhereClause(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			clause, args := buildWhereClause(tt.filter)
+			query, args, err := filterQuery(tablePerfSamples, tt.filter).Select("count()").Build()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
 			if len(args) != tt.wantArgs {
 				t.Errorf("expected %d args, got %d", tt.wantArgs, len(args))
 			}
-			if clause == "" {
-				t.Error("expected non-empty clause")
+			if strings.Count(query, "?") != tt.wantArgs {
+				t.Errorf("expected %d placeholders in %s", tt.wantArgs, query)
 			}
-			t.Logf("Clause: %s, Args: %d", clause, len(args))
+			t.Logf("Query: %s, Args: %d", query, len(args))
 		})
 	}
+
+	// Startups have no scene to filter on
+	_, args, err := filterQuery(tableStartups, models.QueryFilter{Scene: "MainMenu"}).Select("count()").Build()
+	if err != nil || len(args) != 2 {
+		t.Errorf("expected the scene filter to be skipped, got %d args, error %v", len(args), err)
+	}
+}
+
+func TestCollapseScenes(t *testing.T) {
+	got := collapseScenes([]string{"MainMenu", "MainMenu", "Level1", "Level1", "MainMenu"})
+	want := []string{"MainMenu", "Level1", "MainMenu"}
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("expected %v, got %v", want, got)
+		}
+	}
+
+	if empty := collapseScenes(nil); empty == nil || len(empty) != 0 {
+		t.Errorf("expected empty non-nil path, got %v", empty)
+	}
+}
+
+func TestCrashFreeRate(t *testing.T) {
+	tests := []struct {
+		total, crashed int64
+		want           float64
+	}{
+		{0, 0, 0},
+		{100, 0, 100},
+		{100, 5, 95},
+		{4, 4, 0},
+	}
+
+	for _, tt := range tests {
+		if got := crashFreeRate(tt.total, tt.crashed); got != tt.want {
+			t.Errorf("crashFreeRate(%d, %d) = %f, want %f", tt.total, tt.crashed, got, tt.want)
+		}
+	}
+}
+
+func TestAdoptionCurves(t *testing.T) {
+	t0 := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	t1 := t0.Add(24 * time.Hour)
+
+	curves, shares := adoptionCurves([]adoptionBucket{
+		{t: t0, version: "1.0.0", sessions: 90},
+		{t: t0, version: "1.1.0", sessions: 10},
+		{t: t1, version: "1.0.0", sessions: 50},
+		{t: t1, version: "1.1.0", sessions: 50},
+	})
+
+	newer := curves["1.1.0"]
+	if len(newer) != 2 {
+		t.Fatalf("expected 2 points for 1.1.0, got %d", len(newer))
+	}
+	if newer[0].Value != 10 || newer[1].Value != 50 {
+		t.Errorf("expected adoption 10%% then 50%%, got %v", newer)
+	}
+	if shares["1.0.0"] != 70 || shares["1.1.0"] != 30 {
+		t.Errorf("expected shares 70/30, got %v", shares)
+	}
+}
+
+func TestMergeTimeline(t *testing.T) {
+	base := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+
+	perf := []models.TimelineEvent{
+		{Timestamp: base, Type: models.EventTypePerfSample},
+		{Timestamp: base.Add(2 * time.Second), Type: models.EventTypePerfSample},
+	}
+	scenes := []models.TimelineEvent{
+		{Timestamp: base.Add(time.Second), Type: models.EventTypeSceneLoad},
+	}
+	crashes := []models.TimelineEvent{
+		{Timestamp: base.Add(2 * time.Second), Type: models.EventTypeCrash},
+	}
+
+	merged := mergeTimeline(perf, scenes, crashes)
+	want := []models.EventType{
+		models.EventTypePerfSample,
+		models.EventTypeSceneLoad,
+		models.EventTypePerfSample,
+		models.EventTypeCrash,
+	}
+	if len(merged) != len(want) {
+		t.Fatalf("expected %d events, got %d", len(want), len(merged))
+	}
+	for i, typ := range want {
+		if merged[i].Type != typ {
+			t.Errorf("event %d: expected %s, got %s", i, typ, merged[i].Type)
+		}
+	}
+
+	if empty := mergeTimeline(); empty == nil || len(empty) != 0 {
+		t.Errorf("expected empty non-nil timeline, got %v", empty)
+	}
+}
+
+func TestDeviceHistoryEmpty(t *testing.T) {
+	if !deviceHistoryEmpty(&models.DeviceHistory{DeviceID: "d1"}) {
+		t.Error("expected history without data to be empty")
+	}
+	if deviceHistoryEmpty(&models.DeviceHistory{Crashes: []models.DeviceCrash{{Fingerprint: "fp"}}}) {
+		t.Error("expected history with a crash to be non-empty")
+	}
+	if deviceHistoryEmpty(&models.DeviceHistory{Perf: models.DevicePerfSummary{Samples: 3}}) {
+		t.Error("expected history with perf samples to be non-empty")
+	}
 }
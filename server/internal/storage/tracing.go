@@ -0,0 +1,181 @@
+package storage
+
+import (
+	"context"
+	"runtime"
+	"strings"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/warriorguo/ozx_apm/server/internal/storage")
+
+// rowsKey is the span attribute holding the rows a query returned or an
+// insert sent
+const rowsKey = attribute.Key("db.rows")
+
+// tracedConn wraps a ClickHouse connection with a span per query, insert and
+// exec. Spans are named after the repository method that issued them, so
+// call sites need no tracing code. With tracing disabled the global no-op
+// tracer makes this almost free.
+type tracedConn struct {
+	driver.Conn
+}
+
+func (c tracedConn) Query(ctx context.Context, query string, args ...any) (driver.Rows, error) {
+	ctx, span := startQuerySpan(ctx, query)
+	rows, err := c.Conn.Query(ctx, query, args...)
+	if err != nil {
+		endSpan(span, err)
+		return nil, err
+	}
+	return &tracedRows{Rows: rows, span: span}, nil
+}
+
+func (c tracedConn) QueryRow(ctx context.Context, query string, args ...any) driver.Row {
+	ctx, span := startQuerySpan(ctx, query)
+	row := c.Conn.QueryRow(ctx, query, args...)
+	if row.Err() == nil {
+		span.SetAttributes(rowsKey.Int(1))
+	}
+	endSpan(span, row.Err())
+	return row
+}
+
+func (c tracedConn) Select(ctx context.Context, dest any, query string, args ...any) error {
+	ctx, span := startQuerySpan(ctx, query)
+	err := c.Conn.Select(ctx, dest, query, args...)
+	endSpan(span, err)
+	return err
+}
+
+func (c tracedConn) Exec(ctx context.Context, query string, args ...any) error {
+	ctx, span := startQuerySpan(ctx, query)
+	err := c.Conn.Exec(ctx, query, args...)
+	endSpan(span, err)
+	return err
+}
+
+func (c tracedConn) PrepareBatch(ctx context.Context, query string, opts ...driver.PrepareBatchOption) (driver.Batch, error) {
+	ctx, span := startQuerySpan(ctx, query)
+	if table, ok := insertTable(query); ok {
+		span.SetAttributes(semconv.DBSQLTable(table))
+	}
+	batch, err := c.Conn.PrepareBatch(ctx, query, opts...)
+	if err != nil {
+		endSpan(span, err)
+		return nil, err
+	}
+	return &tracedBatch{Batch: batch, span: span}, nil
+}
+
+// tracedRows ends its query's span when closed, recording the rows read
+type tracedRows struct {
+	driver.Rows
+	span trace.Span
+	n    int
+}
+
+func (r *tracedRows) Next() bool {
+	if r.Rows.Next() {
+		r.n++
+		return true
+	}
+	return false
+}
+
+func (r *tracedRows) Close() error {
+	err := r.Rows.Close()
+	if err == nil {
+		err = r.Rows.Err()
+	}
+	r.span.SetAttributes(rowsKey.Int(r.n))
+	endSpan(r.span, err)
+	return err
+}
+
+// tracedBatch ends its insert's span when sent or aborted
+type tracedBatch struct {
+	driver.Batch
+	span trace.Span
+}
+
+func (b *tracedBatch) Send() error {
+	b.span.SetAttributes(rowsKey.Int(b.Batch.Rows()))
+	err := b.Batch.Send()
+	endSpan(b.span, err)
+	return err
+}
+
+func (b *tracedBatch) Abort() error {
+	err := b.Batch.Abort()
+	endSpan(b.span, err)
+	return err
+}
+
+// queryHelpers are the functions between repository methods and tracedConn
+var queryHelpers = map[string]bool{"query": true, "queryRow": true}
+
+// startQuerySpan starts a client span named after the repository method
+// calling into tracedConn, directly or through a query helper
+func startQuerySpan(ctx context.Context, query string) (context.Context, trace.Span) {
+	name := "clickhouse"
+	// Skip runtime.Callers, startQuerySpan and the tracedConn method
+	pcs := make([]uintptr, 4)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(3, pcs)])
+	for {
+		frame, more := frames.Next()
+		if fn := queryName(frame.Function); frame.Function != "" && !queryHelpers[fn] {
+			name = fn
+			break
+		}
+		if !more {
+			break
+		}
+	}
+	return tracer.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemClickhouse,
+			semconv.DBOperation(name),
+			semconv.DBStatement(strings.TrimSpace(query)),
+		),
+	)
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// queryName turns a function name such as
+// ".../storage.(*Repository).QueryFPSMetrics.func1" into "QueryFPSMetrics"
+func queryName(fn string) string {
+	if i := strings.LastIndex(fn, "/"); i >= 0 {
+		fn = fn[i+1:]
+	}
+	// Skip the package and receiver; closures follow the name
+	for _, part := range strings.Split(fn, ".")[1:] {
+		if !strings.HasPrefix(part, "(") {
+			return part
+		}
+	}
+	return fn
+}
+
+// insertTable extracts the table from an "INSERT INTO table" statement
+func insertTable(query string) (string, bool) {
+	fields := strings.Fields(query)
+	if len(fields) < 3 || !strings.EqualFold(fields[0], "INSERT") || !strings.EqualFold(fields[1], "INTO") {
+		return "", false
+	}
+	return fields[2], true
+}
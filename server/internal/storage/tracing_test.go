@@ -0,0 +1,124 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.uber.org/zap"
+
+	"github.com/warriorguo/ozx_apm/server/internal/models"
+)
+
+// fakeConn serves empty result sets and accepts batches, failing sends if
+// sendErr is set
+type fakeConn struct {
+	driver.Conn
+	sendErr error
+}
+
+func (c fakeConn) Query(ctx context.Context, query string, args ...any) (driver.Rows, error) {
+	return fakeRows{}, nil
+}
+
+func (c fakeConn) PrepareBatch(ctx context.Context, query string, opts ...driver.PrepareBatchOption) (driver.Batch, error) {
+	return &fakeBatch{err: c.sendErr}, nil
+}
+
+type fakeRows struct{ driver.Rows }
+
+func (fakeRows) Next() bool   { return false }
+func (fakeRows) Close() error { return nil }
+func (fakeRows) Err() error   { return nil }
+
+type fakeBatch struct {
+	driver.Batch
+	rows int
+	err  error
+}
+
+func (b *fakeBatch) Append(v ...any) error { b.rows++; return nil }
+func (b *fakeBatch) Rows() int             { return b.rows }
+func (b *fakeBatch) Send() error           { return b.err }
+
+func TestTracedConn(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	repo := NewRepository(&ClickHouseClient{conn: tracedConn{fakeConn{}}}, zap.NewNop())
+	ctx := context.Background()
+
+	if err := repo.InsertPerfSamples(ctx, []models.PerfSample{{}, {}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.QueryCrashes(ctx, models.QueryFilter{}); err != nil {
+		t.Fatal(err)
+	}
+
+	failing := NewRepository(&ClickHouseClient{conn: tracedConn{fakeConn{sendErr: errors.New("timeout")}}}, zap.NewNop())
+	if err := failing.InsertJanks(ctx, []models.Jank{{}}); err == nil {
+		t.Fatal("expected the send error")
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("expected 3 spans, got %d", len(spans))
+	}
+
+	attrs := func(s sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+		m := make(map[attribute.Key]attribute.Value)
+		for _, kv := range s.Attributes() {
+			m[kv.Key] = kv.Value
+		}
+		return m
+	}
+
+	insert := spans[0]
+	if insert.Name() != "InsertPerfSamples" {
+		t.Errorf("expected span InsertPerfSamples, got %q", insert.Name())
+	}
+	if a := attrs(insert); a["db.sql.table"].AsString() != "apm_perf_samples" || a[rowsKey].AsInt64() != 2 {
+		t.Errorf("unexpected insert attributes %v", insert.Attributes())
+	}
+
+	query := spans[1]
+	if query.Name() != "QueryCrashes" {
+		t.Errorf("expected span QueryCrashes, got %q", query.Name())
+	}
+	if a := attrs(query); a["db.system"].AsString() != "clickhouse" || a[rowsKey].AsInt64() != 0 {
+		t.Errorf("unexpected query attributes %v", query.Attributes())
+	}
+
+	if spans[2].Name() != "InsertJanks" || spans[2].Status().Code != codes.Error {
+		t.Errorf("expected a failed InsertJanks span, got %q with %v", spans[2].Name(), spans[2].Status())
+	}
+}
+
+func TestQueryName(t *testing.T) {
+	tests := map[string]string{
+		"github.com/warriorguo/ozx_apm/server/internal/storage.(*Repository).QueryFPSMetrics":    "QueryFPSMetrics",
+		"github.com/warriorguo/ozx_apm/server/internal/storage.(*Repository).GetSummary.func1.2": "GetSummary",
+		"github.com/warriorguo/ozx_apm/server/internal/storage.(*ClickHouseClient).Migrate":      "Migrate",
+		"github.com/warriorguo/ozx_apm/server/internal/storage.deviceHistory":                    "deviceHistory",
+	}
+	for fn, want := range tests {
+		if got := queryName(fn); got != want {
+			t.Errorf("queryName(%q) = %q, want %q", fn, got, want)
+		}
+	}
+}
+
+func TestInsertTable(t *testing.T) {
+	if table, ok := insertTable("INSERT INTO apm_janks"); !ok || table != "apm_janks" {
+		t.Errorf("expected apm_janks, got %q", table)
+	}
+	if _, ok := insertTable("SELECT 1"); ok {
+		t.Error("expected no table for a SELECT")
+	}
+}
@@ -3,6 +3,7 @@
 
 -- Performance samples (sampled data)
 CREATE TABLE IF NOT EXISTS apm_perf_samples (
+    app_id String,
     timestamp DateTime64(3),
     app_version String,
     platform String,
@@ -15,14 +16,16 @@ CREATE TABLE IF NOT EXISTS apm_perf_samples (
     frame_time_ms Float32,
     main_thread_ms Float32,
     gc_alloc_kb Float32,
-    mem_mb Float32
+    mem_mb Float32,
+    sample_weight Float32 DEFAULT 1
 ) ENGINE = MergeTree()
 PARTITION BY toYYYYMMDD(timestamp)
-ORDER BY (app_version, platform, timestamp)
+ORDER BY (app_id, app_version, platform, timestamp)
 TTL timestamp + INTERVAL 30 DAY;
 
 -- Jank events
 CREATE TABLE IF NOT EXISTS apm_janks (
+    app_id String,
     timestamp DateTime64(3),
     app_version String,
     platform String,
@@ -38,11 +41,12 @@ CREATE TABLE IF NOT EXISTS apm_janks (
     recent_events Array(String)
 ) ENGINE = MergeTree()
 PARTITION BY toYYYYMMDD(timestamp)
-ORDER BY (app_version, scene, timestamp)
+ORDER BY (app_id, app_version, scene, timestamp)
 TTL timestamp + INTERVAL 30 DAY;
 
 -- Startup events
 CREATE TABLE IF NOT EXISTS apm_startups (
+    app_id String,
     timestamp DateTime64(3),
     app_version String,
     platform String,
@@ -55,11 +59,12 @@ CREATE TABLE IF NOT EXISTS apm_startups (
     tti_ms Float32
 ) ENGINE = MergeTree()
 PARTITION BY toYYYYMMDD(timestamp)
-ORDER BY (app_version, platform, timestamp)
+ORDER BY (app_id, app_version, platform, timestamp)
 TTL timestamp + INTERVAL 30 DAY;
 
 -- Scene loads
 CREATE TABLE IF NOT EXISTS apm_scene_loads (
+    app_id String,
     timestamp DateTime64(3),
     app_version String,
     platform String,
@@ -71,11 +76,12 @@ CREATE TABLE IF NOT EXISTS apm_scene_loads (
     activate_ms Float32
 ) ENGINE = MergeTree()
 PARTITION BY toYYYYMMDD(timestamp)
-ORDER BY (app_version, scene_name, timestamp)
+ORDER BY (app_id, app_version, scene_name, timestamp)
 TTL timestamp + INTERVAL 30 DAY;
 
 -- Exceptions (non-fatal)
 CREATE TABLE IF NOT EXISTS apm_exceptions (
+    app_id String,
     timestamp DateTime64(3),
     app_version String,
     platform String,
@@ -90,11 +96,12 @@ CREATE TABLE IF NOT EXISTS apm_exceptions (
     count UInt32
 ) ENGINE = MergeTree()
 PARTITION BY toYYYYMMDD(timestamp)
-ORDER BY (app_version, fingerprint, timestamp)
+ORDER BY (app_id, app_version, fingerprint, timestamp)
 TTL timestamp + INTERVAL 30 DAY;
 
 -- Crashes
 CREATE TABLE IF NOT EXISTS apm_crashes (
+    app_id String,
     timestamp DateTime64(3),
     app_version String,
     platform String,
@@ -109,33 +116,120 @@ CREATE TABLE IF NOT EXISTS apm_crashes (
     breadcrumbs Array(String)
 ) ENGINE = MergeTree()
 PARTITION BY toYYYYMMDD(timestamp)
-ORDER BY (app_version, fingerprint, timestamp)
+ORDER BY (app_id, app_version, fingerprint, timestamp)
 TTL timestamp + INTERVAL 30 DAY;
 
+-- Sessions (one fragment per session per ingest batch, merged at query time)
+CREATE TABLE IF NOT EXISTS apm_sessions (
+    app_id String,
+    session_id String,
+    device_id String,
+    user_id String,
+    app_version String,
+    platform String,
+    device_model String,
+    os_version String,
+    start_time DateTime64(3),
+    end_time DateTime64(3),
+    scenes Array(String),
+    event_count UInt32,
+    crash_count UInt32,
+    exception_count UInt32,
+    jank_count UInt32,
+    ended_by_crash UInt8
+) ENGINE = MergeTree()
+PARTITION BY toYYYYMMDD(start_time)
+ORDER BY (app_id, app_version, session_id, start_time)
+TTL start_time + INTERVAL 30 DAY;
+
+-- Apps (latest version of each row wins)
+CREATE TABLE IF NOT EXISTS apm_apps (
+    id String,
+    name String,
+    created_at DateTime64(3),
+    updated_at DateTime64(3)
+) ENGINE = ReplacingMergeTree(updated_at)
+ORDER BY id;
+
+-- API keys, stored hashed (latest version of each row wins)
+CREATE TABLE IF NOT EXISTS apm_api_keys (
+    id String,
+    app_id String,
+    label String,
+    prefix String,
+    key_hash String,
+    created_at DateTime64(3),
+    expires_at Nullable(DateTime64(3)),
+    revoked_at Nullable(DateTime64(3)),
+    updated_at DateTime64(3)
+) ENGINE = ReplacingMergeTree(updated_at)
+ORDER BY (app_id, id);
+
+-- Audit log of mutating admin requests
+CREATE TABLE IF NOT EXISTS apm_audit_log (
+    timestamp DateTime64(3),
+    app_id String,
+    username String,
+    method LowCardinality(String),
+    path String,
+    status UInt16,
+    remote_addr String,
+    request_id String
+) ENGINE = MergeTree()
+PARTITION BY toYYYYMM(timestamp)
+ORDER BY (app_id, timestamp);
+
+-- Remote SDK configuration rules, settings stored as JSON (latest version of each row wins)
+CREATE TABLE IF NOT EXISTS apm_remote_configs (
+    app_id String,
+    app_version String,
+    platform String,
+    config String,
+    deleted UInt8,
+    updated_at DateTime64(3)
+) ENGINE = ReplacingMergeTree(updated_at)
+ORDER BY (app_id, app_version, platform);
+
+-- Upgrade tables created before multi-tenancy. The sort key of an existing
+-- MergeTree table cannot be changed, so upgraded tables keep their old
+-- ORDER BY and app-scoped queries on them fall back to a partition scan.
+ALTER TABLE apm_perf_samples ADD COLUMN IF NOT EXISTS app_id String FIRST;
+ALTER TABLE apm_janks ADD COLUMN IF NOT EXISTS app_id String FIRST;
+ALTER TABLE apm_startups ADD COLUMN IF NOT EXISTS app_id String FIRST;
+ALTER TABLE apm_scene_loads ADD COLUMN IF NOT EXISTS app_id String FIRST;
+ALTER TABLE apm_exceptions ADD COLUMN IF NOT EXISTS app_id String FIRST;
+ALTER TABLE apm_crashes ADD COLUMN IF NOT EXISTS app_id String FIRST;
+ALTER TABLE apm_sessions ADD COLUMN IF NOT EXISTS app_id String FIRST;
+
+-- Perf samples stored before server-side sampling each count once
+ALTER TABLE apm_perf_samples ADD COLUMN IF NOT EXISTS sample_weight Float32 DEFAULT 1;
+
 -- Materialized views for aggregations (optional, for better query performance)
 
 -- Daily FPS aggregation
 CREATE MATERIALIZED VIEW IF NOT EXISTS apm_fps_daily
 ENGINE = SummingMergeTree()
 PARTITION BY toYYYYMM(date)
-ORDER BY (date, app_version, platform, scene)
+ORDER BY (app_id, date, app_version, platform, scene)
 AS SELECT
+    app_id,
     toDate(timestamp) as date,
     app_version,
     platform,
     scene,
-    count() as sample_count,
-    sum(fps) as fps_sum,
-    sum(fps * fps) as fps_sum_sq
+    sum(sample_weight) as sample_count,
+    sum(fps * sample_weight) as fps_sum,
+    sum(fps * fps * sample_weight) as fps_sum_sq
 FROM apm_perf_samples
-GROUP BY date, app_version, platform, scene;
+GROUP BY app_id, date, app_version, platform, scene;
 
 -- Daily startup aggregation
 CREATE MATERIALIZED VIEW IF NOT EXISTS apm_startup_daily
 ENGINE = SummingMergeTree()
 PARTITION BY toYYYYMM(date)
-ORDER BY (date, app_version, platform)
+ORDER BY (app_id, date, app_version, platform)
 AS SELECT
+    app_id,
     toDate(timestamp) as date,
     app_version,
     platform,
@@ -144,32 +238,34 @@ AS SELECT
     sum(phase2_ms) as phase2_sum,
     sum(tti_ms) as tti_sum
 FROM apm_startups
-GROUP BY date, app_version, platform;
+GROUP BY app_id, date, app_version, platform;
 
 -- Daily exception count
 CREATE MATERIALIZED VIEW IF NOT EXISTS apm_exception_daily
 ENGINE = SummingMergeTree()
 PARTITION BY toYYYYMM(date)
-ORDER BY (date, app_version, platform, fingerprint)
+ORDER BY (app_id, date, app_version, platform, fingerprint)
 AS SELECT
+    app_id,
     toDate(timestamp) as date,
     app_version,
     platform,
     fingerprint,
     sum(count) as total_count
 FROM apm_exceptions
-GROUP BY date, app_version, platform, fingerprint;
+GROUP BY app_id, date, app_version, platform, fingerprint;
 
 -- Daily crash count
 CREATE MATERIALIZED VIEW IF NOT EXISTS apm_crash_daily
 ENGINE = SummingMergeTree()
 PARTITION BY toYYYYMM(date)
-ORDER BY (date, app_version, platform, fingerprint)
+ORDER BY (app_id, date, app_version, platform, fingerprint)
 AS SELECT
+    app_id,
     toDate(timestamp) as date,
     app_version,
     platform,
     fingerprint,
     count() as crash_count
 FROM apm_crashes
-GROUP BY date, app_version, platform, fingerprint;
+GROUP BY app_id, date, app_version, platform, fingerprint;
@@ -55,7 +55,7 @@ func TestIngestEvents_Success(t *testing.T) {
 	defer client.Close()
 
 	repo := storage.NewRepository(client, logger)
-	router := api.NewRouter(cfg, repo, logger)
+	router := api.NewRouter(cfg, repo, nil, nil, nil, nil, logger)
 
 	// Create test request
 	payload := map[string]interface{}{
@@ -107,7 +107,7 @@ func TestIngestEvents_InvalidJSON(t *testing.T) {
 	}
 
 	// Create router without ClickHouse (for JSON parsing test)
-	router := api.NewRouter(cfg, nil, logger)
+	router := api.NewRouter(cfg, nil, nil, nil, nil, nil, logger)
 
 	req := httptest.NewRequest(http.MethodPost, "/v1/events", bytes.NewReader([]byte("invalid json")))
 	req.Header.Set("Content-Type", "application/json")
@@ -127,7 +127,7 @@ func TestIngestEvents_EmptyBatch(t *testing.T) {
 		RateLimit: config.RateLimitConfig{Enabled: false},
 	}
 
-	router := api.NewRouter(cfg, nil, logger)
+	router := api.NewRouter(cfg, nil, nil, nil, nil, nil, logger)
 
 	payload := map[string]interface{}{
 		"events": []map[string]interface{}{},
@@ -159,7 +159,7 @@ func TestHealthEndpoint(t *testing.T) {
 		RateLimit: config.RateLimitConfig{Enabled: false},
 	}
 
-	router := api.NewRouter(cfg, nil, logger)
+	router := api.NewRouter(cfg, nil, nil, nil, nil, nil, logger)
 
 	req := httptest.NewRequest(http.MethodGet, "/health", nil)
 	w := httptest.NewRecorder()
@@ -39,7 +39,7 @@ func TestQueryFPSMetrics(t *testing.T) {
 	defer client.Close()
 
 	repo := storage.NewRepository(client, logger)
-	router := api.NewRouter(cfg, repo, logger)
+	router := api.NewRouter(cfg, repo, nil, nil, nil, nil, logger)
 
 	// Query FPS metrics
 	startTime := time.Now().Add(-24 * time.Hour).Format(time.RFC3339)
@@ -89,7 +89,7 @@ func TestQueryStartupMetrics(t *testing.T) {
 	defer client.Close()
 
 	repo := storage.NewRepository(client, logger)
-	router := api.NewRouter(cfg, repo, logger)
+	router := api.NewRouter(cfg, repo, nil, nil, nil, nil, logger)
 
 	req := httptest.NewRequest(http.MethodGet, "/v1/metrics/startup", nil)
 	w := httptest.NewRecorder()
@@ -125,7 +125,7 @@ func TestQueryExceptions(t *testing.T) {
 	defer client.Close()
 
 	repo := storage.NewRepository(client, logger)
-	router := api.NewRouter(cfg, repo, logger)
+	router := api.NewRouter(cfg, repo, nil, nil, nil, nil, logger)
 
 	req := httptest.NewRequest(http.MethodGet, "/v1/exceptions?app_version=1.0.0", nil)
 	w := httptest.NewRecorder()
@@ -161,7 +161,7 @@ func TestQueryCrashes(t *testing.T) {
 	defer client.Close()
 
 	repo := storage.NewRepository(client, logger)
-	router := api.NewRouter(cfg, repo, logger)
+	router := api.NewRouter(cfg, repo, nil, nil, nil, nil, logger)
 
 	req := httptest.NewRequest(http.MethodGet, "/v1/crashes?platform=Android&limit=10", nil)
 	w := httptest.NewRecorder()
@@ -12,9 +12,9 @@ func TestAggregator_RecordCrash(t *testing.T) {
 	defer a.Stop()
 
 	// Record some crashes
-	a.RecordCrash("1.0.0", "session1")
-	a.RecordCrash("1.0.0", "session1")
-	a.RecordCrash("1.0.0", "session2")
+	a.RecordCrash("game", "1.0.0", "session1")
+	a.RecordCrash("game", "1.0.0", "session1")
+	a.RecordCrash("game", "1.0.0", "session2")
 
 	count, sessions := a.GetCrashRate("1.0.0")
 
@@ -31,9 +31,9 @@ func TestAggregator_RecordException(t *testing.T) {
 	defer a.Stop()
 
 	// Record some exceptions
-	a.RecordException("1.0.0", "session1")
-	a.RecordException("1.0.0", "session1")
-	a.RecordException("2.0.0", "session3")
+	a.RecordException("game", "1.0.0", "session1")
+	a.RecordException("game", "1.0.0", "session1")
+	a.RecordException("game", "2.0.0", "session3")
 
 	count1, sessions1 := a.GetExceptionRate("1.0.0")
 	count2, sessions2 := a.GetExceptionRate("2.0.0")
@@ -57,9 +57,9 @@ func TestAggregator_RecordJank(t *testing.T) {
 	defer a.Stop()
 
 	// Record some janks
-	a.RecordJank("1.0.0", "session1")
-	a.RecordJank("1.0.0", "session2")
-	a.RecordJank("1.0.0", "session3")
+	a.RecordJank("game", "1.0.0", "session1")
+	a.RecordJank("game", "1.0.0", "session2")
+	a.RecordJank("game", "1.0.0", "session3")
 
 	count, sessions := a.GetJankRate("1.0.0")
 